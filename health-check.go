@@ -6,14 +6,27 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/logger"
 )
 
 // shuttingDown tracks whether this instance of GopherCI is shutting down
-// it's written to by the SignalHandler and read by HealthCheckHandler
-var shuttingDown bool
+// it's written to by the SignalHandler and read by HealthCheckHandler, it's
+// non-zero when shutting down and must only be accessed atomically via
+// setShuttingDown and isShuttingDown.
+var shuttingDown int32
+
+// setShuttingDown marks this instance as shutting down.
+func setShuttingDown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+// isShuttingDown returns true if this instance is shutting down.
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) != 0
+}
 
 // SignalHandler listens for a shutdown signal and calls cancel, if
 // multiple signals are received in short succession, forcible quit.
@@ -31,7 +44,7 @@ func SignalHandler(logger logger.Logger, cancel context.CancelFunc, srv *http.Se
 
 		lastSignal = time.Now()
 		logger.Infof("Received %v, preparing to shutdown", s)
-		shuttingDown = true
+		setShuttingDown()
 		srv.Shutdown(context.Background())
 		cancel()
 	}
@@ -40,8 +53,9 @@ func SignalHandler(logger logger.Logger, cancel context.CancelFunc, srv *http.Se
 // HealthCheckHandler checks whether the instance is shutting down, and if so,
 // responds with 503 Service Unavailable.
 func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	if shuttingDown {
+	if isShuttingDown() {
 		http.Error(w, "Service shutting down", http.StatusServiceUnavailable)
+		return
 	}
 	io.WriteString(w, "Service OK")
 }
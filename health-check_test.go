@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHealthCheckHandler(t *testing.T) {
+	defer atomic.StoreInt32(&shuttingDown, 0)
+
+	tests := []struct {
+		shuttingDown bool
+		wantCode     int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		if test.shuttingDown {
+			setShuttingDown()
+		}
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/health-check", nil)
+		HealthCheckHandler(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("shutting down %v, code have: %v, want: %v", test.shuttingDown, w.Code, test.wantCode)
+		}
+	}
+}
+
+// TestShuttingDown_concurrent should be run with the race detector.
+func TestShuttingDown_concurrent(t *testing.T) {
+	defer atomic.StoreInt32(&shuttingDown, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			setShuttingDown()
+		}()
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/health-check", nil)
+			HealthCheckHandler(w, r)
+			_ = isShuttingDown()
+		}()
+	}
+	wg.Wait()
+
+	if !isShuttingDown() {
+		t.Errorf("expected shutting down")
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/db"
@@ -17,6 +21,19 @@ import (
 const (
 	// ArgBaseBranch replaces tool arg with the name of the base branch
 	ArgBaseBranch = "%BASE_BRANCH%"
+	// ArgOwner replaces tool arg with the owner of the repository.
+	ArgOwner = "%OWNER%"
+	// ArgRepo replaces tool arg with the name of the repository.
+	ArgRepo = "%REPO%"
+	// ArgHeadRef replaces tool arg with the SHA of the commit being analysed,
+	// see Config.HeadSHA.
+	ArgHeadRef = "%HEAD_REF%"
+	// ArgPRNumber replaces tool arg with the pull request's number, or 0 if
+	// not analysing a pull request.
+	ArgPRNumber = "%PR_NUMBER%"
+	// DefaultVersionArgs are the arguments to print a tool's version if the
+	// tool does not configure its own.
+	DefaultVersionArgs = "--version"
 )
 
 // An Analyser is builds an isolated execution environment to run checks in.
@@ -29,10 +46,60 @@ type Analyser interface {
 }
 
 // Config hold configuration options for use in analyser. All options
-// are required.
+// are required unless otherwise stated.
 type Config struct {
 	// HeadRef is the name of the reference containing changes.
 	HeadRef string
+	// SkipNonCodeChanges skips running tools if the patch only changes Go
+	// comments or blank lines. Optional.
+	SkipNonCodeChanges bool
+	// MaxTools is the maximum number of tools to run, any further tools are
+	// skipped. A value of 0 is unlimited. Optional.
+	MaxTools int
+	// MutedTools are the names, ignoring case, or IDs of tools to skip
+	// regardless of the repository's configuration, muting misbehaving
+	// tools. Optional.
+	MutedTools []string
+	// CloneTimeout is the maximum duration of cloning, so a slow clone fails
+	// without consuming the whole analysis's time. A value of 0 is only
+	// limited by the analysis's context. Optional.
+	CloneTimeout time.Duration
+	// FullScan reports all issues in the repository at HeadRef, instead of
+	// only issues in the changes since the base ref. The RefReader is not
+	// used. Optional.
+	FullScan bool
+	// IssueTemplate renders each issue's comment body, see IssueTemplateData
+	// for the available fields. If nil, DefaultIssueTemplate is used.
+	// Optional.
+	IssueTemplate *template.Template
+	// CompareBase additionally runs tools on the base ref, only reporting
+	// issues introduced by HeadRef, instead of all issues on changed lines.
+	// Not used with FullScan. Optional.
+	CompareBase bool
+	// IncompatibleRegexp matches issues indicating a tool could not parse
+	// the code, such as a tool not supporting the repository's Go version.
+	// Matching issues are not reported, instead the tool's error is recorded.
+	// If nil, DefaultIncompatibleRegexp is used. Optional.
+	IncompatibleRegexp *regexp.Regexp
+	// Owner and Repo are the owner and name of the repository, replacing
+	// ArgOwner and ArgRepo in tools' arguments. Optional.
+	Owner, Repo string
+	// PRNumber is the number of the pull request being analysed, replacing
+	// ArgPRNumber in tools' arguments, 0 if not a pull request. Optional.
+	PRNumber int
+	// HeadSHA is the SHA of the commit being analysed, replacing ArgHeadRef
+	// in tools' arguments, for pull requests, pushes and scans alike. Unlike
+	// HeadRef, it's never a branch name. Optional.
+	HeadSHA string
+	// MaxModules if greater than 0 discovers the Go modules in the
+	// repository by their go.mod files, installing dependencies and running
+	// tools in each module containing changes, up to MaxModules modules. A
+	// value of 0 only analyses the repository's root. Optional.
+	MaxModules int
+	// OffDiff also finds the issues on unchanged lines of changed files,
+	// recorded as each tool's OffDiffIssues with a HunkPos of 0, which aren't
+	// compared with the base ref. Not used with FullScan. Optional.
+	OffDiff bool
 }
 
 // Executer executes a single command in a contained environment.
@@ -40,24 +107,129 @@ type Executer interface {
 	// Execute executes a command and returns the combined stdout and stderr,
 	// along with an error if any. Must not be called after Stop(). If the
 	// command returns a non-zero exit code, an error of type NonZeroError
-	// is returned.
+	// is returned. The args are joined by spaces and run by bash, so args
+	// which may contain untrusted input must be quoted, see shellQuote.
 	Execute(context.Context, []string) ([]byte, error)
 	// Stop stops the executer and allows it to cleanup, if applicable.
 	Stop(context.Context) error
 }
 
+// EnvExecuter is an Executer which can add environment variables to a single
+// command, such as credentials which must not be in the command's args.
+type EnvExecuter interface {
+	Executer
+	// ExecuteEnv is Execute with env, a list of key=value, added to the
+	// command's environment.
+	ExecuteEnv(ctx context.Context, env []string, args []string) ([]byte, error)
+}
+
+// Retainer is an Executer which may keep its environment after Stop, such as
+// for post-mortem debugging of a failed analysis.
+type Retainer interface {
+	// Retain marks the environment to be kept when Stop is called, returning
+	// its location, such as a path or container ID, and true. Returns false
+	// if the environment will still be removed. Must be called before Stop.
+	Retain() (location string, ok bool)
+}
+
 // NonZeroError maybe returned by an Executer when the command executed returns
 // with a non-zero exit status.
 type NonZeroError struct {
 	args     []string
 	ExitCode int // ExitCode is the non zero exit code
+	// OutOfMemory is true if the command was killed or failed because it
+	// exceeded its memory limit.
+	OutOfMemory bool
+	// Output is the combined stdout and stderr of the command, the same as
+	// returned by Execute, so the error can be inspected without the output.
+	Output []byte
 }
 
 // Error implements the error interface.
 func (e *NonZeroError) Error() string {
+	if e.OutOfMemory {
+		return fmt.Sprintf("%v ran out of memory, returned exit code %v", e.args, e.ExitCode)
+	}
 	return fmt.Sprintf("%v returned exit code %v", e.args, e.ExitCode)
 }
 
+// executeError is an error executing a command, including the command's
+// output. Its cause is the Executer's error, so a NonZeroError can be
+// inspected with errors.Cause.
+type executeError struct {
+	args []string
+	err  error
+	out  []byte
+}
+
+// execError returns an executeError of executing args, which returned out and
+// err.
+func execError(args []string, err error, out []byte) error {
+	return &executeError{args: args, err: err, out: out}
+}
+
+// Error implements the error interface.
+func (e *executeError) Error() string {
+	return fmt.Sprintf("could not execute %v: %s\n%s", e.args, e.err, e.out)
+}
+
+// Cause returns the Executer's error, see errors.Cause.
+func (e *executeError) Cause() error {
+	return e.err
+}
+
+// sigkillExitCode is the exit code reported by a shell when a process is
+// killed by SIGKILL, such as by the kernel's OOM killer.
+const sigkillExitCode = 128 + int(syscall.SIGKILL)
+
+// issueLineRegexp matches a line reporting an issue in a Go file, such as
+// main.go:1:2: message.
+var issueLineRegexp = regexp.MustCompile(`^\S+\.go:\d+`)
+
+// outOfMemory returns true if a process exiting with exitCode and output out
+// was killed or failed because it exceeded its memory limit, such as when
+// exceeding ulimit -v. Only whole lines printed when allocating fails are
+// matched, so issues which mention memory aren't mistaken for failures.
+func outOfMemory(exitCode int, out []byte) bool {
+	if exitCode == sigkillExitCode {
+		return true
+	}
+	for _, line := range bytes.Split(bytes.ToLower(out), []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		switch {
+		case bytes.HasPrefix(line, []byte("fatal error: runtime: out of memory")): // Go runtime
+			return true
+		case bytes.HasPrefix(line, []byte("bash: ")) && bytes.Contains(line, []byte("cannot allocate")):
+			return true
+		case bytes.HasSuffix(line, []byte(": cannot allocate memory")) && !issueLineRegexp.Match(line): // ENOMEM
+			return true
+		}
+	}
+	return false
+}
+
+// ToolOutOfMemory is the error recorded for a tool which ran out of memory.
+const ToolOutOfMemory = "tool ran out of memory, increase the memory limit"
+
+// clone clones the repository using cloner, if timeout is > 0 cloning is
+// cancelled after timeout.
+func clone(ctx context.Context, logger logger.Logger, exec Executer, cloner Cloner, timeout time.Duration) error {
+	cloneCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		cloneCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := cloner.Clone(cloneCtx, logger, exec)
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() == nil && cloneCtx.Err() == context.DeadlineExceeded:
+		return errors.WithMessage(err, fmt.Sprintf("clone timed out after %v", timeout))
+	}
+	return errors.WithMessage(err, "could not clone")
+}
+
 // Analyse downloads a repository set in config in an environment provided by
 // exec, running the series of tools. Writes results to provided analysis,
 // or an error. The repository is expected to contain at least one Go package.
@@ -69,10 +241,11 @@ func Analyse(ctx context.Context, logger logger.Logger, exec Executer, cloner Cl
 	logger = logger.With("area", "analyser")
 
 	deltaStart := time.Now() // start of specific analysis
-	if err := cloner.Clone(ctx, exec); err != nil {
-		return errors.WithMessage(err, "could not clone")
+	if err := clone(ctx, logger, exec, cloner, config.CloneTimeout); err != nil {
+		return err
 	}
 	analysis.CloneDuration = db.Duration(time.Since(deltaStart))
+	StageLogger(logger, StageCloned, time.Since(deltaStart)).Info("cloned repository")
 
 	// read repository's configuration
 	repoConfig, err := configReader.Read(ctx, exec)
@@ -90,8 +263,9 @@ func Analyse(ctx context.Context, logger logger.Logger, exec Executer, cloner Cl
 	for _, arg := range envArgs {
 		out, err := exec.Execute(ctx, arg)
 		if err != nil {
-			return fmt.Errorf("could not execute %v: %s\n%s", arg, err, out)
+			return execError(arg, err, out)
 		}
+		recordEnvironment(analysis, arg, out)
 	}
 
 	// install packages
@@ -99,75 +273,149 @@ func Analyse(ctx context.Context, logger logger.Logger, exec Executer, cloner Cl
 		return errors.WithMessage(err, "could not install packages")
 	}
 
-	// get the base ref
-	baseRef, err := refReader.Base(ctx, exec)
-	if err != nil {
-		return errors.Wrap(err, "could not get base ref")
+	var (
+		baseRef string
+		patch   []byte
+	)
+	if config.FullScan {
+		// There are no changes to compare against, so tools comparing
+		// against the base ref compare against the head.
+		baseRef = config.HeadRef
+		patch, err = getFullPatch(ctx, exec, config.HeadRef)
+		if err != nil {
+			return errors.Wrap(err, "could not get patch")
+		}
+	} else {
+		// get the base ref
+		baseRef, err = refReader.Base(ctx, exec)
+		if err != nil {
+			return errors.Wrap(err, "could not get base ref")
+		}
+
+		// create a unified diff for use by revgrep
+		patch, err = getPatch(ctx, exec, baseRef, config.HeadRef)
+		if err != nil {
+			return errors.Wrap(err, "could not get patch")
+		}
 	}
 
-	// create a unified diff for use by revgrep
-	patch, err := getPatch(ctx, exec, baseRef, config.HeadRef)
-	if err != nil {
-		return errors.Wrap(err, "could not get patch")
+	if config.SkipNonCodeChanges && !hasCodeChanges(patch) {
+		logger.Info("skipping analysis: ", SkipReasonNoCodeChanges)
+		analysis.SkipReason = SkipReasonNoCodeChanges
+		return nil
+	}
+
+	if len(repoConfig.Paths) > 0 && !changesPaths(patch, repoConfig.Paths) {
+		logger.Info("skipping analysis: ", SkipReasonNoMatchingPaths)
+		analysis.SkipReason = SkipReasonNoMatchingPaths
+		return nil
+	}
+
+	// Issues are only reported on added lines, so there's nothing to report
+	// if lines were only removed, and the tools may fail if every Go file
+	// was removed.
+	if !config.FullScan && onlyDeletions(patch) {
+		logger.Info("skipping analysis: ", SkipReasonOnlyDeletions)
+		analysis.SkipReason = SkipReasonOnlyDeletions
+		return nil
+	}
+
+	modules := []string{rootModule}
+	if config.MaxModules > 0 {
+		modules, err = discoverModules(ctx, logger, exec, patch, config.MaxModules)
+		if err != nil {
+			return errors.WithMessage(err, "could not discover modules")
+		}
+		logger.Infof("analysing %v modules: %v", len(modules), strings.Join(modules, ", "))
 	}
 
 	// install dependencies, some static analysis tools require building a project
 	deltaStart = time.Now()
-	args := []string{"install-deps.sh"}
-	out, err := exec.Execute(ctx, args)
-	if err != nil {
-		return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
+	if err := installDeps(ctx, logger, exec, modules); err != nil {
+		return err
 	}
 	analysis.DepsDuration = db.Duration(time.Since(deltaStart))
-	logger.With("step", "install-deps.sh").Info(string(bytes.TrimSpace(out)))
+	StageLogger(logger, StageDepsInstalled, time.Since(deltaStart)).Info("installed dependencies")
 
 	// get the base package working directory, used by revgrep to change absolute
 	// path for the filename in an issue (used by some tools) to relative (used by
 	// patch).
-	args = []string{"pwd"}
-	out, err = exec.Execute(ctx, args)
+	args := []string{"pwd"}
+	out, err := exec.Execute(ctx, args)
 	if err != nil {
-		return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
+		return execError(args, err, out)
 	}
 	pwd := string(bytes.TrimSpace(out))
 
-	for _, tool := range repoConfig.Tools {
-		deltaStart = time.Now()
-		args := []string{tool.Path}
-		for _, arg := range strings.Fields(tool.Args) {
-			switch arg {
-			case ArgBaseBranch: // TODO change to ArgBaseRef
-				// Tool wants the base ref name as a flag
-				arg = baseRef
-			}
-			args = append(args, arg)
-		}
-		out, err := exec.Execute(ctx, args)
-		switch err.(type) {
-		case nil, *NonZeroError:
-			// Ignore non-zero exit codes from tools, these are often normal.
-		default:
-			return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
+	tools, muted := muteTools(repoConfig.Tools, config.MutedTools)
+	if len(muted) > 0 {
+		logger.Warnf("skipping %v muted tools: %v", len(muted), strings.Join(muted, ", "))
+	}
+	if config.MaxTools > 0 && len(tools) > config.MaxTools {
+		var skipped []string
+		for _, tool := range tools[config.MaxTools:] {
+			skipped = append(skipped, tool.Name)
 		}
-		logger.With("step", tool.Name).Info("ran tool")
+		logger.Warnf("skipping %v tools exceeding maximum of %v: %v", len(skipped), config.MaxTools, strings.Join(skipped, ", "))
+		tools = tools[:config.MaxTools]
+	}
 
-		checker := revgrep.Checker{
-			Patch:   bytes.NewReader(patch),
-			Regexp:  tool.Regexp,
-			AbsPath: pwd,
+	replacer := argReplacer(config, baseRef)
+	headKeys := make(map[db.ToolID][]issueKey) // headKeys are the keys of each tool's issues
+	for _, tool := range tools {
+		version, err := toolVersion(ctx, exec, tool)
+		if err != nil {
+			return err
 		}
+		logger.With("step", tool.Name).Info("version: ", version)
 
-		revIssues, err := checker.Check(bytes.NewReader(out), ioutil.Discard)
+		deltaStart = time.Now()
+		revIssues, revOffDiff, oom, err := moduleIssues(ctx, exec, tool, replacer, modules, pwd, patch, tool.WholeNewFiles, config.OffDiff && !config.FullScan)
 		if err != nil {
 			return err
 		}
+		if oom {
+			// The tool's output is partial, so no issues are reported.
+			StageLogger(logger, StageToolRan, time.Since(deltaStart)).With(LogTool, tool.Name).With(LogIssues, 0).Warn(ToolOutOfMemory)
+			analysis.Tools[tool.ID] = db.AnalysisTool{
+				Duration: db.Duration(time.Since(deltaStart)),
+				Version:  version,
+				Error:    ToolOutOfMemory,
+			}
+			continue
+		}
+		var wholeFiles map[string]bool
+		if tool.WholeNewFiles {
+			wholeFiles = make(map[string]bool)
+			for _, file := range newFiles(patch) {
+				wholeFiles[file] = true
+			}
+		}
 		logger.Infof("revgrep found %v issues", len(revIssues))
 
-		var issues []db.Issue
-		for _, issue := range revIssues {
+		var (
+			issues       []db.Issue
+			offDiff      []db.Issue
+			keys         []issueKey
+			incompatible int // incompatible is the number of issues indicating the tool couldn't parse the code
+		)
+		for i, issue := range append(revIssues, revOffDiff...) {
+			if isIncompatible(config.IncompatibleRegexp, issue.Message) {
+				incompatible++
+				continue
+			}
+
+			if repoConfig.ExcludeTests && strings.HasSuffix(issue.File, "_test.go") {
+				continue // the repository excludes issues in tests
+			}
+
+			if len(repoConfig.Paths) > 0 && !MatchPaths(repoConfig.Paths, issue.File) {
+				continue // outside the analysed paths
+			}
+
 			// Remove issues in generated files, isFileGenereated will return
 			// 0 for file is generated or 1 for file is not generated.
-			args = []string{"isFileGenerated", pwd, issue.File}
+			args := []string{"isFileGenerated", pwd, issue.File}
 			out, err := exec.Execute(ctx, args)
 			logger.With("step", "isFileGenerated").Info(string(bytes.TrimSpace(out)))
 			switch err {
@@ -177,26 +425,255 @@ func Analyse(ctx context.Context, logger logger.Logger, exec Executer, cloner Cl
 				if etype, ok := err.(*NonZeroError); ok && etype.ExitCode == 1 {
 					break // file is not generated, record the issue
 				}
-				return fmt.Errorf("could not execute %v: %s\n%s", args, err, out)
+				return execError(args, err, out)
+			}
+
+			hunkPos := issue.HunkPos
+			if hunkPos == 0 && wholeFiles[issue.File] {
+				// A new file's diff is a single hunk of every line, so the
+				// position is the line number. Issues without a line are
+				// positioned on the first line.
+				hunkPos = issue.LineNo
+				if hunkPos < 1 {
+					hunkPos = 1
+				}
 			}
 
-			issues = append(issues, db.Issue{
-				Path:    issue.File,
-				Line:    issue.LineNo,
-				HunkPos: issue.HunkPos,
-				Issue:   fmt.Sprintf("%s: %s", tool.Name, issue.Message),
+			// Some tools report issues spanning a range of lines.
+			var endHunkPos int
+			endLine := issueEndLine(issue.Message, issue.LineNo)
+			if endLine > 0 {
+				endHunkPos = hunkPosition(patch, issue.File, endLine)
+			}
+
+			body, err := renderIssue(config.IssueTemplate, IssueTemplateData{
+				Tool:     tool.Name,
+				ToolURL:  tool.URL,
+				Message:  issue.Message,
+				Path:     issue.File,
+				Line:     issue.LineNo,
+				Column:   issue.ColNo,
+				Severity: tool.Severity,
 			})
+			if err != nil {
+				return err
+			}
+
+			dbIssue := db.Issue{
+				Path:       issue.File,
+				Line:       issue.LineNo,
+				Column:     issue.ColNo,
+				HunkPos:    hunkPos,
+				EndLine:    endLine,
+				EndHunkPos: endHunkPos,
+				Issue:      body,
+				Severity:   tool.Severity,
+			}
+			if i >= len(revIssues) {
+				// Outside the diff, so there's no position within it.
+				dbIssue.HunkPos, dbIssue.EndHunkPos = 0, 0
+				offDiff = append(offDiff, dbIssue)
+				continue
+			}
+			issues = append(issues, dbIssue)
+			keys = append(keys, issueKey{Path: issue.File, Message: issue.Message})
+		}
+		headKeys[tool.ID] = keys
+
+		var toolErr string
+		if incompatible > 0 {
+			toolErr = toolIncompatible(tool.Name)
+			logger.With("step", tool.Name).Warnf("%s, ignored %v issues", toolErr, incompatible)
 		}
 
 		analysis.Tools[tool.ID] = db.AnalysisTool{
-			Duration: db.Duration(time.Since(deltaStart)),
-			Issues:   issues,
+			Duration:      db.Duration(time.Since(deltaStart)),
+			Version:       version,
+			Issues:        issues,
+			OffDiffIssues: offDiff,
+			Error:         toolErr,
 		}
+		StageLogger(logger, StageToolRan, time.Since(deltaStart)).With(LogTool, tool.Name).With(LogIssues, len(issues)).Info("ran tool")
 	}
 
+	if config.CompareBase && !config.FullScan {
+		deltaStart = time.Now()
+		if err := compareBase(ctx, logger, exec, tools, modules, baseRef, replacer, pwd, analysis, headKeys); err != nil {
+			return err
+		}
+		analysis.BaseDuration = db.Duration(time.Since(deltaStart))
+		StageLogger(logger, StageBaseCompared, time.Since(deltaStart)).With(LogIssues, len(analysis.Issues())).Info("compared issues with base ref")
+	}
+
+	StageLogger(logger, StageAnalysed, time.Since(start)).With(LogIssues, len(analysis.Issues())).Info("analysed")
 	return nil
 }
 
+// installDeps executes install-deps.sh in the repository's root, then in
+// each nested module of modules.
+func installDeps(ctx context.Context, logger logger.Logger, exec Executer, modules []string) error {
+	dirs := []string{rootModule}
+	for _, module := range modules {
+		if module != rootModule {
+			dirs = append(dirs, module)
+		}
+	}
+	args := []string{"install-deps.sh"}
+	for _, dir := range dirs {
+		out, err := inModule(exec, dir).Execute(ctx, args)
+		if err != nil {
+			if dir != rootModule {
+				return errors.WithMessage(execError(args, err, out), fmt.Sprintf("in module %v", dir))
+			}
+			return execError(args, err, out)
+		}
+		logger.With("step", "install-deps.sh").Info(string(bytes.TrimSpace(out)))
+	}
+	return nil
+}
+
+// muteTools returns the tools not named or identified by muted, and the names
+// of the tools which were muted.
+func muteTools(tools []db.Tool, muted []string) (kept []db.Tool, skipped []string) {
+	if len(muted) == 0 {
+		return tools, nil
+	}
+	for _, tool := range tools {
+		if isMuted(tool, muted) {
+			skipped = append(skipped, tool.Name)
+			continue
+		}
+		kept = append(kept, tool)
+	}
+	return kept, skipped
+}
+
+// isMuted returns true if tool's name, ignoring case, or ID is in muted.
+func isMuted(tool db.Tool, muted []string) bool {
+	id := strconv.Itoa(int(tool.ID))
+	for _, m := range muted {
+		if m == id || strings.EqualFold(m, tool.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// argReplacer returns a replacer of the placeholders in tools' arguments,
+// such as ArgBaseBranch, with their values when analysing config against
+// baseRef. Values are quoted, see shellQuote, as they may be controlled by a
+// repository, so placeholders must not be within quotes.
+func argReplacer(config Config, baseRef string) *strings.Replacer {
+	return strings.NewReplacer(
+		ArgBaseBranch, shellQuote(baseRef), // TODO change to ArgBaseRef
+		ArgOwner, shellQuote(config.Owner),
+		ArgRepo, shellQuote(config.Repo),
+		ArgHeadRef, shellQuote(config.HeadSHA),
+		ArgPRNumber, strconv.Itoa(config.PRNumber),
+	)
+}
+
+// runTool executes tool, replacing the placeholders in its arguments using
+// replacer, and returns its output. Non-zero exit codes are ignored as
+// they're often normal, but oom is true if the tool ran out of memory, in
+// which case its output is partial.
+func runTool(ctx context.Context, exec Executer, tool db.Tool, replacer *strings.Replacer) (out []byte, oom bool, err error) {
+	args := []string{tool.Path}
+	for _, arg := range strings.Fields(tool.Args) {
+		args = append(args, replacer.Replace(arg))
+	}
+	out, err = exec.Execute(ctx, args)
+	switch err := err.(type) {
+	case nil:
+	case *NonZeroError:
+		return out, err.OutOfMemory, nil
+	default:
+		return nil, false, execError(args, err, out)
+	}
+	return out, false, nil
+}
+
+// checkOutput returns the issues in a tool's output on lines changed by patch,
+// using checker with each of the tool's Regexps. Each line of out is parsed by
+// the first pattern which matches it, so a tool with multiple output formats
+// reports each issue once.
+func checkOutput(checker revgrep.Checker, patch []byte, tool db.Tool, out []byte) ([]revgrep.Issue, error) {
+	patterns := tool.Regexps()
+	if len(patterns) < 2 {
+		checker.Patch = bytes.NewReader(patch)
+		if len(patterns) == 1 {
+			checker.Regexp = patterns[0]
+		}
+		return checker.Check(bytes.NewReader(out), ioutil.Discard)
+	}
+
+	var (
+		res   = make([]*regexp.Regexp, len(patterns))
+		lines = make([][]byte, len(patterns)) // lines are the lines of out matched by each pattern
+	)
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse regexp: %v", err)
+		}
+		res[i] = re
+	}
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		for i, re := range res {
+			if re.Match(line) {
+				lines[i] = append(append(lines[i], line...), '\n')
+				break
+			}
+		}
+	}
+
+	var issues []revgrep.Issue
+	for i, pattern := range patterns {
+		if len(lines[i]) == 0 {
+			continue
+		}
+		checker.Patch = bytes.NewReader(patch)
+		checker.Regexp = pattern
+		found, err := checker.Check(bytes.NewReader(lines[i]), ioutil.Discard)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, found...)
+	}
+	return issues, nil
+}
+
+// maxVersionLen is the maximum length of a tool's version to record.
+const maxVersionLen = 255
+
+// toolVersion returns the first line of the tool's version output, or blank if
+// the tool does not support printing its version.
+func toolVersion(ctx context.Context, exec Executer, tool db.Tool) (string, error) {
+	versionArgs := tool.VersionArgs
+	if versionArgs == "" {
+		versionArgs = DefaultVersionArgs
+	}
+	args := append([]string{tool.Path}, strings.Fields(versionArgs)...)
+	out, err := exec.Execute(ctx, args)
+	switch err.(type) {
+	case nil:
+	case *NonZeroError:
+		return "", nil // version not supported
+	default:
+		return "", execError(args, err, out)
+	}
+
+	version := string(bytes.TrimSpace(out))
+	if i := strings.IndexByte(version, '\n'); i >= 0 {
+		version = strings.TrimSpace(version[:i])
+	}
+	if len(version) > maxVersionLen {
+		version = version[:maxVersionLen]
+	}
+	return version, nil
+}
+
 func getPatch(ctx context.Context, exec Executer, baseRef, headRef string) ([]byte, error) {
 	args := []string{"git", "diff", fmt.Sprintf("%v...%v", baseRef, headRef)}
 	patch, err := exec.Execute(ctx, args)
@@ -212,12 +689,26 @@ func getPatch(ctx context.Context, exec Executer, baseRef, headRef string) ([]by
 		)
 		patch, showErr = exec.Execute(ctx, showArgs)
 		if showErr != nil {
-			return patch, fmt.Errorf("could not execute %v: %s after trying to execute %v: %v", showArgs, showErr, args, err)
+			return patch, errors.WithMessage(execError(showArgs, showErr, patch), fmt.Sprintf("after trying to execute %v: %v", args, err))
 		}
 	}
 	return patch, nil
 }
 
+// emptyTree is the ID of git's empty tree object.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// getFullPatch returns a unified diff adding every file in headRef, by
+// comparing it to git's empty tree.
+func getFullPatch(ctx context.Context, exec Executer, headRef string) ([]byte, error) {
+	args := []string{"git", "diff", emptyTree, headRef}
+	patch, err := exec.Execute(ctx, args)
+	if err != nil {
+		return patch, execError(args, err, patch)
+	}
+	return patch, nil
+}
+
 // installAptPackages install packages using apt package manager, it expects
 // apt-get update to have already been executed. Can be called with 0 or more
 // packages.
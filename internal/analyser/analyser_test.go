@@ -3,20 +3,26 @@ package analyser
 import (
 	"context"
 	"fmt"
+	osexec "os/exec"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/db"
 	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/bradleyfalzon/revgrep"
+	"github.com/pkg/errors"
 )
 
 type mockExecuter struct {
 	Executed   [][]string
 	ExecuteOut [][]byte
 	ExecuteErr []error
+	Env        [][]string // Env is the env of each call to ExecuteEnv
 }
 
-var _ Executer = &mockExecuter{}
+var _ EnvExecuter = &mockExecuter{}
 
 func (a *mockExecuter) Execute(_ context.Context, args []string) (out []byte, err error) {
 	a.Executed = append(a.Executed, args)
@@ -25,13 +31,18 @@ func (a *mockExecuter) Execute(_ context.Context, args []string) (out []byte, er
 	return out, err
 }
 
+func (a *mockExecuter) ExecuteEnv(ctx context.Context, env []string, args []string) ([]byte, error) {
+	a.Env = append(a.Env, env)
+	return a.Execute(ctx, args)
+}
+
 func (a *mockExecuter) Stop(_ context.Context) error {
 	return nil
 }
 
 type mockCloner struct{}
 
-func (c *mockCloner) Clone(context.Context, Executer) error {
+func (c *mockCloner) Clone(context.Context, logger.Logger, Executer) error {
 	return nil
 }
 
@@ -60,48 +71,54 @@ index 0000000..6362395
 
 	analyser := &mockExecuter{
 		ExecuteOut: [][]byte{
-			{},   // go env
-			{},   // go version
-			{},   // cat /proc/self/limits
-			{},   // lsb_release --description
-			{},   // installAPTPackages
-			diff, // git diff
-			{},   // install-deps.sh
-			[]byte(`/go/src/gopherci`),                   // pwd
-			[]byte("main.go:1: error1"),                  // tool 1
-			[]byte("file is not generated"),              // isFileGenerated
+			{},                                       // go env
+			{},                                       // go version
+			{},                                       // cat /proc/self/limits
+			{},                                       // lsb_release --description
+			{},                                       // installAPTPackages
+			diff,                                     // git diff
+			{},                                       // install-deps.sh
+			[]byte(`/go/src/gopherci`),               // pwd
+			[]byte("tool1 v1.0\nbuilt with go1.9\n"), // tool 1 version
+			[]byte("main.go:1:5: error1"),            // tool 1 with column
+			[]byte("file is not generated"),          // isFileGenerated
+			[]byte("v2.0.0"),                         // tool 2 version
 			[]byte("/go/src/gopherci/main.go:1: error2"), // tool 2 output abs paths
 			[]byte("file is not generated"),              // isFileGenerated
+			[]byte("flag provided but not defined"),      // tool 3 version
 			[]byte("main.go:1: error3"),                  // tool 3 tested a generated file
 			[]byte("file is generated"),                  // isFileGenerated
 		},
 		ExecuteErr: []error{
-			nil, // go env
-			nil, // go version
-			nil, // cat /proc/self/limits
-			nil, // lsb_release --description
-			nil, // installAPTPackages
-			nil, // git diff
-			nil, // install-deps.sh
-			nil, // pwd
-			nil, // tool 1
+			nil,                        // go env
+			nil,                        // go version
+			nil,                        // cat /proc/self/limits
+			nil,                        // lsb_release --description
+			nil,                        // installAPTPackages
+			nil,                        // git diff
+			nil,                        // install-deps.sh
+			nil,                        // pwd
+			nil,                        // tool 1 version
+			nil,                        // tool 1
 			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
-			nil, // tool 2 output abs paths
+			nil,                        // tool 2 version
+			nil,                        // tool 2 output abs paths
 			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
-			nil, // tool 3 tested a generated file
-			nil, // isFileGenerated - generated
+			&NonZeroError{ExitCode: 2}, // tool 3 version not supported
+			nil,                        // tool 3 tested a generated file
+			nil,                        // isFileGenerated - generated
 		},
 	}
 
 	mockDB := db.NewMockDB()
-	analysis, _ := mockDB.StartAnalysis(1, 2, "commitFrom", "commitTo", 0)
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
 	cloner := &mockCloner{}
 	refReader := &FixedRef{BaseRef: "base-ref"}
 	configReader := &mockConfig{
 		RepoConfig{
 			APTPackages: []string{"package1"},
 			Tools: []db.Tool{
-				{ID: 1, Name: "Name1", Path: "tool1", Args: "-flag %BASE_BRANCH% ./..."},
+				{ID: 1, Name: "Name1", Path: "tool1", Args: "-flag %BASE_BRANCH% ./...", VersionArgs: "version -v"},
 				{ID: 2, Name: "Name2", Path: "tool2"},
 				{ID: 3, Name: "Name2", Path: "tool3"},
 			},
@@ -114,7 +131,7 @@ index 0000000..6362395
 	}
 
 	want := map[db.ToolID][]db.Issue{
-		1: []db.Issue{{Path: "main.go", Line: 1, HunkPos: 1, Issue: "Name1: error1"}},
+		1: []db.Issue{{Path: "main.go", Line: 1, Column: 5, HunkPos: 1, Issue: "Name1: error1"}},
 		2: []db.Issue{{Path: "main.go", Line: 1, HunkPos: 1, Issue: "Name2: error2"}},
 		3: nil,
 	}
@@ -127,6 +144,17 @@ index 0000000..6362395
 		t.Errorf("analysis has %v tools want %v", len(analysis.Tools), len(want))
 	}
 
+	wantVersions := map[db.ToolID]string{
+		1: "tool1 v1.0",
+		2: "v2.0.0",
+		3: "",
+	}
+	for toolID, version := range wantVersions {
+		if have := analysis.Tools[toolID].Version; have != version {
+			t.Errorf("unexpected version for toolID %v\nwant: %q\nhave: %q", toolID, version, have)
+		}
+	}
+
 	expectedArgs := [][]string{
 		{"go", "env"},
 		{"go", "version"},
@@ -136,10 +164,13 @@ index 0000000..6362395
 		{"git", "diff", fmt.Sprintf("%s...%v", refReader.BaseRef, cfg.HeadRef)},
 		{"install-deps.sh"},
 		{"pwd"},
-		{"tool1", "-flag", refReader.BaseRef, "./..."},
+		{"tool1", "version", "-v"},
+		{"tool1", "-flag", shellQuote(refReader.BaseRef), "./..."},
 		{"isFileGenerated", "/go/src/gopherci", "main.go"},
+		{"tool2", "--version"},
 		{"tool2"},
 		{"isFileGenerated", "/go/src/gopherci", "main.go"},
+		{"tool3", "--version"},
 		{"tool3"},
 		{"isFileGenerated", "/go/src/gopherci", "main.go"},
 	}
@@ -189,7 +220,7 @@ func TestGetPatch_diffError(t *testing.T) {
 		},
 		ExecuteErr: []error{
 			&NonZeroError{ExitCode: 128}, // git diff
-			nil, // git show
+			nil,                          // git show
 		},
 	}
 
@@ -244,3 +275,771 @@ func TestInstallAPTPackages(t *testing.T) {
 		}
 	}
 }
+
+func TestAnalyse_installDepsError(t *testing.T) {
+	diff := []byte(`diff --git a/main.go b/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main.go
+@@ -0,0 +1,1 @@
++package main`)
+
+	depsOut := []byte("cannot find package")
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},      // go env
+			{},      // go version
+			{},      // cat /proc/self/limits
+			{},      // lsb_release --description
+			diff,    // git diff
+			depsOut, // install-deps.sh
+		},
+		ExecuteErr: []error{nil, nil, nil, nil, nil, &NonZeroError{ExitCode: 1, Output: depsOut}},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{{ID: 1, Name: "Name1", Path: "tool1"}},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, Config{HeadRef: "head-branch"}, analysis)
+	nzErr, ok := errors.Cause(err).(*NonZeroError)
+	if !ok {
+		t.Fatalf("have error: %v, want: NonZeroError", err)
+	}
+	if !reflect.DeepEqual(nzErr.Output, depsOut) {
+		t.Errorf("output have: %q, want: %q", nzErr.Output, depsOut)
+	}
+	if want := "could not execute [install-deps.sh]: [] returned exit code 1\ncannot find package"; err.Error() != want {
+		t.Errorf("error have: %q, want: %q", err, want)
+	}
+}
+
+func TestAnalyse_skipNonCodeChanges(t *testing.T) {
+	cfg := Config{
+		HeadRef:            "head-branch",
+		SkipNonCodeChanges: true,
+	}
+
+	diff := []byte(`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-// old comment
++// new comment`)
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},   // go env
+			{},   // go version
+			{},   // cat /proc/self/limits
+			{},   // lsb_release --description
+			diff, // git diff
+		},
+		ExecuteErr: []error{nil, nil, nil, nil, nil},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{{ID: 1, Name: "Name1", Path: "tool1"}},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if want := SkipReasonNoCodeChanges; analysis.SkipReason != want {
+		t.Errorf("skip reason have: %q, want: %q", analysis.SkipReason, want)
+	}
+	if len(analysis.Tools) != 0 {
+		t.Errorf("expected no tools to run, have: %v", analysis.Tools)
+	}
+	if want := 5; len(analyser.Executed) != want {
+		t.Errorf("executed %v commands, want: %v: %v", len(analyser.Executed), want, analyser.Executed)
+	}
+}
+
+func TestAnalyse_onlyDeletions(t *testing.T) {
+	cfg := Config{HeadRef: "head-branch"}
+
+	diff := []byte(`diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-package main
+-
+-func old() {}`)
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},   // go env
+			{},   // go version
+			{},   // cat /proc/self/limits
+			{},   // lsb_release --description
+			diff, // git diff
+		},
+		ExecuteErr: []error{nil, nil, nil, nil, nil},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{{ID: 1, Name: "Name1", Path: "tool1"}},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if want := SkipReasonOnlyDeletions; analysis.SkipReason != want {
+		t.Errorf("skip reason have: %q, want: %q", analysis.SkipReason, want)
+	}
+	if issues := analysis.Issues(); len(issues) != 0 {
+		t.Errorf("expected no issues, have: %v", issues)
+	}
+	if want := 5; len(analyser.Executed) != want {
+		t.Errorf("executed %v commands, want: %v: %v", len(analyser.Executed), want, analyser.Executed)
+	}
+}
+
+func TestAnalyse_maxTools(t *testing.T) {
+	cfg := Config{
+		HeadRef:  "head-branch",
+		MaxTools: 1,
+	}
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{}, // go env
+			{}, // go version
+			{}, // cat /proc/self/limits
+			{}, // lsb_release --description
+			{}, // git diff
+			{}, // install-deps.sh
+			{}, // pwd
+			{}, // tool 1 version
+			{}, // tool 1
+		},
+		ExecuteErr: []error{nil, nil, nil, nil, nil, nil, nil, nil, nil},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{
+				{ID: 1, Name: "Name1", Path: "tool1"},
+				{ID: 2, Name: "Name2", Path: "tool2"},
+				{ID: 3, Name: "Name3", Path: "tool3"},
+			},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, ok := analysis.Tools[1]; !ok || len(analysis.Tools) != 1 {
+		t.Errorf("expected only tool 1 to run, have: %v", analysis.Tools)
+	}
+	if want := []string{"tool1"}; !reflect.DeepEqual(analyser.Executed[len(analyser.Executed)-1], want) {
+		t.Errorf("last executed have: %v, want: %v", analyser.Executed[len(analyser.Executed)-1], want)
+	}
+}
+
+func TestAnalyse_mutedTools(t *testing.T) {
+	cfg := Config{
+		HeadRef:    "head-branch",
+		MutedTools: []string{"name1", "3"},
+	}
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{}, // go env
+			{}, // go version
+			{}, // cat /proc/self/limits
+			{}, // lsb_release --description
+			{}, // git diff
+			{}, // install-deps.sh
+			{}, // pwd
+			{}, // tool 2 version
+			{}, // tool 2
+		},
+		ExecuteErr: []error{nil, nil, nil, nil, nil, nil, nil, nil, nil},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{
+				{ID: 1, Name: "Name1", Path: "tool1"},
+				{ID: 2, Name: "Name2", Path: "tool2"},
+				{ID: 3, Name: "Name3", Path: "tool3"},
+			},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, ok := analysis.Tools[2]; !ok || len(analysis.Tools) != 1 {
+		t.Errorf("expected only tool 2 to run, have: %v", analysis.Tools)
+	}
+	for _, args := range analyser.Executed {
+		if args[0] == "tool1" || args[0] == "tool3" {
+			t.Errorf("muted tool executed: %v", args)
+		}
+	}
+}
+
+// blockingCloner is a Cloner which blocks until its context is done.
+type blockingCloner struct{}
+
+func (c *blockingCloner) Clone(ctx context.Context, _ logger.Logger, _ Executer) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestAnalyse_cloneTimeout(t *testing.T) {
+	cfg := Config{
+		HeadRef:      "head-branch",
+		CloneTimeout: 10 * time.Millisecond,
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	err := Analyse(ctx, logger.Testing(), &mockExecuter{}, &blockingCloner{}, &mockConfig{}, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err == nil || !strings.Contains(err.Error(), "clone timed out after 10ms") {
+		t.Errorf("have error: %v, want clone timed out", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("clone was not cancelled by its timeout, took %v", elapsed)
+	}
+}
+
+func TestAnalyse_wholeNewFiles(t *testing.T) {
+	cfg := Config{
+		HeadRef: "head-branch",
+	}
+
+	diff := []byte(`diff --git a/new.go b/new.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,1 @@
++package main`)
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},                                   // go env
+			{},                                   // go version
+			{},                                   // cat /proc/self/limits
+			{},                                   // lsb_release --description
+			diff,                                 // git diff
+			{},                                   // install-deps.sh
+			[]byte(`/go/src/gopherci`),           // pwd
+			{},                                   // tool 1 version
+			[]byte("new.go:0: whole file issue"), // tool 1
+			[]byte("file is not generated"),      // isFileGenerated
+			{},                                   // tool 2 version
+			[]byte("new.go:0: whole file issue"), // tool 2
+		},
+		ExecuteErr: []error{
+			nil,                        // go env
+			nil,                        // go version
+			nil,                        // cat /proc/self/limits
+			nil,                        // lsb_release --description
+			nil,                        // git diff
+			nil,                        // install-deps.sh
+			nil,                        // pwd
+			nil,                        // tool 1 version
+			nil,                        // tool 1
+			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
+			nil,                        // tool 2 version
+			nil,                        // tool 2
+		},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{
+				{ID: 1, Name: "Name1", Path: "tool1", WholeNewFiles: true},
+				{ID: 2, Name: "Name2", Path: "tool2"},
+			},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := map[db.ToolID][]db.Issue{
+		1: []db.Issue{{Path: "new.go", Line: 0, HunkPos: 1, Issue: "Name1: whole file issue"}},
+		2: nil,
+	}
+	for toolID, issues := range want {
+		if have := analysis.Tools[toolID].Issues; !reflect.DeepEqual(issues, have) {
+			t.Errorf("unexpected issues for toolID %v\nwant: %+v\nhave: %+v", toolID, issues, have)
+		}
+	}
+}
+
+func TestAnalyse_offDiff(t *testing.T) {
+	cfg := Config{
+		HeadRef: "head-branch",
+		OffDiff: true,
+	}
+
+	diff := []byte(`diff --git a/main.go b/main.go
+index 0000000..6362395 100644
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,3 @@
+ package main
++var changed int
+ var unchanged int`)
+	out := []byte("main.go:2: on diff issue\nmain.go:3: off diff issue\nother.go:1: unchanged file issue")
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},                              // go env
+			{},                              // go version
+			{},                              // cat /proc/self/limits
+			{},                              // lsb_release --description
+			diff,                            // git diff
+			{},                              // install-deps.sh
+			[]byte(`/go/src/gopherci`),      // pwd
+			{},                              // tool 1 version
+			out,                             // tool 1
+			[]byte("file is not generated"), // isFileGenerated
+			[]byte("file is not generated"), // isFileGenerated
+		},
+		ExecuteErr: []error{
+			nil,                        // go env
+			nil,                        // go version
+			nil,                        // cat /proc/self/limits
+			nil,                        // lsb_release --description
+			nil,                        // git diff
+			nil,                        // install-deps.sh
+			nil,                        // pwd
+			nil,                        // tool 1 version
+			nil,                        // tool 1
+			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
+			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
+		},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{{ID: 1, Name: "Name1", Path: "tool1"}},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := []db.Issue{{Path: "main.go", Line: 2, HunkPos: 2, Issue: "Name1: on diff issue"}}
+	if have := analysis.Tools[1].Issues; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected issues\nwant: %+v\nhave: %+v", want, have)
+	}
+	want = []db.Issue{{Path: "main.go", Line: 3, HunkPos: 0, Issue: "Name1: off diff issue"}}
+	if have := analysis.Tools[1].OffDiffIssues; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected off diff issues\nwant: %+v\nhave: %+v", want, have)
+	}
+	if have := analysis.Issues(); len(have) != 1 {
+		t.Errorf("analysis issues have: %+v, want only the issue on the diff", have)
+	}
+}
+
+func TestAnalyse_excludeTests(t *testing.T) {
+	diff := []byte(`diff --git a/main.go b/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main.go
+@@ -0,0 +1,1 @@
++package main
+diff --git a/main_test.go b/main_test.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main_test.go
+@@ -0,0 +1,1 @@
++package main`)
+
+	for _, excludeTests := range []bool{false, true} {
+		out := [][]byte{
+			{},                         // go env
+			{},                         // go version
+			{},                         // cat /proc/self/limits
+			{},                         // lsb_release --description
+			diff,                       // git diff
+			{},                         // install-deps.sh
+			[]byte(`/go/src/gopherci`), // pwd
+			{},                         // tool 1 version
+			[]byte("main.go:1: main issue\nmain_test.go:1: test issue"), // tool 1
+			[]byte("file is not generated"),                             // isFileGenerated main.go
+		}
+		errs := []error{nil, nil, nil, nil, nil, nil, nil, nil, nil, &NonZeroError{ExitCode: 1}}
+		want := []db.Issue{{Path: "main.go", Line: 1, HunkPos: 1, Issue: "Name1: main issue"}}
+		if !excludeTests {
+			out = append(out, []byte("file is not generated")) // isFileGenerated main_test.go
+			errs = append(errs, &NonZeroError{ExitCode: 1})
+			want = append(want, db.Issue{Path: "main_test.go", Line: 1, HunkPos: 1, Issue: "Name1: test issue"})
+		}
+		analyser := &mockExecuter{ExecuteOut: out, ExecuteErr: errs}
+
+		mockDB := db.NewMockDB()
+		analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+		configReader := &mockConfig{
+			RepoConfig{
+				Tools:        []db.Tool{{ID: 1, Name: "Name1", Path: "tool1"}},
+				ExcludeTests: excludeTests,
+			},
+		}
+
+		err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, Config{HeadRef: "head-branch"}, analysis)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if have := analysis.Tools[1].Issues; !reflect.DeepEqual(have, want) {
+			t.Errorf("exclude tests %v unexpected issues\nwant: %+v\nhave: %+v", excludeTests, want, have)
+		}
+	}
+}
+
+func TestAnalyse_paths(t *testing.T) {
+	diff := []byte(`diff --git a/cmd/main.go b/cmd/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/cmd/main.go
+@@ -0,0 +1,1 @@
++package main
+diff --git a/internal/db.go b/internal/db.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/internal/db.go
+@@ -0,0 +1,1 @@
++package internal`)
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},                         // go env
+			{},                         // go version
+			{},                         // cat /proc/self/limits
+			{},                         // lsb_release --description
+			diff,                       // git diff
+			{},                         // install-deps.sh
+			[]byte(`/go/src/gopherci`), // pwd
+			{},                         // tool 1 version
+			[]byte("cmd/main.go:1: cmd issue\ninternal/db.go:1: internal issue"), // tool 1
+			[]byte("file is not generated"),                                      // isFileGenerated cmd/main.go
+		},
+		ExecuteErr: []error{nil, nil, nil, nil, nil, nil, nil, nil, nil, &NonZeroError{ExitCode: 1}},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{{ID: 1, Name: "Name1", Path: "tool1"}},
+			Paths: []string{"cmd/"},
+		},
+	}
+
+	cfg := Config{HeadRef: "head-branch"}
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := []db.Issue{{Path: "cmd/main.go", Line: 1, HunkPos: 1, Issue: "Name1: cmd issue"}}
+	if have := analysis.Tools[1].Issues; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected issues\nwant: %+v\nhave: %+v", want, have)
+	}
+}
+
+func TestAnalyse_noMatchingPaths(t *testing.T) {
+	cfg := Config{HeadRef: "head-branch"}
+
+	diff := []byte(`diff --git a/internal/db.go b/internal/db.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/internal/db.go
+@@ -0,0 +1,1 @@
++package internal`)
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},   // go env
+			{},   // go version
+			{},   // cat /proc/self/limits
+			{},   // lsb_release --description
+			diff, // git diff
+		},
+		ExecuteErr: []error{nil, nil, nil, nil, nil},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{{ID: 1, Name: "Name1", Path: "tool1"}},
+			Paths: []string{"cmd/"},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if want := SkipReasonNoMatchingPaths; analysis.SkipReason != want {
+		t.Errorf("skip reason have: %q, want: %q", analysis.SkipReason, want)
+	}
+	if want := 5; len(analyser.Executed) != want {
+		t.Errorf("executed %v commands, want: %v: %v", len(analyser.Executed), want, analyser.Executed)
+	}
+}
+
+func TestRunTool_args(t *testing.T) {
+	config := Config{HeadRef: "feature", HeadSHA: "abcdef", Owner: "owner", Repo: "repo", PRNumber: 3}
+
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{"./...", []string{"tool", "./..."}},
+		{"-before %BASE_BRANCH% ./...", []string{"tool", "-before", "'base-ref'", "./..."}},
+		{"-owner=%OWNER%", []string{"tool", "-owner='owner'"}},
+		{"-repo %REPO%", []string{"tool", "-repo", "'repo'"}},
+		{"%OWNER%/%REPO%", []string{"tool", "'owner'/'repo'"}},
+		{"-head %HEAD_REF%", []string{"tool", "-head", "'abcdef'"}},
+		{"-pr %PR_NUMBER%", []string{"tool", "-pr", "3"}},
+		{"-unknown %UNKNOWN%", []string{"tool", "-unknown", "%UNKNOWN%"}},
+	}
+
+	for _, test := range tests {
+		exec := &mockExecuter{ExecuteOut: [][]byte{{}}, ExecuteErr: []error{nil}}
+		tool := db.Tool{Path: "tool", Args: test.args}
+		if _, _, err := runTool(context.Background(), exec, tool, argReplacer(config, "base-ref")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if have := exec.Executed[0]; !reflect.DeepEqual(have, test.want) {
+			t.Errorf("args %q have: %q, want: %q", test.args, have, test.want)
+		}
+	}
+
+	// Pushes have no pull request number.
+	exec := &mockExecuter{ExecuteOut: [][]byte{{}}, ExecuteErr: []error{nil}}
+	tool := db.Tool{Path: "tool", Args: "-pr %PR_NUMBER%"}
+	if _, _, err := runTool(context.Background(), exec, tool, argReplacer(Config{}, "base-ref")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have, want := exec.Executed[0], []string{"tool", "-pr", "0"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("push have: %q, want: %q", have, want)
+	}
+
+	// Values controlled by the repository are quoted for the shell.
+	out, err := osexec.Command("bash", "-c", "printf %s "+argReplacer(Config{Repo: "repo;$(id)`id`'"}, "").Replace("%REPO%")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out)
+	}
+	if want := "repo;$(id)`id`'"; string(out) != want {
+		t.Errorf("quoted have: %q, want: %q", out, want)
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	patch := []byte(`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,3 @@
+ package main
++
++func main() {}`)
+
+	out := []byte("main.go:2:1: col format\n" +
+		"main.go:3 no col format\n" +
+		"main.go:1: unchanged line\n" +
+		"unmatched line\n" +
+		"main.go:3:5: both formats\r\n")
+
+	tests := map[string]struct {
+		regexp string
+		want   []string
+	}{
+		"default": {
+			regexp: "",
+			want:   []string{"col format", "both formats"},
+		},
+		"single": {
+			regexp: `(.*?\.go):(\d+)() (.*)`,
+			want:   []string{"no col format"},
+		},
+		"multiple": {
+			regexp: `(.*?\.go):(\d+):(\d+): (.*)` + "\n\n" + `(.*?\.go):(\d+)() (.*)` + "\n",
+			want:   []string{"col format", "both formats", "no col format"},
+		},
+	}
+
+	for desc, test := range tests {
+		issues, err := checkOutput(revgrep.Checker{}, patch, db.Tool{Regexp: test.regexp}, out)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", desc, err)
+		}
+		var have []string
+		for _, issue := range issues {
+			have = append(have, issue.Message)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%s: have: %q, want: %q", desc, have, test.want)
+		}
+	}
+}
+
+func TestGetFullPatch(t *testing.T) {
+	wantPatch := []byte("git diff patch")
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{wantPatch},
+		ExecuteErr: []error{nil},
+	}
+
+	patch, err := getFullPatch(context.Background(), analyser, "abcdef")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expectedArgs := [][]string{
+		{"git", "diff", emptyTree, "abcdef"},
+	}
+
+	if !reflect.DeepEqual(analyser.Executed, expectedArgs) {
+		t.Errorf("\nhave %v\nwant %v", analyser.Executed, expectedArgs)
+	}
+
+	if !reflect.DeepEqual(patch, wantPatch) {
+		t.Errorf("unexpected patch\nhave %v\nwant %v", patch, wantPatch)
+	}
+}
+
+func TestAnalyse_toolOutOfMemory(t *testing.T) {
+	cfg := Config{
+		HeadRef: "head-branch",
+	}
+
+	diff := []byte(`diff --git a/main.go b/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main.go
+@@ -0,0 +1,1 @@
++package main`)
+
+	analyser := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},                                 // go env
+			{},                                 // go version
+			{},                                 // cat /proc/self/limits
+			{},                                 // lsb_release --description
+			diff,                               // git diff
+			{},                                 // install-deps.sh
+			[]byte(`/go/src/gopherci`),         // pwd
+			{},                                 // tool 1 version
+			[]byte("main.go:1: partial issue"), // tool 1
+			{},                                 // tool 2 version
+			{},                                 // tool 2
+		},
+		ExecuteErr: []error{
+			nil, // go env
+			nil, // go version
+			nil, // cat /proc/self/limits
+			nil, // lsb_release --description
+			nil, // git diff
+			nil, // install-deps.sh
+			nil, // pwd
+			nil, // tool 1 version
+			&NonZeroError{ExitCode: sigkillExitCode, OutOfMemory: true}, // tool 1
+			nil, // tool 2 version
+			nil, // tool 2
+		},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{
+				{ID: 1, Name: "Name1", Path: "tool1"},
+				{ID: 2, Name: "Name2", Path: "tool2"},
+			},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), analyser, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if have := analysis.Tools[1]; have.Error != ToolOutOfMemory || have.Issues != nil {
+		t.Errorf("tool 1 have error: %q, issues: %v, want error: %q, no issues", have.Error, have.Issues, ToolOutOfMemory)
+	}
+	if have, ok := analysis.Tools[2]; !ok || have.Error != "" {
+		t.Errorf("tool 2 have: %+v, want no error", have)
+	}
+}
+
+func TestOutOfMemory(t *testing.T) {
+	tests := map[string]struct {
+		exitCode int
+		out      string
+		want     bool
+	}{
+		"killed":          {sigkillExitCode, "", true},
+		"go runtime":      {2, "fatal error: runtime: out of memory\n\ngoroutine 1", true},
+		"enomem":          {1, "fork/exec /usr/bin/git: Cannot allocate memory", true},
+		"bash":            {2, "bash: xrealloc: cannot allocate 48312320 bytes", true},
+		"ordinary issues": {1, "main.go:1: exported func Foo should have comment", false},
+		"issue mentions":  {1, "main.go:1: error strings should not be capitalized: Out of memory\nmain.go:2: cannot allocate memory", false},
+		"not line start":  {1, "main.go:3: comment says fatal error: runtime: out of memory", false},
+	}
+	for desc, test := range tests {
+		if have := outOfMemory(test.exitCode, []byte(test.out)); have != test.want {
+			t.Errorf("%v: have: %v, want: %v", desc, have, test.want)
+		}
+	}
+}
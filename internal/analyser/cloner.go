@@ -3,14 +3,16 @@ package analyser
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
 
-	"github.com/pkg/errors"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
 )
 
 // A Cloner uses the executer to clone the root of a repository into the
 // current working directory.
 type Cloner interface {
-	Clone(context.Context, Executer) error
+	Clone(context.Context, logger.Logger, Executer) error
 }
 
 // PullRequestCloner is a Cloner for handling cloning the HeadURL at HeadRef
@@ -20,12 +22,22 @@ type PullRequestCloner struct {
 	HeadRef string
 	BaseURL string
 	BaseRef string
+	// MergeRef is an optional ref in BaseURL containing the result of merging
+	// the pull request, such as GitHub's refs/pull/N/merge. If set, MergeRef
+	// is checked out instead of HeadRef, falling back to HeadRef if MergeRef
+	// cannot be fetched, such as when the pull request has conflicts, or
+	// doesn't merge HeadSHA.
+	MergeRef string
+	// HeadSHA is the pull request's head commit, which MergeRef must merge,
+	// as the merge ref is updated asynchronously and may merge a previous
+	// head. Required if MergeRef is set.
+	HeadSHA string
 }
 
 var _ Cloner = &PullRequestCloner{}
 
 // Clone implements the Cloner interface.
-func (c *PullRequestCloner) Clone(ctx context.Context, exec Executer) error {
+func (c *PullRequestCloner) Clone(ctx context.Context, logger logger.Logger, exec Executer) error {
 	// We clone a limited, but large, depth because RefReader requires a
 	// history to find the common ancestor when using git merge-base. If the
 	// depth is too small, we might not find the ancestor, if the depth is too
@@ -35,7 +47,21 @@ func (c *PullRequestCloner) Clone(ctx context.Context, exec Executer) error {
 	args := []string{"git", "clone", "--depth", depth, "--branch", c.HeadRef, "--single-branch", c.HeadURL, "."}
 	out, err := exec.Execute(ctx, args)
 	if err != nil {
-		return errors.WithMessage(err, fmt.Sprintf("could not execute %v: %q", args, out))
+		return execError(redactArgs(args), err, out)
+	}
+
+	if c.MergeRef != "" {
+		if err := c.fetchMerge(ctx, exec, depth); err != nil {
+			// The merge ref is unavailable, likely due to conflicts, or
+			// stale, so continue with head.
+			logger.With("error", err).Info("could not use merge ref, using head")
+		} else {
+			args = []string{"git", "checkout", "FETCH_HEAD"}
+			out, err = exec.Execute(ctx, args)
+			if err != nil {
+				return execError(redactArgs(args), err, out)
+			}
+		}
 	}
 
 	// This is a PR, fetch base as some tools (apicompat) needs to
@@ -43,9 +69,29 @@ func (c *PullRequestCloner) Clone(ctx context.Context, exec Executer) error {
 	args = []string{"git", "fetch", "--depth", depth, c.BaseURL, c.BaseRef}
 	out, err = exec.Execute(ctx, args)
 	if err != nil {
-		return errors.WithMessage(err, fmt.Sprintf("could not execute %v: %q", args, out))
+		return execError(redactArgs(args), err, out)
+	}
+
+	return nil
+}
+
+// fetchMerge fetches MergeRef into FETCH_HEAD, returning an error if it
+// couldn't be fetched, or its merge's second parent isn't HeadSHA.
+func (c *PullRequestCloner) fetchMerge(ctx context.Context, exec Executer, depth string) error {
+	args := []string{"git", "fetch", "--depth", depth, c.BaseURL, c.MergeRef}
+	out, err := exec.Execute(ctx, args)
+	if err != nil {
+		return execError(redactArgs(args), err, out)
 	}
 
+	args = []string{"git", "rev-parse", "FETCH_HEAD^2"}
+	out, err = exec.Execute(ctx, args)
+	if err != nil {
+		return execError(args, err, out)
+	}
+	if merged := strings.TrimSpace(string(out)); merged != c.HeadSHA {
+		return fmt.Errorf("%s merges %s, not head %s", c.MergeRef, merged, c.HeadSHA)
+	}
 	return nil
 }
 
@@ -58,22 +104,50 @@ type PushCloner struct {
 var _ Cloner = &PushCloner{}
 
 // Clone implements the Cloner interface.
-func (c *PushCloner) Clone(ctx context.Context, exec Executer) error {
+func (c *PushCloner) Clone(ctx context.Context, _ logger.Logger, exec Executer) error {
 	// clone repo, this cannot be shallow and needs access to all commits
 	// therefore cannot be shallow (or if it is, would required a very
 	// large depth and --no-single-branch).
 	args := []string{"git", "clone", c.HeadURL, "."}
 	out, err := exec.Execute(ctx, args)
 	if err != nil {
-		return errors.WithMessage(err, fmt.Sprintf("could not execute %v: %q", args, out))
+		return execError(redactArgs(args), err, out)
 	}
 
 	// Checkout sha
 	args = []string{"git", "checkout", c.HeadRef}
 	out, err = exec.Execute(ctx, args)
 	if err != nil {
-		return errors.WithMessage(err, fmt.Sprintf("could not execute %v: %q", args, out))
+		return execError(redactArgs(args), err, out)
 	}
 
 	return nil
 }
+
+// redactArgs returns args with the credentials of any URLs redacted, so clone
+// URLs containing access tokens may be included in errors.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if u, err := url.Parse(arg); err == nil && u.User != nil {
+			u.User = url.User("redacted")
+			arg = u.String()
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// gitSSHEnv returns the environment variables for git to authenticate over
+// SSH using the private key keyFile, and if knownHostsFile is set, verify
+// hosts using only knownHostsFile. Returns nil if keyFile is blank.
+func gitSSHEnv(keyFile, knownHostsFile string) []string {
+	if keyFile == "" {
+		return nil
+	}
+	cmd := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes", keyFile)
+	if knownHostsFile != "" {
+		cmd += fmt.Sprintf(" -o UserKnownHostsFile=%s", knownHostsFile)
+	}
+	return []string{"GIT_SSH_COMMAND=" + cmd}
+}
@@ -0,0 +1,115 @@
+package analyser
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/pkg/errors"
+)
+
+// issueKey identifies an issue independently of its line number, so an issue
+// is still matched after changes move it.
+type issueKey struct {
+	Path    string
+	Message string
+}
+
+// newIssues returns the issues in head which are not in base, headKeys are
+// the keys of each issue in head. Each key in base matches at most one issue
+// in head, so additional occurrences of an existing issue are new.
+func newIssues(head []db.Issue, headKeys []issueKey, base []issueKey) []db.Issue {
+	existing := make(map[issueKey]int)
+	for _, key := range base {
+		existing[key]++
+	}
+	var issues []db.Issue
+	for i, issue := range head {
+		if key := headKeys[i]; existing[key] > 0 {
+			existing[key]--
+			continue
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// compareBase checks out baseRef and runs each tool which found issues again
+// in each of modules, with the placeholders in their arguments replaced by replacer, removing
+// issues from analysis which also exist in the base ref, headKeys
+// are the keys of each tool's issues. The original head is checked out again
+// before returning. If the base ref could not be analysed, a warning is
+// logged and all issues are reported, an error is only returned if the head
+// could not be restored.
+func compareBase(ctx context.Context, logger logger.Logger, exec Executer, tools []db.Tool, modules []string, baseRef string, replacer *strings.Replacer, pwd string, analysis *db.Analysis, headKeys map[db.ToolID][]issueKey) error {
+	var compare []db.Tool
+	for _, tool := range tools {
+		if len(analysis.Tools[tool.ID].Issues) > 0 {
+			compare = append(compare, tool)
+		}
+	}
+	if len(compare) == 0 {
+		return nil
+	}
+
+	args := []string{"git", "rev-parse", "HEAD"}
+	out, err := exec.Execute(ctx, args)
+	if err != nil {
+		return execError(args, err, out)
+	}
+	head := string(bytes.TrimSpace(out))
+
+	if err := baseIssues(ctx, logger, exec, compare, modules, baseRef, replacer, pwd, analysis, headKeys); err != nil {
+		logger.With("error", err).Warn("could not compare issues with base ref, reporting all issues")
+	}
+
+	args = []string{"git", "checkout", "-q", "-f", head}
+	if out, err := exec.Execute(ctx, args); err != nil {
+		return errors.WithMessage(execError(args, err, out), "could not restore head")
+	}
+	return nil
+}
+
+// baseIssues checks out baseRef and runs tools in modules, removing their
+// issues from analysis which also exist in the base ref. Tools which run out of memory
+// keep all their issues.
+func baseIssues(ctx context.Context, logger logger.Logger, exec Executer, tools []db.Tool, modules []string, baseRef string, replacer *strings.Replacer, pwd string, analysis *db.Analysis, headKeys map[db.ToolID][]issueKey) error {
+	args := []string{"git", "checkout", "-q", "-f", baseRef}
+	if out, err := exec.Execute(ctx, args); err != nil {
+		return execError(args, err, out)
+	}
+
+	// Every line is new in the full patch, so revgrep reports every issue.
+	patch, err := getFullPatch(ctx, exec, baseRef)
+	if err != nil {
+		return errors.Wrap(err, "could not get base patch")
+	}
+
+	if err := installDeps(ctx, logger, exec, modules); err != nil {
+		return err
+	}
+
+	for _, tool := range tools {
+		revIssues, _, oom, err := moduleIssues(ctx, exec, tool, replacer, modules, pwd, patch, true, false)
+		if err != nil {
+			return err
+		}
+		if oom {
+			logger.With("step", tool.Name).Warn("base ref: ", ToolOutOfMemory)
+			continue
+		}
+
+		var base []issueKey
+		for _, issue := range revIssues {
+			base = append(base, issueKey{Path: issue.File, Message: issue.Message})
+		}
+
+		result := analysis.Tools[tool.ID]
+		result.Issues = newIssues(result.Issues, headKeys[tool.ID], base)
+		analysis.Tools[tool.ID] = result
+		logger.With("step", tool.Name).Infof("base ref: %v issues, %v new issues", len(base), len(result.Issues))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package analyser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+)
+
+func TestNewIssues(t *testing.T) {
+	head := []db.Issue{
+		{Path: "main.go", Line: 10, Issue: "existing"},
+		{Path: "main.go", Line: 20, Issue: "new"},
+		{Path: "main.go", Line: 30, Issue: "repeated"},
+		{Path: "main.go", Line: 40, Issue: "repeated"},
+		{Path: "other.go", Line: 10, Issue: "existing"},
+	}
+	headKeys := []issueKey{
+		{"main.go", "existing"},
+		{"main.go", "new"},
+		{"main.go", "repeated"},
+		{"main.go", "repeated"},
+		{"other.go", "existing"},
+	}
+
+	tests := map[string]struct {
+		base []issueKey
+		want []db.Issue
+	}{
+		"no base issues": {nil, head},
+		"moved": {
+			// Line numbers are ignored, as changes move existing issues.
+			[]issueKey{{"main.go", "existing"}, {"main.go", "repeated"}, {"main.go", "repeated"}, {"other.go", "existing"}},
+			[]db.Issue{head[1]},
+		},
+		"additional occurrence": {
+			[]issueKey{{"main.go", "repeated"}},
+			[]db.Issue{head[0], head[1], head[3], head[4]},
+		},
+		"different path": {
+			[]issueKey{{"moved.go", "existing"}, {"main.go", "existing"}},
+			[]db.Issue{head[1], head[2], head[3], head[4]},
+		},
+		"all existing": {append(headKeys, issueKey{"main.go", "fixed"}), nil},
+	}
+
+	for desc, test := range tests {
+		have := newIssues(head, headKeys, test.base)
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%v:\nhave: %+v\nwant: %+v", desc, have, test.want)
+		}
+	}
+}
+
+func TestCompareBase(t *testing.T) {
+	basePatch := []byte(`diff --git a/main.go b/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main.go
+@@ -0,0 +1,2 @@
++package main
++// existing`)
+
+	exec := &mockExecuter{
+		ExecuteOut: [][]byte{
+			[]byte("abc123\n"),            // git rev-parse HEAD
+			{},                            // git checkout base
+			basePatch,                     // git diff
+			{},                            // install-deps.sh
+			[]byte("main.go:2: existing"), // tool 1
+			{},                            // git checkout head
+		},
+		ExecuteErr: []error{nil, nil, nil, nil, &NonZeroError{ExitCode: 1}, nil},
+	}
+
+	tools := []db.Tool{
+		{ID: 1, Name: "Name1", Path: "tool1", Args: "%BASE_BRANCH%"},
+		{ID: 2, Name: "Name2", Path: "tool2"}, // no issues, not run
+	}
+	analysis := db.NewAnalysis()
+	analysis.Tools[1] = db.AnalysisTool{Issues: []db.Issue{
+		{Path: "main.go", Line: 5, Issue: "Name1: existing"},
+		{Path: "main.go", Line: 6, Issue: "Name1: new"},
+	}}
+	analysis.Tools[2] = db.AnalysisTool{}
+	headKeys := map[db.ToolID][]issueKey{1: {{"main.go", "existing"}, {"main.go", "new"}}}
+
+	err := compareBase(context.Background(), logger.Testing(), exec, tools, []string{rootModule}, "base-ref", argReplacer(Config{}, "base-ref"), "/go/src/gopherci", analysis, headKeys)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := []db.Issue{{Path: "main.go", Line: 6, Issue: "Name1: new"}}
+	if have := analysis.Tools[1].Issues; !reflect.DeepEqual(have, want) {
+		t.Errorf("issues\nhave: %+v\nwant: %+v", have, want)
+	}
+
+	wantArgs := [][]string{
+		{"git", "rev-parse", "HEAD"},
+		{"git", "checkout", "-q", "-f", "base-ref"},
+		{"git", "diff", emptyTree, "base-ref"},
+		{"install-deps.sh"},
+		{"tool1", "'base-ref'"},
+		{"git", "checkout", "-q", "-f", "abc123"},
+	}
+	if !reflect.DeepEqual(exec.Executed, wantArgs) {
+		t.Errorf("executed\nhave: %v\nwant: %v", exec.Executed, wantArgs)
+	}
+}
+
+func TestCompareBase_baseError(t *testing.T) {
+	exec := &mockExecuter{
+		ExecuteOut: [][]byte{
+			[]byte("abc123\n"), // git rev-parse HEAD
+			{},                 // git checkout base
+			{},                 // git checkout head
+		},
+		ExecuteErr: []error{nil, errors.New("checkout failed"), nil},
+	}
+
+	tools := []db.Tool{{ID: 1, Name: "Name1", Path: "tool1"}}
+	issues := []db.Issue{{Path: "main.go", Line: 5, Issue: "Name1: existing"}}
+	analysis := db.NewAnalysis()
+	analysis.Tools[1] = db.AnalysisTool{Issues: issues}
+	headKeys := map[db.ToolID][]issueKey{1: {{"main.go", "existing"}}}
+
+	err := compareBase(context.Background(), logger.Testing(), exec, tools, []string{rootModule}, "base-ref", argReplacer(Config{}, "base-ref"), "/go/src/gopherci", analysis, headKeys)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// All issues are reported if the base could not be analysed.
+	if have := analysis.Tools[1].Issues; !reflect.DeepEqual(have, issues) {
+		t.Errorf("issues\nhave: %+v\nwant: %+v", have, issues)
+	}
+	if have, want := exec.Executed[len(exec.Executed)-1], []string{"git", "checkout", "-q", "-f", "abc123"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("last executed have: %v, want: %v", have, want)
+	}
+}
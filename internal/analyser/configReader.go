@@ -2,6 +2,8 @@ package analyser
 
 import (
 	"context"
+	"path"
+	"regexp"
 
 	yaml "gopkg.in/yaml.v1"
 
@@ -13,6 +15,49 @@ import (
 type RepoConfig struct {
 	APTPackages []string `yaml:"apt_packages"`
 	Tools       []db.Tool
+	// Branches are ordered overrides for specific branches, the first
+	// matching override is applied to the configuration.
+	Branches []BranchConfig `yaml:"branches"`
+	// MustFix are regular expressions matching issues which must be fixed,
+	// such as security related issues. If any issue matches, the analysis's
+	// status is failure.
+	MustFix []string `yaml:"must_fix"`
+	// ExcludeTests excludes issues in test files, those ending in _test.go.
+	ExcludeTests bool `yaml:"exclude_tests"`
+	// MinSeverity is the minimum severity of issues to comment, such as
+	// warning, less severe issues are still recorded. If blank, the server's
+	// minimum severity is used.
+	MinSeverity string `yaml:"min_severity"`
+	// Paths if set only analyses changes to Go files matching any of the
+	// patterns, such as the paths owned by a team in CODEOWNERS, and only
+	// reports issues in matching files, see MatchPaths.
+	Paths []string `yaml:"paths"`
+}
+
+// MustFixPatterns returns the compiled MustFix regular expressions, or an
+// error if any is invalid.
+func (cfg RepoConfig) MustFixPatterns() ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, expr := range cfg.MustFix {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid must_fix pattern %q", expr)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// BranchConfig overrides a repository's configuration when the branch being
+// analysed matches Branch.
+type BranchConfig struct {
+	// Branch is a glob pattern, as supported by path.Match, matching the name
+	// of the branch such as "main" or "feature/*".
+	Branch string `yaml:"branch"`
+	// APTPackages if set replaces the repository's apt_packages.
+	APTPackages []string `yaml:"apt_packages"`
+	// Tools if set limits the tools to run to those with the same name.
+	Tools []string `yaml:"tools"`
 }
 
 // A ConfigReader returns a repository's configuration.
@@ -20,10 +65,25 @@ type ConfigReader interface {
 	Read(context.Context, Executer) (RepoConfig, error)
 }
 
+// ConfigFilenames are the names of a repository's configuration file, in
+// order of preference.
+var ConfigFilenames = []string{".gopherci.yml", ".gopherci.yaml"}
+
+// IsConfigFilename returns true if filename is one of ConfigFilenames.
+func IsConfigFilename(filename string) bool {
+	for _, name := range ConfigFilenames {
+		if filename == name {
+			return true
+		}
+	}
+	return false
+}
+
 // YAMLConfig implements a ConfigReader by reading a yaml configuration file
 // from the repositories root.
 type YAMLConfig struct {
-	Tools []db.Tool // Preset tools to use, before per repo config has been applied
+	Tools  []db.Tool // Preset tools to use, before per repo config has been applied
+	Branch string    // Branch being analysed, used to select branch overrides, may be blank
 }
 
 var _ ConfigReader = &YAMLConfig{}
@@ -34,21 +94,80 @@ func (c *YAMLConfig) Read(ctx context.Context, exec Executer) (RepoConfig, error
 		Tools: c.Tools,
 	}
 
-	const configFilename = ".gopherci.yml"
+	// The first of ConfigFilenames found is used.
+	for _, filename := range ConfigFilenames {
+		args := []string{"cat", filename}
+		yml, err := exec.Execute(ctx, args)
+		switch err.(type) {
+		case nil:
+			err = cfg.parse(yml, filename, c.Branch)
+			return cfg, err
+		case *NonZeroError:
+			// Does not exist, try the next filename
+		default:
+			return cfg, errors.Wrapf(err, "could not read %s", filename)
+		}
+	}
+
+	return cfg, nil
+}
+
+// parse unmarshals the contents of configFilename and applies the overrides
+// for branch.
+func (cfg *RepoConfig) parse(yml []byte, configFilename, branch string) error {
+	if err := yaml.Unmarshal(yml, cfg); err != nil {
+		return errors.Wrapf(err, "could not unmarshal %s", configFilename)
+	}
+
+	if err := cfg.applyBranch(branch); err != nil {
+		return errors.Wrapf(err, "could not apply branch configuration from %s", configFilename)
+	}
 
-	args := []string{"cat", configFilename}
-	yml, err := exec.Execute(ctx, args)
-	switch err.(type) {
-	case nil:
-	case *NonZeroError:
-		return cfg, nil
-	default:
-		return cfg, errors.Wrapf(err, "could not read %s", configFilename)
+	if _, err := cfg.MustFixPatterns(); err != nil {
+		return errors.Wrapf(err, "could not parse %s", configFilename)
 	}
 
-	if err = yaml.Unmarshal(yml, &cfg); err != nil {
-		return cfg, errors.Wrapf(err, "could not unmarshal %s", configFilename)
+	if err := ValidateSeverity(cfg.MinSeverity); err != nil {
+		return errors.Wrapf(err, "invalid min_severity in %s", configFilename)
 	}
 
-	return cfg, nil
+	if err := ValidatePaths(cfg.Paths); err != nil {
+		return errors.Wrapf(err, "invalid paths in %s", configFilename)
+	}
+
+	return nil
+}
+
+// applyBranch applies the first branch override matching branch, if any.
+func (cfg *RepoConfig) applyBranch(branch string) error {
+	if branch == "" {
+		return nil
+	}
+	for _, override := range cfg.Branches {
+		matched, err := path.Match(override.Branch, branch)
+		if err != nil {
+			return errors.Wrapf(err, "invalid branch pattern %q", override.Branch)
+		}
+		if !matched {
+			continue
+		}
+
+		if override.APTPackages != nil {
+			cfg.APTPackages = override.APTPackages
+		}
+		if override.Tools != nil {
+			var tools []db.Tool
+			for _, tool := range cfg.Tools {
+				for _, name := range override.Tools {
+					if tool.Name == name {
+						tools = append(tools, tool)
+						break
+					}
+				}
+			}
+			cfg.Tools = tools
+		}
+		return nil
+	}
+	return nil
 }
@@ -11,8 +11,8 @@ import (
 
 func TestYAMLConfig_default(t *testing.T) {
 	exec := &mockExecuter{
-		ExecuteOut: [][]byte{{}},
-		ExecuteErr: []error{&NonZeroError{ExitCode: 1}},
+		ExecuteOut: [][]byte{{}, {}},
+		ExecuteErr: []error{&NonZeroError{ExitCode: 1}, &NonZeroError{ExitCode: 1}},
 	}
 
 	reader := &YAMLConfig{
@@ -61,6 +61,7 @@ func TestYAMLConfig(t *testing.T) {
 	contents := []byte(`# .gopherci.yml config
 apt_packages:
     - package1
+exclude_tests: true
 `)
 	exec := &mockExecuter{
 		ExecuteOut: [][]byte{contents},
@@ -76,11 +77,209 @@ apt_packages:
 	}
 
 	want := RepoConfig{
-		APTPackages: []string{"package1"},
-		Tools:       reader.Tools,
+		APTPackages:  []string{"package1"},
+		Tools:        reader.Tools,
+		ExcludeTests: true,
 	}
 
 	if !reflect.DeepEqual(have, want) {
 		t.Errorf("\nhave: %v\nwant: %v", have, want)
 	}
 }
+
+func TestYAMLConfig_branches(t *testing.T) {
+	contents := []byte(`# .gopherci.yml config
+apt_packages:
+    - package1
+branches:
+    - branch: main
+      apt_packages:
+          - package2
+    - branch: feature/*
+      tools:
+          - tool1
+    - branch: "*"
+      tools: []
+`)
+
+	tools := []db.Tool{{Name: "tool1"}, {Name: "tool2"}}
+
+	tests := []struct {
+		branch      string
+		wantAPT     []string
+		wantTools   []db.Tool
+		wantErr     bool
+		overrideYML []byte
+	}{
+		{branch: "", wantAPT: []string{"package1"}, wantTools: tools},
+		{branch: "main", wantAPT: []string{"package2"}, wantTools: tools},
+		{branch: "feature/foo", wantAPT: []string{"package1"}, wantTools: []db.Tool{{Name: "tool1"}}},
+		{branch: "feature/foo/bar", wantAPT: []string{"package1"}, wantTools: tools},
+		{branch: "other", wantAPT: []string{"package1"}, wantTools: nil},
+		{branch: "main", overrideYML: []byte("branches:\n    - branch: \"[\"\n"), wantErr: true},
+	}
+
+	for _, test := range tests {
+		yml := contents
+		if test.overrideYML != nil {
+			yml = test.overrideYML
+		}
+		exec := &mockExecuter{
+			ExecuteOut: [][]byte{yml},
+			ExecuteErr: []error{nil},
+		}
+
+		reader := &YAMLConfig{Tools: tools, Branch: test.branch}
+		have, err := reader.Read(context.Background(), exec)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("branch %q expected error, have: %v", test.branch, err)
+			continue
+		case test.wantErr:
+			continue
+		case err != nil:
+			t.Errorf("branch %q unexpected error: %v", test.branch, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(have.APTPackages, test.wantAPT) {
+			t.Errorf("branch %q apt packages\nhave: %v\nwant: %v", test.branch, have.APTPackages, test.wantAPT)
+		}
+		if !reflect.DeepEqual(have.Tools, test.wantTools) {
+			t.Errorf("branch %q tools\nhave: %v\nwant: %v", test.branch, have.Tools, test.wantTools)
+		}
+	}
+}
+
+func TestYAMLConfig_mustFix(t *testing.T) {
+	tests := map[string]struct {
+		yml     string
+		want    []string
+		wantErr bool
+	}{
+		"none":    {"apt_packages: []\n", nil, false},
+		"valid":   {"must_fix:\n    - \"^G10[1-4]:\"\n    - SQL injection\n", []string{"^G10[1-4]:", "SQL injection"}, false},
+		"invalid": {"must_fix:\n    - \"[\"\n", nil, true},
+	}
+
+	for desc, test := range tests {
+		exec := &mockExecuter{
+			ExecuteOut: [][]byte{[]byte(test.yml)},
+			ExecuteErr: []error{nil},
+		}
+
+		reader := &YAMLConfig{}
+		have, err := reader.Read(context.Background(), exec)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case test.wantErr:
+		case err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		case !reflect.DeepEqual(have.MustFix, test.want):
+			t.Errorf("%v: have: %v, want: %v", desc, have.MustFix, test.want)
+		}
+	}
+}
+
+func TestYAMLConfig_minSeverity(t *testing.T) {
+	tests := map[string]struct {
+		yml     string
+		want    string
+		wantErr bool
+	}{
+		"none":    {"apt_packages: []\n", "", false},
+		"valid":   {"min_severity: warning\n", "warning", false},
+		"invalid": {"min_severity: fatal\n", "", true},
+	}
+
+	for desc, test := range tests {
+		exec := &mockExecuter{
+			ExecuteOut: [][]byte{[]byte(test.yml)},
+			ExecuteErr: []error{nil},
+		}
+
+		reader := &YAMLConfig{}
+		have, err := reader.Read(context.Background(), exec)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case test.wantErr:
+		case err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		case have.MinSeverity != test.want:
+			t.Errorf("%v: have: %q, want: %q", desc, have.MinSeverity, test.want)
+		}
+	}
+}
+
+func TestYAMLConfig_paths(t *testing.T) {
+	tests := map[string]struct {
+		yml     string
+		want    []string
+		wantErr bool
+	}{
+		"none":    {"apt_packages: []\n", nil, false},
+		"valid":   {"paths:\n  - cmd/\n  - \"*.pb.go\"\n", []string{"cmd/", "*.pb.go"}, false},
+		"invalid": {"paths:\n  - internal/[a-\n", nil, true},
+	}
+
+	for desc, test := range tests {
+		exec := &mockExecuter{
+			ExecuteOut: [][]byte{[]byte(test.yml)},
+			ExecuteErr: []error{nil},
+		}
+
+		reader := &YAMLConfig{}
+		have, err := reader.Read(context.Background(), exec)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case test.wantErr:
+		case err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		case !reflect.DeepEqual(have.Paths, test.want):
+			t.Errorf("%v: have: %q, want: %q", desc, have.Paths, test.want)
+		}
+	}
+}
+
+func TestYAMLConfig_filenames(t *testing.T) {
+	contents := []byte(`apt_packages:
+    - package1
+`)
+	notFound := &NonZeroError{ExitCode: 1}
+
+	tests := map[string]struct {
+		out          [][]byte
+		err          []error
+		wantExecuted [][]string
+	}{
+		".gopherci.yml": {
+			out:          [][]byte{contents},
+			err:          []error{nil},
+			wantExecuted: [][]string{{"cat", ".gopherci.yml"}},
+		},
+		".gopherci.yaml": {
+			out:          [][]byte{{}, contents},
+			err:          []error{notFound, nil},
+			wantExecuted: [][]string{{"cat", ".gopherci.yml"}, {"cat", ".gopherci.yaml"}},
+		},
+	}
+
+	for desc, test := range tests {
+		exec := &mockExecuter{ExecuteOut: test.out, ExecuteErr: test.err}
+		reader := &YAMLConfig{}
+
+		have, err := reader.Read(context.Background(), exec)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		}
+		if want := []string{"package1"}; !reflect.DeepEqual(have.APTPackages, want) {
+			t.Errorf("%v: apt packages have: %v, want: %v", desc, have.APTPackages, want)
+		}
+		if !reflect.DeepEqual(exec.Executed, test.wantExecuted) {
+			t.Errorf("%v: executed have: %v, want: %v", desc, exec.Executed, test.wantExecuted)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/logger"
@@ -15,9 +17,19 @@ import (
 
 const (
 	stopContainerTimeout = 1
+	// execAttempts is the maximum number of attempts to create an exec, to
+	// handle transient docker daemon errors.
+	execAttempts = 3
+	// execRetryDelay is the delay between exec attempts.
+	execRetryDelay = time.Second
 	// DockerDefaultImage defines the default docker image that can be used
 	// to run checks.
 	DockerDefaultImage = "gopherci/gopherci-env:latest"
+	// dockerGitSSHKeyFile and dockerGitSSHKnownHostsFile are the paths inside
+	// the container the host's GitSSHKeyFile and GitSSHKnownHostsFile are
+	// mounted.
+	dockerGitSSHKeyFile        = "/run/gopherci/ssh/id"
+	dockerGitSSHKnownHostsFile = "/run/gopherci/ssh/known_hosts"
 )
 
 // Docker is an Analyser that provides an Executer to build projects inside
@@ -27,6 +39,48 @@ type Docker struct {
 	image    string
 	client   *docker.Client
 	memLimit int // virtual memory limit in MiB for processes inside container (not container itself).
+
+	// pool contains started containers which haven't been used, ready to be
+	// checked out by any owner, nil if pooling is disabled.
+	pool    chan *docker.Container
+	maxUses int // maxUses is the number of checkouts before a pooled container is recycled.
+	mu      sync.Mutex
+	uses    map[string]int                 // uses is the number of checkouts by container ID.
+	owners  map[string]string              // owners is the owner a used container is reserved for, by container ID.
+	idle    map[string][]*docker.Container // idle are used containers ready to be checked out again, by owner.
+	nIdle   int                            // nIdle is the number of idle containers, at most the pool's size.
+
+	// GitSSHKeyFile is the path on the host to a private key used by git
+	// when cloning over SSH, such as a deploy key for a self-hosted git
+	// server. If GitSSHKnownHostsFile is also set, hosts are verified using
+	// only that file. Both are mounted read only into each container.
+	// Optional, may be set after NewDocker and before EnablePool or use.
+	GitSSHKeyFile        string
+	GitSSHKnownHostsFile string
+
+	// GoModuleEnv is set in the environment of each container, configuring
+	// how dependencies are fetched. Optional, may be set after NewDocker and
+	// before EnablePool or use.
+	GoModuleEnv GoModuleEnv
+
+	// MaxContainers is the maximum number of executers, and therefore
+	// containers, in use concurrently. When reached, NewExecuter blocks until
+	// an executer is stopped, or ContainerWaitTimeout has elapsed. A value of
+	// 0 is unlimited. Optional, may be set after NewDocker and before use.
+	MaxContainers int
+	// ContainerWaitTimeout is the maximum duration NewExecuter blocks waiting
+	// for a container when MaxContainers has been reached. A value of 0 waits
+	// until the context is done. Optional.
+	ContainerWaitTimeout time.Duration
+
+	// KeepOnFailure keeps the container of a failed analysis when its
+	// executer is retained, instead of removing it or returning it to the
+	// pool. Kept containers must be removed manually. Optional, may be set
+	// after NewDocker and before use.
+	KeepOnFailure bool
+
+	slotsOnce sync.Once
+	slots     chan struct{} // slots has a value for each executer in use, if MaxContainers > 0.
 }
 
 // Ensure Docker implements Analyser interface.
@@ -58,55 +112,326 @@ func NewDocker(logger logger.Logger, imageName string, memLimit int) (*Docker, e
 	return &Docker{logger: logger, image: imageName, client: client, memLimit: memLimit}, nil
 }
 
+// EnablePool starts size containers which are kept warm and checked out by
+// NewExecuter instead of creating a new container for each executer.
+//
+// A container is reserved for the owner of the first repository it analyses,
+// such as github.com/owner, so state such as installed packages never leaks
+// between owners, and therefore installations. When an executer is stopped
+// its workspace is removed and the container is kept idle for the owner's
+// next analysis, up to size idle containers for all owners. After maxUses
+// checkouts the container is destroyed to limit state leaking between the
+// owner's analyses. A checked out unused container is replaced in the
+// background.
+func (d *Docker) EnablePool(ctx context.Context, size, maxUses int) error {
+	if size <= 0 {
+		return nil
+	}
+	if maxUses <= 0 {
+		maxUses = 1
+	}
+	d.pool = make(chan *docker.Container, size)
+	d.maxUses = maxUses
+	d.uses = make(map[string]int)
+	d.owners = make(map[string]string)
+	d.idle = make(map[string][]*docker.Container)
+
+	for i := 0; i < size; i++ {
+		container, err := d.startContainer(ctx)
+		if err != nil {
+			d.Close(ctx)
+			return errors.Wrap(err, "could not fill pool")
+		}
+		d.pool <- container
+	}
+	d.logger.Infof("started pool of %d containers, recycling after %d uses", size, maxUses)
+	return nil
+}
+
+// Close stops and removes all idle and unused containers in the pool.
+func (d *Docker) Close(ctx context.Context) error {
+	if d.pool == nil {
+		return nil
+	}
+	d.mu.Lock()
+	idle := d.idle
+	d.idle = make(map[string][]*docker.Container)
+	d.nIdle = 0
+	d.mu.Unlock()
+	for _, containers := range idle {
+		for _, container := range containers {
+			d.removeContainer(ctx, d.logger.With("containerID", container.ID), container.ID)
+		}
+	}
+	for {
+		select {
+		case container := <-d.pool:
+			d.removeContainer(ctx, d.logger.With("containerID", container.ID), container.ID)
+		default:
+			return nil
+		}
+	}
+}
+
+// startContainer creates and starts a new container.
+func (d *Docker) startContainer(ctx context.Context) (*docker.Container, error) {
+	name := fmt.Sprintf("goperci-%d", time.Now().UnixNano())
+
+	// Create container
+	container, err := d.client.CreateContainer(d.createOptions(ctx, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create container")
+	}
+	logger := d.logger.With("containerID", container.ID)
+	logger.Info("created container")
+
+	// Start container
+	if err := d.client.StartContainerWithContext(container.ID, nil, ctx); err != nil {
+		d.removeContainer(ctx, logger, container.ID)
+		return nil, errors.Wrap(err, "could not start container")
+	}
+	logger.Info("started container")
+
+	return container, nil
+}
+
+// createOptions returns the options to create a container called name.
+func (d *Docker) createOptions(ctx context.Context, name string) docker.CreateContainerOptions {
+	options := docker.CreateContainerOptions{
+		Name:    name,
+		Config:  &docker.Config{Image: d.image, Env: d.GoModuleEnv.environ()},
+		Context: ctx,
+	}
+	if d.GitSSHKeyFile == "" {
+		return options
+	}
+
+	var knownHostsFile string
+	binds := []string{d.GitSSHKeyFile + ":" + dockerGitSSHKeyFile + ":ro"}
+	if d.GitSSHKnownHostsFile != "" {
+		knownHostsFile = dockerGitSSHKnownHostsFile
+		binds = append(binds, d.GitSSHKnownHostsFile+":"+dockerGitSSHKnownHostsFile+":ro")
+	}
+	options.Config.Env = append(gitSSHEnv(dockerGitSSHKeyFile, knownHostsFile), options.Config.Env...)
+	options.HostConfig = &docker.HostConfig{Binds: binds}
+	return options
+}
+
+// removeContainer stops and removes a container ignoring any errors.
+func (d *Docker) removeContainer(ctx context.Context, logger logger.Logger, containerID string) {
+	err := d.client.StopContainerWithContext(containerID, stopContainerTimeout, ctx)
+	if err != nil {
+		logger.With("error", err).Error("could not stop container")
+		// Ignore the error and try to delete the container anyway
+	}
+
+	err = d.client.RemoveContainer(docker.RemoveContainerOptions{
+		ID:            containerID,
+		RemoveVolumes: true,
+		Force:         true,
+		Context:       ctx,
+	})
+	if err != nil {
+		logger.With("error", err).Error("could not remove container")
+	}
+}
+
+// checkout returns an idle container reserved for owner, else an unused
+// container from the pool, or nil if pooling is disabled or no containers are
+// available.
+func (d *Docker) checkout(owner string) *docker.Container {
+	if d.pool == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	if idle := d.idle[owner]; len(idle) > 0 {
+		container := idle[len(idle)-1]
+		if len(idle) == 1 {
+			delete(d.idle, owner)
+		} else {
+			d.idle[owner] = idle[:len(idle)-1]
+		}
+		d.nIdle--
+		d.uses[container.ID]++
+		d.mu.Unlock()
+		return container
+	}
+	d.mu.Unlock()
+
+	select {
+	case container := <-d.pool:
+		d.mu.Lock()
+		d.uses[container.ID]++
+		d.owners[container.ID] = owner
+		d.mu.Unlock()
+		go d.replenish()
+		return container
+	default:
+		return nil
+	}
+}
+
+// checkin keeps an executer's container idle for its owner after removing the
+// project's workspace. Returns false if the container was not kept and should
+// be destroyed, such as when it has been recycled.
+func (d *Docker) checkin(ctx context.Context, e *DockerExecuter) bool {
+	if d.pool == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	uses, pooled := d.uses[e.container.ID]
+	owner := d.owners[e.container.ID]
+	d.mu.Unlock()
+
+	if !pooled {
+		// Created when the pool was empty, let it be destroyed.
+		return false
+	}
+	if uses >= d.maxUses {
+		e.logger.Infof("recycling container after %d uses", uses)
+		d.forget(e.container.ID)
+		return false
+	}
+
+	args := []string{"rm", "-rf", e.projPath}
+	if out, err := e.Execute(ctx, args); err != nil {
+		e.logger.With("error", err).Errorf("could not reset workspace, output: %q", out)
+		d.forget(e.container.ID)
+		return false
+	}
+
+	d.mu.Lock()
+	if d.nIdle >= cap(d.pool) {
+		d.mu.Unlock()
+		d.forget(e.container.ID)
+		return false
+	}
+	d.idle[owner] = append(d.idle[owner], e.container)
+	d.nIdle++
+	d.mu.Unlock()
+	e.logger.Infof("returned container to pool for %v", owner)
+	return true
+}
+
+// forget removes a container from the pool's records, so it's destroyed.
+func (d *Docker) forget(containerID string) {
+	d.mu.Lock()
+	delete(d.uses, containerID)
+	delete(d.owners, containerID)
+	d.mu.Unlock()
+}
+
+// replenish starts a new unused container and adds it to the pool, it does
+// not block if the pool is full.
+func (d *Docker) replenish() {
+	ctx := context.Background()
+	container, err := d.startContainer(ctx)
+	if err != nil {
+		d.logger.With("error", err).Error("could not replenish pool")
+		return
+	}
+	d.mu.Lock()
+	d.uses[container.ID] = 0
+	d.mu.Unlock()
+
+	select {
+	case d.pool <- container:
+	default:
+		d.forget(container.ID)
+		d.removeContainer(ctx, d.logger.With("containerID", container.ID), container.ID)
+	}
+}
+
+// acquire reserves a container for a new executer, blocking until one is
+// available if MaxContainers has been reached. Returns an error with the cause
+// ErrQuotaExceeded if ContainerWaitTimeout elapses first.
+func (d *Docker) acquire(ctx context.Context) error {
+	if d.MaxContainers <= 0 {
+		return nil
+	}
+	d.slotsOnce.Do(func() {
+		d.slots = make(chan struct{}, d.MaxContainers)
+	})
+
+	select {
+	case d.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	d.logger.Infof("waiting for one of %d containers", d.MaxContainers)
+
+	var timeout <-chan time.Time
+	if d.ContainerWaitTimeout > 0 {
+		timer := time.NewTimer(d.ContainerWaitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case d.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return errors.Wrapf(ErrQuotaExceeded, "timed out after %v waiting for one of %d containers", d.ContainerWaitTimeout, d.MaxContainers)
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "could not wait for container")
+	}
+}
+
+// release releases a container reserved by acquire.
+func (d *Docker) release() {
+	if d.slots != nil {
+		<-d.slots
+	}
+}
+
 // DockerExecuter is an Executer that runs commands in a contained
 // environment for a single project.
 type DockerExecuter struct {
 	logger    logger.Logger
+	docker    *Docker
 	client    *docker.Client
 	container *docker.Container
 	projPath  string // path to project
 	memLimit  int    // virtual memory limit in MiB for processes
+	stopOnce  sync.Once
+	retain    bool // retain keeps the container when stopped
 }
 
-// NewExecuter implements Analyser interface by creating and starting a
-// docker container.
+// NewExecuter implements Analyser interface by checking out a container from
+// the pool for the owner of goSrcPath, or if unavailable, creating and
+// starting a docker container. If MaxContainers has been reached, NewExecuter
+// blocks until a container is available, see acquire.
 func (d *Docker) NewExecuter(ctx context.Context, goSrcPath string) (Executer, error) {
+	if err := d.acquire(ctx); err != nil {
+		return nil, err
+	}
 	exec := &DockerExecuter{
 		logger:   d.logger,
+		docker:   d,
 		client:   d.client,
 		projPath: filepath.Join("$GOPATH", "src", goSrcPath),
 		memLimit: d.memLimit,
 	}
 
-	name := fmt.Sprintf("goperci-%d", time.Now().UnixNano())
-
-	createOptions := docker.CreateContainerOptions{
-		Name:    name,
-		Config:  &docker.Config{Image: d.image},
-		Context: ctx,
-	}
-
-	// Create container
-	var err error
-	exec.container, err = d.client.CreateContainer(createOptions)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not create container")
-	}
-	exec.logger = d.logger.With("containerID", exec.container.ID)
-	exec.logger.Info("created container")
-
-	// Start container
-	if err := d.client.StartContainerWithContext(exec.container.ID, nil, ctx); err != nil {
-		exec.Stop(ctx)
-		return nil, errors.Wrap(err, "could not start container")
+	if exec.container = d.checkout(path.Dir(goSrcPath)); exec.container != nil {
+		exec.logger = d.logger.With("containerID", exec.container.ID)
+		exec.logger.Info("checked out container from pool")
+	} else {
+		var err error
+		exec.container, err = d.startContainer(ctx)
+		if err != nil {
+			d.release()
+			return nil, err
+		}
+		exec.logger = d.logger.With("containerID", exec.container.ID)
 	}
-	exec.logger.Info("started container")
 
 	// Make required directories to clone into see bug in #16
 	args := []string{"mkdir", "-p", exec.projPath}
 	if out, err := exec.Execute(ctx, args); err != nil {
 		exec.Stop(ctx)
-		return nil, errors.Wrap(err, fmt.Sprintf("could not execute %v, output: %q", args, out))
+		return nil, execError(args, err, out)
 	}
 
 	return exec, nil
@@ -115,6 +440,11 @@ func (d *Docker) NewExecuter(ctx context.Context, goSrcPath string) (Executer, e
 // Execute implements the Executer interface and runs commands inside a
 // docker container.
 func (e *DockerExecuter) Execute(ctx context.Context, args []string) ([]byte, error) {
+	return e.ExecuteEnv(ctx, nil, args)
+}
+
+// ExecuteEnv implements the EnvExecuter interface.
+func (e *DockerExecuter) ExecuteEnv(ctx context.Context, env []string, args []string) ([]byte, error) {
 	cmds := []string{
 		// Set memory limit for the running process.
 		fmt.Sprintf("ulimit -v %d", e.memLimit*1024),
@@ -128,14 +458,26 @@ func (e *DockerExecuter) Execute(ctx context.Context, args []string) ([]byte, er
 		AttachStdout: true,
 		AttachStderr: true,
 		Cmd:          cmd,
+		Env:          env,
 		Container:    e.container.ID,
 	}
 
-	exec, err := e.client.CreateExec(createOptions)
+	// Only creating the exec is retried, as once started the command may have
+	// run, and it's not safe to run again, such as a Fixer's push.
+	var exec *docker.Exec
+	err := retry(ctx, execAttempts, execRetryDelay, func() error {
+		var err error
+		exec, err = e.client.CreateExec(createOptions)
+		return errors.Wrap(err, fmt.Sprintf("could not create exec for containerID %v", e.container.ID))
+	}, func(attempt int, err error) {
+		e.logger.With("error", err).Infof("retrying create exec attempt %d for containerID %v", attempt, e.container.ID)
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("could not create exec for containerID %v", e.container.ID))
+		return nil, err
 	}
-	e.logger.Infof("created exec for cmd: %v", exec, cmd)
+	// The cmd isn't logged as it may contain credentials, such as a Fixer's
+	// push URL.
+	e.logger.Infof("created exec %v", exec.ID)
 
 	var buf bytes.Buffer
 	startOptions := docker.StartExecOptions{
@@ -156,29 +498,56 @@ func (e *DockerExecuter) Execute(ctx context.Context, args []string) ([]byte, er
 		return nil, errors.Wrap(err, fmt.Sprintf("could not inspect exec for containerID %v", e.container.ID))
 	}
 	if inspect.ExitCode != 0 {
-		return buf.Bytes(), &NonZeroError{ExitCode: inspect.ExitCode, args: args}
+		return buf.Bytes(), &NonZeroError{ExitCode: inspect.ExitCode, OutOfMemory: outOfMemory(inspect.ExitCode, buf.Bytes()), Output: buf.Bytes(), args: args}
 	}
 
 	return buf.Bytes(), nil
 }
 
-// Stop stops and removes a container ignoring any errors.
+// Stop returns the container to the pool if pooling is enabled, else stops
+// and removes a container ignoring any errors. The container is released for
+// other executers even if it could not be removed.
 func (e *DockerExecuter) Stop(ctx context.Context) error {
-	err := e.client.StopContainerWithContext(e.container.ID, stopContainerTimeout, ctx)
-	if err != nil {
-		e.logger.With("error", err).Error("could not stop container")
-		// Ignore the error and try to delete the container anyway
+	defer e.stopOnce.Do(e.docker.release)
+	if e.retain {
+		return nil
+	}
+	if e.docker.checkin(ctx, e) {
+		return nil
 	}
+	e.docker.removeContainer(ctx, e.logger, e.container.ID)
+	return nil
+}
 
-	err = e.client.RemoveContainer(docker.RemoveContainerOptions{
-		ID:            e.container.ID,
-		RemoveVolumes: true,
-		Force:         true,
-		Context:       ctx,
-	})
-	if err != nil {
-		e.logger.With("error", err).Error("could not remove container")
+// Retain implements the Retainer interface, the container's ID is returned if
+// Docker.KeepOnFailure is set. A retained container is neither returned to the
+// pool nor removed when stopped.
+func (e *DockerExecuter) Retain() (string, bool) {
+	if !e.docker.KeepOnFailure || e.container == nil {
+		return "", false
 	}
+	e.retain = true
+	return e.container.ID, true
+}
 
-	return nil
+// retry calls fn up to attempts times until it returns nil, waiting delay
+// between each attempt and calling onRetry before each retry. Returns the last
+// error from fn, or the context's error if it's done before retrying.
+func retry(ctx context.Context, attempts int, delay time.Duration, fn func() error, onRetry func(attempt int, err error)) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		onRetry(attempt+1, err)
+	}
+	return err
 }
@@ -3,10 +3,13 @@ package analyser
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/pkg/errors"
 )
 
 func TestDocker(t *testing.T) {
@@ -51,9 +54,212 @@ func TestDocker(t *testing.T) {
 	if !strings.HasSuffix(err.Error(), wantSuffix) {
 		t.Errorf("\nwantSuffix: %q\nhave: %q", wantSuffix, err)
 	}
+	if nzErr, ok := err.(*NonZeroError); !ok || string(nzErr.Output) != "error\n" {
+		t.Errorf("have error: %#v, want: NonZeroError with output %q", err, "error\n")
+	}
 
 	err = exec.Stop(ctx)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+func TestDocker_pool(t *testing.T) {
+	docker, err := NewDocker(logger.Testing(), DockerDefaultImage, 512)
+	if err != nil {
+		t.Fatalf("unexpected error initialising docker: %v", err)
+	}
+	ctx := context.Background()
+	defer docker.Close(ctx)
+
+	const maxUses = 2
+	if err := docker.EnablePool(ctx, 1, maxUses); err != nil {
+		t.Fatalf("unexpected error enabling pool: %v", err)
+	}
+	if have, want := len(docker.pool), 1; have != want {
+		t.Fatalf("pool size have: %v, want: %v", have, want)
+	}
+
+	// First use checks out the warm container, reserving it for the owner
+	exec1, err := docker.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+	containerID := exec1.(*DockerExecuter).container.ID
+	if _, err := exec1.Execute(ctx, []string{"touch", "leaked"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := exec1.Stop(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have, want := len(docker.idle["github.com/gopherci"]), 1; have != want {
+		t.Fatalf("idle containers after return have: %v, want: %v", have, want)
+	}
+
+	// Another owner never gets the reserved container
+	other, err := docker.NewExecuter(ctx, "github.com/other/repo")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+	if have := other.(*DockerExecuter).container.ID; have == containerID {
+		t.Errorf("container ID have: %v, want another owner's container", have)
+	}
+	if err := other.Stop(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Second use by the owner gets the same container with a clean workspace
+	exec2, err := docker.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+	if have := exec2.(*DockerExecuter).container.ID; have != containerID {
+		t.Errorf("container ID have: %v, want: %v", have, containerID)
+	}
+	out, err := exec2.Execute(ctx, []string{"ls"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("workspace not reset, have: %q", out)
+	}
+	if err := exec2.Stop(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Container has reached maxUses so is replaced with a new container
+	exec3, err := docker.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+	defer exec3.Stop(ctx)
+	if have := exec3.(*DockerExecuter).container.ID; have == containerID {
+		t.Errorf("container ID have: %v, want recycled container", have)
+	}
+}
+
+func TestDocker_maxContainers(t *testing.T) {
+	docker, err := NewDocker(logger.Testing(), DockerDefaultImage, 512)
+	if err != nil {
+		t.Fatalf("unexpected error initialising docker: %v", err)
+	}
+	docker.MaxContainers = 1
+	docker.ContainerWaitTimeout = 100 * time.Millisecond
+	ctx := context.Background()
+
+	exec1, err := docker.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+
+	// Limit reached, times out
+	_, err = docker.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if errors.Cause(err) != ErrQuotaExceeded {
+		t.Fatalf("have error: %v, want: %v", err, ErrQuotaExceeded)
+	}
+
+	// Limit reached, blocks until the first executer is stopped
+	docker.ContainerWaitTimeout = 0
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		exec1.Stop(ctx)
+	}()
+	exec2, err := docker.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error in new executer: %v", err)
+	}
+	if err := exec2.Stop(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have := len(docker.slots); have != 0 {
+		t.Errorf("containers in use have: %v, want: 0", have)
+	}
+}
+
+func TestDocker_createOptions(t *testing.T) {
+	ctx := context.Background()
+	d := &Docker{image: DockerDefaultImage}
+
+	options := d.createOptions(ctx, "name")
+	if options.Config.Env != nil || options.HostConfig != nil {
+		t.Errorf("unexpected env %q or host config %+v without a key", options.Config.Env, options.HostConfig)
+	}
+
+	d.GitSSHKeyFile = "/id_rsa"
+	d.GitSSHKnownHostsFile = "/known_hosts"
+	options = d.createOptions(ctx, "name")
+
+	wantEnv := []string{"GIT_SSH_COMMAND=ssh -i /run/gopherci/ssh/id -o IdentitiesOnly=yes -o UserKnownHostsFile=/run/gopherci/ssh/known_hosts"}
+	if !reflect.DeepEqual(options.Config.Env, wantEnv) {
+		t.Errorf("env\nhave: %q\nwant: %q", options.Config.Env, wantEnv)
+	}
+	wantBinds := []string{"/id_rsa:/run/gopherci/ssh/id:ro", "/known_hosts:/run/gopherci/ssh/known_hosts:ro"}
+	if options.HostConfig == nil || !reflect.DeepEqual(options.HostConfig.Binds, wantBinds) {
+		t.Errorf("binds\nhave: %+v\nwant: %q", options.HostConfig, wantBinds)
+	}
+
+	d.GoModuleEnv = GoModuleEnv{Proxy: "https://proxy.example.com", Private: "git.example.com"}
+	options = d.createOptions(ctx, "name")
+
+	wantEnv = append(wantEnv, "GOPROXY=https://proxy.example.com", "GOPRIVATE=git.example.com")
+	if !reflect.DeepEqual(options.Config.Env, wantEnv) {
+		t.Errorf("env with module env\nhave: %q\nwant: %q", options.Config.Env, wantEnv)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transient := errors.New("transient")
+
+	tests := []struct {
+		failures    int // failures is the number of times fn fails before succeeding
+		wantErr     error
+		wantCalls   int
+		wantRetries []int
+	}{
+		{failures: 0, wantErr: nil, wantCalls: 1},
+		{failures: 2, wantErr: nil, wantCalls: 3, wantRetries: []int{2, 3}},
+		{failures: 5, wantErr: transient, wantCalls: 3, wantRetries: []int{2, 3}},
+	}
+
+	for _, test := range tests {
+		var (
+			calls   int
+			retries []int
+		)
+		err := retry(context.Background(), 3, time.Millisecond, func() error {
+			calls++
+			if calls <= test.failures {
+				return transient
+			}
+			return nil
+		}, func(attempt int, err error) {
+			retries = append(retries, attempt)
+		})
+		if err != test.wantErr {
+			t.Errorf("failures %v: err have: %v, want: %v", test.failures, err, test.wantErr)
+		}
+		if calls != test.wantCalls {
+			t.Errorf("failures %v: calls have: %v, want: %v", test.failures, calls, test.wantCalls)
+		}
+		if !reflect.DeepEqual(retries, test.wantRetries) {
+			t.Errorf("failures %v: retries have: %v, want: %v", test.failures, retries, test.wantRetries)
+		}
+	}
+}
+
+func TestRetry_contextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int
+	err := retry(ctx, 3, time.Hour, func() error {
+		calls++
+		return errors.New("transient")
+	}, func(int, error) {})
+	if err != context.Canceled {
+		t.Errorf("err have: %v, want: %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("calls have: %v, want: 1", calls)
+	}
+}
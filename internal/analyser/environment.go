@@ -0,0 +1,87 @@
+package analyser
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+// GoModuleEnv is the environment used by the go command when fetching
+// modules, such as when installing dependencies. Blank values are not set,
+// so the environment's defaults are used.
+type GoModuleEnv struct {
+	// Proxy is GOPROXY, the module proxies modules are fetched from.
+	Proxy string
+	// NoSumDB is GONOSUMDB, the module path patterns which are not verified
+	// using the checksum database.
+	NoSumDB string
+	// Private is GOPRIVATE, the module path patterns of private modules, such
+	// as those fetched from a self-hosted git server, which are fetched
+	// directly and not verified using the checksum database.
+	Private string
+}
+
+// environ returns the environment variables of e's non-blank values, or nil
+// if all are blank.
+func (e GoModuleEnv) environ() []string {
+	var env []string
+	for _, v := range []struct{ key, value string }{
+		{"GOPROXY", e.Proxy},
+		{"GONOSUMDB", e.NoSumDB},
+		{"GOPRIVATE", e.Private},
+	} {
+		if v.value != "" {
+			env = append(env, v.key+"="+v.value)
+		}
+	}
+	return env
+}
+
+// parseGoVersion parses the output of go version, such as "go version go1.9
+// linux/amd64", and returns the version "go1.9". Returns a blank string if
+// the version could not be found.
+func parseGoVersion(out []byte) string {
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 || fields[0] != "go" || fields[1] != "version" {
+		return ""
+	}
+	return fields[2]
+}
+
+// parseLimits parses the output of /proc/self/limits and returns a map of
+// limit name, such as "Max open files", to the soft limit, such as "1024".
+func parseLimits(out []byte) map[string]string {
+	limits := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// The limit name may contain spaces, but columns are separated by
+		// at least two spaces.
+		var fields []string
+		for _, field := range strings.Split(scanner.Text(), "  ") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) < 2 || fields[0] == "Limit" {
+			continue
+		}
+		limits[fields[0]] = fields[1]
+	}
+	return limits
+}
+
+// recordEnvironment records the output of an environment command args into
+// the analysis, ignoring unknown commands.
+func recordEnvironment(analysis *db.Analysis, args []string, out []byte) {
+	switch strings.Join(args, " ") {
+	case "go version":
+		analysis.GoVersion = parseGoVersion(out)
+	case "cat /proc/self/limits":
+		limits := parseLimits(out)
+		analysis.MaxAddressSpace = limits["Max address space"]
+		analysis.MaxOpenFiles = limits["Max open files"]
+		analysis.MaxProcesses = limits["Max processes"]
+	}
+}
@@ -0,0 +1,71 @@
+package analyser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+func TestGoModuleEnv_environ(t *testing.T) {
+	tests := []struct {
+		env  GoModuleEnv
+		want []string
+	}{
+		{GoModuleEnv{}, nil},
+		{GoModuleEnv{Proxy: "off"}, []string{"GOPROXY=off"}},
+		{
+			GoModuleEnv{Proxy: "https://proxy.example.com", NoSumDB: "example.com", Private: "git.example.com/*"},
+			[]string{"GOPROXY=https://proxy.example.com", "GONOSUMDB=example.com", "GOPRIVATE=git.example.com/*"},
+		},
+	}
+
+	for _, test := range tests {
+		if have := test.env.environ(); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%+v\nhave: %q\nwant: %q", test.env, have, test.want)
+		}
+	}
+}
+
+func TestParseGoVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"go version go1.9 linux/amd64\n", "go1.9"},
+		{"go version go1.9.2 darwin/amd64", "go1.9.2"},
+		{"go version devel +4a5fa3f Wed Oct 11 20:14:30 2017 +0000 linux/amd64", "devel"},
+		{"bash: go: command not found", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if have := parseGoVersion([]byte(test.out)); have != test.want {
+			t.Errorf("out: %q have: %q want: %q", test.out, have, test.want)
+		}
+	}
+}
+
+func TestRecordEnvironment(t *testing.T) {
+	limits := []byte(`Limit                     Soft Limit           Hard Limit           Units     
+Max cpu time              unlimited            unlimited            seconds   
+Max processes             63704                63704                processes 
+Max open files            1024                 4096                 files     
+Max address space         524288000            unlimited            bytes     
+`)
+
+	analysis := db.NewAnalysis()
+	recordEnvironment(analysis, []string{"go", "version"}, []byte("go version go1.9 linux/amd64\n"))
+	recordEnvironment(analysis, []string{"cat", "/proc/self/limits"}, limits)
+	recordEnvironment(analysis, []string{"go", "env"}, []byte("GOPATH=/go"))
+
+	want := db.NewAnalysis()
+	want.GoVersion = "go1.9"
+	want.MaxAddressSpace = "524288000"
+	want.MaxOpenFiles = "1024"
+	want.MaxProcesses = "63704"
+
+	if !reflect.DeepEqual(analysis, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", analysis, want)
+	}
+}
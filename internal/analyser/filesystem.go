@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -24,8 +25,43 @@ import (
 type FileSystem struct {
 	base     string // base is the base dir all projects have in common
 	memLimit int    // virtual memory limit in MiB for processes
+
+	// MaxWorkspaces is the maximum number of concurrent executers, new
+	// executers are rejected when reached. A value of 0 is unlimited.
+	// Optional, may be set after NewFileSystem and before use.
+	MaxWorkspaces int
+
+	// MaxDiskUsage is the maximum bytes used by base before new executers
+	// are rejected. A value of 0 is unlimited. Optional, may be set after
+	// NewFileSystem and before use.
+	MaxDiskUsage int64
+
+	// GitSSHKeyFile is the path to a private key used by git when cloning
+	// over SSH, such as a deploy key for a self-hosted git server. If
+	// GitSSHKnownHostsFile is also set, hosts are verified using only that
+	// file. Optional, may be set after NewFileSystem and before use.
+	GitSSHKeyFile        string
+	GitSSHKnownHostsFile string
+
+	// GoModuleEnv is set in the environment of every command, configuring
+	// how dependencies are fetched. Optional, may be set after NewFileSystem
+	// and before use.
+	GoModuleEnv GoModuleEnv
+
+	// KeepOnFailure keeps the workspace of a failed analysis when its
+	// executer is retained, instead of removing it. Kept workspaces still
+	// count towards MaxDiskUsage. Optional, may be set after NewFileSystem
+	// and before use.
+	KeepOnFailure bool
+
+	mu         sync.Mutex
+	workspaces int // workspaces is the number of executers not yet stopped
 }
 
+// ErrQuotaExceeded is returned when a new executer cannot be created as the
+// analyser's workspace, disk or container quota has been reached.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
 // Ensure FileSystem implements Analyser
 var _ Analyser = (*FileSystem)(nil)
 
@@ -40,25 +76,92 @@ func NewFileSystem(base string, memLimit int) (*FileSystem, error) {
 	return fs, nil
 }
 
-// NewExecuter implements the Analyser interface
+// NewExecuter implements the Analyser interface, returns an error with the
+// cause ErrQuotaExceeded if MaxWorkspaces or MaxDiskUsage has been reached.
 func (fs *FileSystem) NewExecuter(_ context.Context, goSrcPath string) (Executer, error) {
-	e := &FileSystemExecuter{memLimit: fs.memLimit}
+	if err := fs.acquire(); err != nil {
+		return nil, err
+	}
+	e := &FileSystemExecuter{
+		memLimit:      fs.memLimit,
+		env:           append(gitSSHEnv(fs.GitSSHKeyFile, fs.GitSSHKnownHostsFile), fs.GoModuleEnv.environ()...),
+		release:       fs.release,
+		keepOnFailure: fs.KeepOnFailure,
+	}
 	if err := e.mktemp(fs.base, goSrcPath); err != nil {
+		e.Stop(context.Background())
 		return nil, err
 	}
 	return e, nil
 }
 
+// acquire reserves a workspace, returning an error if a quota has been
+// reached.
+func (fs *FileSystem) acquire() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.MaxWorkspaces > 0 && fs.workspaces >= fs.MaxWorkspaces {
+		return errors.Wrapf(ErrQuotaExceeded, "%d of %d workspaces in use", fs.workspaces, fs.MaxWorkspaces)
+	}
+	if fs.MaxDiskUsage > 0 {
+		usage, err := diskUsage(fs.base)
+		if err != nil {
+			return errors.Wrapf(err, "could not calculate disk usage of %q", fs.base)
+		}
+		if usage >= fs.MaxDiskUsage {
+			return errors.Wrapf(ErrQuotaExceeded, "%d of %d bytes used by %q", usage, fs.MaxDiskUsage, fs.base)
+		}
+	}
+	fs.workspaces++
+	return nil
+}
+
+// release releases a workspace reserved by acquire.
+func (fs *FileSystem) release() {
+	fs.mu.Lock()
+	fs.workspaces--
+	fs.mu.Unlock()
+}
+
+// diskUsage returns the total size in bytes of all files in path.
+func diskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed by a concurrent Stop.
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
 // FileSystemExecuter is an Executer that runs commands in a contained
 // environment.
 type FileSystemExecuter struct {
-	gopath   string // gopath is base/$rand
-	projpath string // projpath is gopath/src/<goSrcPath>
-	memLimit int    // virtual memory limit in MiB for processes
+	gopath   string   // gopath is base/$rand
+	projpath string   // projpath is gopath/src/<goSrcPath>
+	memLimit int      // virtual memory limit in MiB for processes
+	env      []string // env is additional environment variables for processes
+	release  func()   // release the executer's workspace quota, may be nil
+	stopOnce sync.Once
+
+	keepOnFailure bool // keepOnFailure allows the workspace to be retained
+	retain        bool // retain keeps the workspace when stopped
 }
 
-// Ensure FileSystemExecuter implements Executer
-var _ Executer = (*FileSystemExecuter)(nil)
+// Ensure FileSystemExecuter implements Executer and Retainer
+var (
+	_ EnvExecuter = (*FileSystemExecuter)(nil)
+	_ Retainer    = (*FileSystemExecuter)(nil)
+)
 
 func (e *FileSystemExecuter) mktemp(base, goSrcPath string) error {
 	rand := strconv.Itoa(int(time.Now().UnixNano()))
@@ -73,6 +176,11 @@ func (e *FileSystemExecuter) mktemp(base, goSrcPath string) error {
 
 // Execute implements the Executer interface
 func (e *FileSystemExecuter) Execute(ctx context.Context, args []string) ([]byte, error) {
+	return e.ExecuteEnv(ctx, nil, args)
+}
+
+// ExecuteEnv implements the EnvExecuter interface.
+func (e *FileSystemExecuter) ExecuteEnv(ctx context.Context, env []string, args []string) ([]byte, error) {
 	cmds := []string{
 		fmt.Sprintf("ulimit -v %d", e.memLimit*1024),
 		strings.Join(args, " "),
@@ -81,15 +189,39 @@ func (e *FileSystemExecuter) Execute(ctx context.Context, args []string) ([]byte
 	cmd := exec.CommandContext(ctx, "bash")
 	cmd.Args = args
 	cmd.Dir = e.projpath
-	cmd.Env = []string{"GOPATH=" + e.gopath, "PATH=" + os.Getenv("PATH")}
+	cmd.Env = append(append([]string{"GOPATH=" + e.gopath, "PATH=" + os.Getenv("PATH")}, e.env...), env...)
 	out, err := cmd.CombinedOutput()
 	if msg, ok := err.(*exec.ExitError); ok {
-		return out, &NonZeroError{ExitCode: msg.Sys().(syscall.WaitStatus).ExitStatus(), args: args}
+		status := msg.Sys().(syscall.WaitStatus)
+		exitCode := status.ExitStatus()
+		if status.Signaled() {
+			exitCode = 128 + int(status.Signal())
+		}
+		return out, &NonZeroError{ExitCode: exitCode, OutOfMemory: outOfMemory(exitCode, out), Output: out, args: args}
 	}
 	return out, err
 }
 
-// Stop implements the Executer interface
+// Stop implements the Executer interface, the workspace's quota is released
+// even if it could not be removed.
 func (e *FileSystemExecuter) Stop(_ context.Context) error {
+	defer e.stopOnce.Do(func() {
+		if e.release != nil {
+			e.release()
+		}
+	})
+	if e.gopath == "" || e.retain {
+		return nil
+	}
 	return os.RemoveAll(e.gopath)
 }
+
+// Retain implements the Retainer interface, the workspace's path is returned
+// if FileSystem.KeepOnFailure is set.
+func (e *FileSystemExecuter) Retain() (string, bool) {
+	if !e.keepOnFailure || e.gopath == "" {
+		return "", false
+	}
+	e.retain = true
+	return e.gopath, true
+}
@@ -3,8 +3,12 @@ package analyser
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/pkg/errors"
 )
 
 func TestNewFileSystem_notExist(t *testing.T) {
@@ -73,7 +77,265 @@ func TestFileSystem(t *testing.T) {
 
 }
 
+func TestFileSystem_maxWorkspaces(t *testing.T) {
+	base, err := ioutil.TempDir("", "gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(base)
+
+	fs, err := NewFileSystem(base, 512)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs.MaxWorkspaces = 1
+	ctx := context.Background()
+
+	exec, err := fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Quota reached
+	_, err = fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if errors.Cause(err) != ErrQuotaExceeded {
+		t.Fatalf("have error: %v, want: %v", err, ErrQuotaExceeded)
+	}
+
+	// Stopping releases the quota, even if called multiple times
+	exec.Stop(ctx)
+	exec.Stop(ctx)
+
+	exec, err = fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error after stop: %v", err)
+	}
+	defer exec.Stop(ctx)
+
+	if have, want := fs.workspaces, 1; have != want {
+		t.Errorf("workspaces have: %v, want: %v", have, want)
+	}
+}
+
+func TestFileSystem_gitSSH(t *testing.T) {
+	fs, err := NewFileSystem(os.TempDir(), 512)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs.GitSSHKeyFile = "/id_rsa"
+	fs.GitSSHKnownHostsFile = "/known_hosts"
+	ctx := context.Background()
+
+	exec, err := fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer exec.Stop(ctx)
+
+	out, err := exec.Execute(ctx, []string{"echo $GIT_SSH_COMMAND"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if want := "ssh -i /id_rsa -o IdentitiesOnly=yes -o UserKnownHostsFile=/known_hosts\n"; want != string(out) {
+		t.Errorf("\nwant %q\nhave %q", want, out)
+	}
+}
+
+func TestFileSystem_goModuleEnv(t *testing.T) {
+	fs, err := NewFileSystem(os.TempDir(), 512)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs.GoModuleEnv = GoModuleEnv{
+		Proxy:   "https://proxy.example.com,direct",
+		NoSumDB: "example.com/public",
+		Private: "git.example.com",
+	}
+	ctx := context.Background()
+
+	exec, err := fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer exec.Stop(ctx)
+
+	out, err := exec.Execute(ctx, []string{"echo $GOPROXY $GONOSUMDB $GOPRIVATE"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if want := "https://proxy.example.com,direct example.com/public git.example.com\n"; want != string(out) {
+		t.Errorf("\nwant %q\nhave %q", want, out)
+	}
+}
+
+func TestFileSystem_maxDiskUsage(t *testing.T) {
+	base, err := ioutil.TempDir("", "gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(base)
+
+	fs, err := NewFileSystem(base, 512)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs.MaxDiskUsage = 10
+	ctx := context.Background()
+
+	exec, err := fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Use more than the quota
+	file := filepath.Join(exec.(*FileSystemExecuter).projpath, "large")
+	if err := ioutil.WriteFile(file, make([]byte, 20), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if errors.Cause(err) != ErrQuotaExceeded {
+		t.Fatalf("have error: %v, want: %v", err, ErrQuotaExceeded)
+	}
+
+	// Removing the workspace frees the disk
+	exec.Stop(ctx)
+
+	exec, err = fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error after stop: %v", err)
+	}
+	exec.Stop(ctx)
+}
+
+func TestFileSystem_keepOnFailure(t *testing.T) {
+	base, err := ioutil.TempDir("", "gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(base)
+
+	fs, err := NewFileSystem(base, 512)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs.MaxWorkspaces = 1
+	ctx := context.Background()
+
+	// Without the policy, the workspace is always removed
+	exec, err := fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gopath := exec.(*FileSystemExecuter).gopath
+	if location, ok := exec.(Retainer).Retain(); ok {
+		t.Errorf("unexpected retain of %q without keep on failure", location)
+	}
+	exec.Stop(ctx)
+	if exists(gopath) {
+		t.Errorf("expected %q to be removed", gopath)
+	}
+
+	fs.KeepOnFailure = true
+
+	// Successful analyses aren't retained, and are removed
+	exec, err = fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gopath = exec.(*FileSystemExecuter).gopath
+	exec.Stop(ctx)
+	if exists(gopath) {
+		t.Errorf("expected %q to be removed", gopath)
+	}
+
+	// Failed analyses are retained, but the quota is released
+	exec, err = fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gopath = exec.(*FileSystemExecuter).gopath
+	location, ok := exec.(Retainer).Retain()
+	if !ok || location != gopath {
+		t.Errorf("retain have: %q, %v want: %q, true", location, ok, gopath)
+	}
+	if err := exec.Stop(ctx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !exists(gopath) {
+		t.Errorf("expected %q to be kept", gopath)
+	}
+	if have, want := fs.workspaces, 0; have != want {
+		t.Errorf("workspaces have: %v, want: %v", have, want)
+	}
+}
+
 func exists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil || !os.IsNotExist(err)
 }
+
+func TestFileSystemExecuter_outOfMemory(t *testing.T) {
+	fs, err := NewFileSystem(os.TempDir(), 50)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	exec, err := fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer exec.Stop(ctx)
+
+	tests := map[string]struct {
+		args         []string
+		wantExitCode int
+		wantOOM      bool
+	}{
+		"exceeds limit": {[]string{`x=$(head -c 100000000 /dev/zero | tr "\0" a)`}, 2, true},
+		"killed":        {[]string{"kill", "-9", "$$"}, sigkillExitCode, true},
+		"ordinary exit": {[]string{"exit", "1"}, 1, false},
+	}
+
+	for desc, test := range tests {
+		out, err := exec.Execute(ctx, test.args)
+		nzErr, ok := err.(*NonZeroError)
+		if !ok {
+			t.Errorf("%v: have error: %v, want: NonZeroError", desc, err)
+			continue
+		}
+		if nzErr.ExitCode != test.wantExitCode {
+			t.Errorf("%v: exit code have: %v, want: %v", desc, nzErr.ExitCode, test.wantExitCode)
+		}
+		if nzErr.OutOfMemory != test.wantOOM {
+			t.Errorf("%v: out of memory have: %v, want: %v", desc, nzErr.OutOfMemory, test.wantOOM)
+		}
+		if string(nzErr.Output) != string(out) {
+			t.Errorf("%v: output have: %q, want: %q", desc, nzErr.Output, out)
+		}
+	}
+}
+
+func TestFileSystemExecuter_nonZeroOutput(t *testing.T) {
+	fs, err := NewFileSystem(os.TempDir(), 512)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	exec, err := fs.NewExecuter(ctx, "github.com/gopherci/gopherci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer exec.Stop(ctx)
+
+	_, err = exec.Execute(ctx, []string{"echo out; >&2 echo error; exit 3"})
+	nzErr, ok := err.(*NonZeroError)
+	if !ok {
+		t.Fatalf("have error: %v, want: NonZeroError", err)
+	}
+	if want := "out\nerror\n"; string(nzErr.Output) != want {
+		t.Errorf("output have: %q, want: %q", nzErr.Output, want)
+	}
+}
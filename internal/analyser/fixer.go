@@ -0,0 +1,132 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// fixTokenEnv is the environment variable containing a Fixer's Token for the
+// push's credential helper.
+const fixTokenEnv = "GOPHERCI_FIX_TOKEN"
+
+// Fixer runs a tool which fixes issues by modifying the repository's files,
+// such as gofmt -w, then commits and pushes any changes to a branch. Changes
+// are never force pushed, so if the branch has changed since it was cloned,
+// the push is rejected.
+//
+// Only tracked files the tool changed are committed, files already changed
+// before the tool ran, such as by installing dependencies, are not.
+type Fixer struct {
+	Command     []string // Command is the fixer tool and its arguments.
+	PushURL     string   // PushURL is the remote URL, without credentials.
+	Username    string   // Username is the username to push with, if Token is set.
+	Token       string   // Token is the password to push with, may be blank.
+	Branch      string   // Branch is the name of the branch to push to.
+	AuthorName  string
+	AuthorEmail string
+	Message     string // Message is the commit message.
+}
+
+// Fix runs the fixer's command, and if files were changed, commits and pushes
+// the changes. Returns true if a commit was pushed. The Token is passed to git
+// in the push's environment, so exec must be an EnvExecuter.
+func (f *Fixer) Fix(ctx context.Context, exec Executer) (bool, error) {
+	envExec, ok := exec.(EnvExecuter)
+	if !ok {
+		return false, fmt.Errorf("executer %T cannot set the environment to push", exec)
+	}
+
+	_, dirty, err := changedTracked(ctx, exec)
+	if err != nil {
+		return false, err
+	}
+
+	args := quoteArgs(f.Command)
+	out, err := exec.Execute(ctx, args)
+	if err != nil {
+		return false, execError(args, err, out)
+	}
+
+	changed, _, err := changedTracked(ctx, exec)
+	if err != nil {
+		return false, err
+	}
+	var fixed []string
+	for _, file := range changed {
+		if !dirty[file] {
+			fixed = append(fixed, file)
+		}
+	}
+	if len(fixed) == 0 {
+		return false, nil // no changes
+	}
+
+	args = quoteArgs(append([]string{"git", "add", "--"}, fixed...))
+	if out, err := exec.Execute(ctx, args); err != nil {
+		return false, execError(args, err, out)
+	}
+
+	if out, err := exec.Execute(ctx, f.commitArgs()); err != nil {
+		return false, fmt.Errorf("could not git commit: %q", out)
+	}
+
+	var env []string
+	if f.Token != "" {
+		env = []string{fixTokenEnv + "=" + f.Token}
+	}
+	if out, err := envExec.ExecuteEnv(ctx, env, f.pushArgs()); err != nil {
+		// The error isn't included as the output is enough, and the remote
+		// may echo credentials.
+		return false, fmt.Errorf("could not git push: %q", out)
+	}
+	return true, nil
+}
+
+// changedTracked returns the tracked files with uncommitted changes, as a
+// list in git's order, and as a set.
+func changedTracked(ctx context.Context, exec Executer) (files []string, set map[string]bool, err error) {
+	args := []string{"git", "diff", "--name-only", "-z"}
+	out, err := exec.Execute(ctx, args)
+	if err != nil {
+		return nil, nil, execError(args, err, out)
+	}
+	set = make(map[string]bool)
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			files = append(files, file)
+			set[file] = true
+		}
+	}
+	return files, set, nil
+}
+
+// commitArgs returns the arguments to commit the staged changes.
+func (f *Fixer) commitArgs() []string {
+	return quoteArgs([]string{
+		"git", "-c", "user.name=" + f.AuthorName, "-c", "user.email=" + f.AuthorEmail,
+		"commit", "--no-verify", "--message=" + f.Message,
+	})
+}
+
+// pushArgs returns the arguments to push the commit to the branch, without
+// forcing. If Token is set, a credential helper provides it from the
+// environment, so it's in neither the arguments nor the repository's config.
+func (f *Fixer) pushArgs() []string {
+	args := []string{"git"}
+	if f.Token != "" {
+		helper := fmt.Sprintf(`!f() { echo username=%s; echo "password=$%s"; }; f`, shellQuote(f.Username), fixTokenEnv)
+		args = append(args, "-c", "credential.helper=", "-c", "credential.helper="+helper)
+	}
+	args = append(args, "push", f.PushURL, "HEAD:refs/heads/"+f.Branch)
+	return quoteArgs(args)
+}
+
+// quoteArgs returns args with each argument quoted by shellQuote.
+func quoteArgs(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return quoted
+}
@@ -0,0 +1,129 @@
+package analyser
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFixer_fix(t *testing.T) {
+	fixer := &Fixer{
+		Command:     []string{"gofmt", "-w", "."},
+		PushURL:     "https://github.com/owner/repo.git",
+		Username:    "x-access-token",
+		Token:       "token",
+		Branch:      "feature;$(id)",
+		AuthorName:  "GopherCI",
+		AuthorEmail: "noreply@gopherci.io",
+		Message:     "gopherci:autofix",
+	}
+
+	exec := &mockExecuter{
+		ExecuteOut: [][]byte{
+			[]byte("go.sum\x00"), // git diff - install-deps changed go.sum
+			{},                   // gofmt
+			[]byte("go.sum\x00main.go\x00a b.go\x00"), // git diff
+			{}, // git add
+			{}, // git commit
+			{}, // git push
+		},
+		ExecuteErr: []error{nil, nil, nil, nil, nil, nil},
+	}
+
+	pushed, err := fixer.Fix(context.Background(), exec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !pushed {
+		t.Errorf("pushed have: %v, want: true", pushed)
+	}
+
+	want := [][]string{
+		{"git", "diff", "--name-only", "-z"},
+		{"'gofmt'", "'-w'", "'.'"},
+		{"git", "diff", "--name-only", "-z"},
+		{"'git'", "'add'", "'--'", "'main.go'", "'a b.go'"},
+		{"'git'", "'-c'", "'user.name=GopherCI'", "'-c'", "'user.email=noreply@gopherci.io'", "'commit'", "'--no-verify'", "'--message=gopherci:autofix'"},
+		{"'git'", "'-c'", "'credential.helper='", "'-c'", `'credential.helper=!f() { echo username='\''x-access-token'\''; echo "password=$GOPHERCI_FIX_TOKEN"; }; f'`, "'push'", "'https://github.com/owner/repo.git'", `'HEAD:refs/heads/feature;$(id)'`},
+	}
+	if !reflect.DeepEqual(exec.Executed, want) {
+		t.Errorf("executed\nhave: %v\nwant: %v", exec.Executed, want)
+	}
+	if want := [][]string{{"GOPHERCI_FIX_TOKEN=token"}}; !reflect.DeepEqual(exec.Env, want) {
+		t.Errorf("env have: %v, want: %v", exec.Env, want)
+	}
+	for _, args := range exec.Executed {
+		if strings.Contains(strings.Join(args, " "), "token@") {
+			t.Errorf("args contain credentials: %v", args)
+		}
+	}
+}
+
+func TestFixer_noChanges(t *testing.T) {
+	fixer := &Fixer{Command: []string{"gofmt", "-w", "."}, Branch: "feature"}
+
+	exec := &mockExecuter{
+		ExecuteOut: [][]byte{[]byte("go.sum\x00"), {}, []byte("go.sum\x00")},
+		ExecuteErr: []error{nil, nil, nil},
+	}
+
+	pushed, err := fixer.Fix(context.Background(), exec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pushed {
+		t.Errorf("pushed have: %v, want: false", pushed)
+	}
+	if have, want := len(exec.Executed), 3; have != want {
+		t.Errorf("executed %v commands, want: %v", have, want)
+	}
+}
+
+func TestFixer_pushRejected(t *testing.T) {
+	fixer := &Fixer{
+		Command: []string{"gofmt", "-w", "."},
+		PushURL: "https://github.com/owner/repo.git",
+		Token:   "secret",
+		Branch:  "feature",
+	}
+
+	exec := &mockExecuter{
+		ExecuteOut: [][]byte{{}, {}, []byte("main.go\x00"), {}, {}, []byte("! [rejected] HEAD -> feature (fetch first)")},
+		ExecuteErr: []error{nil, nil, nil, nil, nil, &NonZeroError{ExitCode: 1}},
+	}
+
+	pushed, err := fixer.Fix(context.Background(), exec)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if pushed {
+		t.Errorf("pushed have: %v, want: false", pushed)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error contains credentials: %v", err)
+	}
+}
+
+func TestFixer_pushCredentialHelper(t *testing.T) {
+	fixer := &Fixer{Username: "x-access-token", Token: "v1.token"}
+	args := fixer.pushArgs()
+
+	// Unquote the helper as the Executer's bash would, then run it as git
+	// would, with the token in the environment.
+	out, err := exec.Command("bash", "-c", "printf %s "+args[4]).CombinedOutput()
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out)
+	}
+	helper := strings.TrimPrefix(string(out), "credential.helper=!")
+	cmd := exec.Command("sh", "-c", helper)
+	cmd.Env = []string{fixTokenEnv + "=v1.token"}
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out)
+	}
+	if want := "username=x-access-token\npassword=v1.token\n"; string(out) != want {
+		t.Errorf("have: %q, want: %q", out, want)
+	}
+}
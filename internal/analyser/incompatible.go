@@ -0,0 +1,38 @@
+package analyser
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultIncompatibleRegexp matches issues reported by a tool which could not
+// parse or type check the code, likely because the code uses a newer version
+// of Go, such as generics, than the tool supports.
+const DefaultIncompatibleRegexp = `expected '\(', found '\['` + // type parameters
+	`|expected '\]', found` +
+	`|(undeclared name|undefined): (any|comparable)\b` +
+	`|type parameters? (are not supported|requires?)` +
+	`|requires go1\.\d+ or later` +
+	`|file requires newer Go version` +
+	`|unsupported version: \d+` + // export data written by a newer Go
+	`|invalid go version` +
+	`|unknown directive: toolchain`
+
+// defaultIncompatibleRegexp is the compiled DefaultIncompatibleRegexp.
+var defaultIncompatibleRegexp = regexp.MustCompile(DefaultIncompatibleRegexp)
+
+// toolIncompatible returns the error recorded for a tool whose issues
+// indicated it could not parse the code.
+func toolIncompatible(tool string) string {
+	return fmt.Sprintf("tool %s can't parse this code, likely a Go version mismatch", tool)
+}
+
+// isIncompatible returns true if an issue's message matches re, indicating
+// the tool could not parse the code. If re is nil, DefaultIncompatibleRegexp
+// is used.
+func isIncompatible(re *regexp.Regexp, message string) bool {
+	if re == nil {
+		re = defaultIncompatibleRegexp
+	}
+	return re.MatchString(message)
+}
@@ -0,0 +1,38 @@
+package analyser
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestIsIncompatible(t *testing.T) {
+	tests := map[string]bool{
+		"main.go:5:10: expected '(', found '['":                                   true,
+		"main.go:5:15: expected ']', found ':'":                                   true,
+		"main.go:7:6: undeclared name: any":                                       true,
+		"main.go:7:6: undefined: comparable":                                      true,
+		"main.go:3:8: type parameters require go1.18 or later":                    true,
+		"main.go:3:8: type parameter requires go1.18 or later":                    true,
+		"main.go:9:2: predeclared any requires go1.18 or later":                   true,
+		"main.go:1:1: file requires newer Go version go1.22":                      true,
+		"main.go:4:2: could not import fmt (unsupported version: 2)":              true,
+		"go.mod:3: invalid go version '1.21.0': must match format 1.23":           true,
+		"go.mod:5: unknown directive: toolchain":                                  true,
+		"main.go:1:1: exported function Foo should have comment or be unexported": false,
+		"main.go:7:6: undefined: anything":                                        false,
+		"main.go:2:2: error return value not checked":                             false,
+	}
+	for message, want := range tests {
+		if have := isIncompatible(nil, message); have != want {
+			t.Errorf("isIncompatible(nil, %q) have: %v, want: %v", message, have, want)
+		}
+	}
+
+	re := regexp.MustCompile(`unsupported feature`)
+	if !isIncompatible(re, "main.go:1:1: unsupported feature") {
+		t.Error("expected configured regexp to match")
+	}
+	if isIncompatible(re, "main.go:5:10: expected '(', found '['") {
+		t.Error("expected configured regexp to replace the default")
+	}
+}
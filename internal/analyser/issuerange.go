@@ -0,0 +1,32 @@
+package analyser
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// lineRangeRegexp matches a line range in an issue's message, such as "lines
+// 10-40" or "10-40 lines".
+var lineRangeRegexp = regexp.MustCompile(`\blines (\d+)-(\d+)\b|\b(\d+)-(\d+) lines\b`)
+
+// issueEndLine returns the last line of an issue on line whose message
+// describes a range of lines starting at line, such as "function is too long,
+// lines 10-40". Returns 0 if the message does not contain such a range.
+func issueEndLine(message string, line int) int {
+	for _, match := range lineRangeRegexp.FindAllStringSubmatch(message, -1) {
+		start, end := match[1], match[2]
+		if start == "" {
+			start, end = match[3], match[4]
+		}
+		s, err := strconv.Atoi(start)
+		if err != nil || s != line {
+			// Ranges not starting at the issue may refer to other code,
+			// such as the original of a duplicate.
+			continue
+		}
+		if e, err := strconv.Atoi(end); err == nil && e > s {
+			return e
+		}
+	}
+	return 0
+}
@@ -0,0 +1,24 @@
+package analyser
+
+import "testing"
+
+func TestIssueEndLine(t *testing.T) {
+	tests := []struct {
+		message string
+		line    int
+		want    int
+	}{
+		{"function is too long, lines 10-40", 10, 40},
+		{"10-40 lines are duplicate of `other.go:50-80`", 10, 40},
+		{"lines 10-40 are duplicate of lines 50-80", 10, 40},
+		{"duplicate of lines 50-80", 10, 0},
+		{"lines 40-10", 40, 0},
+		{"exported function Foo should have comment", 10, 0},
+		{"lines 10-40", 11, 0},
+	}
+	for _, test := range tests {
+		if have := issueEndLine(test.message, test.line); have != test.want {
+			t.Errorf("issueEndLine(%q, %v) have: %v, want: %v", test.message, test.line, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package analyser
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/bradleyfalzon/revgrep"
+)
+
+// rootModule is the directory of the repository's root module, relative to
+// the repository. The root is analysed as a module even without a go.mod, as
+// repositories using GOPATH have none.
+const rootModule = "."
+
+// discoverModules returns the directories of the Go modules, relative to the
+// repository's root, containing files changed by patch. Modules are found by
+// their go.mod files, ignoring directories ignored by the go command, such as
+// vendor and testdata, and files outside a nested module belong to the root
+// module. The root module is first, followed by the nested modules in order,
+// any exceeding max are skipped with a warning.
+func discoverModules(ctx context.Context, logger logger.Logger, exec Executer, patch []byte, max int) ([]string, error) {
+	args := []string{"git", "ls-files", "--", "go.mod", "*/go.mod"}
+	out, err := exec.Execute(ctx, args)
+	if err != nil {
+		return nil, execError(args, err, out)
+	}
+
+	var nested []string
+	for _, file := range strings.Split(string(out), "\n") {
+		file = strings.TrimSpace(file)
+		if path.Base(file) != "go.mod" {
+			continue
+		}
+		if dir := path.Dir(file); dir != rootModule && !ignoredDir(dir) {
+			nested = append(nested, dir)
+		}
+	}
+	sort.Strings(nested)
+
+	changed := make(map[string]bool) // changed are the modules containing changed files
+	for _, file := range changedFiles(patch) {
+		changed[fileModule(nested, file)] = true
+	}
+
+	var modules []string
+	for _, module := range append([]string{rootModule}, nested...) {
+		if changed[module] {
+			modules = append(modules, module)
+		}
+	}
+	if len(modules) == 0 {
+		// Nothing was changed, such as in tests, analyse the root as before
+		// modules were discovered.
+		return []string{rootModule}, nil
+	}
+	if len(modules) > max {
+		logger.Warnf("skipping %v modules exceeding maximum of %v: %v", len(modules)-max, max, strings.Join(modules[max:], ", "))
+		modules = modules[:max]
+	}
+	return modules, nil
+}
+
+// ignoredDir returns true if dir, or one of its parents, is ignored by the go
+// command when matching packages, such as vendor, testdata, or directories
+// beginning with . or _.
+func ignoredDir(dir string) bool {
+	for _, elem := range strings.Split(dir, "/") {
+		if elem == "vendor" || elem == "testdata" || strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+			return true
+		}
+	}
+	return false
+}
+
+// fileModule returns the module of modules containing file, the deepest
+// module whose directory contains file, or rootModule if none.
+func fileModule(modules []string, file string) string {
+	module := rootModule
+	for _, dir := range modules {
+		if strings.HasPrefix(file, dir+"/") && len(dir) > len(module) {
+			module = dir
+		}
+	}
+	return module
+}
+
+// changedFiles returns the relative paths of the files added or modified by a
+// unified diff patch.
+func changedFiles(patch []byte) []string {
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "+++ b/") {
+			files = append(files, strings.TrimPrefix(line, "+++ b/"))
+		}
+	}
+	return files
+}
+
+// modulePatch returns the diffs of the files in a unified diff patch within
+// the module's directory, with their paths relative to the module, as
+// reported by tools running in the module.
+func modulePatch(patch []byte, module string) []byte {
+	if module == rootModule {
+		return patch
+	}
+	var (
+		buf    bytes.Buffer
+		inDir  bool // inDir is true if the current file's diff is within module
+		prefix = module + "/"
+	)
+	for _, line := range bytes.SplitAfter(patch, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("diff --git ")) {
+			inDir = bytes.Contains(line, []byte(" b/"+prefix))
+		}
+		if !inDir {
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("diff --git ")) || bytes.HasPrefix(line, []byte("--- a/")) || bytes.HasPrefix(line, []byte("+++ b/")) {
+			line = bytes.Replace(line, []byte("a/"+prefix), []byte("a/"), 1)
+			line = bytes.Replace(line, []byte("b/"+prefix), []byte("b/"), 1)
+		}
+		buf.Write(line)
+	}
+	return buf.Bytes()
+}
+
+// moduleExecuter is an Executer executing commands in a module's directory,
+// relative to the working directory of the embedded Executer.
+type moduleExecuter struct {
+	Executer
+	module string
+}
+
+// Execute implements the Executer interface.
+func (e moduleExecuter) Execute(ctx context.Context, args []string) ([]byte, error) {
+	// Executers run args as a bash command line, so the cd prefixes it.
+	return e.Executer.Execute(ctx, append([]string{"cd", shellQuote(e.module), "&&"}, args...))
+}
+
+// inModule returns an Executer executing commands in module's directory.
+func inModule(exec Executer, module string) Executer {
+	if module == rootModule {
+		return exec
+	}
+	return moduleExecuter{Executer: exec, module: module}
+}
+
+// moduleIssues runs tool in each of modules, returning the issues on lines
+// changed by patch, with paths relative to the repository's root, pwd. Issues
+// the root module's run reports in a nested module are dropped, as they're
+// reported by the nested module's run. If wholeNewFiles is true, issues on
+// any line of new files are returned. If offDiff is true, the issues on other
+// lines of the changed files are also returned as offDiffIssues, with a
+// HunkPos of 0. If the tool ran out of memory in any module, oom is true and
+// no issues are returned, as the tool's output is partial.
+func moduleIssues(ctx context.Context, exec Executer, tool db.Tool, replacer *strings.Replacer, modules []string, pwd string, patch []byte, wholeNewFiles, offDiff bool) (issues, offDiffIssues []revgrep.Issue, oom bool, err error) {
+	for _, module := range modules {
+		out, oom, err := runTool(ctx, inModule(exec, module), tool, replacer)
+		if err != nil || oom {
+			return nil, nil, oom, err
+		}
+
+		modPatch := modulePatch(patch, module)
+		checker := revgrep.Checker{
+			AbsPath: path.Join(pwd, module),
+		}
+		var changed []string
+		if offDiff {
+			changed = changedFiles(modPatch)
+		}
+		if wholeNewFiles {
+			// revgrep checks every line of NewFiles only if they're not in
+			// the patch, else just their hunks are checked.
+			checker.NewFiles = newFiles(modPatch)
+			modPatch = withoutFiles(modPatch, checker.NewFiles)
+		}
+		found, err := checkOutput(checker, modPatch, tool, out)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		onDiff := len(found)
+		if offDiff {
+			// Check every line of the changed files, keeping the issues not
+			// on the changed lines.
+			all, err := checkOutput(revgrep.Checker{AbsPath: checker.AbsPath, NewFiles: changed}, nil, tool, out)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			found = append(found, offDiffOnly(found, all)...)
+		}
+		for i, issue := range found {
+			if module == rootModule {
+				if fileModule(modules, issue.File) != rootModule {
+					continue // reported by the nested module's own run
+				}
+			} else {
+				issue.File = path.Join(module, issue.File)
+			}
+			if i >= onDiff {
+				offDiffIssues = append(offDiffIssues, issue)
+				continue
+			}
+			issues = append(issues, issue)
+		}
+	}
+	return issues, offDiffIssues, false, nil
+}
+
+// offDiffOnly returns the issues of all which aren't in onDiff, with a HunkPos
+// of 0.
+func offDiffOnly(onDiff, all []revgrep.Issue) []revgrep.Issue {
+	type key struct {
+		file      string
+		line, col int
+		issue     string
+	}
+	found := make(map[key]bool)
+	for _, issue := range onDiff {
+		found[key{issue.File, issue.LineNo, issue.ColNo, issue.Issue}] = true
+	}
+	var offDiff []revgrep.Issue
+	for _, issue := range all {
+		if found[key{issue.File, issue.LineNo, issue.ColNo, issue.Issue}] {
+			continue
+		}
+		issue.HunkPos = 0
+		offDiff = append(offDiff, issue)
+	}
+	return offDiff
+}
@@ -0,0 +1,270 @@
+package analyser
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+)
+
+// modulesPatch changes files in the root module, and the nested modules api
+// and tools/gen.
+const modulesPatch = `diff --git a/main.go b/main.go
+index 0000000..6362395 100644
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,2 @@
+ package main
++var _ = fmt.Sprintln()
+diff --git a/api/api.go b/api/api.go
+index 0000000..6362395 100644
+--- a/api/api.go
++++ b/api/api.go
+@@ -1,1 +1,2 @@
+ package api
++var _ = fmt.Sprintln()
+diff --git a/tools/gen/main.go b/tools/gen/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/tools/gen/main.go
+@@ -0,0 +1,1 @@
++package main
+`
+
+func TestDiscoverModules(t *testing.T) {
+	goMods := []byte("go.mod\napi/go.mod\napi/v2/go.mod\ntools/gen/go.mod\nvendor/example.com/lib/go.mod\ninternal/testdata/go.mod\n_examples/go.mod\n")
+
+	tests := map[string]struct {
+		patch string
+		max   int
+		want  []string
+	}{
+		"all changed":   {modulesPatch, 10, []string{".", "api", "tools/gen"}},
+		"max":           {modulesPatch, 2, []string{".", "api"}},
+		"nested only":   {modulesPatch[strings.Index(modulesPatch, "diff --git a/api"):], 10, []string{"api", "tools/gen"}},
+		"nothing":       {"", 10, []string{"."}},
+		"deepest first": {"+++ b/api/v2/api.go\n", 10, []string{"api/v2"}},
+		"ignored dirs":  {"+++ b/vendor/example.com/lib/lib.go\n+++ b/_examples/main.go\n", 10, []string{"."}},
+	}
+	for desc, test := range tests {
+		exec := &mockExecuter{
+			ExecuteOut: [][]byte{goMods},
+			ExecuteErr: []error{nil},
+		}
+		have, err := discoverModules(context.Background(), logger.Testing(), exec, []byte(test.patch), test.max)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%v: have: %v, want: %v", desc, have, test.want)
+		}
+		if want := [][]string{{"git", "ls-files", "--", "go.mod", "*/go.mod"}}; !reflect.DeepEqual(exec.Executed, want) {
+			t.Errorf("%v: executed have: %v, want: %v", desc, exec.Executed, want)
+		}
+	}
+}
+
+func TestModulePatch(t *testing.T) {
+	want := `diff --git a/main.go b/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main.go
+@@ -0,0 +1,1 @@
++package main
+`
+	if have := string(modulePatch([]byte(modulesPatch), "tools/gen")); have != want {
+		t.Errorf("have:\n%s\nwant:\n%s", have, want)
+	}
+	if have := string(modulePatch([]byte(modulesPatch), rootModule)); have != modulesPatch {
+		t.Errorf("root module have:\n%s\nwant:\n%s", have, modulesPatch)
+	}
+}
+
+// bashExecuter is an Executer running commands in dir as the docker and
+// filesystem Executers do, by joining args with spaces and running bash.
+type bashExecuter struct {
+	dir string
+}
+
+func (e bashExecuter) Execute(ctx context.Context, args []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "bash", "-c", strings.Join(args, " "))
+	cmd.Dir = e.dir
+	return cmd.CombinedOutput()
+}
+
+func (e bashExecuter) Stop(context.Context) error { return nil }
+
+func TestInModule_bash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopherci-modules")
+	if err != nil {
+		t.Fatalf("could not make temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "tools", "my gen"), 0700); err != nil {
+		t.Fatalf("could not make module dir: %v", err)
+	}
+
+	out, err := inModule(bashExecuter{dir: dir}, "tools/my gen").Execute(context.Background(), []string{"pwd", "&&", "echo", "ok"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out)
+	}
+	if want := filepath.Join(dir, "tools", "my gen") + "\nok\n"; !strings.HasSuffix(string(out), want) {
+		t.Errorf("have: %q, want suffix: %q", out, want)
+	}
+}
+
+func TestModuleIssues(t *testing.T) {
+	exec := &mockExecuter{
+		ExecuteOut: [][]byte{
+			[]byte("main.go:2: root issue\napi/api.go:2: nested module's issue reported by root"), // root
+			[]byte("/go/src/gopherci/api/api.go:2: api issue"),                                    // api, absolute path
+			[]byte("main.go:1: gen issue"),                                                        // tools/gen
+		},
+		ExecuteErr: []error{nil, nil, &NonZeroError{ExitCode: 1}},
+	}
+	tool := db.Tool{Name: "Name1", Path: "tool1", Args: "./..."}
+	modules := []string{".", "api", "tools/gen"}
+
+	issues, _, oom, err := moduleIssues(context.Background(), exec, tool, argReplacer(Config{}, "base-ref"), modules, "/go/src/gopherci", []byte(modulesPatch), false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if oom {
+		t.Errorf("unexpected oom")
+	}
+
+	var have []string
+	for _, issue := range issues {
+		have = append(have, issue.File+": "+issue.Message)
+	}
+	want := []string{
+		"main.go: root issue",
+		"api/api.go: api issue",
+		"tools/gen/main.go: gen issue",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("issues\nhave: %q\nwant: %q", have, want)
+	}
+
+	wantArgs := [][]string{
+		{"tool1", "./..."},
+		{"cd", "'api'", "&&", "tool1", "./..."},
+		{"cd", "'tools/gen'", "&&", "tool1", "./..."},
+	}
+	if !reflect.DeepEqual(exec.Executed, wantArgs) {
+		t.Errorf("executed\nhave: %v\nwant: %v", exec.Executed, wantArgs)
+	}
+}
+
+func TestModuleIssues_outOfMemory(t *testing.T) {
+	exec := &mockExecuter{
+		ExecuteOut: [][]byte{[]byte("main.go:2: root issue"), nil},
+		ExecuteErr: []error{nil, &NonZeroError{ExitCode: sigkillExitCode, OutOfMemory: true}},
+	}
+	tool := db.Tool{Name: "Name1", Path: "tool1"}
+
+	issues, _, oom, err := moduleIssues(context.Background(), exec, tool, argReplacer(Config{}, "base-ref"), []string{".", "api", "tools/gen"}, "/go/src/gopherci", []byte(modulesPatch), false, false)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case !oom:
+		t.Errorf("expected oom")
+	case len(issues) != 0:
+		t.Errorf("have issues: %v, want none", issues)
+	case len(exec.Executed) != 2:
+		t.Errorf("executed %v, want the tool to stop after running out of memory", exec.Executed)
+	}
+}
+
+func TestAnalyse_modules(t *testing.T) {
+	cfg := Config{
+		HeadRef:    "head-branch",
+		MaxModules: 2,
+	}
+
+	exec := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},                   // go env
+			{},                   // go version
+			{},                   // cat /proc/self/limits
+			{},                   // lsb_release --description
+			[]byte(modulesPatch), // git diff
+			[]byte("go.mod\napi/go.mod\ntools/gen/go.mod\n"), // git ls-files
+			{},                              // install-deps.sh
+			{},                              // install-deps.sh in api
+			[]byte(`/go/src/gopherci`),      // pwd
+			{},                              // tool 1 version
+			[]byte("main.go:2: error1"),     // tool 1
+			[]byte("api.go:2: error2"),      // tool 1 in api
+			[]byte("file is not generated"), // isFileGenerated
+			[]byte("file is not generated"), // isFileGenerated
+		},
+		ExecuteErr: []error{
+			nil,                        // go env
+			nil,                        // go version
+			nil,                        // cat /proc/self/limits
+			nil,                        // lsb_release --description
+			nil,                        // git diff
+			nil,                        // git ls-files
+			nil,                        // install-deps.sh
+			nil,                        // install-deps.sh in api
+			nil,                        // pwd
+			nil,                        // tool 1 version
+			nil,                        // tool 1
+			nil,                        // tool 1 in api
+			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
+			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
+		},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{{ID: 1, Name: "Name1", Path: "tool1", Args: "./..."}},
+		},
+	}
+
+	err := Analyse(context.Background(), logger.Testing(), exec, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, cfg, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := []db.Issue{
+		{Path: "main.go", Line: 2, HunkPos: 2, Issue: "Name1: error1"},
+		{Path: "api/api.go", Line: 2, HunkPos: 2, Issue: "Name1: error2"},
+	}
+	if have := analysis.Tools[1].Issues; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected issues\nhave: %+v\nwant: %+v", have, want)
+	}
+
+	wantArgs := [][]string{
+		{"go", "env"},
+		{"go", "version"},
+		{"cat", "/proc/self/limits"},
+		{"lsb_release", "--description"},
+		{"git", "diff", "base-ref...head-branch"},
+		{"git", "ls-files", "--", "go.mod", "*/go.mod"},
+		{"install-deps.sh"},
+		{"cd", "'api'", "&&", "install-deps.sh"},
+		{"pwd"},
+		{"tool1", "--version"},
+		{"tool1", "./..."},
+		{"cd", "'api'", "&&", "tool1", "./..."},
+		{"isFileGenerated", "/go/src/gopherci", "main.go"},
+		{"isFileGenerated", "/go/src/gopherci", "api/api.go"},
+	}
+	if !reflect.DeepEqual(exec.Executed, wantArgs) {
+		t.Errorf("executed\nhave: %v\nwant: %v", exec.Executed, wantArgs)
+	}
+}
@@ -0,0 +1,38 @@
+package analyser
+
+import "context"
+
+// Null is an Analyser which provides an Executer that does not execute any
+// commands, so analyses always complete without finding any issues. It's
+// designed to test a deployment's integration with a code host, without
+// running any tools.
+type Null struct{}
+
+// Ensure Null implements Analyser interface.
+var _ Analyser = (*Null)(nil)
+
+// NewExecuter implements the Analyser interface.
+func (Null) NewExecuter(_ context.Context, _ string) (Executer, error) {
+	return NullExecuter{}, nil
+}
+
+// NullExecuter is an Executer that does not execute any commands.
+type NullExecuter struct{}
+
+// Ensure NullExecuter implements EnvExecuter interface.
+var _ EnvExecuter = (*NullExecuter)(nil)
+
+// Execute implements the Executer interface and returns no output.
+func (NullExecuter) Execute(_ context.Context, _ []string) ([]byte, error) {
+	return nil, nil
+}
+
+// ExecuteEnv implements the EnvExecuter interface and returns no output.
+func (NullExecuter) ExecuteEnv(_ context.Context, _, _ []string) ([]byte, error) {
+	return nil, nil
+}
+
+// Stop implements the Executer interface.
+func (NullExecuter) Stop(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package analyser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/pkg/errors"
+)
+
+// Keys to order issues by, see SortIssues.
+const (
+	OrderSeverity = "severity" // OrderSeverity orders issues by severity, most severe first.
+	OrderPath     = "path"     // OrderPath orders issues by path.
+	OrderLine     = "line"     // OrderLine orders issues by line, then column.
+)
+
+// DefaultIssueOrder is the order of issues used if no order is configured.
+var DefaultIssueOrder = []string{OrderSeverity, OrderPath, OrderLine}
+
+// severityRanks ranks known severities, lower ranks are more severe. Unknown
+// and blank severities are the least severe.
+var severityRanks = map[string]int{
+	"error":   0,
+	"warning": 1,
+	"info":    2,
+}
+
+// severityRank returns the rank of severity, lower ranks are more severe.
+func severityRank(severity string) int {
+	if rank, ok := severityRanks[strings.ToLower(severity)]; ok {
+		return rank
+	}
+	return len(severityRanks)
+}
+
+// ValidateIssueOrder returns an error if order contains an unknown key.
+func ValidateIssueOrder(order []string) error {
+	for _, key := range order {
+		switch key {
+		case OrderSeverity, OrderPath, OrderLine:
+		default:
+			return errors.Errorf("unknown issue order key %q, must be one of %s, %s, %s", key, OrderSeverity, OrderPath, OrderLine)
+		}
+	}
+	return nil
+}
+
+// SortIssues sorts issues by each key in order in turn, so the most important
+// issues are first and Suppress removes the least important. Issues which are
+// equal by every key keep their original order. If order is nil,
+// DefaultIssueOrder is used, unknown keys are ignored.
+func SortIssues(issues []db.Issue, order []string) {
+	if order == nil {
+		order = DefaultIssueOrder
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		for _, key := range order {
+			switch key {
+			case OrderSeverity:
+				if ra, rb := severityRank(a.Severity), severityRank(b.Severity); ra != rb {
+					return ra < rb
+				}
+			case OrderPath:
+				if a.Path != b.Path {
+					return a.Path < b.Path
+				}
+			case OrderLine:
+				if a.Line != b.Line {
+					return a.Line < b.Line
+				}
+				if a.Column != b.Column {
+					return a.Column < b.Column
+				}
+			}
+		}
+		return false
+	})
+}
+
+// ValidateSeverity returns an error if severity is not blank and not a known
+// severity, error, warning or info.
+func ValidateSeverity(severity string) error {
+	if _, ok := severityRanks[strings.ToLower(severity)]; !ok && severity != "" {
+		return errors.Errorf("unknown severity %q, must be one of error, warning, info", severity)
+	}
+	return nil
+}
+
+// FilterSeverity returns the issues at least as severe as min. Issues without
+// a known severity are always returned, as their severity can't be compared.
+// If min is blank, all issues are returned.
+func FilterSeverity(issues []db.Issue, min string) []db.Issue {
+	if min == "" {
+		return issues
+	}
+	var filtered []db.Issue
+	for _, issue := range issues {
+		rank := severityRank(issue.Severity)
+		if rank <= severityRank(min) || rank == len(severityRanks) {
+			filtered = append(filtered, issue)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,136 @@
+package analyser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+func TestSortIssues(t *testing.T) {
+	issues := []db.Issue{
+		{Path: "b.go", Line: 1, Severity: "warning", Issue: "b1 warning"},
+		{Path: "a.go", Line: 2, Column: 2, Issue: "a2:2 blank"},
+		{Path: "a.go", Line: 2, Column: 1, Severity: "Error", Issue: "a2:1 error"},
+		{Path: "b.go", Line: 1, Severity: "error", Issue: "b1 error"},
+		{Path: "a.go", Line: 10, Severity: "custom", Issue: "a10 custom"},
+		{Path: "a.go", Line: 1, Severity: "info", Issue: "a1 info"},
+	}
+
+	tests := map[string]struct {
+		order []string
+		want  []string
+	}{
+		"default": {nil, []string{"a2:1 error", "b1 error", "b1 warning", "a1 info", "a2:2 blank", "a10 custom"}},
+		"path, line": {
+			[]string{OrderPath, OrderLine},
+			[]string{"a1 info", "a2:1 error", "a2:2 blank", "a10 custom", "b1 warning", "b1 error"},
+		},
+		"severity only, stable": {
+			[]string{OrderSeverity},
+			[]string{"a2:1 error", "b1 error", "b1 warning", "a1 info", "a2:2 blank", "a10 custom"},
+		},
+		"empty, unchanged": {
+			[]string{},
+			[]string{"b1 warning", "a2:2 blank", "a2:1 error", "b1 error", "a10 custom", "a1 info"},
+		},
+	}
+
+	for desc, test := range tests {
+		sorted := append([]db.Issue(nil), issues...)
+		SortIssues(sorted, test.order)
+
+		var have []string
+		for _, issue := range sorted {
+			have = append(have, issue.Issue)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%v:\nhave: %v\nwant: %v", desc, have, test.want)
+		}
+	}
+}
+
+func TestSortIssues_suppress(t *testing.T) {
+	var issues []db.Issue
+	for n := 0; n < MaxIssueComments; n++ {
+		issues = append(issues, db.Issue{Path: "a.go", Line: n, Severity: "warning", Issue: "warning"})
+	}
+	issues = append(issues, db.Issue{Path: "z.go", Line: 100, Severity: "error", Issue: "error"})
+
+	SortIssues(issues, nil)
+	suppressed, issues := Suppress(issues, MaxIssueComments)
+
+	if suppressed != 1 {
+		t.Errorf("suppressed have: %v, want: %v", suppressed, 1)
+	}
+	if issues[0].Issue != "error" {
+		t.Errorf("first issue have: %q, want: %q", issues[0].Issue, "error")
+	}
+	if last := issues[len(issues)-1]; last.Line != MaxIssueComments-2 {
+		t.Errorf("last issue line have: %v, want: %v", last.Line, MaxIssueComments-2)
+	}
+}
+
+func TestValidateIssueOrder(t *testing.T) {
+	tests := map[string]struct {
+		order   []string
+		wantErr bool
+	}{
+		"nil":     {nil, false},
+		"default": {DefaultIssueOrder, false},
+		"unknown": {[]string{OrderPath, "tool"}, true},
+	}
+	for desc, test := range tests {
+		err := ValidateIssueOrder(test.order)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case !test.wantErr && err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		}
+	}
+}
+
+func TestValidateSeverity(t *testing.T) {
+	tests := map[string]bool{
+		"":        false,
+		"error":   false,
+		"Warning": false,
+		"info":    false,
+		"fatal":   true,
+	}
+	for severity, wantErr := range tests {
+		err := ValidateSeverity(severity)
+		switch {
+		case wantErr && err == nil:
+			t.Errorf("%q: expected error", severity)
+		case !wantErr && err != nil:
+			t.Errorf("%q: unexpected error: %v", severity, err)
+		}
+	}
+}
+
+func TestFilterSeverity(t *testing.T) {
+	issues := []db.Issue{
+		{Issue: "error", Severity: "error"},
+		{Issue: "warning", Severity: "Warning"},
+		{Issue: "info", Severity: "info"},
+		{Issue: "blank"},
+		{Issue: "unknown", Severity: "style"},
+	}
+	tests := map[string][]string{
+		"":        {"error", "warning", "info", "blank", "unknown"},
+		"info":    {"error", "warning", "info", "blank", "unknown"},
+		"warning": {"error", "warning", "blank", "unknown"},
+		"error":   {"error", "blank", "unknown"},
+	}
+	for min, want := range tests {
+		var have []string
+		for _, issue := range FilterSeverity(issues, min) {
+			have = append(have, issue.Issue)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("%q: have: %v, want: %v", min, have, want)
+		}
+	}
+}
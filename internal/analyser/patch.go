@@ -0,0 +1,225 @@
+package analyser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SkipReasonNoCodeChanges is the reason recorded when an analysis was skipped
+// because the patch only changed Go comments or blank lines.
+const SkipReasonNoCodeChanges = "no Go code changes, only comments or blank lines"
+
+// SkipReasonOnlyDeletions is the reason recorded when an analysis was skipped
+// because the patch only removed lines, so there are no lines to report issues
+// on.
+const SkipReasonOnlyDeletions = "only deletions, no lines added"
+
+// SkipReasonNoMatchingPaths is the reason recorded when an analysis was
+// skipped because the patch didn't change Go files matching the repository's
+// paths.
+const SkipReasonNoMatchingPaths = "no changes to Go files matching the repository's paths"
+
+// changesPaths returns true if a unified diff patch adds or modifies a Go file
+// matching any of patterns, see MatchPaths.
+func changesPaths(patch []byte, patterns []string) bool {
+	for _, file := range changedFiles(patch) {
+		if hasGoExtension(file) && MatchPaths(patterns, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCodeChanges returns false if a unified diff patch only adds or removes
+// blank lines or line comments in Go files. This is best-effort, changes to
+// non-Go files, lines that may be part of block comments, directives, such as
+// //go:generate or // +build, and comments in files importing C, which may be
+// part of the cgo preamble, are considered code changes.
+func hasCodeChanges(patch []byte) bool {
+	var (
+		isGo     bool
+		inHunk   bool // inHunk is true after the file's first hunk header
+		cgo      bool // cgo is true if the file's patch imports C
+		comments bool // comments is true if the file's comments changed
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "diff --git ") {
+			if cgo && comments {
+				return true
+			}
+			isGo, inHunk, cgo, comments = hasGoExtension(line), false, false, false
+			continue
+		}
+		if !inHunk {
+			// Headers, such as --- a/main.go, precede the first hunk, within
+			// hunks the same prefixes are removed or added lines.
+			inHunk = strings.HasPrefix(line, "@@ ")
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		content := strings.TrimSpace(line[1:])
+		switch line[0] {
+		case '+', '-':
+		case ' ':
+			if content == `import "C"` {
+				cgo = true
+			}
+			continue
+		default:
+			continue // next hunk's header, or \ No newline at end of file
+		}
+		switch {
+		case !isGo:
+			return true
+		case content == "":
+		case !strings.HasPrefix(content, "//"), isDirective(content):
+			return true
+		default:
+			comments = true
+		}
+	}
+	// If the patch could not be read, assume there were changes.
+	return cgo && comments || scanner.Err() != nil
+}
+
+// directiveRegexp matches directives using Go's //tool:directive convention,
+// such as //go:generate, //go:build, //go:embed or //lint:ignore.
+var directiveRegexp = regexp.MustCompile(`^//[a-z0-9]+:[a-z0-9]`)
+
+// isDirective returns true if a line comment is a directive which may change
+// the build or the analysis, rather than documentation.
+func isDirective(comment string) bool {
+	switch {
+	case directiveRegexp.MatchString(comment):
+		return true
+	case strings.HasPrefix(comment, "// +build"), strings.HasPrefix(comment, "//line "),
+		strings.HasPrefix(comment, "//export "), strings.HasPrefix(comment, "//extern "):
+		return true
+	}
+	// Preprocessor lines in a cgo preamble, such as #cgo LDFLAGS: or
+	// #include, even if import "C" isn't within the patch.
+	return strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(comment, "//")), "#")
+}
+
+// onlyDeletions returns true if a unified diff patch removes lines, such as
+// when deleting files, but does not add any lines.
+func onlyDeletions(patch []byte) bool {
+	var deletions bool
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+			continue
+		case strings.HasPrefix(line, "+"):
+			return false
+		case strings.HasPrefix(line, "-"):
+			deletions = true
+		}
+	}
+	// If the patch could not be read, assume there were additions.
+	return deletions && scanner.Err() == nil
+}
+
+// hunkPosition returns the position of line in the new version of path,
+// relative to the file's first hunk in a unified diff patch, as used by
+// GitHub's review comments. Returns 0 if line is not in the patch.
+func hunkPosition(patch []byte, path string, line int) int {
+	var (
+		inFile  bool
+		pos     int // pos is the position of the current line
+		newLine int // newLine is the current line number in the new file
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			if inFile {
+				return 0 // end of path's diff
+			}
+		case !inFile:
+			if strings.HasPrefix(text, "+++ ") {
+				inFile = strings.TrimPrefix(text, "+++ b/") == path
+				pos = -1 // the first hunk's header is position 0
+			}
+		case strings.HasPrefix(text, "@@ "):
+			pos++
+			if i := strings.Index(text, " +"); i >= 0 {
+				fmt.Sscanf(text[i:], " +%d", &newLine)
+			}
+		case strings.HasPrefix(text, "-"), strings.HasPrefix(text, "\\"):
+			pos++ // removed lines and "\ No newline" markers aren't new lines
+		default:
+			pos++
+			if newLine == line {
+				return pos
+			}
+			newLine++
+		}
+	}
+	return 0
+}
+
+// hasGoExtension returns true if a diff header line refers to a Go file.
+func hasGoExtension(header string) bool {
+	return strings.HasSuffix(header, ".go")
+}
+
+// newFiles returns the relative paths of the files added by a unified diff
+// patch, that is, files whose original is /dev/null.
+func newFiles(patch []byte) []string {
+	var (
+		files []string
+		isNew bool
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			isNew = line == "--- /dev/null"
+		case strings.HasPrefix(line, "+++ b/") && isNew:
+			files = append(files, strings.TrimPrefix(line, "+++ b/"))
+			isNew = false
+		}
+	}
+	return files
+}
+
+// withoutFiles returns the diffs of a unified diff patch except those of
+// files, such as new files whose every line is checked, as revgrep only
+// checks a file's changed lines if the file's diff is in the patch.
+func withoutFiles(patch []byte, files []string) []byte {
+	if len(files) == 0 {
+		return patch
+	}
+	skip := make(map[string]bool)
+	for _, file := range files {
+		skip["diff --git a/"+file+" b/"+file] = true
+	}
+	var (
+		buf    bytes.Buffer
+		inFile bool // inFile is true if the current file's diff is skipped
+	)
+	for _, line := range bytes.SplitAfter(patch, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("diff --git ")) {
+			inFile = skip[string(bytes.TrimRight(line, "\r\n"))]
+		}
+		if !inFile {
+			buf.Write(line)
+		}
+	}
+	return buf.Bytes()
+}
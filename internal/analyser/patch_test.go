@@ -0,0 +1,320 @@
+package analyser
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestHasCodeChanges(t *testing.T) {
+	tests := map[string]struct {
+		patch string
+		want  bool
+	}{
+		"empty": {"", false},
+		"comment only": {`diff --git a/main.go b/main.go
+index 4810940..4090359 100644
+--- a/main.go
++++ b/main.go
+@@ -1,5 +1,6 @@
+ package main
+ 
+-// Old comment
++// New comment
++
+ func main() {}
+`, false},
+		"code change": {`diff --git a/main.go b/main.go
+index 4810940..4090359 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+ 
+-func main() {}
++func main() { println() }
+`, true},
+		"trailing comment": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-var a = 1
++var a = 1 // comment
+`, true},
+		"non go file": {`diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -1,1 +1,1 @@
+-// readme
++// readme
+`, true},
+		"block comment": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,3 @@
++/*
++comment
++*/
+`, true},
+		"removed double dash comment": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,1 @@
+--- not a header
+ package main
+diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -1,1 +1,1 @@
+ readme
+`, true},
+		"added double plus comment": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,2 @@
++++ counter
+ package main
+`, true},
+		"go generate": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,2 @@
++//go:generate stringer -type=Kind
+ package main
+`, true},
+		"build constraint": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,2 @@
+-// +build linux
++// +build linux darwin
+ 
+`, true},
+		"cgo directive": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,2 @@
+-// #cgo LDFLAGS: -lm
++// #cgo LDFLAGS: -lm -lz
+ 
+`, true},
+		"cgo preamble": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+-// int add(int a, int b) { return a + b; }
++// int add(int a, int b) { return a - b; }
+ import "C"
+ 
+`, true},
+		"comment in file importing C": {`diff --git a/c.go b/c.go
+--- a/c.go
++++ b/c.go
+@@ -1,2 +1,2 @@
+ import "C"
+-// Old comment
++// New comment
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-// Old comment
++// New comment
+`, true},
+		"comment in file not importing C": {`diff --git a/c.go b/c.go
+--- a/c.go
++++ b/c.go
+@@ -1,2 +1,3 @@
+ import "C"
++
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-// Old comment
++// New comment
+`, false},
+		"comment mentioning directive": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-// Use go:generate to regenerate.
++// Use go generate to regenerate.
+`, false},
+	}
+
+	for desc, test := range tests {
+		if have := hasCodeChanges([]byte(test.patch)); have != test.want {
+			t.Errorf("%v: have: %v, want: %v", desc, have, test.want)
+		}
+	}
+}
+
+func TestOnlyDeletions(t *testing.T) {
+	tests := map[string]struct {
+		patch string
+		want  bool
+	}{
+		"empty": {"", false},
+		"deleted file": {`diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-package main
+`, true},
+		"removed lines": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,1 @@
+ package main
+-
+-func main() {}
+`, true},
+		"changed line": {`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-var a = 1
++var a = 2
+`, false},
+		"deleted and added files": {`diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-package main
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,1 @@
++package main
+`, false},
+	}
+
+	for desc, test := range tests {
+		if have := onlyDeletions([]byte(test.patch)); have != test.want {
+			t.Errorf("%v: have: %v, want: %v", desc, have, test.want)
+		}
+	}
+}
+
+func TestNewFiles(t *testing.T) {
+	patch := []byte(`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-var a = 1
++var a = 2
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,1 @@
++package main
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-package main
+diff --git a/sub/other.go b/sub/other.go
+new file mode 100644
+--- /dev/null
++++ b/sub/other.go
+@@ -0,0 +1,1 @@
++package sub
+`)
+
+	have := newFiles(patch)
+	if want := []string{"new.go", "sub/other.go"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have: %v, want: %v", have, want)
+	}
+}
+
+func TestWithoutFiles(t *testing.T) {
+	patch := []byte(`diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-var a = 1
++var a = 2
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,1 @@
++package main
+diff --git a/new.go.orig b/new.go.orig
+new file mode 100644
+--- /dev/null
++++ b/new.go.orig
+@@ -0,0 +1,1 @@
++package main
+`)
+
+	want := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-var a = 1
++var a = 2
+diff --git a/new.go.orig b/new.go.orig
+new file mode 100644
+--- /dev/null
++++ b/new.go.orig
+@@ -0,0 +1,1 @@
++package main
+`
+	if have := string(withoutFiles(patch, []string{"new.go"})); have != want {
+		t.Errorf("have:\n%s\nwant:\n%s", have, want)
+	}
+	if have := withoutFiles(patch, nil); !bytes.Equal(have, patch) {
+		t.Errorf("no files have:\n%s\nwant:\n%s", have, patch)
+	}
+}
+
+func TestHunkPosition(t *testing.T) {
+	patch := []byte(`diff --git a/other.go b/other.go
+--- a/other.go
++++ b/other.go
+@@ -1,1 +1,1 @@
+-var a = 1
++var a = 2
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@
+ package main
+-func main() {}
++func main() {
++}
+ var b = 1
+@@ -10,2 +11,2 @@
+ var c = 1
+-var d = 1
++var d = 2
+`)
+
+	tests := []struct {
+		path string
+		line int
+		want int
+	}{
+		{"main.go", 1, 1},
+		{"main.go", 2, 3},
+		{"main.go", 3, 4},
+		{"main.go", 4, 5},
+		{"main.go", 11, 7},
+		{"main.go", 12, 9},
+		{"main.go", 8, 0},
+		{"other.go", 1, 2},
+		{"unknown.go", 1, 0},
+	}
+	for _, test := range tests {
+		if have := hunkPosition(patch, test.path, test.line); have != test.want {
+			t.Errorf("hunkPosition(%q, %v) have: %v, want: %v", test.path, test.line, have, test.want)
+		}
+	}
+}
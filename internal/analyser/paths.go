@@ -0,0 +1,57 @@
+package analyser
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MatchPaths returns true if file, relative to the repository's root, matches
+// any of patterns. As in CODEOWNERS, a pattern is a glob, as supported by
+// path.Match, matching the file or a parent directory. A pattern ending in "/"
+// only matches directories, so matches every file within them. A pattern
+// containing a "/", other than at its end, matches from the repository's root,
+// such as /main.go or internal/*/db, otherwise it matches at any depth, such
+// as *.pb.go or vendor/.
+func MatchPaths(patterns []string, file string) bool {
+	file = strings.TrimPrefix(file, "/")
+	for _, pattern := range patterns {
+		if matchPath(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath returns true if file matches pattern, see MatchPaths.
+func matchPath(pattern, file string) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	rooted := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	for dir := file; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if dirOnly && dir == file {
+			continue
+		}
+		name := dir
+		if !rooted {
+			name = path.Base(dir)
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePaths returns an error if any of patterns is malformed, see
+// MatchPaths.
+func ValidatePaths(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.Trim(pattern, "/"), ""); err != nil {
+			return errors.Wrapf(err, "invalid path pattern %q", pattern)
+		}
+	}
+	return nil
+}
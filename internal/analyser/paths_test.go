@@ -0,0 +1,45 @@
+package analyser
+
+import "testing"
+
+func TestMatchPaths(t *testing.T) {
+	patterns := []string{"cmd/server/", "/internal/db", "*.pb.go", "docs/*.go", "testdata/", "/tools.go"}
+	tests := map[string]bool{
+		"cmd/server/main.go":       true,
+		"cmd/server/http/route.go": true,
+		"cmd/client/main.go":       false,
+		"internal/db/sqldb.go":     true,
+		"internal/db":              true,
+		"internal/dbx/sqldb.go":    false,
+		"api.pb.go":                true,
+		"api/v1/api.pb.go":         true, // patterns without a slash match at any depth
+		"docs/example.go":          true,
+		"docs/sub/example.go":      false,
+		"pkg/docs/example.go":      false, // patterns with a slash match from the root
+		"testdata/main.go":         true,
+		"pkg/testdata/a/main.go":   true,
+		"testdata":                 false, // directory patterns don't match files
+		"tools.go":                 true,
+		"cmd/tools.go":             false,
+		"/cmd/server/main.go":      true,
+		"main.go":                  false,
+	}
+	for file, want := range tests {
+		if have := MatchPaths(patterns, file); have != want {
+			t.Errorf("MatchPaths(%q) have: %v, want: %v", file, have, want)
+		}
+	}
+
+	if MatchPaths(nil, "main.go") {
+		t.Error("expected no patterns to match nothing")
+	}
+}
+
+func TestValidatePaths(t *testing.T) {
+	if err := ValidatePaths([]string{"cmd/", "*.go", "/internal/[a-z]*/"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidatePaths([]string{"cmd/", "internal/[a-"}); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+}
@@ -3,9 +3,6 @@ package analyser
 import (
 	"bytes"
 	"context"
-	"fmt"
-
-	"github.com/pkg/errors"
 )
 
 // RefReader returns the base reference of a repository.
@@ -25,7 +22,32 @@ func (b *MergeBase) Base(ctx context.Context, exec Executer) (string, error) {
 	args := []string{"git", "merge-base", "FETCH_HEAD", "HEAD"}
 	out, err := exec.Execute(ctx, args)
 	if err != nil {
-		return "", errors.WithMessage(err, fmt.Sprintf("could not execute %v: %q", args, out))
+		return "", execError(args, err, out)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// BranchMergeBase is a RefReader for handling pushes creating a branch by
+// using git's merge-base tool to find the common ancestor between HEAD and
+// the remote Branch, such as the repository's default branch. It expects the
+// repository to be cloned with full history. If there's no common ancestor,
+// FallbackRef is returned.
+type BranchMergeBase struct {
+	Branch      string
+	FallbackRef string
+}
+
+var _ RefReader = &BranchMergeBase{}
+
+// Base implements the RefReader interface.
+func (b *BranchMergeBase) Base(ctx context.Context, exec Executer) (string, error) {
+	args := []string{"git", "merge-base", "origin/" + b.Branch, "HEAD"}
+	out, err := exec.Execute(ctx, args)
+	if _, ok := err.(*NonZeroError); ok && b.FallbackRef != "" {
+		return b.FallbackRef, nil
+	}
+	if err != nil {
+		return "", execError(args, err, out)
 	}
 	return string(bytes.TrimSpace(out)), nil
 }
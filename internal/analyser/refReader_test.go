@@ -23,7 +23,7 @@ func TestMergeBase(t *testing.T) {
 		ExecuteOut: [][]byte{{}},
 		ExecuteErr: []error{errors.New("git merge-base fail")},
 	}
-	readerFailErr := errors.New(`could not execute [git merge-base FETCH_HEAD HEAD]: "": git merge-base fail`)
+	readerFailErr := errors.New("could not execute [git merge-base FETCH_HEAD HEAD]: git merge-base fail\n")
 
 	tests := []struct {
 		executer *mockExecuter
@@ -63,3 +63,48 @@ func TestFixedRef(t *testing.T) {
 		t.Errorf("have: %v, want: %v", have, want)
 	}
 }
+
+func TestBranchMergeBase(t *testing.T) {
+	tests := map[string]struct {
+		reader   *BranchMergeBase
+		executer *mockExecuter
+		want     string
+		wantErr  bool
+	}{
+		"merge base": {
+			&BranchMergeBase{Branch: "master", FallbackRef: "abcdef~2"},
+			&mockExecuter{ExecuteOut: [][]byte{[]byte("123456\n")}, ExecuteErr: []error{nil}},
+			"123456", false,
+		},
+		"no common ancestor": {
+			&BranchMergeBase{Branch: "master", FallbackRef: "abcdef~2"},
+			&mockExecuter{ExecuteOut: [][]byte{{}}, ExecuteErr: []error{&NonZeroError{ExitCode: 1}}},
+			"abcdef~2", false,
+		},
+		"no fallback": {
+			&BranchMergeBase{Branch: "master"},
+			&mockExecuter{ExecuteOut: [][]byte{{}}, ExecuteErr: []error{&NonZeroError{ExitCode: 1}}},
+			"", true,
+		},
+		"execute error": {
+			&BranchMergeBase{Branch: "master", FallbackRef: "abcdef~2"},
+			&mockExecuter{ExecuteOut: [][]byte{{}}, ExecuteErr: []error{errors.New("execute fail")}},
+			"", true,
+		},
+	}
+
+	for desc, test := range tests {
+		have, err := test.reader.Base(context.Background(), test.executer)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case !test.wantErr && err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		case have != test.want:
+			t.Errorf("%v: have: %q, want: %q", desc, have, test.want)
+		}
+		if want := [][]string{{"git", "merge-base", "origin/master", "HEAD"}}; !reflect.DeepEqual(test.executer.Executed, want) {
+			t.Errorf("%v: executed have: %v, want: %v", desc, test.executer.Executed, want)
+		}
+	}
+}
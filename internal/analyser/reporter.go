@@ -11,6 +11,13 @@ type Reporter interface {
 	Report(context.Context, []db.Issue) error
 }
 
+// A SuppressingReporter is a Reporter which may suppress issues, see Suppress.
+type SuppressingReporter interface {
+	Reporter
+	// Suppressed returns the issues suppressed by the last call to Report.
+	Suppressed() []db.Issue
+}
+
 // MaxIssueComments is the maximum number of comments that will be written
 // on a pull request by writeissues. a pr may have more comments written if
 // writeissues is called multiple times, such is multiple syncronise events.
@@ -0,0 +1,29 @@
+package analyser
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// selfTestPath is the goSrcPath of the executer created by SelfTest.
+const selfTestPath = "gopherci-selftest"
+
+// SelfTest checks the analyser can create an executer and execute a command
+// by running go version, so misconfiguration is found at startup instead of
+// during a user's analysis. Returns the output of go version.
+func SelfTest(ctx context.Context, analyser Analyser) (string, error) {
+	exec, err := analyser.NewExecuter(ctx, selfTestPath)
+	if err != nil {
+		return "", errors.Wrap(err, "could not create executer")
+	}
+	defer exec.Stop(ctx)
+
+	args := []string{"go", "version"}
+	out, err := exec.Execute(ctx, args)
+	if err != nil {
+		return "", execError(args, err, out)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
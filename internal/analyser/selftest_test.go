@@ -0,0 +1,64 @@
+package analyser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type mockAnalyser struct {
+	Executer    *mockExecuter
+	ExecuterErr error
+}
+
+var _ Analyser = &mockAnalyser{}
+
+func (a *mockAnalyser) NewExecuter(context.Context, string) (Executer, error) {
+	return a.Executer, a.ExecuterErr
+}
+
+func TestSelfTest(t *testing.T) {
+	tests := map[string]struct {
+		analyser *mockAnalyser
+		want     string
+		wantErr  bool
+	}{
+		"success": {
+			analyser: &mockAnalyser{Executer: &mockExecuter{
+				ExecuteOut: [][]byte{[]byte("go version go1.9 linux/amd64\n")},
+				ExecuteErr: []error{nil},
+			}},
+			want: "go version go1.9 linux/amd64",
+		},
+		"executer error": {
+			analyser: &mockAnalyser{ExecuterErr: errors.New("docker unavailable")},
+			wantErr:  true,
+		},
+		"execute error": {
+			analyser: &mockAnalyser{Executer: &mockExecuter{
+				ExecuteOut: [][]byte{[]byte("go: not found")},
+				ExecuteErr: []error{&NonZeroError{ExitCode: 127}},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for desc, test := range tests {
+		have, err := SelfTest(context.Background(), test.analyser)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case !test.wantErr && err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		}
+		if have != test.want {
+			t.Errorf("%v: have: %q, want: %q", desc, have, test.want)
+		}
+		if exec := test.analyser.Executer; exec != nil {
+			if want := [][]string{{"go", "version"}}; !reflect.DeepEqual(exec.Executed, want) {
+				t.Errorf("%v: executed have: %v, want: %v", desc, exec.Executed, want)
+			}
+		}
+	}
+}
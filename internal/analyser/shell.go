@@ -0,0 +1,11 @@
+package analyser
+
+import "strings"
+
+// shellQuote returns s quoted as a single word for bash, as Executers run
+// their args as a bash command line. Values which may be controlled by a
+// repository, such as branch names, must be quoted to prevent them running
+// as commands.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,27 @@
+package analyser
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []string{
+		"",
+		"feature",
+		"a b",
+		"it's",
+		"$(touch pwned); `id` | & > <",
+		`"'\`,
+	}
+	for _, test := range tests {
+		out, err := exec.Command("bash", "-c", "printf %s "+shellQuote(test)).CombinedOutput()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v\n%s", test, err, out)
+			continue
+		}
+		if have := string(out); have != test {
+			t.Errorf("have: %q, want: %q", have, test)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package analyser
+
+import (
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+)
+
+// Structured fields logged at each stage of an analysis. The names are
+// stable, so they may be relied on by log based dashboards.
+const (
+	LogStage    = "stage"    // LogStage is the lifecycle stage, see the Stage constants.
+	LogDuration = "duration" // LogDuration is the stage's duration in seconds.
+	LogTool     = "tool"     // LogTool is the name of the tool.
+	LogIssues   = "issues"   // LogIssues is the number of issues.
+)
+
+// Lifecycle stages of an analysis, logged with LogStage.
+const (
+	StageCloned        = "cloned"         // StageCloned is after the repository was cloned.
+	StageDepsInstalled = "deps_installed" // StageDepsInstalled is after the dependencies were installed.
+	StageToolRan       = "tool_ran"       // StageToolRan is after each tool ran, with LogTool and LogIssues.
+	StageBaseCompared  = "base_compared"  // StageBaseCompared is after issues were compared with the base ref, with LogIssues.
+	StageAnalysed      = "analysed"       // StageAnalysed is after all tools ran, with LogIssues.
+	StageReported      = "reported"       // StageReported is after the issues were reported, with LogIssues.
+)
+
+// StageLogger returns logger with the fields of an analysis's stage, which
+// took d.
+func StageLogger(logger logger.Logger, stage string, d time.Duration) logger.Logger {
+	return logger.With(LogStage, stage).With(LogDuration, d.Seconds())
+}
@@ -0,0 +1,115 @@
+package analyser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+)
+
+func TestAnalyse_stageLogs(t *testing.T) {
+	diff := []byte(`diff --git a/main.go b/main.go
+new file mode 100644
+index 0000000..6362395
+--- /dev/null
++++ b/main.go
+@@ -0,0 +1,1 @@
++package main`)
+
+	exec := &mockExecuter{
+		ExecuteOut: [][]byte{
+			{},                         // go env
+			{},                         // go version
+			{},                         // cat /proc/self/limits
+			{},                         // lsb_release --description
+			diff,                       // git diff
+			{},                         // install-deps.sh
+			[]byte(`/go/src/gopherci`), // pwd
+			{},                         // tool 1 version
+			[]byte("main.go:1: issue"), // tool 1
+			{},                         // isFileGenerated
+			{},                         // tool 2 version
+			{},                         // tool 2
+		},
+		ExecuteErr: []error{
+			nil,                        // go env
+			nil,                        // go version
+			nil,                        // cat /proc/self/limits
+			nil,                        // lsb_release --description
+			nil,                        // git diff
+			nil,                        // install-deps.sh
+			nil,                        // pwd
+			nil,                        // tool 1 version
+			nil,                        // tool 1
+			&NonZeroError{ExitCode: 1}, // isFileGenerated - not generated
+			nil,                        // tool 2 version
+			nil,                        // tool 2
+		},
+	}
+
+	mockDB := db.NewMockDB()
+	analysis, _ := mockDB.StartAnalysis(1, 2, db.AnalysisTriggerPush, "commitFrom", "commitTo", 0, "", "")
+	configReader := &mockConfig{
+		RepoConfig{
+			Tools: []db.Tool{
+				{ID: 1, Name: "Name1", Path: "tool1"},
+				{ID: 2, Name: "Name2", Path: "tool2"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	log := logger.New(&buf, "", "production", "", nil) // production logs JSON
+
+	err := Analyse(context.Background(), log, exec, &mockCloner{}, configReader, &FixedRef{BaseRef: "base-ref"}, Config{HeadRef: "head-branch"}, analysis)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// stages are the fields logged for each stage, keyed by stage and tool.
+	stages := make(map[string]map[string]interface{})
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("could not decode log entry: %v", err)
+		}
+		if stage, ok := entry[LogStage].(string); ok {
+			if tool, ok := entry[LogTool].(string); ok {
+				stage += " " + tool
+			}
+			stages[stage] = entry
+		}
+	}
+
+	tests := []struct {
+		stage      string
+		wantIssues float64 // wantIssues is the number of issues, -1 if not logged
+	}{
+		{StageCloned, -1},
+		{StageDepsInstalled, -1},
+		{StageToolRan + " Name1", 1},
+		{StageToolRan + " Name2", 0},
+		{StageAnalysed, 1},
+	}
+	for _, test := range tests {
+		entry, ok := stages[test.stage]
+		if !ok {
+			t.Errorf("stage %q not logged", test.stage)
+			continue
+		}
+		if _, ok := entry[LogDuration].(float64); !ok {
+			t.Errorf("stage %q duration have: %v, want: seconds", test.stage, entry[LogDuration])
+		}
+		issues, ok := entry[LogIssues].(float64)
+		switch {
+		case test.wantIssues < 0 && ok:
+			t.Errorf("stage %q unexpected issues: %v", test.stage, issues)
+		case test.wantIssues >= 0 && issues != test.wantIssues:
+			t.Errorf("stage %q issues have: %v, want: %v", test.stage, entry[LogIssues], test.wantIssues)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package analyser
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultIssueTemplate is the issue template used if none is configured.
+const DefaultIssueTemplate = "{{.Tool}}: {{.Message}}"
+
+// IssueTemplateData is the data available to an issue template.
+type IssueTemplateData struct {
+	Tool     string // Tool is the name of the tool that found the issue.
+	ToolURL  string // ToolURL is the tool's URL, may be blank.
+	Message  string // Message is the issue as reported by the tool.
+	Path     string // Path is the file's path relative to the repository.
+	Line     int    // Line is the line number, may be 0.
+	Column   int    // Column is the column number, may be 0.
+	Severity string // Severity is the tool's severity, may be blank.
+}
+
+// defaultIssueTemplate is the parsed DefaultIssueTemplate.
+var defaultIssueTemplate = template.Must(template.New("issue").Parse(DefaultIssueTemplate))
+
+// ParseIssueTemplate parses text as an issue template, returning an error if
+// the template is invalid or cannot be executed.
+func ParseIssueTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("issue").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse issue template")
+	}
+	// Execute against sample data to catch references to unknown fields.
+	sample := IssueTemplateData{
+		Tool: "tool", ToolURL: "https://example.com", Message: "message",
+		Path: "main.go", Line: 1, Column: 1, Severity: "warning",
+	}
+	if _, err := renderIssue(tmpl, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderIssue executes tmpl with data, if tmpl is nil DefaultIssueTemplate is
+// used. Leading and trailing whitespace is removed.
+func renderIssue(tmpl *template.Template, data IssueTemplateData) (string, error) {
+	if tmpl == nil {
+		tmpl = defaultIssueTemplate
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrap(err, "could not execute issue template")
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
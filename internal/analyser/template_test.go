@@ -0,0 +1,97 @@
+package analyser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderIssue(t *testing.T) {
+	data := IssueTemplateData{
+		Tool:     "golint",
+		ToolURL:  "https://github.com/golang/lint",
+		Message:  "exported func Foo should have comment",
+		Path:     "foo/main.go",
+		Line:     10,
+		Column:   2,
+		Severity: "warning",
+	}
+
+	tests := map[string]struct {
+		text string
+		want string
+	}{
+		"default": {DefaultIssueTemplate, "golint: exported func Foo should have comment"},
+		"all fields": {
+			"[{{.Severity}}] {{.Tool}} ({{.ToolURL}}) {{.Path}}:{{.Line}}:{{.Column}}: {{.Message}}",
+			"[warning] golint (https://github.com/golang/lint) foo/main.go:10:2: exported func Foo should have comment",
+		},
+		"conditional": {"{{if .Severity}}**{{.Severity}}** {{end}}{{.Message}}", "**warning** exported func Foo should have comment"},
+		"trimmed":     {"\n  {{.Tool}}: {{.Message}}\n\n", "golint: exported func Foo should have comment"},
+	}
+
+	for desc, test := range tests {
+		tmpl, err := ParseIssueTemplate(test.text)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", desc, err)
+			continue
+		}
+		have, err := renderIssue(tmpl, data)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", desc, err)
+			continue
+		}
+		if have != test.want {
+			t.Errorf("%v: have: %q, want: %q", desc, have, test.want)
+		}
+	}
+
+	// nil template uses the default
+	have, err := renderIssue(nil, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "golint: exported func Foo should have comment"; have != want {
+		t.Errorf("nil template have: %q, want: %q", have, want)
+	}
+}
+
+func TestRenderIssue_stable(t *testing.T) {
+	// Dedupe compares rendered bodies with existing comments, so rendering the
+	// same issue must always produce the same body.
+	tmpl, err := ParseIssueTemplate("{{.Tool}}: {{.Message}}\n\n{{.ToolURL}}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := IssueTemplateData{Tool: "vet", ToolURL: "https://golang.org/cmd/vet", Message: "unreachable code"}
+
+	first, err := renderIssue(tmpl, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		have, err := renderIssue(tmpl, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if have != first {
+			t.Fatalf("render %v have: %q, want: %q", i, have, first)
+		}
+	}
+}
+
+func TestParseIssueTemplate_errors(t *testing.T) {
+	tests := map[string]struct {
+		text string
+		want string
+	}{
+		"syntax":        {"{{.Tool", "could not parse issue template"},
+		"unknown field": {"{{.Tool}}: {{.Unknown}}", "could not execute issue template"},
+	}
+
+	for desc, test := range tests {
+		_, err := ParseIssueTemplate(test.text)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: have error: %v, want: %q", desc, err, test.want)
+		}
+	}
+}
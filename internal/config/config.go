@@ -0,0 +1,657 @@
+// Package config loads and validates GopherCI's configuration from the
+// environment.
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/scheduler"
+)
+
+// Config is GopherCI's configuration, see .env.example for a description of
+// each environment variable.
+type Config struct {
+	LoggerEnv          string            // LOGGER_ENV
+	LoggerSentryDSN    string            // LOGGER_SENTRY_DSN
+	LoggerSentryRoutes map[string]string // LOGGER_SENTRY_ROUTES, installation ID to DSN
+	BaseURL            string            // GCI_BASE_URL, may be blank
+	SessionKey         []byte            // GCI_SESSION_KEY
+	Admins             []string          // GCI_ADMINS
+	HTTPProxy          string            // GCI_HTTP_PROXY, may be blank
+
+	HTTPReadHeaderTimeout int // GCI_HTTP_READ_HEADER_TIMEOUT in seconds
+	HTTPReadTimeout       int // GCI_HTTP_READ_TIMEOUT in seconds
+	HTTPWriteTimeout      int // GCI_HTTP_WRITE_TIMEOUT in seconds
+	HTTPIdleTimeout       int // GCI_HTTP_IDLE_TIMEOUT in seconds
+	HTTPHandlerTimeout    int // GCI_HTTP_HANDLER_TIMEOUT in seconds
+
+	DB       DBConfig
+	Analyser AnalyserConfig
+	Queuer   QueuerConfig
+	GitHub   GitHubConfig
+	Secrets  SecretsConfig
+}
+
+// DBConfig is the configuration for the database.
+type DBConfig struct {
+	Driver    string // DB_DRIVER
+	Host      string // DB_HOST
+	Port      string // DB_PORT
+	Database  string // DB_DATABASE
+	Username  string // DB_USERNAME
+	Password  string // DB_PASSWORD
+	SeedTools bool   // DB_SEED_TOOLS
+
+	MaxOutput     int // DB_MAX_OUTPUT in bytes
+	MaxDiffOutput int // DB_MAX_DIFF_OUTPUT in bytes
+
+	AnalysisRetention int // DB_ANALYSIS_RETENTION in days
+	MaxIssues         int // DB_MAX_ISSUES
+}
+
+// DSN returns the data source name to connect to the database.
+func (c DBConfig) DSN() string {
+	return fmt.Sprintf(`%s:%s@tcp(%s:%s)/%s?charset=utf8&collation=utf8_unicode_ci&timeout=6s&time_zone='%%2B00:00'&parseTime=true`,
+		c.Username, c.Password, c.Host, c.Port, c.Database,
+	)
+}
+
+// AnalyserConfig is the configuration for the analyser.
+type AnalyserConfig struct {
+	Type                    string   // ANALYSER, either docker, filesystem or null
+	MemoryLimit             int      // ANALYSER_MEMORY_LIMIT in MiB
+	SkipNonCodeChanges      bool     // ANALYSER_SKIP_NON_CODE_CHANGES
+	MaxTools                int      // ANALYSER_MAX_TOOLS
+	MaxModules              int      // ANALYSER_MAX_MODULES
+	MutedTools              []string // ANALYSER_MUTED_TOOLS, names or IDs
+	CloneTimeout            int      // ANALYSER_CLONE_TIMEOUT in seconds
+	IssueTemplate           string   // ANALYSER_ISSUE_TEMPLATE, may be blank
+	IncompatibleRegexp      string   // ANALYSER_INCOMPATIBLE_REGEXP, may be blank
+	IssueOrder              []string // ANALYSER_ISSUE_ORDER
+	CompareBase             bool     // ANALYSER_COMPARE_BASE
+	FileSystemPath          string   // ANALYSER_FILESYSTEM_PATH
+	FileSystemMaxWorkspaces int      // ANALYSER_FILESYSTEM_MAX_WORKSPACES
+	FileSystemMaxDiskUsage  int      // ANALYSER_FILESYSTEM_MAX_DISK_USAGE in MiB
+	DockerImage             string   // ANALYSER_DOCKER_IMAGE
+	DockerPoolSize          int      // ANALYSER_DOCKER_POOL_SIZE
+	DockerPoolMaxUses       int      // ANALYSER_DOCKER_POOL_MAX_USES
+	DockerMaxContainers     int      // ANALYSER_DOCKER_MAX_CONTAINERS
+	DockerContainerWait     int      // ANALYSER_DOCKER_CONTAINER_WAIT in seconds
+	GitSSHKeyFile           string   // ANALYSER_GIT_SSH_KEY_FILE
+	GitSSHKnownHostsFile    string   // ANALYSER_GIT_SSH_KNOWN_HOSTS_FILE
+	GoProxy                 string   // ANALYSER_GOPROXY, may be blank
+	GoNoSumDB               string   // ANALYSER_GONOSUMDB, may be blank
+	GoPrivate               string   // ANALYSER_GOPRIVATE, may be blank
+	KeepOnFailure           bool     // ANALYSER_KEEP_ON_FAILURE
+}
+
+// QueuerConfig is the configuration for the queuer.
+type QueuerConfig struct {
+	Type                    string // QUEUER, either memory or gcppubsub
+	MemoryDrainTimeout      int    // QUEUER_MEMORY_DRAIN_TIMEOUT in seconds
+	Paused                  bool   // QUEUER_PAUSED
+	GCPPubSubProjectID      string // QUEUER_GCPPUBSUB_PROJECT_ID
+	GCPPubSubTopic          string // QUEUER_GCPPUBSUB_TOPIC
+	GCPPubSubMaxOutstanding int    // QUEUER_GCPPUBSUB_MAX_OUTSTANDING
+}
+
+// SecretsConfig is the configuration for secret managers, used by secrets
+// given as URIs.
+type SecretsConfig struct {
+	VaultAddr  string // VAULT_ADDR, may be blank
+	VaultToken string // VAULT_TOKEN, may be blank
+}
+
+// GitHubConfig is the configuration for the GitHub integration.
+type GitHubConfig struct {
+	ID                    int                      // GITHUB_ID
+	PEMFile               string                   // GITHUB_PEM_FILE, a path or secret URI
+	WebhookSecret         string                   // GITHUB_WEBHOOK_SECRET, a value or secret URI
+	Apps                  []GitHubAppConfig        // GITHUB_APPS, additional GitHub Apps
+	InlineCommitThreshold int                      // GITHUB_INLINE_COMMIT_THRESHOLD
+	CommitCommentGroupBy  string                   // GITHUB_COMMIT_COMMENT_GROUP_BY, blank, file or tool
+	OffDiffCommitComment  bool                     // GITHUB_OFF_DIFF_COMMIT_COMMENT
+	PerToolStatuses       bool                     // GITHUB_PER_TOOL_STATUSES
+	SkipStatuses          bool                     // GITHUB_SKIP_STATUSES
+	StatusDuration        bool                     // GITHUB_STATUS_DURATION
+	NoIssuesDescription   string                   // GITHUB_NO_ISSUES_DESCRIPTION
+	PushCheckRuns         bool                     // GITHUB_PUSH_CHECK_RUNS
+	PRFilesMaxPages       int                      // GITHUB_PR_FILES_MAX_PAGES
+	MinSeverity           string                   // GITHUB_MIN_SEVERITY, blank, error, warning or info
+	DailyDurationBudget   int                      // GITHUB_DAILY_DURATION_BUDGET in minutes
+	PRDebounceWindow      int                      // GITHUB_PR_DEBOUNCE_WINDOW in seconds
+	PRMergeRef            bool                     // GITHUB_PR_MERGE_REF
+	CloneProtocol         string                   // GITHUB_CLONE_PROTOCOL, either event, https or ssh
+	FullScanSchedule      string                   // GITHUB_FULL_SCAN_SCHEDULE, cron expression, may be blank
+	AutoFixCommand        string                   // GITHUB_AUTOFIX_COMMAND, may be blank
+	AutoFixInstallations  []int                    // GITHUB_AUTOFIX_INSTALLATIONS
+	QuietHours            map[int]scheduler.Window // GITHUB_QUIET_HOURS, installation ID to window in UTC
+	WebhookOrigins        []*net.IPNet             // GITHUB_WEBHOOK_ORIGINS
+	WebhookOriginsMeta    bool                     // GITHUB_WEBHOOK_ORIGINS_META
+	WebhookProxies        int                      // GITHUB_WEBHOOK_PROXIES
+	ResultWebhooks        map[int]string           // GITHUB_RESULT_WEBHOOKS, installation ID to URL
+	ResultWebhookSecrets  map[int]string           // GITHUB_RESULT_WEBHOOK_SECRETS, installation ID to a value or secret URI
+	OAuthClientID         string                   // GITHUB_OAUTH_CLIENT_ID
+	OAuthClientSecret     string                   // GITHUB_OAUTH_CLIENT_SECRET
+}
+
+// usesScheme returns true if any private key, webhook secret or result
+// webhook secret is a secret URI with scheme.
+func (c GitHubConfig) usesScheme(scheme string) bool {
+	prefix := scheme + "://"
+	secrets := []string{c.PEMFile, c.WebhookSecret}
+	for _, app := range c.Apps {
+		secrets = append(secrets, app.PEMFile, app.WebhookSecret)
+	}
+	for _, secret := range c.ResultWebhookSecrets {
+		secrets = append(secrets, secret)
+	}
+	for _, secret := range secrets {
+		if strings.HasPrefix(secret, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GitHubAppConfig is the configuration for an additional GitHub App.
+type GitHubAppConfig struct {
+	ID            int
+	PEMFile       string // a path or secret URI
+	WebhookSecret string // a value or secret URI
+}
+
+// Errors is a list of configuration errors.
+type Errors []error
+
+// Error implements the error interface.
+func (e Errors) Error() string {
+	var msgs []string
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+// Load returns the configuration from the environment, if any values are
+// missing or invalid, an Errors is returned containing all problems. The
+// returned Config is populated as much as possible even if an error is
+// returned, so that a logger may still be initialised to report the error.
+func Load() (Config, error) {
+	return load(os.Getenv)
+}
+
+// load returns the configuration using getenv to lookup each variable.
+func load(getenv func(string) string) (Config, error) {
+	return parse(newParser(getenv))
+}
+
+// parse returns the configuration using p to lookup each variable.
+func parse(p *parser) (Config, error) {
+	getenv := p.getenv
+
+	cfg := Config{
+		LoggerEnv:          getenv("LOGGER_ENV"),
+		LoggerSentryDSN:    getenv("LOGGER_SENTRY_DSN"),
+		LoggerSentryRoutes: p.pairs("LOGGER_SENTRY_ROUTES"),
+		BaseURL:            getenv("GCI_BASE_URL"),
+		SessionKey:         []byte(getenv("GCI_SESSION_KEY")),
+		Admins:             p.list("GCI_ADMINS"),
+		HTTPProxy:          getenv("GCI_HTTP_PROXY"),
+
+		HTTPReadHeaderTimeout: p.int("GCI_HTTP_READ_HEADER_TIMEOUT", 10),
+		HTTPReadTimeout:       p.int("GCI_HTTP_READ_TIMEOUT", 30),
+		HTTPWriteTimeout:      p.int("GCI_HTTP_WRITE_TIMEOUT", 0),
+		HTTPIdleTimeout:       p.int("GCI_HTTP_IDLE_TIMEOUT", 120),
+		HTTPHandlerTimeout:    p.int("GCI_HTTP_HANDLER_TIMEOUT", 60),
+		DB: DBConfig{
+			Driver:    p.required("DB_DRIVER"),
+			Host:      getenv("DB_HOST"),
+			Port:      getenv("DB_PORT"),
+			Database:  getenv("DB_DATABASE"),
+			Username:  getenv("DB_USERNAME"),
+			Password:  getenv("DB_PASSWORD"),
+			SeedTools: p.bool("DB_SEED_TOOLS", false),
+
+			MaxOutput:     p.int("DB_MAX_OUTPUT", db.DefaultMaxOutput),
+			MaxDiffOutput: p.int("DB_MAX_DIFF_OUTPUT", 0),
+
+			AnalysisRetention: p.int("DB_ANALYSIS_RETENTION", 0),
+			MaxIssues:         p.int("DB_MAX_ISSUES", 0),
+		},
+		Analyser: AnalyserConfig{
+			Type:                    p.oneOf("ANALYSER", "docker", "filesystem", "null"),
+			MemoryLimit:             p.int("ANALYSER_MEMORY_LIMIT", 0),
+			SkipNonCodeChanges:      p.bool("ANALYSER_SKIP_NON_CODE_CHANGES", false),
+			MaxTools:                p.int("ANALYSER_MAX_TOOLS", 0),
+			MaxModules:              p.int("ANALYSER_MAX_MODULES", 0),
+			MutedTools:              p.list("ANALYSER_MUTED_TOOLS"),
+			CloneTimeout:            p.int("ANALYSER_CLONE_TIMEOUT", 0),
+			IssueTemplate:           getenv("ANALYSER_ISSUE_TEMPLATE"),
+			IncompatibleRegexp:      getenv("ANALYSER_INCOMPATIBLE_REGEXP"),
+			IssueOrder:              p.list("ANALYSER_ISSUE_ORDER"),
+			CompareBase:             p.bool("ANALYSER_COMPARE_BASE", false),
+			FileSystemPath:          getenv("ANALYSER_FILESYSTEM_PATH"),
+			FileSystemMaxWorkspaces: p.int("ANALYSER_FILESYSTEM_MAX_WORKSPACES", 0),
+			FileSystemMaxDiskUsage:  p.int("ANALYSER_FILESYSTEM_MAX_DISK_USAGE", 0),
+			DockerImage:             p.string("ANALYSER_DOCKER_IMAGE", analyser.DockerDefaultImage),
+			DockerPoolSize:          p.int("ANALYSER_DOCKER_POOL_SIZE", 0),
+			DockerPoolMaxUses:       p.int("ANALYSER_DOCKER_POOL_MAX_USES", 10),
+			DockerMaxContainers:     p.int("ANALYSER_DOCKER_MAX_CONTAINERS", 0),
+			DockerContainerWait:     p.int("ANALYSER_DOCKER_CONTAINER_WAIT", 0),
+			GitSSHKeyFile:           getenv("ANALYSER_GIT_SSH_KEY_FILE"),
+			GitSSHKnownHostsFile:    getenv("ANALYSER_GIT_SSH_KNOWN_HOSTS_FILE"),
+			GoProxy:                 getenv("ANALYSER_GOPROXY"),
+			GoNoSumDB:               getenv("ANALYSER_GONOSUMDB"),
+			GoPrivate:               getenv("ANALYSER_GOPRIVATE"),
+			KeepOnFailure:           p.bool("ANALYSER_KEEP_ON_FAILURE", false),
+		},
+		Queuer: QueuerConfig{
+			Type:                    p.oneOf("QUEUER", "memory", "gcppubsub"),
+			MemoryDrainTimeout:      p.int("QUEUER_MEMORY_DRAIN_TIMEOUT", 0),
+			Paused:                  p.bool("QUEUER_PAUSED", false),
+			GCPPubSubProjectID:      getenv("QUEUER_GCPPUBSUB_PROJECT_ID"),
+			GCPPubSubTopic:          getenv("QUEUER_GCPPUBSUB_TOPIC"),
+			GCPPubSubMaxOutstanding: p.int("QUEUER_GCPPUBSUB_MAX_OUTSTANDING", 1),
+		},
+		GitHub: GitHubConfig{
+			ID:                    p.requiredInt("GITHUB_ID"),
+			PEMFile:               p.required("GITHUB_PEM_FILE"),
+			WebhookSecret:         p.required("GITHUB_WEBHOOK_SECRET"),
+			Apps:                  p.apps("GITHUB_APPS"),
+			InlineCommitThreshold: p.int("GITHUB_INLINE_COMMIT_THRESHOLD", 1),
+			CommitCommentGroupBy:  p.optionalOneOf("GITHUB_COMMIT_COMMENT_GROUP_BY", "", "file", "tool"),
+			OffDiffCommitComment:  p.bool("GITHUB_OFF_DIFF_COMMIT_COMMENT", false),
+			PerToolStatuses:       p.bool("GITHUB_PER_TOOL_STATUSES", false),
+			SkipStatuses:          p.bool("GITHUB_SKIP_STATUSES", false),
+			StatusDuration:        p.bool("GITHUB_STATUS_DURATION", false),
+			NoIssuesDescription:   getenv("GITHUB_NO_ISSUES_DESCRIPTION"),
+			PushCheckRuns:         p.bool("GITHUB_PUSH_CHECK_RUNS", false),
+			PRFilesMaxPages:       p.int("GITHUB_PR_FILES_MAX_PAGES", 0),
+			MinSeverity:           p.optionalOneOf("GITHUB_MIN_SEVERITY", "", "error", "warning", "info"),
+			DailyDurationBudget:   p.int("GITHUB_DAILY_DURATION_BUDGET", 0),
+			PRDebounceWindow:      p.int("GITHUB_PR_DEBOUNCE_WINDOW", 0),
+			PRMergeRef:            p.bool("GITHUB_PR_MERGE_REF", false),
+			CloneProtocol:         p.optionalOneOf("GITHUB_CLONE_PROTOCOL", "event", "event", "https", "ssh"),
+			FullScanSchedule:      getenv("GITHUB_FULL_SCAN_SCHEDULE"),
+			AutoFixCommand:        getenv("GITHUB_AUTOFIX_COMMAND"),
+			AutoFixInstallations:  p.ints("GITHUB_AUTOFIX_INSTALLATIONS"),
+			QuietHours:            p.windows("GITHUB_QUIET_HOURS"),
+			WebhookOrigins:        p.cidrs("GITHUB_WEBHOOK_ORIGINS"),
+			WebhookOriginsMeta:    p.bool("GITHUB_WEBHOOK_ORIGINS_META", false),
+			WebhookProxies:        p.int("GITHUB_WEBHOOK_PROXIES", 0),
+			ResultWebhooks:        p.idPairs("GITHUB_RESULT_WEBHOOKS"),
+			ResultWebhookSecrets:  p.idPairs("GITHUB_RESULT_WEBHOOK_SECRETS"),
+			OAuthClientID:         getenv("GITHUB_OAUTH_CLIENT_ID"),
+			OAuthClientSecret:     getenv("GITHUB_OAUTH_CLIENT_SECRET"),
+		},
+		Secrets: SecretsConfig{
+			VaultAddr:  getenv("VAULT_ADDR"),
+			VaultToken: getenv("VAULT_TOKEN"),
+		},
+	}
+
+	if cfg.HTTPReadHeaderTimeout < 0 {
+		p.errorf("GCI_HTTP_READ_HEADER_TIMEOUT must not be negative, have %d", cfg.HTTPReadHeaderTimeout)
+	}
+	if cfg.HTTPReadTimeout < 0 {
+		p.errorf("GCI_HTTP_READ_TIMEOUT must not be negative, have %d", cfg.HTTPReadTimeout)
+	}
+	if cfg.HTTPWriteTimeout < 0 {
+		p.errorf("GCI_HTTP_WRITE_TIMEOUT must not be negative, have %d", cfg.HTTPWriteTimeout)
+	}
+	if cfg.HTTPIdleTimeout < 0 {
+		p.errorf("GCI_HTTP_IDLE_TIMEOUT must not be negative, have %d", cfg.HTTPIdleTimeout)
+	}
+	if cfg.HTTPHandlerTimeout < 0 {
+		p.errorf("GCI_HTTP_HANDLER_TIMEOUT must not be negative, have %d", cfg.HTTPHandlerTimeout)
+	}
+	if cfg.DB.MaxOutput < 1 {
+		p.errorf("DB_MAX_OUTPUT must be at least 1, have %d", cfg.DB.MaxOutput)
+	}
+	if cfg.Queuer.GCPPubSubMaxOutstanding < 1 {
+		p.errorf("QUEUER_GCPPUBSUB_MAX_OUTSTANDING must be at least 1, have %d", cfg.Queuer.GCPPubSubMaxOutstanding)
+	}
+	if cfg.Analyser.MaxModules < 0 {
+		p.errorf("ANALYSER_MAX_MODULES must not be negative, have %d", cfg.Analyser.MaxModules)
+	}
+	if cfg.GitHub.WebhookProxies < 0 {
+		p.errorf("GITHUB_WEBHOOK_PROXIES must not be negative, have %d", cfg.GitHub.WebhookProxies)
+	}
+	if cfg.Queuer.MemoryDrainTimeout < 0 {
+		p.errorf("QUEUER_MEMORY_DRAIN_TIMEOUT must not be negative, have %d", cfg.Queuer.MemoryDrainTimeout)
+	}
+	if cfg.DB.MaxDiffOutput < 0 {
+		p.errorf("DB_MAX_DIFF_OUTPUT must not be negative, have %d", cfg.DB.MaxDiffOutput)
+	}
+	if cfg.DB.AnalysisRetention < 0 {
+		p.errorf("DB_ANALYSIS_RETENTION must not be negative, have %d", cfg.DB.AnalysisRetention)
+	}
+	if cfg.DB.MaxIssues < 0 {
+		p.errorf("DB_MAX_ISSUES must not be negative, have %d", cfg.DB.MaxIssues)
+	}
+
+	// Dependent values
+	if cfg.Analyser.Type == "filesystem" && cfg.Analyser.FileSystemPath == "" {
+		p.errorf("ANALYSER_FILESYSTEM_PATH is required when ANALYSER is filesystem")
+	}
+	if n := utf8.RuneCountInString(cfg.GitHub.NoIssuesDescription); n > 140 {
+		// GitHub rejects longer status descriptions.
+		p.errorf("GITHUB_NO_ISSUES_DESCRIPTION must be at most 140 characters, have %d", n)
+	}
+	if cfg.Queuer.Type == "gcppubsub" && cfg.Queuer.GCPPubSubProjectID == "" {
+		p.errorf("QUEUER_GCPPUBSUB_PROJECT_ID is required when QUEUER is gcppubsub")
+	}
+	if cfg.Analyser.IssueTemplate != "" {
+		if _, err := analyser.ParseIssueTemplate(cfg.Analyser.IssueTemplate); err != nil {
+			p.errorf("ANALYSER_ISSUE_TEMPLATE is invalid: %v", err)
+		}
+	}
+	if _, err := regexp.Compile(cfg.Analyser.IncompatibleRegexp); err != nil {
+		p.errorf("ANALYSER_INCOMPATIBLE_REGEXP is invalid: %v", err)
+	}
+	if err := analyser.ValidateIssueOrder(cfg.Analyser.IssueOrder); err != nil {
+		p.errorf("ANALYSER_ISSUE_ORDER is invalid: %v", err)
+	}
+	if cfg.GitHub.FullScanSchedule != "" {
+		if _, err := scheduler.Parse(cfg.GitHub.FullScanSchedule); err != nil {
+			p.errorf("GITHUB_FULL_SCAN_SCHEDULE is invalid: %v", err)
+		}
+	}
+	if cfg.Secrets.VaultAddr == "" && cfg.GitHub.usesScheme("vault") {
+		p.errorf("VAULT_ADDR is required when a secret is a vault:// URI")
+	}
+	for id, hook := range cfg.GitHub.ResultWebhooks {
+		if u, err := url.Parse(hook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.errorf("GITHUB_RESULT_WEBHOOKS must have an http or https URL, have %q", hook)
+		}
+		if cfg.GitHub.ResultWebhookSecrets[id] == "" {
+			p.errorf("GITHUB_RESULT_WEBHOOK_SECRETS is required for installation %d in GITHUB_RESULT_WEBHOOKS", id)
+		}
+	}
+	if cfg.GitHub.OAuthClientID != "" && len(cfg.SessionKey) == 0 {
+		p.errorf("GCI_SESSION_KEY is required when GITHUB_OAUTH_CLIENT_ID is set")
+	}
+
+	if len(p.errs) > 0 {
+		return cfg, p.errs
+	}
+	return cfg, nil
+}
+
+// parser parses environment variables, recording any errors and the
+// variables looked up.
+type parser struct {
+	getenv   func(string) string
+	errs     Errors
+	settings []*setting // settings are the variables looked up, in order
+}
+
+// setting is a variable looked up by a parser.
+type setting struct {
+	key   string
+	value string // value is the variable's value, may be blank
+	def   string // def is the default used if value is blank, may be blank
+}
+
+// newParser returns a parser using getenv to lookup each variable.
+func newParser(getenv func(string) string) *parser {
+	p := &parser{}
+	p.getenv = func(key string) string {
+		v := getenv(key)
+		if p.setting(key) == nil {
+			p.settings = append(p.settings, &setting{key: key, value: v})
+		}
+		return v
+	}
+	return p
+}
+
+// setting returns the setting of key, or nil if key has not been looked up.
+func (p *parser) setting(key string) *setting {
+	for _, s := range p.settings {
+		if s.key == key {
+			return s
+		}
+	}
+	return nil
+}
+
+// defaulted records def as the default of key, which has been looked up.
+func (p *parser) defaulted(key string, def interface{}) {
+	if s := p.setting(key); s != nil {
+		s.def = fmt.Sprint(def)
+	}
+}
+
+// errorf records an error.
+func (p *parser) errorf(format string, args ...interface{}) {
+	p.errs = append(p.errs, fmt.Errorf(format, args...))
+}
+
+// string returns the value of key, or def if blank.
+func (p *parser) string(key, def string) string {
+	if v := p.getenv(key); v != "" {
+		return v
+	}
+	p.defaulted(key, def)
+	return def
+}
+
+// required returns the value of key, recording an error if blank.
+func (p *parser) required(key string) string {
+	v := p.getenv(key)
+	if v == "" {
+		p.errorf("%s is required", key)
+	}
+	return v
+}
+
+// oneOf returns the value of key, recording an error if blank or not one of
+// options.
+func (p *parser) oneOf(key string, options ...string) string {
+	v := p.required(key)
+	if v == "" {
+		return v
+	}
+	for _, option := range options {
+		if v == option {
+			return v
+		}
+	}
+	p.errorf("%s must be one of %s, have %q", key, strings.Join(options, ", "), v)
+	return v
+}
+
+// optionalOneOf returns the value of key, or def if blank, recording an error
+// if not one of options.
+func (p *parser) optionalOneOf(key, def string, options ...string) string {
+	if p.getenv(key) == "" {
+		p.defaulted(key, def)
+		return def
+	}
+	return p.oneOf(key, options...)
+}
+
+// int returns the value of key as an int, or def if blank, recording an error
+// if the value could not be parsed.
+func (p *parser) int(key string, def int) int {
+	v := p.getenv(key)
+	if v == "" {
+		p.defaulted(key, def)
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		p.errorf("%s must be an integer, have %q", key, v)
+		return def
+	}
+	return i
+}
+
+// requiredInt returns the value of key as an int, recording an error if blank
+// or the value could not be parsed.
+func (p *parser) requiredInt(key string) int {
+	if p.getenv(key) == "" {
+		p.errorf("%s is required", key)
+		return 0
+	}
+	return p.int(key, 0)
+}
+
+// bool returns the value of key as a bool, or def if blank, recording an error
+// if the value could not be parsed.
+func (p *parser) bool(key string, def bool) bool {
+	v := p.getenv(key)
+	if v == "" {
+		p.defaulted(key, def)
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		p.errorf("%s must be a boolean, have %q", key, v)
+		return def
+	}
+	return b
+}
+
+// list returns the value of key as a comma separated list, ignoring blank
+// items.
+func (p *parser) list(key string) []string {
+	var items []string
+	for _, item := range strings.Split(p.getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ints returns the value of key as a comma separated list of ints, recording
+// an error if an item could not be parsed.
+func (p *parser) ints(key string) []int {
+	var ints []int
+	for _, item := range p.list(key) {
+		i, err := strconv.Atoi(item)
+		if err != nil {
+			p.errorf("%s must be a list of integers, have %q", key, item)
+			continue
+		}
+		ints = append(ints, i)
+	}
+	return ints
+}
+
+// cidrs returns the value of key as a comma separated list of CIDR ranges,
+// recording an error if an item could not be parsed.
+func (p *parser) cidrs(key string) []*net.IPNet {
+	var cidrs []*net.IPNet
+	for _, item := range p.list(key) {
+		_, ipnet, err := net.ParseCIDR(item)
+		if err != nil {
+			p.errorf("%s must be a list of CIDR ranges, have %q", key, item)
+			continue
+		}
+		cidrs = append(cidrs, ipnet)
+	}
+	return cidrs
+}
+
+// pairs returns the value of key as a comma separated list of key=value pairs,
+// recording an error if an item is not a pair. The value may be blank.
+func (p *parser) pairs(key string) map[string]string {
+	items := p.list(key)
+	if len(items) == 0 {
+		return nil
+	}
+	pairs := make(map[string]string, len(items))
+	for _, item := range items {
+		i := strings.IndexByte(item, '=')
+		if i <= 0 {
+			p.errorf("%s must be a list of key=value pairs, have %q", key, item)
+			continue
+		}
+		pairs[strings.TrimSpace(item[:i])] = strings.TrimSpace(item[i+1:])
+	}
+	return pairs
+}
+
+// idPairs returns the value of key as a comma separated list of id=value
+// pairs, recording an error if an id is not an integer. The value may be
+// blank.
+func (p *parser) idPairs(key string) map[int]string {
+	pairs := p.pairs(key)
+	if len(pairs) == 0 {
+		return nil
+	}
+	idPairs := make(map[int]string, len(pairs))
+	for id, v := range pairs {
+		i, err := strconv.Atoi(id)
+		if err != nil {
+			p.errorf("%s must have an integer id, have %q", key, id)
+			continue
+		}
+		idPairs[i] = v
+	}
+	return idPairs
+}
+
+// windows returns the value of key as a comma separated list of id=window
+// pairs, such as 1=22:00-06:00, recording an error if an id is not an integer
+// or a window is invalid.
+func (p *parser) windows(key string) map[int]scheduler.Window {
+	pairs := p.idPairs(key)
+	if len(pairs) == 0 {
+		return nil
+	}
+	windows := make(map[int]scheduler.Window, len(pairs))
+	for id, spec := range pairs {
+		window, err := scheduler.ParseWindow(spec)
+		if err != nil {
+			p.errorf("%s is invalid: %v", key, err)
+			continue
+		}
+		windows[id] = window
+	}
+	return windows
+}
+
+// apps returns the value of key as a comma separated list of
+// id:pem_file:webhook_secret GitHub Apps, recording an error if an item is
+// invalid. The pem_file may be a secret URI, such as vault://path#field.
+func (p *parser) apps(key string) []GitHubAppConfig {
+	var apps []GitHubAppConfig
+	for _, item := range p.list(key) {
+		fields := strings.SplitN(item, ":", 2)
+		if len(fields) == 2 {
+			// Skip the separator after a secret URI's scheme.
+			offset := 0
+			if i := strings.Index(fields[1], "://"); i > 0 && !strings.ContainsRune(fields[1][:i], ':') {
+				offset = i + len("://")
+			}
+			if i := strings.IndexByte(fields[1][offset:], ':'); i >= 0 {
+				fields = append(fields[:1], fields[1][:offset+i], fields[1][offset+i+1:])
+			}
+		}
+		if len(fields) != 3 || fields[1] == "" || fields[2] == "" {
+			p.errorf("%s must be a list of id:pem_file:webhook_secret, have %q", key, item)
+			continue
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			p.errorf("%s must have an integer id, have %q", key, fields[0])
+			continue
+		}
+		apps = append(apps, GitHubAppConfig{ID: id, PEMFile: fields[1], WebhookSecret: fields[2]})
+	}
+	return apps
+}
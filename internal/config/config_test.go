@@ -0,0 +1,347 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+)
+
+// env returns a getenv function which looks up values in vars.
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// required returns the minimum set of valid environment variables.
+func required() map[string]string {
+	return map[string]string{
+		"DB_DRIVER":             "mysql",
+		"ANALYSER":              "docker",
+		"QUEUER":                "memory",
+		"GITHUB_ID":             "1",
+		"GITHUB_PEM_FILE":       "private-key.pem",
+		"GITHUB_WEBHOOK_SECRET": "secret",
+	}
+}
+
+// with returns the required environment variables overridden by vars.
+func with(vars map[string]string) map[string]string {
+	env := required()
+	for key, value := range vars {
+		env[key] = value
+	}
+	return env
+}
+
+func TestLoad_defaults(t *testing.T) {
+	have, err := load(env(required()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := Config{
+		SessionKey:            []byte{},
+		HTTPReadHeaderTimeout: 10,
+		HTTPReadTimeout:       30,
+		HTTPIdleTimeout:       120,
+		HTTPHandlerTimeout:    60,
+		DB:                    DBConfig{Driver: "mysql", MaxOutput: db.DefaultMaxOutput},
+		Analyser: AnalyserConfig{
+			Type:              "docker",
+			DockerImage:       analyser.DockerDefaultImage,
+			DockerPoolMaxUses: 10,
+		},
+		Queuer: QueuerConfig{Type: "memory", GCPPubSubMaxOutstanding: 1},
+		GitHub: GitHubConfig{
+			ID:                    1,
+			PEMFile:               "private-key.pem",
+			WebhookSecret:         "secret",
+			InlineCommitThreshold: 1,
+			CloneProtocol:         "event",
+		},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+}
+
+func TestLoad_values(t *testing.T) {
+	have, err := load(env(with(map[string]string{
+		"GCI_ADMINS":                     "alice, bob,",
+		"LOGGER_SENTRY_ROUTES":           "1=https://key@sentry.io/1, 2=",
+		"GITHUB_AUTOFIX_INSTALLATIONS":   "1, 2",
+		"GITHUB_QUIET_HOURS":             "1=22:00-06:00",
+		"GITHUB_WEBHOOK_ORIGINS":         "192.30.252.0/22, 2a0a:a440::/29",
+		"GITHUB_WEBHOOK_PROXIES":         "1",
+		"GITHUB_RESULT_WEBHOOKS":         "1=https://example.com/hook?id=1",
+		"GITHUB_RESULT_WEBHOOK_SECRETS":  "1=vault://kv/hooks#one",
+		"GITHUB_APPS":                    "2:app2.pem:secret2, 3:app3.pem:sec:ret3, 4:vault://kv/app4#key:vault://kv/app4#secret",
+		"VAULT_ADDR":                     "https://vault:8200",
+		"ANALYSER_MEMORY_LIMIT":          "512",
+		"ANALYSER_SKIP_NON_CODE_CHANGES": "true",
+		"GITHUB_INLINE_COMMIT_THRESHOLD": "0",
+		"GITHUB_COMMIT_COMMENT_GROUP_BY": "tool",
+		"GITHUB_OFF_DIFF_COMMIT_COMMENT": "true",
+		"GITHUB_STATUS_DURATION":         "true",
+		"GITHUB_NO_ISSUES_DESCRIPTION":   "No issues found",
+		"GITHUB_PUSH_CHECK_RUNS":         "true",
+		"ANALYSER_ISSUE_ORDER":           "path, line",
+		"GITHUB_MIN_SEVERITY":            "warning",
+		"ANALYSER_MUTED_TOOLS":           "golint, 3",
+		"ANALYSER_KEEP_ON_FAILURE":       "true",
+		"ANALYSER_INCOMPATIBLE_REGEXP":   "unsupported version",
+		"ANALYSER_GOPRIVATE":             "git.example.com",
+		"GITHUB_CLONE_PROTOCOL":          "ssh",
+		"DB_MAX_OUTPUT":                  "65536",
+		"DB_MAX_DIFF_OUTPUT":             "1024",
+		"DB_ANALYSIS_RETENTION":          "90",
+		"DB_MAX_ISSUES":                  "1000000",
+		"DB_SEED_TOOLS":                  "true",
+		"QUEUER_MEMORY_DRAIN_TIMEOUT":    "30",
+		"QUEUER_PAUSED":                  "true",
+		"ANALYSER_MAX_MODULES":           "5",
+		"GITHUB_SKIP_STATUSES":           "true",
+		"GCI_HTTP_WRITE_TIMEOUT":         "30",
+		"GCI_HTTP_HANDLER_TIMEOUT":       "0",
+	})))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"alice", "bob"}; !reflect.DeepEqual(have.Admins, want) {
+		t.Errorf("admins have: %v, want: %v", have.Admins, want)
+	}
+	if want := map[string]string{"1": "https://key@sentry.io/1", "2": ""}; !reflect.DeepEqual(have.LoggerSentryRoutes, want) {
+		t.Errorf("logger sentry routes have: %v, want: %v", have.LoggerSentryRoutes, want)
+	}
+	if want := "[192.30.252.0/22 2a0a:a440::/29]"; fmt.Sprint(have.GitHub.WebhookOrigins) != want {
+		t.Errorf("webhook origins have: %v, want: %v", have.GitHub.WebhookOrigins, want)
+	}
+	if want := 1; have.GitHub.WebhookProxies != want {
+		t.Errorf("webhook proxies have: %v, want: %v", have.GitHub.WebhookProxies, want)
+	}
+	if want := map[int]string{1: "https://example.com/hook?id=1"}; !reflect.DeepEqual(have.GitHub.ResultWebhooks, want) {
+		t.Errorf("result webhooks have: %v, want: %v", have.GitHub.ResultWebhooks, want)
+	}
+	if want := map[int]string{1: "vault://kv/hooks#one"}; !reflect.DeepEqual(have.GitHub.ResultWebhookSecrets, want) {
+		t.Errorf("result webhook secrets have: %v, want: %v", have.GitHub.ResultWebhookSecrets, want)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(have.GitHub.AutoFixInstallations, want) {
+		t.Errorf("autofix installations have: %v, want: %v", have.GitHub.AutoFixInstallations, want)
+	}
+	if window, ok := have.GitHub.QuietHours[1]; !ok || !window.Contains(time.Date(2017, 9, 15, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("quiet hours have: %v, want: 1=22:00-06:00", have.GitHub.QuietHours)
+	}
+	wantApps := []GitHubAppConfig{
+		{ID: 2, PEMFile: "app2.pem", WebhookSecret: "secret2"},
+		{ID: 3, PEMFile: "app3.pem", WebhookSecret: "sec:ret3"},
+		{ID: 4, PEMFile: "vault://kv/app4#key", WebhookSecret: "vault://kv/app4#secret"},
+	}
+	if !reflect.DeepEqual(have.GitHub.Apps, wantApps) {
+		t.Errorf("apps have: %+v, want: %+v", have.GitHub.Apps, wantApps)
+	}
+	if want := 512; have.Analyser.MemoryLimit != want {
+		t.Errorf("memory limit have: %v, want: %v", have.Analyser.MemoryLimit, want)
+	}
+	if want := true; have.Analyser.SkipNonCodeChanges != want {
+		t.Errorf("skip non code changes have: %v, want: %v", have.Analyser.SkipNonCodeChanges, want)
+	}
+	if want := 0; have.GitHub.InlineCommitThreshold != want {
+		t.Errorf("inline commit threshold have: %v, want: %v", have.GitHub.InlineCommitThreshold, want)
+	}
+	if want := "tool"; have.GitHub.CommitCommentGroupBy != want {
+		t.Errorf("commit comment group by have: %v, want: %v", have.GitHub.CommitCommentGroupBy, want)
+	}
+	if !have.GitHub.OffDiffCommitComment {
+		t.Errorf("off diff commit comment have: %v, want: true", have.GitHub.OffDiffCommitComment)
+	}
+	if want := []string{"path", "line"}; !reflect.DeepEqual(have.Analyser.IssueOrder, want) {
+		t.Errorf("issue order have: %v, want: %v", have.Analyser.IssueOrder, want)
+	}
+	if want := "warning"; have.GitHub.MinSeverity != want {
+		t.Errorf("min severity have: %q, want: %q", have.GitHub.MinSeverity, want)
+	}
+	if want := []string{"golint", "3"}; !reflect.DeepEqual(have.Analyser.MutedTools, want) {
+		t.Errorf("muted tools have: %v, want: %v", have.Analyser.MutedTools, want)
+	}
+	if want := true; have.Analyser.KeepOnFailure != want {
+		t.Errorf("keep on failure have: %v, want: %v", have.Analyser.KeepOnFailure, want)
+	}
+	if want := "git.example.com"; have.Analyser.GoPrivate != want {
+		t.Errorf("go private have: %q, want: %q", have.Analyser.GoPrivate, want)
+	}
+	if want := true; have.GitHub.StatusDuration != want {
+		t.Errorf("status duration have: %v, want: %v", have.GitHub.StatusDuration, want)
+	}
+	if want := "No issues found"; have.GitHub.NoIssuesDescription != want {
+		t.Errorf("no issues description have: %q, want: %q", have.GitHub.NoIssuesDescription, want)
+	}
+	if want := true; have.GitHub.PushCheckRuns != want {
+		t.Errorf("push check runs have: %v, want: %v", have.GitHub.PushCheckRuns, want)
+	}
+	if want := "ssh"; have.GitHub.CloneProtocol != want {
+		t.Errorf("clone protocol have: %v, want: %v", have.GitHub.CloneProtocol, want)
+	}
+	if want := 65536; have.DB.MaxOutput != want {
+		t.Errorf("max output have: %v, want: %v", have.DB.MaxOutput, want)
+	}
+	if want := "unsupported version"; have.Analyser.IncompatibleRegexp != want {
+		t.Errorf("incompatible regexp have: %v, want: %v", have.Analyser.IncompatibleRegexp, want)
+	}
+	if want := 1024; have.DB.MaxDiffOutput != want {
+		t.Errorf("max diff output have: %v, want: %v", have.DB.MaxDiffOutput, want)
+	}
+	if want := 90; have.DB.AnalysisRetention != want {
+		t.Errorf("analysis retention have: %v, want: %v", have.DB.AnalysisRetention, want)
+	}
+	if want := 1000000; have.DB.MaxIssues != want {
+		t.Errorf("max issues have: %v, want: %v", have.DB.MaxIssues, want)
+	}
+	if !have.DB.SeedTools {
+		t.Errorf("seed tools have: %v, want: true", have.DB.SeedTools)
+	}
+	if want := 30; have.Queuer.MemoryDrainTimeout != want {
+		t.Errorf("memory drain timeout have: %v, want: %v", have.Queuer.MemoryDrainTimeout, want)
+	}
+	if !have.Queuer.Paused {
+		t.Errorf("paused have: false, want: true")
+	}
+	if want := 5; have.Analyser.MaxModules != want {
+		t.Errorf("max modules have: %v, want: %v", have.Analyser.MaxModules, want)
+	}
+	if !have.GitHub.SkipStatuses {
+		t.Errorf("skip statuses have: false, want: true")
+	}
+	if want := 10; have.HTTPReadHeaderTimeout != want {
+		t.Errorf("http read header timeout have: %v, want: %v", have.HTTPReadHeaderTimeout, want)
+	}
+	if want := 30; have.HTTPWriteTimeout != want {
+		t.Errorf("http write timeout have: %v, want: %v", have.HTTPWriteTimeout, want)
+	}
+	if want := 0; have.HTTPHandlerTimeout != want {
+		t.Errorf("http handler timeout have: %v, want: %v", have.HTTPHandlerTimeout, want)
+	}
+}
+
+func TestLoad_errors(t *testing.T) {
+	tests := map[string]struct {
+		vars    map[string]string
+		wantErr []string
+	}{
+		"missing required": {
+			vars: map[string]string{},
+			wantErr: []string{
+				"DB_DRIVER is required",
+				"ANALYSER is required",
+				"QUEUER is required",
+				"GITHUB_ID is required",
+				"GITHUB_PEM_FILE is required",
+				"GITHUB_WEBHOOK_SECRET is required",
+			},
+		},
+		"invalid values": {
+			vars: with(map[string]string{
+				"ANALYSER":                         "vm",
+				"ANALYSER_MEMORY_LIMIT":            "lots",
+				"GITHUB_ID":                        "one",
+				"GITHUB_PER_TOOL_STATUSES":         "maybe",
+				"LOGGER_SENTRY_ROUTES":             "1=dsn,nope",
+				"GITHUB_FULL_SCAN_SCHEDULE":        "every night",
+				"GITHUB_AUTOFIX_INSTALLATIONS":     "1,two",
+				"GITHUB_QUIET_HOURS":               "one=22:00-06:00,2=22:00",
+				"GITHUB_WEBHOOK_ORIGINS":           "192.30.252.0/22,192.30.252.1",
+				"GITHUB_WEBHOOK_PROXIES":           "-1",
+				"GITHUB_RESULT_WEBHOOKS":           "1=ftp://example.com,two=https://example.com",
+				"ANALYSER_ISSUE_TEMPLATE":          "{{.Tool}}: {{.Unknown}}",
+				"ANALYSER_INCOMPATIBLE_REGEXP":     "found '['",
+				"GITHUB_APPS":                      "two:app.pem:secret,3:app.pem",
+				"ANALYSER_ISSUE_ORDER":             "severity,tool",
+				"GITHUB_MIN_SEVERITY":              "fatal",
+				"GITHUB_CLONE_PROTOCOL":            "git",
+				"GITHUB_COMMIT_COMMENT_GROUP_BY":   "author",
+				"DB_MAX_OUTPUT":                    "0",
+				"DB_MAX_DIFF_OUTPUT":               "-1",
+				"DB_ANALYSIS_RETENTION":            "-1",
+				"DB_MAX_ISSUES":                    "-1",
+				"QUEUER_GCPPUBSUB_MAX_OUTSTANDING": "0",
+				"QUEUER_MEMORY_DRAIN_TIMEOUT":      "-1",
+				"QUEUER_PAUSED":                    "maybe",
+				"ANALYSER_MAX_MODULES":             "-1",
+				"GITHUB_NO_ISSUES_DESCRIPTION":     strings.Repeat("ʕ", 141),
+				"GCI_HTTP_READ_TIMEOUT":            "-1",
+				"GCI_HTTP_IDLE_TIMEOUT":            "soon",
+				"GCI_HTTP_HANDLER_TIMEOUT":         "-1",
+			}),
+			wantErr: []string{
+				`ANALYSER must be one of docker, filesystem, null, have "vm"`,
+				`ANALYSER_MEMORY_LIMIT must be an integer, have "lots"`,
+				`GITHUB_ID must be an integer, have "one"`,
+				`GITHUB_PER_TOOL_STATUSES must be a boolean, have "maybe"`,
+				`LOGGER_SENTRY_ROUTES must be a list of key=value pairs, have "nope"`,
+				`GITHUB_FULL_SCAN_SCHEDULE is invalid`,
+				`GITHUB_AUTOFIX_INSTALLATIONS must be a list of integers, have "two"`,
+				`GITHUB_QUIET_HOURS must have an integer id, have "one"`,
+				`GITHUB_QUIET_HOURS is invalid`,
+				`GITHUB_WEBHOOK_ORIGINS must be a list of CIDR ranges, have "192.30.252.1"`,
+				`GITHUB_RESULT_WEBHOOKS must have an integer id, have "two"`,
+				`GITHUB_RESULT_WEBHOOKS must have an http or https URL, have "ftp://example.com"`,
+				`GITHUB_RESULT_WEBHOOK_SECRETS is required for installation 1 in GITHUB_RESULT_WEBHOOKS`,
+				`ANALYSER_ISSUE_TEMPLATE is invalid`,
+				`ANALYSER_INCOMPATIBLE_REGEXP is invalid`,
+				`GITHUB_APPS must have an integer id, have "two"`,
+				`GITHUB_APPS must be a list of id:pem_file:webhook_secret, have "3:app.pem"`,
+				`ANALYSER_ISSUE_ORDER is invalid`,
+				`GITHUB_MIN_SEVERITY must be one of error, warning, info, have "fatal"`,
+				`GITHUB_CLONE_PROTOCOL must be one of event, https, ssh, have "git"`,
+				`GITHUB_COMMIT_COMMENT_GROUP_BY must be one of file, tool, have "author"`,
+				`DB_MAX_OUTPUT must be at least 1, have 0`,
+				`DB_MAX_DIFF_OUTPUT must not be negative, have -1`,
+				`DB_ANALYSIS_RETENTION must not be negative, have -1`,
+				`DB_MAX_ISSUES must not be negative, have -1`,
+				`QUEUER_GCPPUBSUB_MAX_OUTSTANDING must be at least 1, have 0`,
+				`QUEUER_MEMORY_DRAIN_TIMEOUT must not be negative, have -1`,
+				`QUEUER_PAUSED must be a boolean, have "maybe"`,
+				`ANALYSER_MAX_MODULES must not be negative, have -1`,
+				`GITHUB_WEBHOOK_PROXIES must not be negative, have -1`,
+				`GITHUB_NO_ISSUES_DESCRIPTION must be at most 140 characters, have 141`,
+				`GCI_HTTP_READ_TIMEOUT must not be negative, have -1`,
+				`GCI_HTTP_IDLE_TIMEOUT must be an integer, have "soon"`,
+				`GCI_HTTP_HANDLER_TIMEOUT must not be negative, have -1`,
+			},
+		},
+		"dependent values": {
+			vars: with(map[string]string{
+				"ANALYSER":               "filesystem",
+				"QUEUER":                 "gcppubsub",
+				"GITHUB_OAUTH_CLIENT_ID": "client-id",
+				"GITHUB_WEBHOOK_SECRET":  "vault://kv/gopherci#webhook_secret",
+			}),
+			wantErr: []string{
+				"ANALYSER_FILESYSTEM_PATH is required when ANALYSER is filesystem",
+				"QUEUER_GCPPUBSUB_PROJECT_ID is required when QUEUER is gcppubsub",
+				"GCI_SESSION_KEY is required when GITHUB_OAUTH_CLIENT_ID is set",
+				"VAULT_ADDR is required when a secret is a vault:// URI",
+			},
+		},
+	}
+
+	for desc, test := range tests {
+		_, err := load(env(test.vars))
+		if err == nil {
+			t.Errorf("%v: expected error", desc)
+			continue
+		}
+		for _, want := range test.wantErr {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%v: error %q does not contain %q", desc, err, want)
+			}
+		}
+		if have, want := len(err.(Errors)), len(test.wantErr); have != want {
+			t.Errorf("%v: have %v errors, want %v: %v", desc, have, want, err)
+		}
+	}
+}
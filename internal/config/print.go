@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bradleyfalzon/gopherci/internal/secrets"
+)
+
+// redacted replaces the value of a secret when printed.
+const redacted = "[redacted]"
+
+// secretKeys are the variables containing secrets, which are redacted when
+// printed. If true, the variable may be a secret URI, which is not redacted.
+var secretKeys = map[string]bool{
+	"LOGGER_SENTRY_DSN":             false,
+	"LOGGER_SENTRY_ROUTES":          false,
+	"GCI_SESSION_KEY":               false,
+	"GCI_HTTP_PROXY":                false, // may contain credentials
+	"DB_PASSWORD":                   false,
+	"GITHUB_WEBHOOK_SECRET":         true,
+	"GITHUB_APPS":                   false,
+	"GITHUB_OAUTH_CLIENT_SECRET":    false,
+	"GITHUB_RESULT_WEBHOOK_SECRETS": false,
+	"VAULT_TOKEN":                   false,
+}
+
+// Print writes each variable of the configuration from the environment, with
+// its effective value, to w, such as DB_PORT=3306. Defaults are marked, and
+// secrets are redacted. If the configuration is invalid, the Errors are
+// returned after printing.
+func Print(w io.Writer) error {
+	return printConfig(w, os.Getenv)
+}
+
+// printConfig writes the configuration using getenv to lookup each variable
+// to w, see Print.
+func printConfig(w io.Writer, getenv func(string) string) error {
+	p := newParser(getenv)
+	_, cfgErr := parse(p)
+	for _, s := range p.settings {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", s.key, s.display()); err != nil {
+			return err
+		}
+	}
+	return cfgErr
+}
+
+// display returns the setting's effective value to print.
+func (s *setting) display() string {
+	switch {
+	case s.value == "" && s.def != "":
+		return s.def + " (default)"
+	case s.value == "":
+		return ""
+	}
+	if allowsURI, ok := secretKeys[s.key]; ok && !(allowsURI && secrets.IsURI(s.value)) {
+		return redacted
+	}
+	return s.value
+}
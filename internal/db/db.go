@@ -4,34 +4,134 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // DB interface provides access to a persistent database.
 type DB interface {
-	// AddGHInstallation records a new installation.
-	AddGHInstallation(installationID, accountID, senderID int) error
+	// AddGHInstallation records a new installation of the GitHub App
+	// integrationID.
+	AddGHInstallation(integrationID, installationID, accountID, senderID int) error
 	// RemoveGHInstallation removes an installation.
 	RemoveGHInstallation(installationID int) error
 	// GetGHInstallation returns an installation for a given installationID, returns
 	// nil if no installation was found, or an error occurs.
 	GetGHInstallation(installationID int) (*GHInstallation, error)
+	// ListGHInstallations returns all enabled installations, ordered by
+	// installationID.
+	ListGHInstallations() ([]GHInstallation, error)
+	// RecordGHInstallationEvent records an installation sent a webhook at the
+	// time at, unknown installations are ignored.
+	RecordGHInstallationEvent(installationID int, at time.Time) error
+	// ListStaleGHInstallations returns enabled installations which haven't
+	// sent a webhook since, ordered by the least recent event first, with
+	// installations which never sent an event first.
+	ListStaleGHInstallations(since time.Time) ([]GHInstallation, error)
+	// SetRepositoryRule allows or denies a repository for an installation,
+	// replacing any existing rule.
+	SetRepositoryRule(installationID, repositoryID int, allowed bool) error
+	// RemoveRepositoryRule removes a repository's rule for an installation.
+	RemoveRepositoryRule(installationID, repositoryID int) error
+	// IsRepositoryAllowed returns true if an installation's repository rules
+	// allow the repository to be analysed, see RepositoryRules.Allowed.
+	IsRepositoryAllowed(installationID, repositoryID int) (bool, error)
+	// GetRepoSettings returns a repository's settings, or the default
+	// settings if the repository has none.
+	GetRepoSettings(repositoryID int) (RepoSettings, error)
+	// SetRepoSettings records a repository's settings, replacing any existing
+	// settings.
+	SetRepoSettings(settings RepoSettings) error
+	// RemoveRepoSettings removes a repository's settings, so the default
+	// settings are used.
+	RemoveRepoSettings(repositoryID int) error
+	// QueuePaused returns true if processing of the queue is paused for
+	// maintenance, shared by all instances.
+	QueuePaused() (bool, error)
+	// SetQueuePaused pauses or resumes processing of the queue.
+	SetQueuePaused(paused bool) error
 	// ListTools returns all tools. Returns nil if no tools were found, error will
 	// be non-nil if an error occurs.
 	ListTools() ([]Tool, error)
-	// StartAnalysis records a new analysis. RequestNumber is a GitHub Pull Request
-	// ID (or Merge Request) and may be 0 for none, if 0 commitTo must be set,
-	// but commitFrom may be blank if this is the first push.
-	StartAnalysis(ghInstallationID, repositoryID int, commitFrom, commitTo string, requestNumber int) (*Analysis, error)
+	// AddTool records a new tool, returning its ID.
+	AddTool(tool Tool) (ToolID, error)
+	// StartAnalysis records a new analysis. Trigger is the type of event which
+	// triggered the analysis. RequestNumber is a GitHub Pull Request ID (or
+	// Merge Request) and may be 0 for none, if 0 commitTo must be set, but
+	// commitFrom may be blank if this is the first push. Branch and author
+	// label the analysis for filtering and may be blank if unknown.
+	StartAnalysis(ghInstallationID, repositoryID int, trigger AnalysisTrigger, commitFrom, commitTo string, requestNumber int, branch, author string) (*Analysis, error)
 	// FinishAnalysis marks a status as finished.
 	FinishAnalysis(analysisID int, status AnalysisStatus, analysis *Analysis) error
 	// GetAnalysis returns an analysis for a given analysisID, returns nil if no
 	// analysis was found, or an error occurs.
 	GetAnalysis(analysisID int) (*Analysis, error)
-	// AnalysisOutputs returns the ordered output from the database.
-	AnalysisOutputs(analysisID int) ([]Output, error)
+	// LatestAnalysis returns the most recent successful analysis of a push
+	// to a repository's branch, returns nil if no analysis was found, or an
+	// error occurs.
+	LatestAnalysis(repositoryID int, branch string) (*Analysis, error)
+	// EachAnalysisOutput calls f with each of an analysis's outputs in order
+	// as they're read from the database, so all outputs are not held in
+	// memory. If f returns an error, no further outputs are read and the
+	// error is returned.
+	EachAnalysisOutput(analysisID int, f func(Output) error) error
+	// AnalysisOutputsPage returns a page of an analysis's outputs matching
+	// filter in order.
+	AnalysisOutputsPage(analysisID int, filter OutputFilter) ([]Output, error)
 	// ExecRecorder records the analysis in the database by wrapping the executer.
 	ExecRecorder(analysisID int, exec Executer) Executer
+	// RecurringIssues returns issues, grouped by path and issue text, found
+	// in at least minCount analyses for a repository, ordered by the most
+	// recurring first.
+	RecurringIssues(repositoryID, minCount int) ([]RecurringIssue, error)
+	// ListAnalyses returns analyses matching filter, ordered by the most
+	// recent first. Tools and issues are not populated.
+	ListAnalyses(filter AnalysisFilter) ([]Analysis, error)
+	// InstallationDuration returns the cumulative total duration of all
+	// analyses for an installation created at or after since.
+	InstallationDuration(ghInstallationID int, since time.Time) (Duration, error)
+	// ListFailedAnalyses returns analyses which finished with an internal
+	// error created at or after since, ordered by the most recent first.
+	ListFailedAnalyses(since time.Time) ([]FailedAnalysis, error)
+	// ListInstallationRepositories returns a summary of each repository
+	// analysed by a GitHub installation, ordered by the most recently
+	// analysed first.
+	ListInstallationRepositories(installationID int) ([]RepositorySummary, error)
+	// ListMigrations returns the applied schema migrations, ordered by
+	// version, the last being the current schema version.
+	ListMigrations() ([]Migration, error)
+}
+
+// AnalysisTrigger is the type of event which triggered an analysis.
+type AnalysisTrigger string
+
+// AnalysisTrigger mappings to the analysis table.
+const (
+	AnalysisTriggerPush        AnalysisTrigger = "push"         // Analysis was triggered by a push.
+	AnalysisTriggerPullRequest AnalysisTrigger = "pull_request" // Analysis was triggered by a pull/merge request.
+	AnalysisTriggerFullScan    AnalysisTrigger = "full_scan"    // Analysis was a full scan of a branch.
+)
+
+// AnalysisFilter filters a list of analyses, blank fields are not filtered.
+type AnalysisFilter struct {
+	RepositoryID int             // RepositoryID is required.
+	Trigger      AnalysisTrigger // Trigger is the type of event.
+	Branch       string          // Branch is the name of the branch.
+	Author       string          // Author is the login of the author.
+	CommitTo     string          // CommitTo is the last commit analysed.
+	Limit        int             // Limit is the maximum number of analyses, 0 uses a default.
+}
+
+// OutputFilter filters and pages an analysis's outputs.
+type OutputFilter struct {
+	Prefix  string   // Prefix only includes outputs whose arguments start with Prefix.
+	Exclude []string // Exclude excludes outputs whose arguments start with any of Exclude.
+	Limit   int      // Limit is the maximum number of outputs, 0 uses a default.
+	Offset  int      // Offset is the number of matching outputs to skip.
 }
 
 // AnalysisStatus represents a status in the analysis table.
@@ -43,6 +143,7 @@ const (
 	AnalysisStatusFailure AnalysisStatus = "Failure" // Analysis is marked as failed.
 	AnalysisStatusSuccess AnalysisStatus = "Success" // Analysis is marked as successful.
 	AnalysisStatusError   AnalysisStatus = "Error"   // Analysis failed due to an internal error.
+	AnalysisStatusSkipped AnalysisStatus = "Skipped" // Analysis was skipped without running, such as when over budget.
 )
 
 var errUnknownAnalysis = errors.New("unknown analysis status")
@@ -62,6 +163,8 @@ func (s *AnalysisStatus) Scan(value interface{}) error {
 		*s = AnalysisStatusSuccess
 	case "Error":
 		*s = AnalysisStatusError
+	case "Skipped":
+		*s = AnalysisStatusSkipped
 	default:
 		return errUnknownAnalysis
 	}
@@ -72,9 +175,14 @@ func (s *AnalysisStatus) Scan(value interface{}) error {
 type GHInstallation struct {
 	ID             int
 	InstallationID int
-	AccountID      int
-	SenderID       int
-	enabledAt      time.Time
+	// IntegrationID is the GitHub App the installation belongs to, 0 if
+	// recorded before multiple GitHub Apps were supported.
+	IntegrationID int
+	AccountID     int
+	SenderID      int
+	// LastEventAt is when the installation last sent a webhook, zero if never.
+	LastEventAt time.Time
+	enabledAt   time.Time
 }
 
 // IsEnabled returns true if the installation is enabled.
@@ -82,6 +190,78 @@ func (i GHInstallation) IsEnabled() bool {
 	return i.enabledAt.Before(time.Now()) && !i.enabledAt.IsZero()
 }
 
+// RepositoryRule allows or denies a single repository for an installation.
+type RepositoryRule struct {
+	InstallationID int  `db:"installation_id"`
+	RepositoryID   int  `db:"repository_id"`
+	Allowed        bool `db:"allowed"`
+}
+
+// RepositoryRules are all the repository rules for an installation.
+type RepositoryRules []RepositoryRule
+
+// Allowed returns true if repositoryID is allowed by the rules. A repository
+// is denied if it has a deny rule, or if there are any allow rules and it
+// isn't one of them. Without any rules all repositories are allowed.
+func (rules RepositoryRules) Allowed(repositoryID int) bool {
+	var allowlist bool
+	for _, rule := range rules {
+		if rule.RepositoryID == repositoryID {
+			return rule.Allowed
+		}
+		if rule.Allowed {
+			allowlist = true
+		}
+	}
+	return !allowlist
+}
+
+// RepoSettings are a repository's settings. The zero value, except for the
+// RepositoryID, is the default for repositories without settings.
+type RepoSettings struct {
+	RepositoryID int
+	// Silent only sets statuses, no comments are made.
+	Silent bool
+	// PRLabel, if not blank, only analyses pull requests with this label.
+	PRLabel string
+	// DisabledTools are the names of tools which are not run.
+	DisabledTools []string
+}
+
+// AllowsLabels returns true if a pull request with labels should be analysed.
+func (s RepoSettings) AllowsLabels(labels []string) bool {
+	if s.PRLabel == "" {
+		return true
+	}
+	for _, label := range labels {
+		if strings.EqualFold(label, s.PRLabel) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnabledTools returns tools without the repository's disabled tools.
+func (s RepoSettings) EnabledTools(tools []Tool) []Tool {
+	if len(s.DisabledTools) == 0 {
+		return tools
+	}
+	var enabled []Tool
+	for _, tool := range tools {
+		disabled := false
+		for _, name := range s.DisabledTools {
+			if strings.EqualFold(tool.Name, name) {
+				disabled = true
+				break
+			}
+		}
+		if !disabled {
+			enabled = append(enabled, tool)
+		}
+	}
+	return enabled
+}
+
 // ToolID is the primary key on the tools table.
 type ToolID int
 
@@ -92,7 +272,47 @@ type Tool struct {
 	URL    string `db:"url"`
 	Path   string `db:"path"`
 	Args   string `db:"args"`
-	Regexp string `db:"regexp"`
+	Regexp string `db:"regexp"` // Regexp may contain multiple newline separated patterns, see Regexps.
+	// VersionArgs are the arguments to print the tool's version, if blank
+	// --version is used.
+	VersionArgs string `db:"version_args"`
+	// WholeNewFiles reports all issues in files added by the patch, not just
+	// issues on lines revgrep can match to the diff, such as issues without a
+	// line number.
+	WholeNewFiles bool `db:"whole_new_files"`
+	// Severity is the severity of the tool's issues, such as error or
+	// warning, available to the issue template. May be blank.
+	Severity string `db:"severity"`
+}
+
+// Regexps returns each pattern in the tool's Regexp, ignoring blank lines. A
+// blank Regexp returns no patterns.
+func (t Tool) Regexps() []string {
+	var patterns []string
+	for _, pattern := range strings.Split(t.Regexp, "\n") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// ValidTools returns the tools whose Regexps compile, and an error for each
+// tool with a pattern which does not, so a misconfigured tool can be skipped
+// instead of failing every analysis. A blank Regexp uses revgrep's default
+// and is valid.
+func ValidTools(tools []Tool) (valid []Tool, invalid []error) {
+tools:
+	for _, tool := range tools {
+		for _, pattern := range tool.Regexps() {
+			if _, err := regexp.Compile(pattern); err != nil {
+				invalid = append(invalid, fmt.Errorf("tool %q (%d) has an invalid regexp: %v", tool.Name, tool.ID, err))
+				continue tools
+			}
+		}
+		valid = append(valid, tool)
+	}
+	return valid, invalid
 }
 
 // Duration is similar to a time.Duration but with extra methods to better
@@ -140,13 +360,27 @@ type Analysis struct {
 	CommitTo       string         `db:"commit_to"`
 	RequestNumber  int            `db:"request_number"`
 	Status         AnalysisStatus `db:"status"`
-	CreatedAt      time.Time      `db:"created_at"`
+
+	// Labels to filter analyses.
+	Trigger AnalysisTrigger `db:"trigger_type"` // Trigger is the type of event which triggered the analysis.
+	Branch  string          `db:"branch"`       // Branch is the name of the branch analysed, may be blank.
+	Author  string          `db:"author"`       // Author is the login of the user who pushed or opened the request, may be blank.
+
+	CreatedAt time.Time `db:"created_at"`
 
 	// When an analysis is finished
 	CloneDuration Duration `db:"clone_duration"` // CloneDuration is the wall clock time taken to run clone.
 	DepsDuration  Duration `db:"deps_duration"`  // DepsDuration is the wall clock time taken to fetch dependencies.
+	BaseDuration  Duration `db:"base_duration"`  // BaseDuration is the wall clock time taken to compare issues with the base ref, 0 if not compared.
 	TotalDuration Duration `db:"total_duration"` // TotalDuration is the wall clock time taken for the entire analysis.
+	SkipReason    string   `db:"skip_reason"`    // SkipReason is why tools were not run, blank if they were.
 	Tools         map[ToolID]AnalysisTool
+
+	// Environment the analysis was executed in, may be blank if unknown.
+	GoVersion       string `db:"go_version"`        // GoVersion is the version of Go, such as go1.9.
+	MaxAddressSpace string `db:"max_address_space"` // MaxAddressSpace is the soft limit of a process's virtual memory in bytes.
+	MaxOpenFiles    string `db:"max_open_files"`    // MaxOpenFiles is the soft limit of a process's open files.
+	MaxProcesses    string `db:"max_processes"`     // MaxProcesses is the soft limit of a user's processes.
 }
 
 // NewAnalysis returns a ready to use analysis.
@@ -156,11 +390,33 @@ func NewAnalysis() *Analysis {
 	}
 }
 
-// Issues returns all the issues by each tool as a slice.
+// Issues returns all the issues by each tool as a slice, ordered by tool ID.
 func (a *Analysis) Issues() []Issue {
+	var toolIDs []int
+	for toolID := range a.Tools {
+		toolIDs = append(toolIDs, int(toolID))
+	}
+	sort.Ints(toolIDs)
+
+	var issues []Issue
+	for _, toolID := range toolIDs {
+		issues = append(issues, a.Tools[ToolID(toolID)].Issues...)
+	}
+	return issues
+}
+
+// OffDiffIssues returns all the issues outside the diff by each tool as a
+// slice, ordered by tool ID.
+func (a *Analysis) OffDiffIssues() []Issue {
+	var toolIDs []int
+	for toolID := range a.Tools {
+		toolIDs = append(toolIDs, int(toolID))
+	}
+	sort.Ints(toolIDs)
+
 	var issues []Issue
-	for _, tool := range a.Tools {
-		issues = append(issues, tool.Issues...)
+	for _, toolID := range toolIDs {
+		issues = append(issues, a.Tools[ToolID(toolID)].OffDiffIssues...)
 	}
 	return issues
 }
@@ -176,12 +432,64 @@ func (a *Analysis) IsPush() bool {
 	return a.RequestNumber == 0
 }
 
+// FailedAnalysis is an analysis which finished with an internal error, and
+// the last command it executed.
+type FailedAnalysis struct {
+	Analysis
+	LastArguments string `db:"last_arguments"` // LastArguments are the arguments of the last command, blank if none.
+	LastOutput    string `db:"last_output"`    // LastOutput is the end of the last command's output, blank if none.
+}
+
+// RepositorySummary is a repository analysed by an installation and the
+// result of its latest analysis.
+type RepositorySummary struct {
+	RepositoryID     int            `db:"repository_id"`
+	Analyses         int            `db:"analyses"`           // Analyses is the number of analyses of the repository.
+	LatestAnalysisID int            `db:"latest_analysis_id"` // LatestAnalysisID is the ID of the latest analysis.
+	Status           AnalysisStatus `db:"status"`             // Status is the status of the latest analysis.
+	Issues           int            `db:"issues"`             // Issues is the number of issues found by the latest analysis.
+	CreatedAt        time.Time      `db:"created_at"`         // CreatedAt is when the latest analysis started.
+}
+
+// Migration is a schema migration applied to the database, recorded in the
+// migrations table.
+type Migration struct {
+	ID        string    `db:"id"`         // ID is the migration's file name, such as 21_repo_settings.sql.
+	AppliedAt time.Time `db:"applied_at"` // AppliedAt is when the migration was applied.
+}
+
+// Version returns the number prefixing the migration's ID, such as 21 for
+// 21_repo_settings.sql, or 0 if the ID has no number.
+func (m Migration) Version() int {
+	i := strings.IndexFunc(m.ID, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(m.ID)
+	}
+	version, _ := strconv.Atoi(m.ID[:i])
+	return version
+}
+
+// sortMigrations sorts migrations by version, and then by ID.
+func sortMigrations(migrations []Migration) {
+	sort.Slice(migrations, func(i, j int) bool {
+		if vi, vj := migrations[i].Version(), migrations[j].Version(); vi != vj {
+			return vi < vj
+		}
+		return migrations[i].ID < migrations[j].ID
+	})
+}
+
 // AnalysisTool contains the timing and result of an individual tool's analysis.
 type AnalysisTool struct {
 	Tool     *Tool    // Tool is the tool.
 	ToolID   ToolID   // ToolID is the ID of the tool.
 	Duration Duration // Duration is the wall clock time taken to run the tool.
+	Version  string   // Version is the version reported by the tool, blank if unknown.
+	Error    string   // Error is why the tool failed, such as running out of memory, blank if it ran.
 	Issues   []Issue  // Issues maybe nil if no issues found.
+	// OffDiffIssues are the issues on unchanged lines of changed files, only
+	// found if requested, and not recorded.
+	OffDiffIssues []Issue
 }
 
 // Issue contains file, position and string describing a single issue.
@@ -192,8 +500,60 @@ type Issue struct {
 	Path string
 	// Line is the line number of the file.
 	Line int
+	// Column is the column number of the line, 0 if unknown.
+	Column int
 	// HunkPos is the position relative to the files first hunk.
 	HunkPos int
+	// EndLine is the last line number of an issue spanning multiple lines,
+	// 0 if the issue is on a single line.
+	EndLine int
+	// EndHunkPos is the position of EndLine relative to the files first hunk,
+	// 0 if the issue is on a single line or EndLine is not in the diff.
+	EndHunkPos int
 	// Issue is the issue.
 	Issue string // maybe this should be issue
+	// Severity is the severity of the tool which found the issue, may be
+	// blank.
+	Severity string
+}
+
+// Anchor returns the name of the HTML anchor of the issue's line, see
+// LineAnchor.
+func (i Issue) Anchor() string {
+	return LineAnchor(i.Path, i.Line)
+}
+
+// LineAnchor returns the name of the HTML anchor of a line in a file with
+// issues. Anchors are based on the location, not an issue's ID, as an issue's
+// ID isn't known until the analysis has been finished, so all issues on a line
+// share its anchor. The path is escaped, so the name can be used as a URL's
+// fragment as is.
+func LineAnchor(path string, line int) string {
+	return fmt.Sprintf("issue-%s-L%d", url.PathEscape(path), line)
+}
+
+// FirstIssue returns the issue appearing first by path and line, or nil if
+// there are no issues.
+func FirstIssue(issues []Issue) *Issue {
+	var first *Issue
+	for i := range issues {
+		issue := &issues[i]
+		switch {
+		case first == nil,
+			issue.Path < first.Path,
+			issue.Path == first.Path && issue.Line < first.Line,
+			issue.Path == first.Path && issue.Line == first.Line && issue.Column < first.Column:
+			first = issue
+		}
+	}
+	return first
+}
+
+// RecurringIssue is an issue that has been found in multiple analyses of a
+// repository.
+type RecurringIssue struct {
+	Path           string `db:"path"`             // Path is the relative path name of the file.
+	Issue          string `db:"issue"`            // Issue is the issue.
+	Count          int    `db:"count"`            // Count is the number of analyses the issue was found in.
+	LastAnalysisID int    `db:"last_analysis_id"` // LastAnalysisID is the most recent analysis the issue was found in.
 }
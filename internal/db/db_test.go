@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -18,6 +19,7 @@ func TestAnalysisStatus_scan(t *testing.T) {
 		{[]uint8("Failure"), AnalysisStatusFailure, nil},
 		{[]uint8("Success"), AnalysisStatusSuccess, nil},
 		{[]uint8("Error"), AnalysisStatusError, nil},
+		{[]uint8("Skipped"), AnalysisStatusSkipped, nil},
 		{[]uint8("NA"), "", errUnknownAnalysis},
 	}
 
@@ -78,16 +80,22 @@ func TestDuration_string(t *testing.T) {
 
 func TestAnalysis_issues(t *testing.T) {
 	analysis := NewAnalysis()
+	analysis.Tools[3] = AnalysisTool{
+		Issues: []Issue{{Issue: "issue3"}},
+	}
 	analysis.Tools[1] = AnalysisTool{
-		Issues: []Issue{{Issue: "issue"}},
+		Issues: []Issue{{Issue: "issue1a"}, {Issue: "issue1b"}},
 	}
 	analysis.Tools[2] = AnalysisTool{
-		Issues: []Issue{{Issue: "issue"}},
+		Issues: []Issue{{Issue: "issue2"}},
 	}
 
-	want := []Issue{{Issue: "issue"}, {Issue: "issue"}}
-	if have := analysis.Issues(); !reflect.DeepEqual(have, want) {
-		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	// Issues are ordered by tool ID, regardless of map iteration order.
+	want := []Issue{{Issue: "issue1a"}, {Issue: "issue1b"}, {Issue: "issue2"}, {Issue: "issue3"}}
+	for i := 0; i < 10; i++ {
+		if have := analysis.Issues(); !reflect.DeepEqual(have, want) {
+			t.Fatalf("\nhave: %#v\nwant: %#v", have, want)
+		}
 	}
 }
 
@@ -100,6 +108,40 @@ func TestAnalysis_htmlurl(t *testing.T) {
 	}
 }
 
+func TestIssue_anchor(t *testing.T) {
+	tests := []struct {
+		issue Issue
+		want  string
+	}{
+		{Issue{ID: 5, Path: "main.go", Line: 12}, "issue-main.go-L12"},
+		{Issue{ID: 6, Path: "pkg/a b#c.go", Line: 3}, "issue-pkg%2Fa%20b%23c.go-L3"},
+	}
+	for _, test := range tests {
+		if have := test.issue.Anchor(); have != test.want {
+			t.Errorf("path: %q have: %q, want: %q", test.issue.Path, have, test.want)
+		}
+	}
+}
+
+func TestFirstIssue(t *testing.T) {
+	tests := []struct {
+		issues []Issue
+		want   *Issue
+	}{
+		{nil, nil},
+		{[]Issue{{Path: "b.go", Line: 1}, {Path: "a.go", Line: 2}}, &Issue{Path: "a.go", Line: 2}},
+		{[]Issue{{Path: "a.go", Line: 2}, {Path: "a.go", Line: 1}}, &Issue{Path: "a.go", Line: 1}},
+		{[]Issue{{Path: "a.go", Line: 1, Column: 5}, {Path: "a.go", Line: 1, Column: 2}}, &Issue{Path: "a.go", Line: 1, Column: 2}},
+	}
+
+	for _, test := range tests {
+		have := FirstIssue(test.issues)
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("issues: %v have: %v, want: %v", test.issues, have, test.want)
+		}
+	}
+}
+
 func TestAnalysis_isPush(t *testing.T) {
 	tests := []struct {
 		RequestNumber int
@@ -122,3 +164,162 @@ func TestAnalysis_isPush(t *testing.T) {
 		}
 	}
 }
+
+func TestRepositoryRules_allowed(t *testing.T) {
+	tests := []struct {
+		rules RepositoryRules
+		want  bool
+	}{
+		{nil, true}, // no rules allows all
+		{RepositoryRules{{RepositoryID: 1, Allowed: true}}, true},
+		{RepositoryRules{{RepositoryID: 1, Allowed: false}}, false},
+		{RepositoryRules{{RepositoryID: 2, Allowed: false}}, true}, // only other repository denied
+		{RepositoryRules{{RepositoryID: 2, Allowed: true}}, false}, // only other repository allowed
+		{RepositoryRules{{RepositoryID: 2, Allowed: true}, {RepositoryID: 1, Allowed: true}}, true},
+	}
+
+	for _, test := range tests {
+		if have := test.rules.Allowed(1); have != test.want {
+			t.Errorf("rules: %+v have: %v, want: %v", test.rules, have, test.want)
+		}
+	}
+}
+
+func TestRepoSettings_allowsLabels(t *testing.T) {
+	tests := []struct {
+		label  string
+		labels []string
+		want   bool
+	}{
+		{"", nil, true}, // no label allows all
+		{"gopherci", nil, false},
+		{"gopherci", []string{"bug", "gopherci"}, true},
+		{"gopherci", []string{"GopherCI"}, true},
+		{"gopherci", []string{"bug"}, false},
+	}
+
+	for _, test := range tests {
+		settings := RepoSettings{RepositoryID: 1, PRLabel: test.label}
+		if have := settings.AllowsLabels(test.labels); have != test.want {
+			t.Errorf("label: %q labels: %v have: %v, want: %v", test.label, test.labels, have, test.want)
+		}
+	}
+}
+
+func TestRepoSettings_enabledTools(t *testing.T) {
+	tools := []Tool{{ID: 1, Name: "go vet"}, {ID: 2, Name: "golint"}, {ID: 3, Name: "staticcheck"}}
+
+	tests := []struct {
+		disabled []string
+		want     []Tool
+	}{
+		{nil, tools},
+		{[]string{"golint"}, []Tool{tools[0], tools[2]}},
+		{[]string{"GoLint", "go vet"}, []Tool{tools[2]}},
+		{[]string{"unknown"}, tools},
+	}
+
+	for _, test := range tests {
+		settings := RepoSettings{RepositoryID: 1, DisabledTools: test.disabled}
+		if have := settings.EnabledTools(tools); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("disabled: %v\nhave: %+v\nwant: %+v", test.disabled, have, test.want)
+		}
+	}
+}
+
+func TestTool_Regexps(t *testing.T) {
+	tests := map[string][]string{
+		"":                           nil,
+		"(.*):(\\d+)() (.*)":         {"(.*):(\\d+)() (.*)"},
+		"a\n\n  b \r\n\n":            {"a", "b"},
+		"(.*):(\\d+)()\n(.*):(\\d+)": {"(.*):(\\d+)()", "(.*):(\\d+)"},
+	}
+	for pattern, want := range tests {
+		if have := (Tool{Regexp: pattern}).Regexps(); !reflect.DeepEqual(have, want) {
+			t.Errorf("%q have: %q, want: %q", pattern, have, want)
+		}
+	}
+}
+
+func TestValidTools(t *testing.T) {
+	tools := []Tool{
+		{ID: 1, Name: "go vet"},
+		{ID: 2, Name: "golint", Regexp: `(.*?):(\d+):(\d+): (.*)`},
+		{ID: 3, Name: "broken", Regexp: `(.*?:(\d+`},
+		{ID: 4, Name: "formats", Regexp: "(.*?):(\\d+):(\\d+): (.*)\n(.*?):(\\d+)() (.*)"},
+		{ID: 5, Name: "broken format", Regexp: "(.*?):(\\d+):(\\d+): (.*)\n(.*?:(\\d+"},
+	}
+
+	valid, invalid := ValidTools(tools)
+	if want := []Tool{tools[0], tools[1], tools[3]}; !reflect.DeepEqual(valid, want) {
+		t.Errorf("valid have: %+v, want: %+v", valid, want)
+	}
+	if len(invalid) != 2 ||
+		!strings.Contains(invalid[0].Error(), `tool "broken" (3) has an invalid regexp`) ||
+		!strings.Contains(invalid[1].Error(), `tool "broken format" (5) has an invalid regexp`) {
+		t.Errorf("invalid have: %v, want broken tools' errors", invalid)
+	}
+}
+
+func TestMigration_version(t *testing.T) {
+	tests := map[string]int{
+		"1_gh_installations.sql": 1,
+		"21_repo_settings.sql":   21,
+		"22":                     22,
+		"seed.sql":               0,
+		"":                       0,
+	}
+	for id, want := range tests {
+		if have := (Migration{ID: id}).Version(); have != want {
+			t.Errorf("%q have: %v, want: %v", id, have, want)
+		}
+	}
+}
+
+func TestSortMigrations(t *testing.T) {
+	migrations := []Migration{{ID: "10_b.sql"}, {ID: "2_a.sql"}, {ID: "1_b.sql"}, {ID: "1_a.sql"}}
+	sortMigrations(migrations)
+
+	want := []Migration{{ID: "1_a.sql"}, {ID: "1_b.sql"}, {ID: "2_a.sql"}, {ID: "10_b.sql"}}
+	if !reflect.DeepEqual(migrations, want) {
+		t.Errorf("have: %v, want: %v", migrations, want)
+	}
+}
+
+func TestSeedTools(t *testing.T) {
+	db := NewMockDB()
+
+	n, err := SeedTools(db, DefaultTools)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != len(DefaultTools) {
+		t.Errorf("seeded have: %v, want: %v", n, len(DefaultTools))
+	}
+	if len(db.Tools) != len(DefaultTools) {
+		t.Fatalf("tools have: %v, want: %v", len(db.Tools), len(DefaultTools))
+	}
+	for i, tool := range db.Tools {
+		want := DefaultTools[i]
+		want.ID = ToolID(i + 1)
+		if !reflect.DeepEqual(tool, want) {
+			t.Errorf("tool have: %+v, want: %+v", tool, want)
+		}
+	}
+
+	// Existing tools are not seeded
+	n, err = SeedTools(db, DefaultTools)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 0 || len(db.Tools) != len(DefaultTools) {
+		t.Errorf("seeded have: %v with %v tools, want: 0 with %v tools", n, len(db.Tools), len(DefaultTools))
+	}
+
+	// Errors
+	db = NewMockDB()
+	db.ForceError(fmt.Errorf("forced"))
+	if _, err := SeedTools(db, DefaultTools); err == nil {
+		t.Error("expected error")
+	}
+}
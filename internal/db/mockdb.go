@@ -1,13 +1,25 @@
 package db
 
-import "time"
+import (
+	"sort"
+	"strings"
+	"time"
+)
 
 // MockDB is an in-memory database repository implementing the DB interface
 // used for testing
 type MockDB struct {
-	installations map[int]GHInstallation // installationID -> exists
+	installations map[int]GHInstallation  // installationID -> exists
+	lastID        int                     // lastID is the last gh_installations ID assigned
+	rules         map[int]RepositoryRules // installationID -> rules
+	settings      map[int]RepoSettings    // repositoryID -> settings
+	paused        bool                    // paused is whether the queue is paused
 	err           error
 	Tools         []Tool
+	Analysis      *Analysis   // Analysis is returned by GetAnalysis if the ID matches
+	Outputs       []Output    // Outputs are returned by EachAnalysisOutput
+	Analyses      []Analysis  // Analyses is filtered and returned by ListAnalyses
+	Migrations    []Migration // Migrations are sorted and returned by ListMigrations
 }
 
 // Ensure MockDB implements DB
@@ -17,6 +29,8 @@ var _ DB = (*MockDB)(nil)
 func NewMockDB() *MockDB {
 	return &MockDB{
 		installations: make(map[int]GHInstallation),
+		rules:         make(map[int]RepositoryRules),
+		settings:      make(map[int]RepoSettings),
 	}
 }
 
@@ -26,9 +40,15 @@ func (db *MockDB) ForceError(err error) {
 }
 
 // AddGHInstallation implements DB interface
-func (db *MockDB) AddGHInstallation(installationID, accountID, senderID int) error {
+func (db *MockDB) AddGHInstallation(integrationID, installationID, accountID, senderID int) error {
+	if _, ok := db.installations[installationID]; ok {
+		return db.err // ignore duplicates
+	}
+	db.lastID++
 	db.installations[installationID] = GHInstallation{
+		ID:             db.lastID,
 		InstallationID: installationID,
+		IntegrationID:  integrationID,
 		AccountID:      accountID,
 		SenderID:       senderID,
 	}
@@ -49,6 +69,65 @@ func (db *MockDB) EnableGHInstallation(installationID int) error {
 	return db.err
 }
 
+// SetRepositoryRule implements DB interface
+func (db *MockDB) SetRepositoryRule(installationID, repositoryID int, allowed bool) error {
+	db.RemoveRepositoryRule(installationID, repositoryID)
+	db.rules[installationID] = append(db.rules[installationID], RepositoryRule{
+		InstallationID: installationID,
+		RepositoryID:   repositoryID,
+		Allowed:        allowed,
+	})
+	return db.err
+}
+
+// RemoveRepositoryRule implements DB interface
+func (db *MockDB) RemoveRepositoryRule(installationID, repositoryID int) error {
+	var rules RepositoryRules
+	for _, rule := range db.rules[installationID] {
+		if rule.RepositoryID != repositoryID {
+			rules = append(rules, rule)
+		}
+	}
+	db.rules[installationID] = rules
+	return db.err
+}
+
+// IsRepositoryAllowed implements DB interface
+func (db *MockDB) IsRepositoryAllowed(installationID, repositoryID int) (bool, error) {
+	return db.rules[installationID].Allowed(repositoryID), db.err
+}
+
+// GetRepoSettings implements DB interface
+func (db *MockDB) GetRepoSettings(repositoryID int) (RepoSettings, error) {
+	if settings, ok := db.settings[repositoryID]; ok {
+		return settings, db.err
+	}
+	return RepoSettings{RepositoryID: repositoryID}, db.err
+}
+
+// SetRepoSettings implements DB interface
+func (db *MockDB) SetRepoSettings(settings RepoSettings) error {
+	db.settings[settings.RepositoryID] = settings
+	return db.err
+}
+
+// RemoveRepoSettings implements DB interface
+func (db *MockDB) RemoveRepoSettings(repositoryID int) error {
+	delete(db.settings, repositoryID)
+	return db.err
+}
+
+// QueuePaused implements DB interface
+func (db *MockDB) QueuePaused() (bool, error) {
+	return db.paused, db.err
+}
+
+// SetQueuePaused implements DB interface
+func (db *MockDB) SetQueuePaused(paused bool) error {
+	db.paused = paused
+	return db.err
+}
+
 // GetGHInstallation implements DB interface
 func (db *MockDB) GetGHInstallation(installationID int) (*GHInstallation, error) {
 	if installation, ok := db.installations[installationID]; ok {
@@ -57,18 +136,76 @@ func (db *MockDB) GetGHInstallation(installationID int) (*GHInstallation, error)
 	return nil, db.err
 }
 
+// ListGHInstallations implements DB interface
+func (db *MockDB) ListGHInstallations() ([]GHInstallation, error) {
+	var installations []GHInstallation
+	for _, installation := range db.installations {
+		if installation.IsEnabled() {
+			installations = append(installations, installation)
+		}
+	}
+	sort.Slice(installations, func(i, j int) bool {
+		return installations[i].InstallationID < installations[j].InstallationID
+	})
+	return installations, db.err
+}
+
+// RecordGHInstallationEvent implements DB interface
+func (db *MockDB) RecordGHInstallationEvent(installationID int, at time.Time) error {
+	if installation, ok := db.installations[installationID]; ok {
+		installation.LastEventAt = at
+		db.installations[installationID] = installation
+	}
+	return db.err
+}
+
+// ListStaleGHInstallations implements DB interface
+func (db *MockDB) ListStaleGHInstallations(since time.Time) ([]GHInstallation, error) {
+	installations, _ := db.ListGHInstallations()
+	return staleGHInstallations(installations, since), db.err
+}
+
+// staleGHInstallations returns the installations whose last event was before
+// since, ordered by the least recent event first, see ListStaleGHInstallations.
+func staleGHInstallations(installations []GHInstallation, since time.Time) []GHInstallation {
+	var stale []GHInstallation
+	for _, installation := range installations {
+		if installation.LastEventAt.Before(since) {
+			stale = append(stale, installation)
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool {
+		return stale[i].LastEventAt.Before(stale[j].LastEventAt)
+	})
+	return stale
+}
+
 // ListTools implements DB interface
 func (db *MockDB) ListTools() ([]Tool, error) {
 	return db.Tools, nil
 }
 
+// AddTool implements the DB interface.
+func (db *MockDB) AddTool(tool Tool) (ToolID, error) {
+	if db.err != nil {
+		return 0, db.err
+	}
+	tool.ID = ToolID(len(db.Tools) + 1)
+	db.Tools = append(db.Tools, tool)
+	return tool.ID, nil
+}
+
 // StartAnalysis implements the DB interface.
-func (db *MockDB) StartAnalysis(ghInstallationID, repositoryID int, commitFrom, commitTo string, requestNumber int) (*Analysis, error) {
+func (db *MockDB) StartAnalysis(ghInstallationID, repositoryID int, trigger AnalysisTrigger, commitFrom, commitTo string, requestNumber int, branch, author string) (*Analysis, error) {
 	analysis := NewAnalysis()
 	analysis.ID = 99
+	analysis.RepositoryID = repositoryID
 	analysis.CommitFrom = commitFrom
 	analysis.CommitTo = commitTo
 	analysis.RequestNumber = requestNumber
+	analysis.Trigger = trigger
+	analysis.Branch = branch
+	analysis.Author = author
 	return analysis, nil
 }
 
@@ -79,15 +216,160 @@ func (db *MockDB) FinishAnalysis(analysisID int, status AnalysisStatus, analysis
 
 // GetAnalysis implements the DB interface.
 func (db *MockDB) GetAnalysis(analysisID int) (*Analysis, error) {
-	return nil, nil
+	if db.Analysis != nil && db.Analysis.ID == analysisID {
+		return db.Analysis, db.err
+	}
+	return nil, db.err
+}
+
+// LatestAnalysis implements the DB interface.
+func (db *MockDB) LatestAnalysis(repositoryID int, branch string) (*Analysis, error) {
+	if db.Analysis != nil && db.Analysis.RepositoryID == repositoryID && db.Analysis.Branch == branch {
+		return db.Analysis, db.err
+	}
+	return nil, db.err
 }
 
-// AnalysisOutputs implements the DB interface.
-func (db *MockDB) AnalysisOutputs(analysisID int) ([]Output, error) {
-	return nil, nil
+// EachAnalysisOutput implements the DB interface.
+func (db *MockDB) EachAnalysisOutput(analysisID int, f func(Output) error) error {
+	if db.err != nil {
+		return db.err
+	}
+	for _, output := range db.Outputs {
+		if output.AnalysisID != analysisID {
+			continue
+		}
+		if err := f(output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AnalysisOutputsPage implements the DB interface.
+func (db *MockDB) AnalysisOutputsPage(analysisID int, filter OutputFilter) ([]Output, error) {
+	var outputs []Output
+	for _, output := range db.Outputs {
+		if output.AnalysisID != analysisID || !strings.HasPrefix(output.Arguments, filter.Prefix) {
+			continue
+		}
+		excluded := false
+		for _, exclude := range filter.Exclude {
+			if strings.HasPrefix(output.Arguments, exclude) {
+				excluded = true
+			}
+		}
+		if !excluded {
+			outputs = append(outputs, output)
+		}
+	}
+	if filter.Offset >= len(outputs) {
+		return nil, db.err
+	}
+	outputs = outputs[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(outputs) {
+		outputs = outputs[:filter.Limit]
+	}
+	return outputs, db.err
 }
 
 // ExecRecorder implements the DB interface.
 func (db *MockDB) ExecRecorder(analysisID int, executer Executer) Executer {
 	return executer
 }
+
+// ListAnalyses implements the DB interface.
+func (db *MockDB) ListAnalyses(filter AnalysisFilter) ([]Analysis, error) {
+	var analyses []Analysis
+	for _, analysis := range db.Analyses {
+		switch {
+		case analysis.RepositoryID != filter.RepositoryID:
+		case filter.Trigger != "" && analysis.Trigger != filter.Trigger:
+		case filter.Branch != "" && analysis.Branch != filter.Branch:
+		case filter.Author != "" && analysis.Author != filter.Author:
+		case filter.CommitTo != "" && analysis.CommitTo != filter.CommitTo:
+		default:
+			analyses = append(analyses, analysis)
+		}
+	}
+	return analyses, db.err
+}
+
+// InstallationDuration implements the DB interface, analyses are matched by
+// the GitHub installation ID of the installation with ghInstallationID.
+func (db *MockDB) InstallationDuration(ghInstallationID int, since time.Time) (Duration, error) {
+	var installationID int
+	for _, installation := range db.installations {
+		if installation.ID == ghInstallationID {
+			installationID = installation.InstallationID
+		}
+	}
+	var total Duration
+	for _, analysis := range db.Analyses {
+		if installationID != 0 && analysis.InstallationID == installationID && !analysis.CreatedAt.Before(since) {
+			total += analysis.TotalDuration
+		}
+	}
+	return total, db.err
+}
+
+// ListFailedAnalyses implements the DB interface, the last output is from
+// Outputs.
+func (db *MockDB) ListFailedAnalyses(since time.Time) ([]FailedAnalysis, error) {
+	var analyses []FailedAnalysis
+	for _, analysis := range db.Analyses {
+		if analysis.Status != AnalysisStatusError || analysis.CreatedAt.Before(since) {
+			continue
+		}
+		failed := FailedAnalysis{Analysis: analysis}
+		for _, output := range db.Outputs {
+			if output.AnalysisID == analysis.ID {
+				failed.LastArguments = output.Arguments
+				failed.LastOutput = output.Output
+			}
+		}
+		analyses = append(analyses, failed)
+	}
+	return analyses, db.err
+}
+
+// ListMigrations implements the DB interface.
+func (db *MockDB) ListMigrations() ([]Migration, error) {
+	migrations := append([]Migration(nil), db.Migrations...)
+	sortMigrations(migrations)
+	return migrations, db.err
+}
+
+// ListInstallationRepositories implements the DB interface, summarising
+// Analyses.
+func (db *MockDB) ListInstallationRepositories(installationID int) ([]RepositorySummary, error) {
+	var repos []RepositorySummary
+	index := make(map[int]int) // repositoryID -> index in repos
+	for _, analysis := range db.Analyses {
+		if analysis.InstallationID != installationID {
+			continue
+		}
+		i, ok := index[analysis.RepositoryID]
+		if !ok {
+			i = len(repos)
+			index[analysis.RepositoryID] = i
+			repos = append(repos, RepositorySummary{RepositoryID: analysis.RepositoryID})
+		}
+		repos[i].Analyses++
+		if analysis.ID > repos[i].LatestAnalysisID {
+			repos[i].LatestAnalysisID = analysis.ID
+			repos[i].Status = analysis.Status
+			repos[i].Issues = len(analysis.Issues())
+			repos[i].CreatedAt = analysis.CreatedAt
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].LatestAnalysisID > repos[j].LatestAnalysisID
+	})
+	return repos, db.err
+}
+
+// RecurringIssues implements the DB interface.
+func (db *MockDB) RecurringIssues(repositoryID, minCount int) ([]RecurringIssue, error) {
+	return nil, db.err
+}
@@ -3,24 +3,28 @@ package db
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestMockDB(t *testing.T) {
 	db := NewMockDB()
 
 	const (
+		integrationID  = 1
 		installationID = 2
 		accountID      = 3
 		senderID       = 4
 	)
 
-	err := db.AddGHInstallation(installationID, accountID, senderID)
+	err := db.AddGHInstallation(integrationID, installationID, accountID, senderID)
 	if err != nil {
 		t.Fatal("unexpected error:", err)
 	}
 
 	want := &GHInstallation{
+		ID:             1,
 		InstallationID: installationID,
+		IntegrationID:  integrationID,
 		AccountID:      accountID,
 		SenderID:       senderID,
 	}
@@ -47,3 +51,229 @@ func TestMockDB(t *testing.T) {
 		t.Fatal("expected nil, got:", installation)
 	}
 }
+
+func TestMockDB_installationEvents(t *testing.T) {
+	db := NewMockDB()
+	for _, installationID := range []int{1, 2, 3} {
+		db.AddGHInstallation(1, installationID, 3, 4)
+		db.EnableGHInstallation(installationID)
+	}
+
+	now := time.Date(2017, 10, 16, 12, 0, 0, 0, time.UTC)
+	if err := db.RecordGHInstallationEvent(1, now); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := db.RecordGHInstallationEvent(2, now.AddDate(0, 0, -10)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := db.RecordGHInstallationEvent(4, now); err != nil { // unknown
+		t.Fatal("unexpected error:", err)
+	}
+
+	installation, _ := db.GetGHInstallation(1)
+	if !installation.LastEventAt.Equal(now) {
+		t.Errorf("last event at have: %v, want: %v", installation.LastEventAt, now)
+	}
+
+	stale, err := db.ListStaleGHInstallations(now.AddDate(0, 0, -7))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	var have []int
+	for _, installation := range stale {
+		have = append(have, installation.InstallationID)
+	}
+	if want := []int{3, 2}; !reflect.DeepEqual(have, want) {
+		t.Errorf("stale installations have: %v, want: %v", have, want)
+	}
+}
+
+func TestMockDB_listAnalyses(t *testing.T) {
+	db := NewMockDB()
+
+	analysis, err := db.StartAnalysis(1, 2, AnalysisTriggerPullRequest, "", "abcdef", 3, "feature", "gopher")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if analysis.Trigger != AnalysisTriggerPullRequest || analysis.Branch != "feature" || analysis.Author != "gopher" {
+		t.Fatalf("unexpected labels: %+v", analysis)
+	}
+
+	db.Analyses = []Analysis{
+		{ID: 1, RepositoryID: 2, Trigger: AnalysisTriggerPush, Branch: "master", Author: "gopher", CommitTo: "abcdef"},
+		{ID: 2, RepositoryID: 2, Trigger: AnalysisTriggerPullRequest, Branch: "feature", Author: "gopher"},
+		{ID: 3, RepositoryID: 2, Trigger: AnalysisTriggerPush, Branch: "master", Author: "other"},
+		{ID: 4, RepositoryID: 5, Trigger: AnalysisTriggerPush, Branch: "master", Author: "gopher"},
+	}
+
+	tests := []struct {
+		filter  AnalysisFilter
+		wantIDs []int
+	}{
+		{AnalysisFilter{RepositoryID: 2}, []int{1, 2, 3}},
+		{AnalysisFilter{RepositoryID: 2, Trigger: AnalysisTriggerPush}, []int{1, 3}},
+		{AnalysisFilter{RepositoryID: 2, Branch: "feature"}, []int{2}},
+		{AnalysisFilter{RepositoryID: 2, Trigger: AnalysisTriggerPush, Author: "gopher"}, []int{1}},
+		{AnalysisFilter{RepositoryID: 2, CommitTo: "abcdef"}, []int{1}},
+		{AnalysisFilter{RepositoryID: 3}, nil},
+	}
+
+	for _, test := range tests {
+		analyses, err := db.ListAnalyses(test.filter)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		var haveIDs []int
+		for _, analysis := range analyses {
+			haveIDs = append(haveIDs, analysis.ID)
+		}
+		if !reflect.DeepEqual(haveIDs, test.wantIDs) {
+			t.Errorf("filter %+v\nhave: %v\nwant: %v", test.filter, haveIDs, test.wantIDs)
+		}
+	}
+}
+
+func TestMockDB_installationDuration(t *testing.T) {
+	db := NewMockDB()
+	_ = db.AddGHInstallation(0, 10, 3, 4)
+	_ = db.AddGHInstallation(0, 20, 3, 4)
+	install, _ := db.GetGHInstallation(10)
+
+	today := time.Date(2017, 10, 16, 0, 0, 0, 0, time.UTC)
+	db.Analyses = []Analysis{
+		{ID: 1, InstallationID: 10, CreatedAt: today.Add(-time.Hour), TotalDuration: Duration(time.Hour)}, // yesterday
+		{ID: 2, InstallationID: 10, CreatedAt: today, TotalDuration: Duration(2 * time.Minute)},
+		{ID: 3, InstallationID: 10, CreatedAt: today.Add(time.Hour), TotalDuration: Duration(3 * time.Minute)},
+		{ID: 4, InstallationID: 20, CreatedAt: today.Add(time.Hour), TotalDuration: Duration(time.Hour)}, // other installation
+		{ID: 5, InstallationID: install.ID, CreatedAt: today, TotalDuration: Duration(time.Hour)},        // internal ID
+	}
+
+	// The GitHub installation ID and gh_installations ID must differ.
+	if install.ID == install.InstallationID {
+		t.Fatalf("installation ID %v is the GitHub installation ID", install.ID)
+	}
+
+	have, err := db.InstallationDuration(install.ID, today)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if want := Duration(5 * time.Minute); have != want {
+		t.Errorf("have: %v, want: %v", have, want)
+	}
+}
+
+func TestMockDB_listFailedAnalyses(t *testing.T) {
+	db := NewMockDB()
+
+	today := time.Date(2017, 10, 16, 0, 0, 0, 0, time.UTC)
+	db.Analyses = []Analysis{
+		{ID: 1, Status: AnalysisStatusError, CreatedAt: today.Add(-time.Hour)}, // yesterday
+		{ID: 2, Status: AnalysisStatusError, CreatedAt: today},
+		{ID: 3, Status: AnalysisStatusFailure, CreatedAt: today}, // issues found
+	}
+	db.Outputs = []Output{
+		{ID: 1, AnalysisID: 2, Arguments: "git clone", Output: "cloned"},
+		{ID: 2, AnalysisID: 2, Arguments: "go get", Output: "could not fetch"},
+		{ID: 3, AnalysisID: 3, Arguments: "golint", Output: "issue"},
+	}
+
+	have, err := db.ListFailedAnalyses(today)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	want := []FailedAnalysis{
+		{Analysis: db.Analyses[1], LastArguments: "go get", LastOutput: "could not fetch"},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+}
+
+func TestMockDB_listInstallationRepositories(t *testing.T) {
+	db := NewMockDB()
+
+	today := time.Date(2017, 10, 16, 0, 0, 0, 0, time.UTC)
+	issues := map[ToolID]AnalysisTool{1: {Issues: []Issue{{Issue: "first"}, {Issue: "second"}}}}
+	db.Analyses = []Analysis{
+		{ID: 1, InstallationID: 1, RepositoryID: 10, Status: AnalysisStatusFailure, CreatedAt: today, Tools: issues},
+		{ID: 2, InstallationID: 1, RepositoryID: 20, Status: AnalysisStatusError, CreatedAt: today.Add(time.Minute)},
+		{ID: 3, InstallationID: 1, RepositoryID: 10, Status: AnalysisStatusSuccess, CreatedAt: today.Add(time.Hour)},
+		{ID: 4, InstallationID: 2, RepositoryID: 30, Status: AnalysisStatusSuccess, CreatedAt: today}, // other installation
+		{ID: 5, InstallationID: 1, RepositoryID: 20, Status: AnalysisStatusFailure, CreatedAt: today.Add(2 * time.Hour), Tools: issues},
+	}
+
+	have, err := db.ListInstallationRepositories(1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	want := []RepositorySummary{
+		{RepositoryID: 20, Analyses: 2, LatestAnalysisID: 5, Status: AnalysisStatusFailure, Issues: 2, CreatedAt: today.Add(2 * time.Hour)},
+		{RepositoryID: 10, Analyses: 2, LatestAnalysisID: 3, Status: AnalysisStatusSuccess, Issues: 0, CreatedAt: today.Add(time.Hour)},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %+v\nwant: %+v", have, want)
+	}
+}
+
+func TestMockDB_repositoryRules(t *testing.T) {
+	db := NewMockDB()
+
+	if allowed, _ := db.IsRepositoryAllowed(1, 2); !allowed {
+		t.Errorf("repository not allowed without rules")
+	}
+
+	_ = db.SetRepositoryRule(1, 2, false)
+	if allowed, _ := db.IsRepositoryAllowed(1, 2); allowed {
+		t.Errorf("denied repository allowed")
+	}
+
+	// Replacing a rule
+	_ = db.SetRepositoryRule(1, 2, true)
+	if allowed, _ := db.IsRepositoryAllowed(1, 2); !allowed {
+		t.Errorf("allowed repository denied")
+	}
+	if allowed, _ := db.IsRepositoryAllowed(1, 3); allowed {
+		t.Errorf("repository not in allowlist allowed")
+	}
+	if allowed, _ := db.IsRepositoryAllowed(2, 3); !allowed {
+		t.Errorf("other installation's rules applied")
+	}
+
+	_ = db.RemoveRepositoryRule(1, 2)
+	if allowed, _ := db.IsRepositoryAllowed(1, 3); !allowed {
+		t.Errorf("repository not allowed after rules removed")
+	}
+}
+
+func TestMockDB_repoSettings(t *testing.T) {
+	db := NewMockDB()
+
+	have, err := db.GetRepoSettings(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (RepoSettings{RepositoryID: 2}); !reflect.DeepEqual(have, want) {
+		t.Errorf("default settings have: %+v, want: %+v", have, want)
+	}
+
+	want := RepoSettings{RepositoryID: 2, Silent: true, PRLabel: "gopherci", DisabledTools: []string{"golint"}}
+	_ = db.SetRepoSettings(want)
+	if have, _ := db.GetRepoSettings(2); !reflect.DeepEqual(have, want) {
+		t.Errorf("settings have: %+v, want: %+v", have, want)
+	}
+
+	// Replacing settings
+	want = RepoSettings{RepositoryID: 2, PRLabel: "analyse"}
+	_ = db.SetRepoSettings(want)
+	if have, _ := db.GetRepoSettings(2); !reflect.DeepEqual(have, want) {
+		t.Errorf("replaced settings have: %+v, want: %+v", have, want)
+	}
+	if have, _ := db.GetRepoSettings(3); !reflect.DeepEqual(have, RepoSettings{RepositoryID: 3}) {
+		t.Errorf("other repository's settings applied: %+v", have)
+	}
+
+	_ = db.RemoveRepoSettings(2)
+	if have, _ := db.GetRepoSettings(2); !reflect.DeepEqual(have, RepoSettings{RepositoryID: 2}) {
+		t.Errorf("settings have: %+v after remove, want default", have)
+	}
+}
@@ -0,0 +1,35 @@
+package db
+
+import "fmt"
+
+// DefaultTools are the tools added by SeedTools, matching the tools added by
+// the migrations.
+var DefaultTools = []Tool{
+	{Name: "go vet", URL: "https://golang.org/cmd/vet/", Path: "go", Args: "vet ./..."},
+	{Name: "golint", URL: "https://github.com/golang/lint", Path: "golint", Args: "./..."},
+	{Name: "apicompat", URL: "https://github.com/bradleyfalzon/apicompat", Path: "apicompat", Args: "-before %BASE_BRANCH% ./...", Regexp: `.*?:(.*?\.go):([0-9]+):()(.*)`},
+	{Name: "gosimple", URL: "https://github.com/dominikh/go-tools/tree/master/cmd/gosimple", Path: "gosimple", Args: "./..."},
+	{Name: "staticcheck", URL: "https://github.com/dominikh/go-tools/tree/master/cmd/staticcheck", Path: "staticcheck", Args: "./..."},
+	{Name: "unused", URL: "https://github.com/dominikh/go-tools/tree/master/cmd/unused", Path: "unused", Args: "./..."},
+	{Name: "unparam", URL: "https://github.com/mvdan/unparam", Path: "unparam", Args: "./..."},
+	{Name: "unconvert", URL: "https://github.com/mdempsky/unconvert", Path: "unconvert", Args: "./..."},
+}
+
+// SeedTools adds tools to db if db has no tools, such as when all tools have
+// been removed, so analyses always run some tools. Returns the number of tools
+// added.
+func SeedTools(db DB, tools []Tool) (int, error) {
+	existing, err := db.ListTools()
+	if err != nil {
+		return 0, fmt.Errorf("could not list tools: %v", err)
+	}
+	if len(existing) > 0 {
+		return 0, nil
+	}
+	for i, tool := range tools {
+		if _, err := db.AddTool(tool); err != nil {
+			return i, fmt.Errorf("could not add tool %q: %v", tool.Name, err)
+		}
+	}
+	return len(tools), nil
+}
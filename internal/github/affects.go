@@ -0,0 +1,55 @@
+package github
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// affectsGoTTL is the duration a pull request's affects Go decision is cached,
+// so repeated events for the same head commit don't list its files again.
+const affectsGoTTL = 10 * time.Minute
+
+// affectsGoEntry is a cached affects Go decision for a pull request's head.
+type affectsGoEntry struct {
+	sha       string
+	affectsGo bool
+	expires   time.Time
+}
+
+// prAffectsGo returns true if a pull request affects Go, see checkPRAffectsGo.
+// The decision is cached for the pull request's head SHA for affectsGoTTL, a
+// new head SHA replaces the cached decision.
+func (g *GitHub) prAffectsGo(ctx context.Context, installation *Installation, e *github.PullRequestEvent) (bool, error) {
+	key := pullRequestKey{repositoryID: e.Repo.GetID(), number: e.GetNumber()}
+	sha := e.PullRequest.Head.GetSHA()
+	now := time.Now()
+
+	g.affectsGoMu.Lock()
+	entry, ok := g.affectsGo[key]
+	g.affectsGoMu.Unlock()
+	if ok && entry.sha == sha && now.Before(entry.expires) {
+		return entry.affectsGo, nil
+	}
+
+	affectsGo, err := checkPRAffectsGo(ctx, installation, e.Repo.GetOwner().GetLogin(), e.Repo.GetName(), e.GetNumber(), g.PRFilesMaxPages)
+	if err != nil {
+		return false, err
+	}
+
+	g.affectsGoMu.Lock()
+	defer g.affectsGoMu.Unlock()
+	if g.affectsGo == nil {
+		g.affectsGo = make(map[pullRequestKey]affectsGoEntry)
+	}
+	for k, entry := range g.affectsGo {
+		if !now.Before(entry.expires) {
+			delete(g.affectsGo, k)
+		}
+	}
+	if sha != "" {
+		g.affectsGo[key] = affectsGoEntry{sha: sha, affectsGo: affectsGo, expires: now.Add(affectsGoTTL)}
+	}
+	return affectsGo, nil
+}
@@ -0,0 +1,73 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestPRAffectsGo_cache(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/1/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/repos/owner/repo/pulls/2/files?per_page=100":
+			requests++
+			fmt.Fprintln(w, `[{"filename": "main.go"}]`)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	g, _, memDB := setup(t)
+	g.baseURL = ts.URL
+	_ = memDB.AddGHInstallation(0, 1, 2, 3)
+	memDB.EnableGHInstallation(1)
+	installation, err := g.NewInstallation(1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	e := goodPREvent()
+	tests := []struct {
+		desc         string
+		sha          string
+		expire       bool // expire the cached decision before checking
+		wantRequests int
+	}{
+		{"first event", "abcdef", false, 1},
+		{"same sha", "abcdef", false, 1},
+		{"new sha", "123456", false, 2},
+		{"same new sha", "123456", false, 2},
+		{"expired", "123456", true, 3},
+	}
+
+	for _, test := range tests {
+		e.PullRequest.Head.SHA = github.String(test.sha)
+		if test.expire {
+			key := pullRequestKey{repositoryID: e.Repo.GetID(), number: e.GetNumber()}
+			entry := g.affectsGo[key]
+			entry.expires = time.Now().Add(-time.Second)
+			g.affectsGo[key] = entry
+		}
+
+		have, err := g.prAffectsGo(context.Background(), installation, e)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.desc, err)
+		}
+		if !have {
+			t.Errorf("%v: have: %v, want: true", test.desc, have)
+		}
+		if requests != test.wantRequests {
+			t.Errorf("%v: requests have: %v, want: %v", test.desc, requests, test.wantRequests)
+		}
+	}
+}
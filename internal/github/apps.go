@@ -0,0 +1,83 @@
+package github
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// hookTargetIDHeader is the webhook header containing the ID of the GitHub
+// App the webhook was delivered for.
+const hookTargetIDHeader = "X-GitHub-Hook-Installation-Target-ID"
+
+// app is a registered GitHub App, also known as an integration.
+type app struct {
+	id            int    // id is the integration id
+	key           []byte // key is the integration's private key
+	webhookSecret []byte // webhookSecret is the webhook secret configured for the integration
+}
+
+// AddApp registers an additional GitHub App, so a single GopherCI instance
+// can serve multiple GitHub Apps, such as a public and an internal App.
+// Webhooks are validated with the webhookSecret of the App they're
+// delivered for, and installations of the App authenticate using
+// integrationKey. Must be called after New and before use.
+func (g *GitHub) AddApp(integrationID int, integrationKey []byte, webhookSecret string) error {
+	if _, err := g.app(integrationID); err == nil {
+		return fmt.Errorf("github app %v already registered", integrationID)
+	}
+	g.apps = append(g.apps, &app{id: integrationID, key: integrationKey, webhookSecret: []byte(webhookSecret)})
+	return nil
+}
+
+// app returns the registered GitHub App for integrationID, an integrationID
+// of 0 returns the default App.
+func (g *GitHub) app(integrationID int) (*app, error) {
+	if integrationID == 0 {
+		return g.apps[0], nil
+	}
+	for _, app := range g.apps {
+		if app.id == integrationID {
+			return app, nil
+		}
+	}
+	return nil, fmt.Errorf("github app %v is not registered", integrationID)
+}
+
+// validatePayload validates a webhook's payload and returns it, along with
+// the GitHub App it was delivered for. The App is selected by the hook's
+// target ID header, or if the header isn't set, the first App whose webhook
+// secret validates the payload.
+func (g *GitHub) validatePayload(r *http.Request) ([]byte, *app, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not read payload")
+	}
+
+	apps := g.apps
+	if header := r.Header.Get(hookTargetIDHeader); header != "" {
+		integrationID, err := strconv.Atoi(header)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s header %q", hookTargetIDHeader, header)
+		}
+		target, err := g.app(integrationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		apps = []*app{target}
+	}
+
+	for _, app := range apps {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var payload []byte
+		if payload, err = github.ValidatePayload(r, app.webhookSecret); err == nil {
+			return payload, app, nil
+		}
+	}
+	return nil, nil, errors.Wrap(err, "could not validate payload")
+}
@@ -0,0 +1,110 @@
+package github
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGitHub_app(t *testing.T) {
+	g, _, _ := setup(t)
+	if err := g.AddApp(2, integrationKey, "secret2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := g.AddApp(2, integrationKey, "secret2"); err == nil {
+		t.Errorf("expected error adding duplicate app")
+	}
+
+	tests := map[string]struct {
+		integrationID int
+		wantID        int
+		wantErr       bool
+	}{
+		"default":    {0, 1, false},
+		"first":      {1, 1, false},
+		"additional": {2, 2, false},
+		"unknown":    {3, 0, true},
+	}
+
+	for desc, test := range tests {
+		have, err := g.app(test.integrationID)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case !test.wantErr && err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		case !test.wantErr && have.id != test.wantID:
+			t.Errorf("%v: app have: %v, want: %v", desc, have.id, test.wantID)
+		}
+	}
+}
+
+func TestGitHub_validatePayload(t *testing.T) {
+	g, _, _ := setup(t)
+	if err := g.AddApp(2, integrationKey, "secret2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]struct {
+		secret  string
+		header  string // header is the hook target ID, if set
+		wantID  int
+		wantErr bool
+	}{
+		"default by secret":     {webhookSecret, "", 1, false},
+		"additional by secret":  {"secret2", "", 2, false},
+		"default by header":     {webhookSecret, "1", 1, false},
+		"additional by header":  {"secret2", "2", 2, false},
+		"header secret differs": {webhookSecret, "2", 0, true},
+		"unknown header":        {webhookSecret, "3", 0, true},
+		"invalid header":        {webhookSecret, "one", 0, true},
+		"unknown secret":        {"unknown", "", 0, true},
+	}
+
+	for desc, test := range tests {
+		body := []byte(`{"zen": "Keep it logically awesome."}`)
+		r, _ := http.NewRequest("POST", "http://example.com", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if test.header != "" {
+			r.Header.Set(hookTargetIDHeader, test.header)
+		}
+		sig := hmac.New(sha1.New, []byte(test.secret))
+		sig.Write(body)
+		r.Header.Set("X-Hub-Signature", fmt.Sprintf("sha1=%x", sig.Sum(nil)))
+
+		payload, app, err := g.validatePayload(r)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case !test.wantErr && err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		case !test.wantErr && app.id != test.wantID:
+			t.Errorf("%v: app have: %v, want: %v", desc, app.id, test.wantID)
+		case !test.wantErr && !bytes.Equal(payload, body):
+			t.Errorf("%v: payload have: %s, want: %s", desc, payload, body)
+		}
+	}
+}
+
+func TestNewInstallation_app(t *testing.T) {
+	g, _, memDB := setup(t)
+	if err := g.AddApp(2, integrationKey, "secret2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_ = memDB.AddGHInstallation(2, 1, 2, 3)
+	memDB.EnableGHInstallation(1)
+	if _, err := g.NewInstallation(1); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Installation of an App which is no longer registered
+	_ = memDB.AddGHInstallation(3, 2, 2, 3)
+	memDB.EnableGHInstallation(2)
+	if _, err := g.NewInstallation(2); err == nil {
+		t.Errorf("expected error for unregistered app")
+	}
+}
@@ -0,0 +1,326 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// checkRunEventType is the X-GitHub-Event header value of check run events.
+const checkRunEventType = "check_run"
+
+// checkRunEvent is a check run webhook event, sent when a user re-runs a check
+// run. The pinned go-github does not support the Checks API, so only the
+// fields required to re-run an analysis are decoded.
+type checkRunEvent struct {
+	Action       *string              `json:"action"`
+	CheckRun     *checkRun            `json:"check_run"`
+	Repo         *github.Repository   `json:"repository"`
+	Sender       *github.User         `json:"sender"`
+	Installation *github.Installation `json:"installation"`
+}
+
+// checkRun is the check run of a checkRunEvent.
+type checkRun struct {
+	HeadSHA      *string               `json:"head_sha"`
+	PullRequests []checkRunPullRequest `json:"pull_requests"`
+}
+
+// checkRunPullRequest is a pull request whose head is a checkRun's head SHA.
+type checkRunPullRequest struct {
+	Number *int `json:"number"`
+}
+
+// GetAction returns the Action field if it's non-nil, zero value otherwise.
+func (e *checkRunEvent) GetAction() string {
+	if e == nil || e.Action == nil {
+		return ""
+	}
+	return *e.Action
+}
+
+// GetNumber returns the Number field if it's non-nil, zero value otherwise.
+func (p checkRunPullRequest) GetNumber() int {
+	if p.Number == nil {
+		return 0
+	}
+	return *p.Number
+}
+
+// parseWebHook parses the payload of a webhook event of eventType, see
+// github.ParseWebHook, including events unsupported by go-github.
+func parseWebHook(eventType string, payload []byte) (interface{}, error) {
+	if eventType != checkRunEventType {
+		return github.ParseWebHook(eventType, payload)
+	}
+	e := &checkRunEvent{}
+	if err := json.Unmarshal(payload, e); err != nil {
+		return nil, errors.Wrap(err, "could not decode check run event")
+	}
+	return e, nil
+}
+
+// checkRunEvent handles a check run event, queuing the check run's head SHA
+// to be analysed again if a user rerequested the check run. A pull request's
+// check run is analysed as the pull request, and a push's check run as its
+// previous analysis, with the same checks as Rerun. Returns error type
+// *ignoreEvent if the event should be ignored.
+func (g *GitHub) checkRunEvent(ctx context.Context, e *checkRunEvent) error {
+	if e.GetAction() != "rerequested" {
+		return &ignoreEvent{reason: ignoreInvalidAction, extra: e.GetAction()}
+	}
+	if e.CheckRun == nil || e.CheckRun.HeadSHA == nil {
+		return &ignoreEvent{reason: ignoreNoAnalysis, extra: "check run has no head SHA"}
+	}
+	headSHA := *e.CheckRun.HeadSHA
+
+	installation, err := g.NewInstallation(*e.Installation.ID)
+	if err != nil {
+		return err
+	}
+	if !installation.IsEnabled() {
+		return &ignoreEvent{reason: ignoreNoInstallation}
+	}
+	if err := g.checkRepositoryAllowed(*e.Installation.ID, *e.Repo.ID); err != nil {
+		return err
+	}
+	if e.Repo.GetPrivate() {
+		return &ignoreEvent{reason: ignorePrivateRepos}
+	}
+
+	if len(e.CheckRun.PullRequests) == 0 {
+		// A push's analysis requires the push's commits, which are read from
+		// its previous analysis.
+		analyses, err := g.db.ListAnalyses(db.AnalysisFilter{
+			RepositoryID: *e.Repo.ID,
+			Trigger:      db.AnalysisTriggerPush,
+			CommitTo:     headSHA,
+			Limit:        1,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "could not list analyses of commit %q", headSHA)
+		}
+		if len(analyses) == 0 {
+			return &ignoreEvent{reason: ignoreNoAnalysis, extra: "no push analysis of commit " + headSHA}
+		}
+		g.queuePush <- newRerun(*e.Installation.ID, &analyses[0], e.Repo)
+		return nil
+	}
+
+	number := e.CheckRun.PullRequests[0].GetNumber()
+	if number == 0 {
+		return &ignoreEvent{reason: ignoreNoAnalysis, extra: "check run has no pull request number"}
+	}
+	owner, repo := e.Repo.GetOwner().GetLogin(), e.Repo.GetName()
+	pr, draft, err := getPullRequest(ctx, installation.client, owner, repo, number)
+	if err != nil {
+		return err
+	}
+	if err := g.checkRerunPR(*e.Repo.ID, pr, draft); err != nil {
+		return err
+	}
+	if pr.Head.GetSHA() != headSHA {
+		// The pull request's head is cloned, so a check run of an earlier
+		// commit cannot be analysed, and its head has its own check run.
+		return &ignoreEvent{reason: ignoreStaleCheckRun, extra: headSHA}
+	}
+	if pr.Head.Repo.GetPrivate() || pr.Base.Repo.GetPrivate() {
+		return &ignoreEvent{reason: ignorePrivateRepos}
+	}
+
+	g.queuePullRequest(&github.PullRequestEvent{
+		Action:       e.Action,
+		Number:       github.Int(number),
+		PullRequest:  pr,
+		Repo:         e.Repo,
+		Sender:       e.Sender,
+		Installation: e.Installation,
+	})
+	return nil
+}
+
+// checksAccept is the media type required by the Checks API preview.
+const checksAccept = "application/vnd.github.antiope-preview+json"
+
+// maxCheckRunAnnotations is the maximum number of annotations GitHub accepts
+// per check run request, further annotations are added by updating the check
+// run.
+const maxCheckRunAnnotations = 50
+
+// checkRunRequest creates or updates a check run.
+type checkRunRequest struct {
+	Name       string         `json:"name,omitempty"`
+	HeadSHA    string         `json:"head_sha,omitempty"`
+	DetailsURL string         `json:"details_url,omitempty"`
+	Status     string         `json:"status,omitempty"`
+	Conclusion string         `json:"conclusion,omitempty"`
+	Output     checkRunOutput `json:"output"`
+}
+
+// checkRunOutput is the summary and annotations of a check run.
+type checkRunOutput struct {
+	Title       string               `json:"title"`
+	Summary     string               `json:"summary"`
+	Annotations []checkRunAnnotation `json:"annotations,omitempty"`
+}
+
+// checkRunAnnotation annotates lines of a file with an issue.
+type checkRunAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Message         string `json:"message"`
+}
+
+// PushCheckRunReporter is an analyser.Reporter which creates a completed check
+// run summarising a push's analysis, annotating each issue.
+type PushCheckRunReporter struct {
+	client      *github.Client
+	owner       string
+	repo        string
+	commit      string
+	name        string
+	commits     int
+	analysisURL string
+}
+
+var _ analyser.Reporter = &PushCheckRunReporter{}
+
+// NewPushCheckRunReporter returns a PushCheckRunReporter creating a check run
+// named name on commit. commits is the number of commits the analysis is
+// checking and analysisURL is the URL of the analysis.
+func NewPushCheckRunReporter(client *github.Client, owner, repo, commit, name string, commits int, analysisURL string) *PushCheckRunReporter {
+	return &PushCheckRunReporter{
+		client:      client,
+		owner:       owner,
+		repo:        repo,
+		commit:      commit,
+		name:        name,
+		commits:     commits,
+		analysisURL: analysisURL,
+	}
+}
+
+// Report implements the analyser.Reporter interface.
+func (r *PushCheckRunReporter) Report(ctx context.Context, issues []db.Issue) error {
+	var checkRunID int64
+	for i, run := range r.checkRuns(issues) {
+		method, path := "POST", fmt.Sprintf("repos/%v/%v/check-runs", r.owner, r.repo)
+		if i > 0 {
+			method, path = "PATCH", fmt.Sprintf("repos/%v/%v/check-runs/%v", r.owner, r.repo, checkRunID)
+		}
+		req, err := r.client.NewRequest(method, path, run)
+		if err != nil {
+			return errors.Wrap(err, "could not make check run request")
+		}
+		req.Header.Set("Accept", checksAccept)
+
+		var created struct {
+			ID int64 `json:"id"`
+		}
+		if _, err := r.client.Do(ctx, req, &created); err != nil {
+			return errors.Wrapf(err, "could not %v check run for commit %q", method, r.commit)
+		}
+		if i == 0 {
+			checkRunID = created.ID
+		}
+	}
+	return nil
+}
+
+// checkRuns returns the requests to create the check run, and if there are
+// more annotations than GitHub accepts per request, update it with the
+// remaining annotations.
+func (r *PushCheckRunReporter) checkRuns(issues []db.Issue) []checkRunRequest {
+	output := checkRunOutput{
+		Title:   fmt.Sprintf("Found %d issues", len(issues)),
+		Summary: pushCheckRunSummary(len(issues), r.commits, r.analysisURL),
+	}
+	conclusion := "neutral"
+	switch len(issues) {
+	case 0:
+		output.Title = "Found no issues"
+		conclusion = "success"
+	case 1:
+		output.Title = "Found 1 issue"
+	}
+
+	runs := []checkRunRequest{{
+		Name:       r.name,
+		HeadSHA:    r.commit,
+		DetailsURL: r.analysisURL,
+		Status:     "completed",
+		Conclusion: conclusion,
+		Output:     output,
+	}}
+	for i := 0; i < len(issues); i += maxCheckRunAnnotations {
+		end := i + maxCheckRunAnnotations
+		if end > len(issues) {
+			end = len(issues)
+		}
+		var annotations []checkRunAnnotation
+		for _, issue := range issues[i:end] {
+			annotations = append(annotations, issueAnnotation(issue))
+		}
+		if i == 0 {
+			runs[0].Output.Annotations = annotations
+			continue
+		}
+		// Updates append annotations, but must repeat the output.
+		runs = append(runs, checkRunRequest{
+			Output: checkRunOutput{Title: output.Title, Summary: output.Summary, Annotations: annotations},
+		})
+	}
+	return runs
+}
+
+// pushCheckRunSummary returns the summary of a push's check run.
+func pushCheckRunSummary(issues, commits int, analysisURL string) string {
+	plural := "s"
+	if issues == 1 {
+		plural = ""
+	}
+	checked := fmt.Sprintf("the last **%d** commits", commits)
+	if commits == 1 {
+		checked = "this commit"
+	}
+	summary := fmt.Sprintf("GopherCI found **%d** issue%s in %s.", issues, plural, checked)
+	if analysisURL != "" {
+		summary += fmt.Sprintf(" See the full analysis at %s", analysisURL)
+	}
+	return summary
+}
+
+// issueAnnotation returns the check run annotation of an issue, spanning the
+// issue's range of lines if it has one.
+func issueAnnotation(issue db.Issue) checkRunAnnotation {
+	start := issue.Line
+	if start < 1 {
+		start = 1 // issues without a line annotate the first line
+	}
+	end := start
+	if issue.EndLine > start {
+		end = issue.EndLine
+	}
+	level := "notice"
+	switch strings.ToLower(issue.Severity) {
+	case "error":
+		level = "failure"
+	case "warning":
+		level = "warning"
+	}
+	return checkRunAnnotation{
+		Path:            issue.Path,
+		StartLine:       start,
+		EndLine:         end,
+		AnnotationLevel: level,
+		Message:         issue.Issue,
+	}
+}
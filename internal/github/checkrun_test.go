@@ -0,0 +1,271 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/github"
+)
+
+func TestParseWebHook_checkRun(t *testing.T) {
+	payload := []byte(`{
+		"action": "rerequested",
+		"check_run": {"head_sha": "abcdef", "pull_requests": [{"number": 2}]},
+		"repository": {"id": 2, "name": "repo", "owner": {"login": "owner"}},
+		"installation": {"id": 1}
+	}`)
+
+	event, err := parseWebHook(checkRunEventType, payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e, ok := event.(*checkRunEvent)
+	if !ok {
+		t.Fatalf("have: %T, want: *checkRunEvent", event)
+	}
+	switch {
+	case e.GetAction() != "rerequested":
+		t.Errorf("action have: %q, want: %q", e.GetAction(), "rerequested")
+	case e.CheckRun.HeadSHA == nil || *e.CheckRun.HeadSHA != "abcdef":
+		t.Errorf("head sha have: %v, want: %q", e.CheckRun.HeadSHA, "abcdef")
+	case len(e.CheckRun.PullRequests) != 1 || *e.CheckRun.PullRequests[0].Number != 2:
+		t.Errorf("pull requests have: %+v, want: [2]", e.CheckRun.PullRequests)
+	case e.Repo.GetID() != 2 || e.Installation.GetID() != 1:
+		t.Errorf("unexpected repository %v or installation %v", e.Repo.GetID(), e.Installation.GetID())
+	}
+
+	if _, err := parseWebHook("push", []byte(`{}`)); err != nil {
+		t.Errorf("unexpected error parsing push event: %v", err)
+	}
+}
+
+func TestCheckRunEvent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/1/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/repos/owner/repo/pulls/2":
+			fmt.Fprintln(w, `{
+				"number": 2,
+				"state": "open",
+				"labels": [{"name": "gopherci"}],
+				"statuses_url": "https://github.com/owner/repo/status/abcdef",
+				"head": {"ref": "head-branch", "sha": "abcdef", "repo": {"clone_url": "https://github.com/owner/repo.git"}},
+				"base": {"ref": "base-branch", "repo": {"name": "repo", "owner": {"login": "owner"}}}
+			}`)
+		case "/repos/owner/repo/pulls/3":
+			fmt.Fprintln(w, `{"number": 3, "state": "closed", "labels": [{"name": "gopherci"}], "head": {"sha": "abcdef", "repo": {}}}`)
+		case "/repos/owner/repo/pulls/4":
+			fmt.Fprintln(w, `{"number": 4, "state": "open", "draft": true, "labels": [{"name": "gopherci"}], "head": {"sha": "abcdef", "repo": {}}}`)
+		case "/repos/owner/repo/pulls/5":
+			fmt.Fprintln(w, `{"number": 5, "state": "open", "labels": [{"name": "other"}], "head": {"sha": "abcdef", "repo": {}}}`)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	checkRun := func(action string, prs ...int) *checkRunEvent {
+		e := &checkRunEvent{
+			Action:       github.String(action),
+			Installation: &github.Installation{ID: github.Int(1)},
+			Repo: &github.Repository{
+				Owner: &github.User{Login: github.String("owner")},
+				Name:  github.String("repo"),
+				ID:    github.Int(2),
+			},
+			CheckRun: &checkRun{HeadSHA: github.String("abcdef")},
+		}
+		for _, pr := range prs {
+			e.CheckRun.PullRequests = append(e.CheckRun.PullRequests, checkRunPullRequest{Number: github.Int(pr)})
+		}
+		return e
+	}
+
+	private := checkRun("rerequested", 2)
+	private.Repo.Private = github.Bool(true)
+	stale := checkRun("rerequested", 2)
+	stale.CheckRun.HeadSHA = github.String("012345")
+	unknownPush := checkRun("rerequested")
+	unknownPush.CheckRun.HeadSHA = github.String("012345")
+	noNumber := checkRun("rerequested")
+	noNumber.CheckRun.PullRequests = []checkRunPullRequest{{}}
+
+	tests := map[string]struct {
+		event      *checkRunEvent
+		wantReason ignoreReason // wantReason is the reason the event is ignored, if wantQueued is false
+		wantQueued bool
+	}{
+		"pull request":  {checkRun("rerequested", 2), 0, true},
+		"push":          {checkRun("rerequested"), 0, true},
+		"created":       {checkRun("created", 2), ignoreInvalidAction, false},
+		"stale":         {stale, ignoreStaleCheckRun, false},
+		"push analysis": {unknownPush, ignoreNoAnalysis, false},
+		"private":       {private, ignorePrivateRepos, false},
+		"closed":        {checkRun("rerequested", 3), ignorePRClosed, false},
+		"draft":         {checkRun("rerequested", 4), ignoreDraft, false},
+		"missing label": {checkRun("rerequested", 5), ignoreMissingLabel, false},
+		"no number":     {noNumber, ignoreNoAnalysis, false},
+	}
+
+	for desc, test := range tests {
+		g, _, memDB := setup(t)
+		g.baseURL = ts.URL
+		_ = memDB.AddGHInstallation(0, 1, 2, 3)
+		memDB.EnableGHInstallation(1)
+		_ = memDB.SetRepoSettings(db.RepoSettings{RepositoryID: 2, PRLabel: "gopherci"})
+		memDB.Analyses = []db.Analysis{
+			{ID: 1, RepositoryID: 2, Trigger: db.AnalysisTriggerPush, CommitFrom: "fedcba", CommitTo: "abcdef", Branch: "master"},
+		}
+
+		c := make(chan interface{}, 1)
+		g.queuePush = c
+
+		err := g.checkRunEvent(context.Background(), test.event)
+		if !test.wantQueued {
+			if ierr, ok := err.(*ignoreEvent); !ok || ierr.reason != test.wantReason {
+				t.Errorf("%v: have error: %v, want reason: %v", desc, err, test.wantReason)
+			}
+			if len(c) > 0 {
+				t.Errorf("%v: unexpected job: %v", desc, <-c)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", desc, err)
+			continue
+		}
+		if len(c) != 1 {
+			t.Errorf("%v: expected job to be queued", desc)
+			continue
+		}
+		switch job := (<-c).(type) {
+		case *github.PullRequestEvent:
+			switch {
+			case len(test.event.CheckRun.PullRequests) == 0:
+				t.Errorf("%v: unexpected pull request job: %+v", desc, job)
+			case job.GetAction() != "rerequested":
+				t.Errorf("%v: action have: %q, want: %q", desc, job.GetAction(), "rerequested")
+			case job.GetNumber() != 2 || job.PullRequest.Head.GetSHA() != "abcdef":
+				t.Errorf("%v: unexpected event: %+v", desc, job)
+			}
+		case *Rerun:
+			want := &Rerun{InstallationID: 1, RepositoryID: 2, Owner: "owner", Repo: "repo", Branch: "master", CommitFrom: "fedcba", CommitTo: "abcdef"}
+			if len(test.event.CheckRun.PullRequests) != 0 {
+				t.Errorf("%v: unexpected push job: %+v", desc, job)
+			} else if diff := cmp.Diff(job, want); diff != "" {
+				t.Errorf("%v: rerun not equal (-have +want)\n%s", desc, diff)
+			}
+		default:
+			t.Errorf("%v: unexpected job: %T", desc, job)
+		}
+	}
+}
+
+func TestPushCheckRunReporter_checkRuns(t *testing.T) {
+	r := NewPushCheckRunReporter(nil, "owner", "repo", "abcdef", "ci/gopherci/push", 2, "https://gopherci.io/analysis/1")
+
+	have := r.checkRuns(nil)
+	want := []checkRunRequest{{
+		Name:       "ci/gopherci/push",
+		HeadSHA:    "abcdef",
+		DetailsURL: "https://gopherci.io/analysis/1",
+		Status:     "completed",
+		Conclusion: "success",
+		Output: checkRunOutput{
+			Title:   "Found no issues",
+			Summary: "GopherCI found **0** issues in the last **2** commits. See the full analysis at https://gopherci.io/analysis/1",
+		},
+	}}
+	if diff := cmp.Diff(have, want); diff != "" {
+		t.Errorf("no issues not equal (-have +want)\n%s", diff)
+	}
+
+	issues := make([]db.Issue, maxCheckRunAnnotations+1)
+	for i := range issues {
+		issues[i] = db.Issue{Path: "main.go", Line: i + 1, Issue: "issue"}
+	}
+	have = r.checkRuns(issues)
+	if len(have) != 2 {
+		t.Fatalf("have %v requests, want 2: %+v", len(have), have)
+	}
+	if have[0].Conclusion != "neutral" || have[0].Output.Title != "Found 51 issues" {
+		t.Errorf("unexpected conclusion %q or title %q", have[0].Conclusion, have[0].Output.Title)
+	}
+	if len(have[0].Output.Annotations) != maxCheckRunAnnotations || len(have[1].Output.Annotations) != 1 {
+		t.Errorf("annotations have: %v and %v, want: %v and 1", len(have[0].Output.Annotations), len(have[1].Output.Annotations), maxCheckRunAnnotations)
+	}
+	if have[1].Name != "" || have[1].Output.Summary != have[0].Output.Summary {
+		t.Errorf("unexpected update: %+v", have[1])
+	}
+}
+
+func TestIssueAnnotation(t *testing.T) {
+	tests := []struct {
+		issue db.Issue
+		want  checkRunAnnotation
+	}{
+		{
+			db.Issue{Path: "main.go", Line: 2, Issue: "issue", Severity: "error"},
+			checkRunAnnotation{Path: "main.go", StartLine: 2, EndLine: 2, AnnotationLevel: "failure", Message: "issue"},
+		},
+		{
+			db.Issue{Path: "main.go", Line: 10, EndLine: 40, Issue: "too long", Severity: "warning"},
+			checkRunAnnotation{Path: "main.go", StartLine: 10, EndLine: 40, AnnotationLevel: "warning", Message: "too long"},
+		},
+		{
+			db.Issue{Path: "main.go", Issue: "no line"},
+			checkRunAnnotation{Path: "main.go", StartLine: 1, EndLine: 1, AnnotationLevel: "notice", Message: "no line"},
+		},
+	}
+	for _, test := range tests {
+		if diff := cmp.Diff(issueAnnotation(test.issue), test.want); diff != "" {
+			t.Errorf("%+v not equal (-have +want)\n%s", test.issue, diff)
+		}
+	}
+}
+
+func TestPushCheckRunReporter_report(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Get("Accept"); accept != checksAccept {
+			t.Errorf("accept have: %q, want: %q", accept, checksAccept)
+		}
+		var run checkRunRequest
+		if err := json.NewDecoder(r.Body).Decode(&run); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		requests = append(requests, fmt.Sprintf("%v %v %v", r.Method, r.RequestURI, len(run.Output.Annotations)))
+		fmt.Fprintln(w, `{"id": 5}`)
+	}))
+	defer ts.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(ts.URL)
+
+	issues := make([]db.Issue, maxCheckRunAnnotations+1)
+	for i := range issues {
+		issues[i] = db.Issue{Path: "main.go", Line: i + 1, Issue: "issue"}
+	}
+	r := NewPushCheckRunReporter(client, "owner", "repo", "abcdef", "ci/gopherci/push", 1, "")
+	if err := r.Report(context.Background(), issues); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"POST /repos/owner/repo/check-runs 50",
+		"PATCH /repos/owner/repo/check-runs/5 1",
+	}
+	if diff := cmp.Diff(requests, want); diff != "" {
+		t.Errorf("requests not equal (-have +want)\n%s", diff)
+	}
+}
@@ -0,0 +1,124 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/pkg/errors"
+)
+
+// Protocols used to clone repositories, see GitHub.CloneProtocol.
+const (
+	// CloneProtocolEvent clones using the event's clone URL, unchanged.
+	CloneProtocolEvent = "event"
+	// CloneProtocolHTTPS clones over HTTPS using the installation's access
+	// token, required to clone private repositories.
+	CloneProtocolHTTPS = "https"
+	// CloneProtocolSSH clones over SSH, such as from self-hosted git servers
+	// using the analyser's SSH key.
+	CloneProtocolSSH = "ssh"
+)
+
+// protocolCloner returns cloner with its URLs rewritten for CloneProtocol.
+// For CloneProtocolHTTPS the URLs contain the installation's access token,
+// the token is not stored as the recorded arguments are redacted, and the
+// clone's origin is reset to the URL without the token after cloning, see
+// cleanOriginCloner.
+func (g *GitHub) protocolCloner(install *Installation, cloner analyser.Cloner) (analyser.Cloner, error) {
+	var rewrite func(string) (string, error)
+	switch g.CloneProtocol {
+	case CloneProtocolHTTPS:
+		token, err := install.token()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get installation token")
+		}
+		rewrite = func(cloneURL string) (string, error) {
+			return credentialURL(cloneURL, token)
+		}
+	case CloneProtocolSSH:
+		rewrite = sshURL
+	default:
+		return cloner, nil
+	}
+
+	var (
+		rewritten analyser.Cloner
+		originURL string // originURL is the URL cloned, as the origin remote
+		err       error
+	)
+	switch c := cloner.(type) {
+	case *analyser.PushCloner:
+		push := *c
+		if push.HeadURL, err = rewrite(c.HeadURL); err != nil {
+			return nil, err
+		}
+		rewritten, originURL = &push, c.HeadURL
+	case *analyser.PullRequestCloner:
+		pr := *c
+		if pr.HeadURL, err = rewrite(c.HeadURL); err != nil {
+			return nil, err
+		}
+		if pr.BaseURL, err = rewrite(c.BaseURL); err != nil {
+			return nil, err
+		}
+		rewritten, originURL = &pr, c.HeadURL
+	default:
+		return cloner, nil
+	}
+	if g.CloneProtocol == CloneProtocolHTTPS {
+		return &cleanOriginCloner{Cloner: rewritten, originURL: originURL}, nil
+	}
+	return rewritten, nil
+}
+
+// cleanOriginCloner is a Cloner which, after cloning, sets the origin
+// remote's URL to originURL, without credentials, as git stores the cloned
+// URL in the repository's config, where untrusted code such as tools and
+// install-deps.sh could read the access token. URLs fetched without a remote
+// aren't stored.
+type cleanOriginCloner struct {
+	analyser.Cloner
+	originURL string
+}
+
+// Clone implements the analyser.Cloner interface.
+func (c *cleanOriginCloner) Clone(ctx context.Context, logger logger.Logger, exec analyser.Executer) error {
+	if err := c.Cloner.Clone(ctx, logger, exec); err != nil {
+		return err
+	}
+	args := []string{"git", "remote", "set-url", "origin", c.originURL}
+	if out, err := exec.Execute(ctx, args); err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("could not execute %v: %q", args, out))
+	}
+	return nil
+}
+
+// sshURL returns the SSH URL of an HTTPS clone URL, such as
+// git@github.com:owner/repo.git for https://github.com/owner/repo.git. URLs
+// which are already SSH are returned unchanged.
+func sshURL(cloneURL string) (string, error) {
+	if !strings.Contains(cloneURL, "://") {
+		// scp-like syntax, such as git@github.com:owner/repo.git.
+		return cloneURL, nil
+	}
+	u, err := url.Parse(cloneURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not parse clone URL %q", cloneURL)
+	}
+	switch u.Scheme {
+	case "ssh", "git+ssh":
+		return cloneURL, nil
+	case "http", "https":
+	default:
+		return "", errors.Errorf("could not convert clone URL with scheme %q to SSH", u.Scheme)
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	if path == "" {
+		return "", errors.Errorf("clone URL %q has no repository path", cloneURL)
+	}
+	return fmt.Sprintf("git@%s:%s", u.Hostname(), path), nil
+}
@@ -0,0 +1,178 @@
+package github
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// toolRunStatusesContext is the status API context of tool runs, distinct from
+// the pull request's context as only some tools are run.
+const toolRunStatusesContext = "ci/gopherci/run"
+
+// ToolRun is a queue job to analyse a pull request with a single tool,
+// requested by a reviewer commenting /gopherci run <tool>.
+type ToolRun struct {
+	Event *github.PullRequestEvent // Event is the pull request to analyse.
+	Tool  string                   // Tool is the name of the tool to run.
+}
+
+func init() {
+	// ToolRun is added to the queue, which may gob encode it.
+	gob.Register(&ToolRun{})
+}
+
+// ToolRunConfig returns an AnalyseConfig for a tool run, only running the
+// requested tool. If mergeRef is true, the result of merging the pull request
+// is analysed, see PullRequestConfig. Fixes are never pushed.
+func ToolRunConfig(r *ToolRun, mergeRef bool) AnalyseConfig {
+	cfg := PullRequestConfig(r.Event, mergeRef)
+	cfg.statusesContext = toolRunStatusesContext
+	cfg.tools = []string{r.Tool}
+	cfg.fixURL, cfg.fixBranch = "", ""
+	return cfg
+}
+
+// parseRunCommand returns the name of the tool requested by the first line of
+// body which is a run command, such as /gopherci run staticcheck. Returns
+// false if body does not contain a run command.
+func parseRunCommand(body string) (string, bool) {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "/gopherci" || fields[1] != "run" {
+			continue
+		}
+		return strings.Join(fields[2:], " "), true
+	}
+	return "", false
+}
+
+// findTool returns the tool named name, ignoring case, or nil if not found.
+func findTool(tools []db.Tool, name string) *db.Tool {
+	for i := range tools {
+		if strings.EqualFold(tools[i].Name, name) {
+			return &tools[i]
+		}
+	}
+	return nil
+}
+
+// scopeTools returns the tools named in names, ignoring case. If names is nil,
+// all tools are returned.
+func scopeTools(tools []db.Tool, names []string) []db.Tool {
+	if names == nil {
+		return tools
+	}
+	var scoped []db.Tool
+	for _, name := range names {
+		if tool := findTool(tools, name); tool != nil {
+			scoped = append(scoped, *tool)
+		}
+	}
+	return scoped
+}
+
+// issueCommentEvent handles a comment on an issue or pull request, queuing a
+// ToolRun if the comment is a run command on a pull request by a user with
+// write access to the repository. Returns error type *ignoreEvent if the event
+// should be ignored.
+func (g *GitHub) issueCommentEvent(ctx context.Context, e *github.IssueCommentEvent) error {
+	if e.GetAction() != "created" {
+		return &ignoreEvent{reason: ignoreInvalidAction, extra: e.GetAction()}
+	}
+	if e.Issue.PullRequestLinks == nil {
+		return &ignoreEvent{reason: ignoreNoCommand, extra: "not a pull request"}
+	}
+	name, ok := parseRunCommand(e.Comment.GetBody())
+	if !ok {
+		return &ignoreEvent{reason: ignoreNoCommand}
+	}
+
+	installation, err := g.NewInstallation(*e.Installation.ID)
+	if err != nil {
+		return err
+	}
+	if !installation.IsEnabled() {
+		return &ignoreEvent{reason: ignoreNoInstallation}
+	}
+	if err := g.checkRepositoryAllowed(*e.Installation.ID, *e.Repo.ID); err != nil {
+		return err
+	}
+	if e.Repo.GetPrivate() {
+		return &ignoreEvent{reason: ignorePrivateRepos}
+	}
+
+	// Only the tools Analyse would run are accepted.
+	tools, err := g.db.ListTools()
+	if err != nil {
+		return errors.Wrap(err, "could not get tools")
+	}
+	tools, _ = db.ValidTools(tools)
+	settings, err := g.db.GetRepoSettings(*e.Repo.ID)
+	if err != nil {
+		return errors.Wrap(err, "could not get repository settings")
+	}
+	tool := findTool(settings.EnabledTools(tools), name)
+	if tool == nil {
+		return &ignoreEvent{reason: ignoreUnknownTool, extra: name}
+	}
+
+	owner, repo := e.Repo.GetOwner().GetLogin(), e.Repo.GetName()
+	if err := checkWriteAccess(ctx, installation, owner, repo, e.Comment.GetUser().GetLogin()); err != nil {
+		return err
+	}
+
+	pr, _, err := installation.client.PullRequests.Get(ctx, owner, repo, e.Issue.GetNumber())
+	if err != nil {
+		return errors.Wrapf(err, "could not get pull request %v", e.Issue.GetNumber())
+	}
+	if pr.Head == nil || pr.Head.Repo == nil {
+		// The head repository has been deleted.
+		return &ignoreEvent{reason: ignorePRInaccessible, extra: "head repository not found"}
+	}
+	if pr.GetState() != "open" {
+		return &ignoreEvent{reason: ignorePRClosed}
+	}
+	if pr.Head.Repo.GetPrivate() || pr.Base.Repo.GetPrivate() {
+		return &ignoreEvent{reason: ignorePrivateRepos}
+	}
+
+	g.queuePush <- &ToolRun{
+		Event: &github.PullRequestEvent{
+			Action:       github.String("run"),
+			Number:       e.Issue.Number,
+			PullRequest:  pr,
+			Repo:         e.Repo,
+			Sender:       e.Sender,
+			Installation: e.Installation,
+		},
+		Tool: tool.Name,
+	}
+	return nil
+}
+
+// checkWriteAccess checks whether user has write access to a repository.
+// Returns error type *ignoreEvent if the user does not have write access, nil
+// if they do, or other error if check could not be completed.
+func checkWriteAccess(ctx context.Context, installation *Installation, owner, repo, user string) error {
+	req, err := installation.client.NewRequest("GET", fmt.Sprintf("repos/%v/%v/collaborators/%v/permission", owner, repo, user), nil)
+	if err != nil {
+		return errors.Wrap(err, "could not make permission request")
+	}
+	var level struct {
+		Permission string `json:"permission"`
+	}
+	if _, err := installation.client.Do(ctx, req, &level); err != nil {
+		return errors.Wrapf(err, "could not get permission of %v", user)
+	}
+	switch level.Permission {
+	case "admin", "write":
+		return nil
+	}
+	return &ignoreEvent{reason: ignoreNoWriteAccess, extra: user}
+}
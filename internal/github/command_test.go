@@ -0,0 +1,240 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/google/go-github/github"
+)
+
+func TestParseRunCommand(t *testing.T) {
+	tests := []struct {
+		body   string
+		want   string
+		wantOK bool
+	}{
+		{"/gopherci run staticcheck", "staticcheck", true},
+		{"  /gopherci   run   go vet  ", "go vet", true},
+		{"Thanks!\r\n/gopherci run golint\r\nAnd again.", "golint", true},
+		{"/gopherci run a\n/gopherci run b", "a", true},
+		{"/gopherci run", "", false},
+		{"/gopherci rerun golint", "", false},
+		{"please /gopherci run golint", "", false},
+		{"LGTM", "", false},
+	}
+	for _, test := range tests {
+		have, ok := parseRunCommand(test.body)
+		if have != test.want || ok != test.wantOK {
+			t.Errorf("parseRunCommand(%q) have: %q, %v want: %q, %v", test.body, have, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestScopeTools(t *testing.T) {
+	tools := []db.Tool{{ID: 1, Name: "go vet"}, {ID: 2, Name: "golint"}, {ID: 3, Name: "staticcheck"}}
+
+	tests := map[string]struct {
+		names []string
+		want  []db.Tool
+	}{
+		"all":          {nil, tools},
+		"single":       {[]string{"golint"}, []db.Tool{tools[1]}},
+		"ignores case": {[]string{"StaticCheck"}, []db.Tool{tools[2]}},
+		"unknown":      {[]string{"unknown"}, nil},
+	}
+	for desc, test := range tests {
+		if have := scopeTools(tools, test.names); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%v:\nhave: %+v\nwant: %+v", desc, have, test.want)
+		}
+	}
+}
+
+func TestToolRunConfig(t *testing.T) {
+	e := goodPREvent()
+	e.PullRequest.Head.Repo.ID = github.Int(2)
+	e.PullRequest.Base.Repo.ID = github.Int(2)
+
+	have := ToolRunConfig(&ToolRun{Event: e, Tool: "golint"}, false)
+
+	if want := []string{"golint"}; !reflect.DeepEqual(have.tools, want) {
+		t.Errorf("tools have: %v, want: %v", have.tools, want)
+	}
+	if have.statusesContext != toolRunStatusesContext {
+		t.Errorf("statuses context have: %q, want: %q", have.statusesContext, toolRunStatusesContext)
+	}
+	if have.fixBranch != "" {
+		t.Errorf("fix branch have: %q, want: blank", have.fixBranch)
+	}
+	if want := 2; have.pr != want {
+		t.Errorf("pr have: %v, want: %v", have.pr, want)
+	}
+}
+
+// goodPREvent returns a pull request event for PR 2 on owner/repo.
+func goodPREvent() *github.PullRequestEvent {
+	return &github.PullRequestEvent{
+		Action: github.String("run"),
+		Number: github.Int(2),
+		PullRequest: &github.PullRequest{
+			StatusesURL: github.String("https://github.com/owner/repo/status/abcdef"),
+			Base: &github.PullRequestBranch{
+				Repo: &github.Repository{
+					HTMLURL:  github.String("https://github.com/owner/repo"),
+					CloneURL: github.String("https://github.com/owner/repo.git"),
+					Name:     github.String("repo"),
+					Owner:    &github.User{Login: github.String("owner")},
+				},
+				Ref: github.String("base-branch"),
+			},
+			Head: &github.PullRequestBranch{
+				Repo: &github.Repository{CloneURL: github.String("https://github.com/owner/repo.git")},
+				SHA:  github.String("abcdef"),
+				Ref:  github.String("head-branch"),
+			},
+		},
+		Installation: &github.Installation{ID: github.Int(1)},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String("owner")},
+			Name:  github.String("repo"),
+			ID:    github.Int(2),
+		},
+	}
+}
+
+func TestIssueCommentEvent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/1/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/repos/owner/repo/collaborators/writer/permission":
+			fmt.Fprintln(w, `{"permission": "write"}`)
+		case "/repos/owner/repo/collaborators/reader/permission":
+			fmt.Fprintln(w, `{"permission": "read"}`)
+		case "/repos/owner/repo/pulls/2":
+			fmt.Fprintln(w, `{
+				"number": 2,
+				"state": "open",
+				"statuses_url": "https://github.com/owner/repo/status/abcdef",
+				"head": {"ref": "head-branch", "sha": "abcdef", "repo": {"clone_url": "https://github.com/owner/repo.git"}},
+				"base": {"ref": "base-branch", "repo": {"name": "repo", "owner": {"login": "owner"}}}
+			}`)
+		case "/repos/owner/repo/pulls/3":
+			fmt.Fprintln(w, `{
+				"number": 3,
+				"state": "closed",
+				"head": {"ref": "head-branch", "sha": "abcdef", "repo": {"clone_url": "https://github.com/owner/repo.git"}},
+				"base": {"ref": "base-branch", "repo": {"name": "repo", "owner": {"login": "owner"}}}
+			}`)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	comment := func(body, user string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Action: github.String("created"),
+			Issue: &github.Issue{
+				Number:           github.Int(2),
+				PullRequestLinks: &github.PullRequestLinks{},
+			},
+			Comment: &github.IssueComment{
+				Body: github.String(body),
+				User: &github.User{Login: github.String(user)},
+			},
+			Installation: &github.Installation{ID: github.Int(1)},
+			Repo: &github.Repository{
+				Owner: &github.User{Login: github.String("owner")},
+				Name:  github.String("repo"),
+				ID:    github.Int(2),
+			},
+		}
+	}
+
+	edited := comment("/gopherci run golint", "writer")
+	edited.Action = github.String("edited")
+	issue := comment("/gopherci run golint", "writer")
+	issue.Issue.PullRequestLinks = nil
+	closed := comment("/gopherci run golint", "writer")
+	closed.Issue.Number = github.Int(3)
+
+	tests := map[string]struct {
+		event      *github.IssueCommentEvent
+		wantReason ignoreReason // wantReason is the reason the event is ignored, if wantTool is blank
+		wantTool   string
+	}{
+		"run":             {comment("/gopherci run GoLint", "writer"), 0, "golint"},
+		"edited":          {edited, ignoreInvalidAction, ""},
+		"issue":           {issue, ignoreNoCommand, ""},
+		"no command":      {comment("LGTM", "writer"), ignoreNoCommand, ""},
+		"unknown tool":    {comment("/gopherci run unknown", "writer"), ignoreUnknownTool, ""},
+		"no write access": {comment("/gopherci run golint", "reader"), ignoreNoWriteAccess, ""},
+		"disabled tool":   {comment("/gopherci run go vet", "writer"), ignoreUnknownTool, ""},
+		"invalid tool":    {comment("/gopherci run broken", "writer"), ignoreUnknownTool, ""},
+		"closed":          {closed, ignorePRClosed, ""},
+	}
+
+	for desc, test := range tests {
+		g, _, memDB := setup(t)
+		g.baseURL = ts.URL
+		_ = memDB.AddGHInstallation(0, 1, 2, 3)
+		memDB.EnableGHInstallation(1)
+		memDB.Tools = []db.Tool{{ID: 1, Name: "golint"}, {ID: 2, Name: "go vet"}, {ID: 3, Name: "broken", Regexp: "("}}
+		_ = memDB.SetRepoSettings(db.RepoSettings{RepositoryID: 2, DisabledTools: []string{"go vet"}})
+
+		c := make(chan interface{}, 1)
+		g.queuePush = c
+
+		err := g.issueCommentEvent(context.Background(), test.event)
+		if test.wantTool == "" {
+			if ierr, ok := err.(*ignoreEvent); !ok || ierr.reason != test.wantReason {
+				t.Errorf("%v: have error: %v, want reason: %v", desc, err, test.wantReason)
+			}
+			if len(c) > 0 {
+				t.Errorf("%v: unexpected job: %v", desc, <-c)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", desc, err)
+			continue
+		}
+		if len(c) != 1 {
+			t.Errorf("%v: expected job to be queued", desc)
+			continue
+		}
+		run, ok := (<-c).(*ToolRun)
+		switch {
+		case !ok:
+			t.Errorf("%v: job is not a *ToolRun", desc)
+		case run.Tool != test.wantTool:
+			t.Errorf("%v: tool have: %q, want: %q", desc, run.Tool, test.wantTool)
+		case run.Event.GetNumber() != 2 || run.Event.PullRequest.Head.GetSHA() != "abcdef":
+			t.Errorf("%v: unexpected event: %+v", desc, run.Event)
+		}
+	}
+}
+
+func TestCommentReporter_toolRun(t *testing.T) {
+	g, _, _ := setup(t)
+
+	cfg := AnalyseConfig{pr: 2, tools: []string{"golint"}}
+	reporter, ok := g.commentReporter(logger.Testing(), github.NewClient(nil), cfg, "", nil).(*PRReviewReporter)
+	if !ok || !reporter.keepThreads {
+		t.Errorf("have: %#v, want PRReviewReporter keeping threads", reporter)
+	}
+
+	cfg.tools = nil
+	reporter, ok = g.commentReporter(logger.Testing(), github.NewClient(nil), cfg, "", nil).(*PRReviewReporter)
+	if !ok || reporter.keepThreads {
+		t.Errorf("have: %#v, want PRReviewReporter resolving threads", reporter)
+	}
+}
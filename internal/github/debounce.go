@@ -0,0 +1,48 @@
+package github
+
+import (
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// pullRequestKey identifies a pull request to coalesce its events.
+type pullRequestKey struct {
+	repositoryID int
+	number       int
+}
+
+// queuePullRequest adds a pull request event to the queue. If PRDebounceWindow
+// is set, the event is held until the window since the pull request's first
+// pending event has passed, and any events received in the meantime replace
+// the pending event, so only the latest is analysed. Returns true if the event
+// replaced a pending event.
+func (g *GitHub) queuePullRequest(e *github.PullRequestEvent) bool {
+	if g.PRDebounceWindow <= 0 {
+		g.queuePush <- e
+		return false
+	}
+
+	key := pullRequestKey{repositoryID: e.Repo.GetID(), number: e.GetNumber()}
+
+	g.pendingMu.Lock()
+	defer g.pendingMu.Unlock()
+	if g.pending == nil {
+		g.pending = make(map[pullRequestKey]*github.PullRequestEvent)
+	}
+	if _, ok := g.pending[key]; ok {
+		g.pending[key] = e
+		return true
+	}
+	g.pending[key] = e
+
+	time.AfterFunc(g.PRDebounceWindow, func() {
+		g.pendingMu.Lock()
+		latest := g.pending[key]
+		delete(g.pending, key)
+		g.pendingMu.Unlock()
+
+		g.queuePush <- latest
+	})
+	return false
+}
@@ -0,0 +1,88 @@
+package github
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestQueuePullRequest(t *testing.T) {
+	event := func(repositoryID, number int, sha string) *github.PullRequestEvent {
+		return &github.PullRequestEvent{
+			Action: github.String("synchronize"),
+			Number: github.Int(number),
+			Repo:   &github.Repository{ID: github.Int(repositoryID)},
+			PullRequest: &github.PullRequest{
+				Head: &github.PullRequestBranch{SHA: github.String(sha)},
+			},
+		}
+	}
+
+	g, _, _ := setup(t)
+	c := make(chan interface{}, 3)
+	g.queuePush = c
+	g.PRDebounceWindow = 50 * time.Millisecond
+
+	events := []struct {
+		event        *github.PullRequestEvent
+		wantReplaced bool
+	}{
+		{event(1, 2, "first"), false},
+		{event(1, 2, "second"), true},
+		{event(1, 3, "other-pr"), false},
+		{event(1, 2, "latest"), true},
+		{event(4, 2, "other-repo"), false},
+	}
+	for _, e := range events {
+		if replaced := g.queuePullRequest(e.event); replaced != e.wantReplaced {
+			t.Errorf("%v replaced have: %v, want: %v", e.event.PullRequest.Head.GetSHA(), replaced, e.wantReplaced)
+		}
+	}
+	if len(c) > 0 {
+		t.Fatalf("queued %d events before window passed", len(c))
+	}
+
+	have := make(map[string]bool)
+	timeout := time.After(time.Second)
+	for len(have) < 3 {
+		select {
+		case job := <-c:
+			have[job.(*github.PullRequestEvent).PullRequest.Head.GetSHA()] = true
+		case <-timeout:
+			t.Fatalf("timeout waiting for events, have: %v", have)
+		}
+	}
+	for _, sha := range []string{"latest", "other-pr", "other-repo"} {
+		if !have[sha] {
+			t.Errorf("have %v, want %v queued", have, sha)
+		}
+	}
+
+	// After the window, events are held again
+	if replaced := g.queuePullRequest(event(1, 2, "next")); replaced {
+		t.Errorf("event after window replaced pending event")
+	}
+	select {
+	case job := <-c:
+		if sha := job.(*github.PullRequestEvent).PullRequest.Head.GetSHA(); sha != "next" {
+			t.Errorf("have %v, want next", sha)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event after window")
+	}
+}
+
+func TestQueuePullRequest_noWindow(t *testing.T) {
+	g, _, _ := setup(t)
+	c := make(chan interface{}, 1)
+	g.queuePush = c
+
+	e := &github.PullRequestEvent{Number: github.Int(2), Repo: &github.Repository{ID: github.Int(1)}}
+	if replaced := g.queuePullRequest(e); replaced {
+		t.Errorf("replaced have: %v, want: false", replaced)
+	}
+	if len(c) != 1 {
+		t.Errorf("queued have: %v, want: 1", len(c))
+	}
+}
@@ -0,0 +1,65 @@
+package github
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/pkg/errors"
+)
+
+// tokenUsername is the username GitHub accepts with an installation access
+// token for git over HTTPS.
+const tokenUsername = "x-access-token"
+
+const (
+	fixAuthorName  = "GopherCI"
+	fixAuthorEmail = "noreply@gopherci.io"
+	fixMessage     = "gopherci:autofix"
+)
+
+// autoFixEnabled returns true if AutoFixCommand is configured, the analysis's
+// installation opted in, and the analysis allows fixes to be pushed.
+func (g *GitHub) autoFixEnabled(cfg AnalyseConfig) bool {
+	if len(g.AutoFixCommand) == 0 || cfg.fixBranch == "" {
+		return false
+	}
+	for _, installationID := range g.AutoFixInstallations {
+		if installationID == cfg.installationID {
+			return true
+		}
+	}
+	return false
+}
+
+// autoFix runs AutoFixCommand using exec, which must contain the analysed
+// repository, pushing any changes to cfg's fixBranch using the installation's
+// credentials. Returns true if fixes were pushed.
+func (g *GitHub) autoFix(ctx context.Context, install *Installation, exec analyser.Executer, cfg AnalyseConfig) (bool, error) {
+	token, err := install.token()
+	if err != nil {
+		return false, errors.Wrap(err, "could not get installation token")
+	}
+	fixer := &analyser.Fixer{
+		Command:     g.AutoFixCommand,
+		PushURL:     cfg.fixURL,
+		Username:    tokenUsername,
+		Token:       token,
+		Branch:      cfg.fixBranch,
+		AuthorName:  fixAuthorName,
+		AuthorEmail: fixAuthorEmail,
+		Message:     fixMessage,
+	}
+	return fixer.Fix(ctx, exec)
+}
+
+// credentialURL returns the clone URL with an installation access token as
+// its credentials, as accepted by GitHub for git over HTTPS.
+func credentialURL(cloneURL, token string) (string, error) {
+	u, err := url.Parse(cloneURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not parse clone URL %q", cloneURL)
+	}
+	u.User = url.UserPassword(tokenUsername, token)
+	return u.String(), nil
+}
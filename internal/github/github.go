@@ -1,46 +1,228 @@
 package github
 
 import (
+	"net"
 	"net/http"
+	"regexp"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/bradleyfalzon/gopherci/internal/analyser"
 	"github.com/bradleyfalzon/gopherci/internal/db"
 	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/bradleyfalzon/gopherci/internal/scheduler"
+	"github.com/google/go-github/github"
 	"github.com/sethgrid/pester"
 )
 
 // GitHub is the type gopherci uses to interract with github.com.
 type GitHub struct {
-	logger         logger.Logger
-	db             db.DB
-	analyser       analyser.Analyser
-	queuePush      chan<- interface{}
-	webhookSecret  []byte            // shared webhook secret configured for the integration
-	integrationID  int               // id is the integration id
-	integrationKey []byte            // integrationKey is the private key for the installationID
-	tr             http.RoundTripper // tr is a transport shared by all installations to reuse http connections
-	baseURL        string            // baseURL for GitHub API
-	gciBaseURL     string            // gciBaseURL is the base URL for GopherCI
+	logger        logger.Logger
+	db            db.DB
+	analyser      analyser.Analyser
+	queuePush     chan<- interface{}
+	apps          []*app   // apps are the registered GitHub Apps, the first is the default
+	baseURL       string   // baseURL for GitHub API
+	gciBaseURL    string   // gciBaseURL is the base URL for GopherCI
+	installations sync.Map // installations caches *Installation by installationID to share clients
+
+	// Transport is shared by all installations to reuse http connections.
+	// Defaults to http.DefaultTransport. Optional, may be set after New and
+	// before use.
+	Transport http.RoundTripper
+
+	// InlineCommitThreshold is the maximum number of commits in a push for
+	// issues to be commented inline on the latest commit, pushes with more
+	// commits receive a single comment linking to the analysis. Defaults to
+	// 1, a value of 0 always uses a single comment. Optional, may be set
+	// after New and before use.
+	InlineCommitThreshold int
+
+	// CommitCommentGroupBy groups the summary commented on pushes with many
+	// issues, either CommentGroupByFile or CommentGroupByTool, listing the
+	// number of issues in each group. If blank, only the number of issues is
+	// summarised. Optional, may be set after New and before use.
+	CommitCommentGroupBy string
+
+	// OffDiffCommitComment additionally comments a summary on the latest
+	// commit of pushes whose issues are commented inline, listing the issues
+	// outside the diff which can't be commented inline. Optional, may be set
+	// after New and before use.
+	OffDiffCommitComment bool
+
+	// SkipNonCodeChanges skips running tools when an analysis only changes
+	// Go comments or blank lines. Optional, may be set after New and before
+	// use.
+	SkipNonCodeChanges bool
+
+	// PerToolStatuses additionally reports a status for each tool using the
+	// context ci/gopherci/<tool>, allowing specific tools to be required.
+	// Optional, may be set after New and before use.
+	PerToolStatuses bool
+
+	// StatusDuration appends the analysis's duration to the success status
+	// description, such as "Found 2 issues in 1m3s". Optional, may be set
+	// after New and before use.
+	StatusDuration bool
+
+	// NoIssuesDesc is the success status description if no issues were
+	// found, if blank DefaultNoIssuesDesc is used. Optional, may be set after
+	// New and before use.
+	NoIssuesDesc string
+
+	// PushCheckRuns additionally creates a check run for each push's analysis,
+	// summarising the analysis and annotating each issue. Requires the GitHub
+	// App to have the checks write permission, failures are logged but don't
+	// fail the analysis. Optional, may be set after New and before use.
+	PushCheckRuns bool
+
+	// PRFilesMaxPages is the maximum number of pages of a pull request's
+	// files to check for Go files, if the limit is reached the pull request is
+	// assumed to affect Go. A value of 0 checks all pages. Optional, may be set
+	// after New and before use.
+	PRFilesMaxPages int
+
+	// DailyDurationBudget is the maximum cumulative duration of analyses
+	// per installation per UTC day, once exceeded new analyses are skipped
+	// until the next day. A value of 0 is unlimited. Optional, may be set
+	// after New and before use.
+	DailyDurationBudget time.Duration
+
+	// MaxTools is the maximum number of tools run per analysis, protecting
+	// against misconfigured tools. A value of 0 is unlimited. Optional, may
+	// be set after New and before use.
+	MaxTools int
+
+	// MaxModules if greater than 0 discovers the Go modules in each
+	// repository, analysing up to MaxModules modules containing changes, see
+	// analyser.Config.MaxModules. Optional, may be set after New and before
+	// use.
+	MaxModules int
+
+	// MutedTools are the names or IDs of tools skipped in every analysis,
+	// muting misbehaving tools without changing the database. Optional, may
+	// be set after New and before use.
+	MutedTools []string
+
+	// CloneTimeout is the maximum duration to clone a repository, so a slow
+	// clone fails without consuming the whole analysis's time. A value of 0
+	// is only limited by the analysis's timeout. Optional, may be set after
+	// New and before use.
+	CloneTimeout time.Duration
+
+	// IssueTemplate renders each issue's comment body, if nil
+	// analyser.DefaultIssueTemplate is used. Optional, may be set after New
+	// and before use.
+	IssueTemplate *template.Template
+
+	// IncompatibleRegexp matches issues indicating a tool could not parse the
+	// code, such as a tool not supporting the repository's Go version, see
+	// analyser.Config. If nil analyser.DefaultIncompatibleRegexp is used.
+	// Optional, may be set after New and before use.
+	IncompatibleRegexp *regexp.Regexp
+
+	// IssueOrder is the keys issues are ordered by before reporting, so the
+	// least important issues are suppressed, see analyser.SortIssues. If nil
+	// analyser.DefaultIssueOrder is used. Optional, may be set after New and
+	// before use.
+	IssueOrder []string
+
+	// SkipStatuses sets a status on pull requests ignored because they
+	// don't change Go files, are private, don't have the repository's label
+	// or are drafts, describing why the pull request wasn't analysed, see
+	// skipStatus. Optional, may be set after New and before use.
+	SkipStatuses bool
+
+	// MinSeverity is the minimum severity of issues to comment, such as
+	// warning, a repository's min_severity takes precedence. Less severe
+	// issues are still recorded and shown on the analysis's page, see
+	// analyser.FilterSeverity. Optional, may be set after New and before use.
+	MinSeverity string
+
+	// CompareBase additionally runs tools on the base of pushes and pull
+	// requests, only reporting issues they introduced. Analyses take
+	// approximately twice as long. Optional, may be set after New and before
+	// use.
+	CompareBase bool
+
+	// PRDebounceWindow is the duration to hold a pull request's event before
+	// queuing it, further events for the same pull request received during
+	// the window replace the held event, so rapid pushes only analyse the
+	// latest. A value of 0 queues events immediately. Optional, may be set
+	// after New and before use.
+	PRDebounceWindow time.Duration
+
+	// CloneProtocol is the protocol used to clone repositories, one of
+	// CloneProtocolEvent, CloneProtocolHTTPS or CloneProtocolSSH. Blank is
+	// CloneProtocolEvent. Optional, may be set after New and before use.
+	CloneProtocol string
+
+	// AutoFixCommand is a fixer tool and its arguments, such as gofmt -w .,
+	// run after analysing a pull request, and the files it changes are
+	// committed and pushed to the pull request's branch. Fixes are only pushed for
+	// installations in AutoFixInstallations, to pull requests from the same
+	// repository, and never force pushed. Optional, may be set after New and
+	// before use.
+	AutoFixCommand []string
+	// AutoFixInstallations are the GitHub installation IDs which opted in to
+	// AutoFixCommand.
+	AutoFixInstallations []int
+
+	// QuietHours are daily windows, in UTC, by GitHub installation ID, during
+	// which the installation's analyses only set statuses. Analyses still
+	// run and are recorded, but comments are not posted, including after the
+	// window has passed. Optional, may be set after New and before use.
+	QuietHours map[int]scheduler.Window
+
+	// WebhookOrigins are the IP ranges webhooks must be received from, in
+	// addition to being signed, see also WatchHookOrigins. Webhooks from
+	// other addresses are rejected. If empty, and WatchHookOrigins isn't
+	// used, webhooks from any address are accepted. Optional, may be set
+	// after New and before use.
+	WebhookOrigins []*net.IPNet
+
+	// WebhookProxies is the number of trusted proxies, such as load
+	// balancers, in front of the server, each appending the address of its
+	// peer to the X-Forwarded-For header. A webhook's origin is the address
+	// the outermost trusted proxy received it from, or the connection's peer
+	// if 0, see PeerAddr. Optional, may be set after New and before use.
+	WebhookProxies int
+
+	// ResultWebhooks are the outgoing webhooks each analysis's results are
+	// POSTed to, keyed by GitHub installation ID. Optional, may be set after
+	// New and before use.
+	ResultWebhooks map[int]ResultWebhook
+
+	pendingMu sync.Mutex
+	pending   map[pullRequestKey]*github.PullRequestEvent // pending are pull request events held by PRDebounceWindow
+
+	affectsGoMu sync.Mutex
+	affectsGo   map[pullRequestKey]affectsGoEntry // affectsGo caches pull requests' affects Go decisions, see prAffectsGo
+
+	hookOriginsMu sync.RWMutex
+	hookOrigins   []*net.IPNet // hookOrigins are GitHub's webhook ranges, see WatchHookOrigins
 }
 
 // New returns a GitHub object for use with GitHub integrations
 // https://developer.github.com/changes/2016-09-14-Integrations-Early-Access/
 // integrationID is the GitHub Integration ID (not installation ID).
 // integrationKey is the key for the integrationID provided to you by GitHub
-// during the integration registration.
+// during the integration registration. Additional GitHub Apps may be
+// registered with AddApp.
 func New(logger logger.Logger, analyser analyser.Analyser, db db.DB, queuePush chan<- interface{}, integrationID int, integrationKey []byte, webhookSecret, gciBaseURL string) (*GitHub, error) {
 	g := &GitHub{
-		logger:         logger,
-		analyser:       analyser,
-		db:             db,
-		queuePush:      queuePush,
-		webhookSecret:  []byte(webhookSecret),
-		integrationID:  integrationID,
-		integrationKey: integrationKey,
-		tr:             http.DefaultTransport,
-		baseURL:        "https://api.github.com",
-		gciBaseURL:     gciBaseURL,
+		logger:     logger,
+		analyser:   analyser,
+		db:         db,
+		queuePush:  queuePush,
+		apps:       []*app{{id: integrationID, key: integrationKey, webhookSecret: []byte(webhookSecret)}},
+		baseURL:    "https://api.github.com",
+		gciBaseURL: gciBaseURL,
+
+		Transport:             http.DefaultTransport,
+		InlineCommitThreshold: 1,
 	}
 
 	// TODO some prechecks should be done now, instead of later, fail fast/early.
@@ -48,12 +230,20 @@ func New(logger logger.Logger, analyser analyser.Analyser, db db.DB, queuePush c
 	return g, nil
 }
 
-func (g *GitHub) newInstallationTransport(installationID int) (*ghinstallation.Transport, error) {
-	tr, err := ghinstallation.New(g.tr, g.integrationID, installationID, g.integrationKey)
+// newInstallationTransport returns a transport authenticating as
+// installationID of the GitHub App integrationID, an integrationID of 0 uses
+// the default GitHub App.
+func (g *GitHub) newInstallationTransport(integrationID, installationID int) (*ghinstallation.Transport, error) {
+	app, err := g.app(integrationID)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := ghinstallation.New(g.Transport, app.id, installationID, app.key)
 	if err != nil {
 		return nil, err
 	}
-	tr.Client = pester.New() // provide retry functionality for intermittent network issues
+	// provide retry functionality for intermittent network issues
+	tr.Client = pester.NewExtendedClient(&http.Client{Transport: g.Transport})
 	tr.BaseURL = g.baseURL
 	return tr, nil
 }
@@ -2,14 +2,18 @@ package github
 
 import (
 	"context"
+	"encoding/json"
+	"expvar"
 	"fmt"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/analyser"
 	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
 )
@@ -43,14 +47,20 @@ func (g *GitHub) CallbackHandler(w http.ResponseWriter, r *http.Request) {
 func (g *GitHub) WebHookHandler(w http.ResponseWriter, r *http.Request) {
 	logger := g.logger.With("deliveryID", github.DeliveryID(r))
 
-	payload, err := github.ValidatePayload(r, g.webhookSecret)
+	if !g.allowedOrigin(r) {
+		logger.With("remoteAddr", r.RemoteAddr).Error("rejected webhook from disallowed origin")
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	payload, app, err := g.validatePayload(r)
 	if err != nil {
 		logger.With("error", err).Error("failed to validate payload")
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	event, err := github.ParseWebHook(github.WebHookType(r), payload)
+	event, err := parseWebHook(github.WebHookType(r), payload)
 	if err != nil {
 		if strings.HasPrefix(err.Error(), "unknown X-Github-Event in message: integration_installation") {
 			// Ignore error message about deprecated integration_installation and integration_installation_repositories events.
@@ -66,7 +76,7 @@ func (g *GitHub) WebHookHandler(w http.ResponseWriter, r *http.Request) {
 	switch e := event.(type) {
 	case *github.InstallationEvent:
 		logger = logger.With("installationID", *e.Installation.ID).With("event", "InstallationEvent")
-		err = g.integrationInstallationEvent(e)
+		err = g.integrationInstallationEvent(app.id, e)
 	case *github.PushEvent:
 		var installation *Installation
 		logger = logger.With("installationID", *e.Installation.ID).With("event", "PushEvent")
@@ -77,6 +87,9 @@ func (g *GitHub) WebHookHandler(w http.ResponseWriter, r *http.Request) {
 			err = &ignoreEvent{reason: ignoreNoInstallation}
 			break
 		}
+		if err = g.checkRepositoryAllowed(*e.Installation.ID, *e.Repo.ID); err != nil {
+			break
+		}
 		if !checkPushAffectsGo(e) {
 			err = &ignoreEvent{reason: ignoreNoGoFiles}
 			break
@@ -102,15 +115,32 @@ func (g *GitHub) WebHookHandler(w http.ResponseWriter, r *http.Request) {
 			err = &ignoreEvent{reason: ignoreNoInstallation}
 			break
 		}
+		if err = g.checkRepositoryAllowed(*e.Installation.ID, *e.Repo.ID); err != nil {
+			break
+		}
 		if e.Repo.GetPrivate() || e.PullRequest.Head.Repo.GetPrivate() || e.PullRequest.Base.Repo.GetPrivate() {
 			err = &ignoreEvent{reason: ignorePrivateRepos}
 			break
 		}
+		if isDraftPR(payload) {
+			err = &ignoreEvent{reason: ignoreDraft}
+			break
+		}
+		var added *github.Label
+		if *e.Action == "labeled" {
+			added = &github.Label{}
+			if e.Label != nil {
+				added = e.Label
+			}
+		}
+		if err = g.checkPRLabels(*e.Repo.ID, e.PullRequest.Labels, added); err != nil {
+			break
+		}
 		err = checkPRAccessible(r.Context(), installation, *e.Repo.Owner.Login, *e.Repo.Name, *e.Number)
 		if err != nil {
 			break
 		}
-		ok, err = checkPRAffectsGo(r.Context(), installation, *e.Repo.Owner.Login, *e.Repo.Name, *e.Number)
+		ok, err = g.prAffectsGo(r.Context(), installation, e)
 		if err != nil {
 			break
 		}
@@ -118,7 +148,15 @@ func (g *GitHub) WebHookHandler(w http.ResponseWriter, r *http.Request) {
 			err = &ignoreEvent{reason: ignoreNoGoFiles}
 			break
 		}
-		g.queuePush <- e
+		if g.queuePullRequest(e) {
+			logger.Info("replaced pending event for pull request")
+		}
+	case *github.IssueCommentEvent:
+		logger = logger.With("installationID", *e.Installation.ID).With("event", "IssueCommentEvent").With("action", e.GetAction())
+		err = g.issueCommentEvent(r.Context(), e)
+	case *checkRunEvent:
+		logger = logger.With("installationID", *e.Installation.ID).With("event", "CheckRunEvent").With("action", e.GetAction())
+		err = g.checkRunEvent(r.Context(), e)
 	default:
 		err = &ignoreEvent{reason: ignoreUnknownEvent}
 	}
@@ -126,14 +164,56 @@ func (g *GitHub) WebHookHandler(w http.ResponseWriter, r *http.Request) {
 	switch err.(type) {
 	case nil:
 	case *ignoreEvent:
-		logger.With("error", err).Info("ignoring event")
+		logIgnoreEvent(logger, err.(*ignoreEvent))
+		if e, ok := event.(*github.PullRequestEvent); ok {
+			g.setSkipStatus(r.Context(), logger, e, err.(*ignoreEvent))
+		}
 	default:
 		logger.With("error", err).Error("cannot handle event")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
+	g.recordInstallationEvent(logger, payload)
 	logger.Info("received event")
 }
 
+// isDraftPR returns true if a pull request event's payload is for a draft
+// pull request. The draft field is decoded from the payload, as it's not
+// supported by github.PullRequest. Drafts are analysed once marked ready for
+// review.
+func isDraftPR(payload []byte) bool {
+	var event struct {
+		PullRequest struct {
+			Draft bool `json:"draft"`
+		} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return false
+	}
+	return event.PullRequest.Draft
+}
+
+// installationEvents counts the webhooks received from each installation,
+// published with expvar.
+var installationEvents = expvar.NewMap("github_installation_events")
+
+// recordInstallationEvent records the installation which sent a webhook's
+// payload, if any, sent an event now. Errors are only logged, as the event
+// has been handled.
+func (g *GitHub) recordInstallationEvent(logger logger.Logger, payload []byte) {
+	var event struct {
+		Installation struct {
+			ID int `json:"id"`
+		} `json:"installation"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil || event.Installation.ID == 0 {
+		return
+	}
+	installationEvents.Add(strconv.Itoa(event.Installation.ID), 1)
+	if err := g.db.RecordGHInstallationEvent(event.Installation.ID, time.Now()); err != nil {
+		logger.With("error", err).Error("could not record installation event")
+	}
+}
+
 type ignoreReason int
 
 const (
@@ -144,8 +224,106 @@ const (
 	ignoreNoGoFiles
 	ignorePrivateRepos
 	ignorePRInaccessible
+	ignoreRepositoryNotAllowed
+	ignoreNoCommand
+	ignoreUnknownTool
+	ignoreNoWriteAccess
+	ignoreMissingLabel
+	ignoreNoAnalysis
+	ignorePRClosed
+	ignoreStaleCheckRun
+	ignoreDraft
 )
 
+// String returns the reason's machine readable name, used in logs and
+// metrics.
+func (r ignoreReason) String() string {
+	switch r {
+	case ignoreUnknownEvent:
+		return "unknown_event"
+	case ignoreInvalidAction:
+		return "invalid_action"
+	case ignoreNoAction:
+		return "no_action"
+	case ignoreNoInstallation:
+		return "no_installation"
+	case ignoreNoGoFiles:
+		return "no_go_files"
+	case ignorePrivateRepos:
+		return "private_repos"
+	case ignorePRInaccessible:
+		return "pr_inaccessible"
+	case ignoreRepositoryNotAllowed:
+		return "repository_not_allowed"
+	case ignoreNoCommand:
+		return "no_command"
+	case ignoreUnknownTool:
+		return "unknown_tool"
+	case ignoreNoWriteAccess:
+		return "no_write_access"
+	case ignoreMissingLabel:
+		return "missing_label"
+	case ignoreNoAnalysis:
+		return "no_analysis"
+	case ignorePRClosed:
+		return "pr_closed"
+	case ignoreStaleCheckRun:
+		return "stale_check_run"
+	case ignoreDraft:
+		return "draft"
+	}
+	return fmt.Sprintf("unknown_reason_%d", r)
+}
+
+// ignoredEvents counts the events ignored by reason, published with expvar.
+var ignoredEvents = expvar.NewMap("github_ignored_events")
+
+// logIgnoreEvent logs an ignored event with its reason and increments the
+// reason's ignoredEvents counter.
+func logIgnoreEvent(logger logger.Logger, e *ignoreEvent) {
+	ignoredEvents.Add(e.reason.String(), 1)
+	logger.With("error", e).With("reason", e.reason.String()).Info("ignoring event")
+}
+
+// skipStatus returns the status state and description of a pull request
+// ignored for e's reason, or a blank description if the reason isn't reported
+// to the pull request, such as the installation not being enabled. Pull
+// requests which will be analysed once changed, such as by adding the label or
+// marking a draft ready for review, are pending, so a required status check
+// doesn't pass without an analysis.
+func skipStatus(e *ignoreEvent) (StatusState, string) {
+	switch e.reason {
+	case ignoreNoGoFiles:
+		return StatusStateSuccess, "Skipped: no Go files changed"
+	case ignorePrivateRepos:
+		return StatusStateSuccess, "Skipped: private repositories are not yet supported"
+	case ignoreMissingLabel:
+		return StatusStatePending, fmt.Sprintf("Skipped: pull request does not have the %q label", e.extra)
+	case ignoreDraft:
+		return StatusStatePending, "Skipped: pull request is a draft"
+	}
+	return "", ""
+}
+
+// setSkipStatus sets a status on an ignored pull request's head describing
+// why it was ignored, if SkipStatuses is enabled and the reason is reported,
+// see skipStatus. Errors are only logged, as the event has been handled.
+func (g *GitHub) setSkipStatus(ctx context.Context, logger logger.Logger, e *github.PullRequestEvent, ignore *ignoreEvent) {
+	state, desc := skipStatus(ignore)
+	if !g.SkipStatuses || desc == "" {
+		return
+	}
+	installation, err := g.NewInstallation(e.GetInstallation().GetID())
+	if err != nil {
+		logger.With("error", err).Error("could not set skipped status")
+		return
+	}
+	reporter := NewStatusAPIReporter(logger, installation.client, e.GetPullRequest().GetStatusesURL(), prStatusesContext, "")
+	if err := reporter.SetStatus(ctx, state, desc); err != nil {
+		logger.With("error", err).Error("could not set skipped status")
+	}
+}
+
 // ignoreEvent indicates the event should be accepted but ignored.
 type ignoreEvent struct {
 	reason ignoreReason
@@ -169,10 +347,70 @@ func (e *ignoreEvent) Error() string {
 		return "private repositories are not yet supported"
 	case ignorePRInaccessible:
 		return "pull request is inaccessible: " + e.extra
+	case ignoreRepositoryNotAllowed:
+		return "repository is not allowed by the installation's repository rules"
+	case ignoreNoCommand:
+		if e.extra != "" {
+			return "no command: " + e.extra
+		}
+		return "no command"
+	case ignoreUnknownTool:
+		return "unknown tool: " + e.extra
+	case ignoreNoWriteAccess:
+		return "user does not have write access: " + e.extra
+	case ignoreMissingLabel:
+		return "pull request does not have the repository's label: " + e.extra
+	case ignoreNoAnalysis:
+		return "no analysis to re-run: " + e.extra
+	case ignorePRClosed:
+		return "pull request is closed"
+	case ignoreStaleCheckRun:
+		return "check run's commit is no longer the pull request's head: " + e.extra
+	case ignoreDraft:
+		return "pull request is a draft"
 	}
 	return e.extra
 }
 
+// checkRepositoryAllowed checks an installation's repository rules to
+// determine whether the event should continue to be processed. Returns error
+// type *ignoreEvent if the repository is not allowed, nil if it should be
+// processed, or other error if check could not be completed.
+func (g *GitHub) checkRepositoryAllowed(installationID, repositoryID int) error {
+	allowed, err := g.db.IsRepositoryAllowed(installationID, repositoryID)
+	if err != nil {
+		return errors.Wrap(err, "could not check repository rules")
+	}
+	if !allowed {
+		return &ignoreEvent{reason: ignoreRepositoryNotAllowed}
+	}
+	return nil
+}
+
+// checkPRLabels checks a repository's settings to determine whether a pull
+// request's labels allow it to be analysed. If added is not nil, the event
+// added that label, which is only processed if it's the label the settings
+// require, so adding any other label doesn't analyse the pull request again.
+// Returns error type *ignoreEvent if the pull request should be ignored, nil
+// if it should be processed, or other error if check could not be completed.
+func (g *GitHub) checkPRLabels(repositoryID int, labels []*github.Label, added *github.Label) error {
+	settings, err := g.db.GetRepoSettings(repositoryID)
+	if err != nil {
+		return errors.Wrap(err, "could not get repository settings")
+	}
+	if added != nil && (settings.PRLabel == "" || !strings.EqualFold(added.GetName(), settings.PRLabel)) {
+		return &ignoreEvent{reason: ignoreInvalidAction, extra: "labeled " + added.GetName()}
+	}
+	var names []string
+	for _, label := range labels {
+		names = append(names, label.GetName())
+	}
+	if !settings.AllowsLabels(names) {
+		return &ignoreEvent{reason: ignoreMissingLabel, extra: settings.PRLabel}
+	}
+	return nil
+}
+
 // checkPRAction checks a pull request's action to determine whether the event
 // should continue to be processed. Returns error type *ignoreEvent if the event
 // should be ignored, nil if it should be processed, or other error if check
@@ -181,34 +419,33 @@ func checkPRAction(e *github.PullRequestEvent) error {
 	if e.Action == nil {
 		return &ignoreEvent{reason: ignoreNoAction}
 	}
-	if *e.Action != "opened" && *e.Action != "synchronize" && *e.Action != "reopened" {
+	switch *e.Action {
+	case "opened", "synchronize", "reopened", "ready_for_review":
+	case "labeled":
+		// Only the label required by the repository's settings is processed,
+		// see checkPRLabels.
+	default:
 		return &ignoreEvent{reason: ignoreInvalidAction, extra: *e.Action}
 	}
 	return nil
 }
 
-const configFilename = ".gopherci.yml"
-
 // checkPRAffectsGo returns true if a pull request modifies, adds or removes
-// Go files, else returns error if an error occurs.
-func checkPRAffectsGo(ctx context.Context, installation *Installation, owner, repo string, number int) (bool, error) {
-	opt := &github.ListOptions{PerPage: 100}
-	for {
-		files, resp, err := installation.client.PullRequests.ListFiles(ctx, owner, repo, number, opt)
-		if err != nil {
-			return false, errors.Wrap(err, "could not list files")
-		}
-		for _, file := range files {
-			if hasGoExtension(*file.Filename) || *file.Filename == configFilename {
-				return true, nil
-			}
-		}
-		if resp.NextPage == 0 {
-			break
+// Go files, else returns error if an error occurs. If maxPages is > 0, only
+// maxPages pages of files are checked, and if more pages remain the pull
+// request is assumed to affect Go.
+func checkPRAffectsGo(ctx context.Context, installation *Installation, owner, repo string, number, maxPages int) (bool, error) {
+	files, more, err := listPRFiles(ctx, installation.client, owner, repo, number, maxPages)
+	if err != nil {
+		return false, err
+	}
+	for _, file := range files {
+		if hasGoExtension(file.GetFilename()) || analyser.IsConfigFilename(file.GetFilename()) {
+			return true, nil
 		}
-		opt.Page = resp.NextPage
 	}
-	return false, nil
+	// If there were too many files to check, assume it does affect Go.
+	return more, nil
 }
 
 // checkPRAccessible checks to ensure the pull request is accessible. GitHub
@@ -226,7 +463,7 @@ func checkPRAccessible(ctx context.Context, installation *Installation, owner, r
 func checkPushAffectsGo(event *github.PushEvent) bool {
 	hasGoFile := func(files []string) bool {
 		for _, filename := range files {
-			if hasGoExtension(filename) || filename == configFilename {
+			if hasGoExtension(filename) || analyser.IsConfigFilename(filename) {
 				return true
 			}
 		}
@@ -245,15 +482,21 @@ func hasGoExtension(filename string) bool {
 	return strings.HasSuffix(filename, ".go")
 }
 
-func (g *GitHub) integrationInstallationEvent(e *github.InstallationEvent) error {
+// integrationInstallationEvent handles an installation event delivered for
+// the GitHub App integrationID.
+func (g *GitHub) integrationInstallationEvent(integrationID int, e *github.InstallationEvent) error {
 	var err error
 	switch *e.Action {
 	case "created":
 		// Record the installation event in the database
-		err = g.db.AddGHInstallation(*e.Installation.ID, *e.Installation.Account.ID, *e.Sender.ID)
+		err = g.db.AddGHInstallation(integrationID, *e.Installation.ID, *e.Installation.Account.ID, *e.Sender.ID)
 	case "deleted":
 		// Remove the installation event from the database
+		g.invalidateInstallation(*e.Installation.ID)
 		err = g.db.RemoveGHInstallation(*e.Installation.ID)
+	case "suspend", "unsuspend":
+		// Permissions and tokens may have changed, use a new client
+		g.invalidateInstallation(*e.Installation.ID)
 	}
 	if err != nil {
 		return errors.Wrap(err, "database error handling integration installation event")
@@ -261,14 +504,27 @@ func (g *GitHub) integrationInstallationEvent(e *github.InstallationEvent) error
 	return nil
 }
 
-// PushConfig returns an AnalyseConfig for a GitHub Push Event.
+// PushConfig returns an AnalyseConfig for a GitHub Push Event. If the push
+// created a branch other than the repository's default branch, the changes
+// since the merge base with the default branch are analysed.
 func PushConfig(e *github.PushEvent) AnalyseConfig {
+	// baseRef is after~numCommits to better handle forced pushes, as a
+	// forced push has the before ref of a commit that's been overwritten.
+	baseRef := fmt.Sprintf("%v~%v", *e.After, len(e.Commits))
+	var refReader analyser.RefReader = &analyser.FixedRef{BaseRef: baseRef}
+
 	// commitFrom is after~numCommits for the same reason as baseRef but
 	// also because first pushes's before is 000000.... which can't be
 	// used in api request
-	commitFrom := fmt.Sprintf("%v~%v", *e.After, len(e.Commits))
+	commitFrom := baseRef
+	branch := strings.TrimPrefix(e.GetRef(), "refs/heads/")
 	if e.Created != nil && *e.Created {
 		commitFrom = ""
+		// A created branch's commits may not all be in the push, so compare
+		// against where it diverged from the default branch.
+		if defaultBranch := e.Repo.GetDefaultBranch(); defaultBranch != "" && defaultBranch != branch {
+			refReader = &analyser.BranchMergeBase{Branch: defaultBranch, FallbackRef: baseRef}
+		}
 	}
 
 	return AnalyseConfig{
@@ -276,11 +532,7 @@ func PushConfig(e *github.PushEvent) AnalyseConfig {
 			HeadURL: *e.Repo.CloneURL,
 			HeadRef: *e.After,
 		},
-		refReader: &analyser.FixedRef{
-			// baseRef is after~numCommits to better handle forced pushes, as a
-			// forced push has the before ref of a commit that's been overwritten.
-			BaseRef: fmt.Sprintf("%v~%v", *e.After, len(e.Commits)),
-		},
+		refReader:       refReader,
 		installationID:  *e.Installation.ID,
 		repositoryID:    *e.Repo.ID,
 		statusesContext: "ci/gopherci/push",
@@ -289,6 +541,8 @@ func PushConfig(e *github.PushEvent) AnalyseConfig {
 		commitTo:        *e.After,
 		commitCount:     len(e.Commits),
 		headRef:         *e.After,
+		branch:          branch,
+		author:          e.GetSender().GetLogin(),
 		goSrcPath:       stripScheme(*e.Repo.HTMLURL),
 		owner:           *e.Repo.Owner.Name,
 		repo:            *e.Repo.Name,
@@ -296,27 +550,44 @@ func PushConfig(e *github.PushEvent) AnalyseConfig {
 	}
 }
 
-// PullRequestConfig return an AnalyseConfig for a GitHub Pull Request.
-func PullRequestConfig(e *github.PullRequestEvent) AnalyseConfig {
+// PullRequestConfig return an AnalyseConfig for a GitHub Pull Request. If
+// mergeRef is true, the result of merging the pull request is analysed instead
+// of its head, if GitHub was able to merge it.
+func PullRequestConfig(e *github.PullRequestEvent, mergeRef bool) AnalyseConfig {
 	pr := e.PullRequest
+	cloner := &analyser.PullRequestCloner{
+		BaseURL: *pr.Base.Repo.CloneURL,
+		BaseRef: *pr.Base.Ref,
+		HeadURL: *pr.Head.Repo.CloneURL,
+		HeadRef: *pr.Head.Ref,
+	}
+	if mergeRef {
+		cloner.MergeRef = fmt.Sprintf("refs/pull/%d/merge", *e.Number)
+		cloner.HeadSHA = pr.Head.GetSHA()
+	}
+	var fixURL, fixBranch string
+	if !mergeRef && pr.Head.Repo.GetID() != 0 && pr.Head.Repo.GetID() == pr.Base.Repo.GetID() {
+		// Only push fixes to the head branch when it was checked out, and
+		// is in the same repository, as forks cannot be pushed to.
+		fixURL, fixBranch = pr.Head.Repo.GetCloneURL(), pr.Head.GetRef()
+	}
 	return AnalyseConfig{
-		cloner: &analyser.PullRequestCloner{
-			BaseURL: *pr.Base.Repo.CloneURL,
-			BaseRef: *pr.Base.Ref,
-			HeadURL: *pr.Head.Repo.CloneURL,
-			HeadRef: *pr.Head.Ref,
-		},
+		cloner:          cloner,
 		refReader:       &analyser.MergeBase{},
 		installationID:  *e.Installation.ID,
 		repositoryID:    *e.Repo.ID,
-		statusesContext: "ci/gopherci/pr",
+		statusesContext: prStatusesContext,
 		statusesURL:     *pr.StatusesURL,
 		headRef:         *pr.Head.Ref,
+		branch:          *pr.Head.Ref,
+		author:          pr.GetUser().GetLogin(),
 		goSrcPath:       stripScheme(*pr.Base.Repo.HTMLURL),
 		owner:           *pr.Base.Repo.Owner.Login,
 		repo:            *pr.Base.Repo.Name,
 		pr:              *e.Number,
 		sha:             *pr.Head.SHA,
+		fixURL:          fixURL,
+		fixBranch:       fixBranch,
 	}
 }
 
@@ -338,9 +609,20 @@ type AnalyseConfig struct {
 	// if pull request (EventTypePullRequest)
 	pr int
 
+	// author is the login of the user who pushed or opened the pull request,
+	// used to label the analysis, may be blank.
+	author string
+
 	// for analyser.
 	headRef   string // ref can be branch for pr or sha (after) for push.
+	branch    string // branch name used to select branch config overrides, may be blank.
 	goSrcPath string
+	fullScan  bool   // fullScan reports all issues, not only those in the changes.
+	fixURL    string // fixURL is the clone URL of the repository fixes may be pushed to.
+	fixBranch string // fixBranch is the branch fixes may be pushed to, blank if fixes must not be pushed.
+	// tools are the names of the only tools to run, such as for a tool run,
+	// if nil all tools are run.
+	tools []string
 
 	// for issue comments.
 	owner string
@@ -348,6 +630,17 @@ type AnalyseConfig struct {
 	sha   string
 }
 
+// trigger returns the type of event which triggered the analysis.
+func (cfg AnalyseConfig) trigger() db.AnalysisTrigger {
+	switch {
+	case cfg.fullScan:
+		return db.AnalysisTriggerFullScan
+	case cfg.pr != 0:
+		return db.AnalysisTriggerPullRequest
+	}
+	return db.AnalysisTriggerPush
+}
+
 // Analyse analyses a GitHub event. If cfg.pr is not 0, comments will also be
 // written on the Pull Request.
 func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
@@ -374,9 +667,21 @@ func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
 	if err != nil {
 		return errors.Wrap(err, "could not get tools")
 	}
+	tools, invalid := db.ValidTools(tools)
+	for _, err := range invalid {
+		logger.With("error", err).Error("skipping tool")
+	}
+	settings, err := g.db.GetRepoSettings(cfg.repositoryID)
+	if err != nil {
+		return errors.Wrap(err, "could not get repository settings")
+	}
+	tools = scopeTools(settings.EnabledTools(tools), cfg.tools)
+	if len(tools) == 0 && cfg.tools != nil {
+		return fmt.Errorf("could not find tools %v", cfg.tools)
+	}
 
 	// Record start of analysis
-	analysis, err := g.db.StartAnalysis(install.ID, cfg.repositoryID, cfg.commitFrom, cfg.commitTo, cfg.pr)
+	analysis, err := g.db.StartAnalysis(install.ID, cfg.repositoryID, cfg.trigger(), cfg.commitFrom, cfg.commitTo, cfg.pr, cfg.branch, cfg.author)
 	if err != nil {
 		return errors.Wrap(err, "error starting analysis")
 	}
@@ -386,11 +691,14 @@ func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
 
 	// Set the CI status API to pending
 	statusAPIReporter := NewStatusAPIReporter(logger, install.client, cfg.statusesURL, cfg.statusesContext, analysisURL)
+	statusAPIReporter.SetNoIssuesDesc(g.NoIssuesDesc)
 	err = statusAPIReporter.SetStatus(ctx, StatusStatePending, "In progress")
 	if err != nil {
 		return err
 	}
 
+	toolReporters := g.toolStatusReporters(logger, install.client, cfg, tools, analysisURL)
+
 	// if Analyse returns an error, set status as internally failed, and if
 	// we were panicking, catch it, set the error, and then panic again, the
 	// stacktrack should be maintained
@@ -404,6 +712,11 @@ func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
 			if serr := statusAPIReporter.SetStatus(ctx, StatusStateError, "Internal error"); serr != nil {
 				logger.With("error", serr).Error("could not set status API to error")
 			}
+			for _, reporter := range toolReporters {
+				if serr := reporter.SetStatus(ctx, StatusStateError, "Internal error"); serr != nil {
+					logger.With("error", serr).Error("could not set tool status API to error")
+				}
+			}
 
 			if ferr := g.db.FinishAnalysis(analysis.ID, db.AnalysisStatusError, nil); ferr != nil {
 				logger.With("error", ferr).Error("could not set analysis to error")
@@ -415,57 +728,167 @@ func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
 		}
 	}()
 
+	// Skip the analysis if the installation has used its daily budget.
+	exceeded, err := g.budgetExceeded(install.ID, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "could not check daily duration budget")
+	}
+	if exceeded {
+		logger.Info("skipping analysis: ", SkipReasonBudgetExceeded)
+		return g.skipAnalysis(ctx, analysis, SkipReasonBudgetExceeded, statusAPIReporter, toolReporters)
+	}
+
+	// Without tools the analysis would always pass, hiding the
+	// misconfiguration.
+	if len(tools) == 0 {
+		logger.Warn("skipping analysis: ", SkipReasonNoTools)
+		return g.skipAnalysis(ctx, analysis, SkipReasonNoTools, statusAPIReporter, toolReporters)
+	}
+
+	for _, reporter := range toolReporters {
+		if err := reporter.SetStatus(ctx, StatusStatePending, "In progress"); err != nil {
+			return err
+		}
+	}
+
 	// Analyse
 	acfg := analyser.Config{
-		HeadRef: cfg.headRef,
+		HeadRef:            cfg.headRef,
+		SkipNonCodeChanges: g.SkipNonCodeChanges,
+		MaxTools:           g.MaxTools,
+		MaxModules:         g.MaxModules,
+		MutedTools:         g.MutedTools,
+		CloneTimeout:       g.CloneTimeout,
+		FullScan:           cfg.fullScan,
+		IssueTemplate:      g.IssueTemplate,
+		IncompatibleRegexp: g.IncompatibleRegexp,
+		CompareBase:        g.CompareBase,
+		Owner:              cfg.owner,
+		Repo:               cfg.repo,
+		PRNumber:           cfg.pr,
+		HeadSHA:            cfg.sha,
+		OffDiff:            g.offDiffEnabled(cfg),
 	}
 
-	configReader := &analyser.YAMLConfig{
-		Tools: tools,
-	}
+	configReader := &repoConfigRecorder{ConfigReader: &analyser.YAMLConfig{
+		Tools:  tools,
+		Branch: cfg.branch,
+	}}
 
 	// Get a new executer/environment to execute in
-	executer, err := g.analyser.NewExecuter(ctx, cfg.goSrcPath)
+	env, err := g.analyser.NewExecuter(ctx, cfg.goSrcPath)
 	if err != nil {
 		return errors.Wrap(err, "analyser could create new executer")
 	}
 	defer func() {
-		if err := executer.Stop(ctx); err != nil {
+		// Keep the environment of a failed analysis for debugging, if the
+		// analyser is configured to.
+		if r, ok := env.(analyser.Retainer); ok && err != nil {
+			if location, ok := r.Retain(); ok {
+				logger.With("location", location).Warn("retaining environment of failed analysis")
+			}
+		}
+		if err := env.Stop(ctx); err != nil {
 			logger.With("error", err).Error("could not stop executer")
 		}
 	}()
 
 	// Wrap it with our DB as it wants to record the results.
-	executer = g.db.ExecRecorder(analysis.ID, executer)
+	executer := g.db.ExecRecorder(analysis.ID, env)
+
+	cloner, err := g.protocolCloner(install, cfg.cloner)
+	if err != nil {
+		return errors.Wrap(err, "could not rewrite clone URLs")
+	}
 
-	err = analyser.Analyse(ctx, logger, executer, cfg.cloner, configReader, cfg.refReader, acfg, analysis)
+	err = analyser.Analyse(ctx, logger, executer, cloner, configReader, cfg.refReader, acfg, analysis)
 	if err != nil {
 		return errors.Wrap(err, "could not run analyser")
 	}
 
 	// Report the issues.
+	reportStart := time.Now()
+	if g.StatusDuration {
+		statusAPIReporter.SetDuration(time.Duration(analysis.TotalDuration))
+	}
+	// The patterns were validated when the configuration was read.
+	mustFix, _ := configReader.config.MustFixPatterns()
+	statusAPIReporter.SetMustFix(mustFix)
 	var reporters []analyser.Reporter
 	reporters = append(reporters, statusAPIReporter) // Status API.
 
-	switch {
-	case cfg.pr != 0:
-		// Inline code comments on the PR.
-		reporters = append(reporters, NewPRReviewReporter(install.client, cfg.owner, cfg.repo, cfg.pr, cfg.sha))
-	case cfg.commitCount == 1:
-		// Comment on the single commit the issues inline.
-		reporters = append(reporters, NewInlineCommitCommentReporter(install.client, cfg.owner, cfg.repo, cfg.sha))
-	case cfg.commitCount > 1:
-		// Comment on the latest commit a summary of all commits.
-		reporters = append(reporters, NewCommitCommentReporter(install.client, cfg.owner, cfg.repo, cfg.sha, cfg.commitCount, analysisURL))
+	var commentReporters []analyser.Reporter
+	if g.commentsEnabled(logger, settings, cfg.installationID, time.Now()) {
+		commentReporters = g.commentReporters(logger, install.client, cfg, analysisURL, issueToolNames(analysis, tools))
 	}
 
+	// Order the issues so the least important are suppressed.
+	issues := analysis.Issues()
+	analyser.SortIssues(issues, g.IssueOrder)
+
+	// Each reporter has its own copy of the issues, so one reporter modifying
+	// them doesn't affect the others.
 	for _, reporter := range reporters {
-		err := reporter.Report(ctx, analysis.Issues())
+		err := reporter.Report(ctx, copyIssues(issues))
 		if err != nil {
 			return errors.WithMessage(err, "error reporting issues")
 		}
 	}
 
+	if g.PushCheckRuns && cfg.pr == 0 && !cfg.fullScan {
+		// Checks API summary and annotations of the push. The installation
+		// may not have granted the checks permission, and the status is
+		// already set, so only log failures rather than failing the analysis.
+		reporter := NewPushCheckRunReporter(install.client, cfg.owner, cfg.repo, cfg.sha, cfg.statusesContext, cfg.commitCount, analysisURL)
+		if err := reporter.Report(ctx, copyIssues(issues)); err != nil {
+			logger.With("error", err).Warn("could not create push check run")
+		}
+	}
+
+	// Issues below the minimum severity are recorded, but not commented.
+	minSeverity := g.minSeverity(configReader.config)
+	commentIssues := analyser.FilterSeverity(issues, minSeverity)
+	if acfg.OffDiff {
+		// The issues outside the diff are only commented by the
+		// OffDiffCommentReporter, the others ignore them.
+		offDiff := analysis.OffDiffIssues()
+		analyser.SortIssues(offDiff, g.IssueOrder)
+		commentIssues = append(copyIssues(commentIssues), analyser.FilterSeverity(offDiff, minSeverity)...)
+	}
+	for _, reporter := range commentReporters {
+		if err := reporter.Report(ctx, copyIssues(commentIssues)); err != nil {
+			return errors.WithMessage(err, "error reporting issues")
+		}
+	}
+
+	for _, reporter := range toolReporters {
+		if err := reporter.ReportAnalysis(ctx, analysis); err != nil {
+			return errors.WithMessage(err, "error reporting tool status")
+		}
+	}
+	analyser.StageLogger(logger, analyser.StageReported, time.Since(reportStart)).With(analyser.LogIssues, len(issues)).Info("reported issues")
+
+	if hook, ok := g.ResultWebhooks[cfg.installationID]; ok {
+		reporter := NewWebhookReporter(&http.Client{Transport: g.Transport, Timeout: resultWebhookTimeout}, hook, cfg.owner, cfg.repo, cfg.installationID, analysis, analysisURL, issueToolNames(analysis, tools))
+		if err := reporter.Report(ctx, copyIssues(issues)); err != nil {
+			// The receiver is outside our control, so only log failures
+			// rather than failing the analysis.
+			logger.With("error", err).Warn("could not send result webhook")
+		}
+	}
+
+	if g.autoFixEnabled(cfg) {
+		pushed, err := g.autoFix(ctx, install, executer, cfg)
+		switch {
+		case err != nil:
+			// The analysis succeeded, so only log failures, such as the
+			// branch having changed.
+			logger.With("error", err).Warn("could not push fixes")
+		case pushed:
+			logger.Infof("pushed fixes to %v", cfg.fixBranch)
+		}
+	}
+
 	err = g.db.FinishAnalysis(analysis.ID, db.AnalysisStatusSuccess, analysis)
 	if err != nil {
 		return errors.Wrapf(err, "could not set analysis status for analysisID %v", analysis.ID)
@@ -474,6 +897,157 @@ func (g *GitHub) Analyse(cfg AnalyseConfig) (err error) {
 	return nil
 }
 
+// repoConfigRecorder is an analyser.ConfigReader recording the repository's
+// configuration read by the embedded ConfigReader, so the configuration can
+// be used to report the analysis.
+type repoConfigRecorder struct {
+	analyser.ConfigReader
+	config analyser.RepoConfig // config is the configuration last read
+}
+
+// Read implements the analyser.ConfigReader interface.
+func (r *repoConfigRecorder) Read(ctx context.Context, exec analyser.Executer) (analyser.RepoConfig, error) {
+	cfg, err := r.ConfigReader.Read(ctx, exec)
+	if err == nil {
+		r.config = cfg
+	}
+	return cfg, err
+}
+
+// SkipReasonBudgetExceeded is the reason recorded when an analysis was skipped
+// because the installation exceeded its daily duration budget.
+const SkipReasonBudgetExceeded = "daily analysis budget exceeded"
+
+// SkipReasonNoTools is the reason recorded when an analysis was skipped
+// because no tools are configured, or all tools are disabled by the
+// repository's settings.
+const SkipReasonNoTools = "no tools configured"
+
+// budgetExceeded returns true if the installation, identified by its
+// gh_installations ID, has used its daily duration budget for the UTC day
+// containing now.
+func (g *GitHub) budgetExceeded(ghInstallationID int, now time.Time) (bool, error) {
+	if g.DailyDurationBudget <= 0 {
+		return false, nil
+	}
+	startOfDay := now.UTC().Truncate(24 * time.Hour)
+	used, err := g.db.InstallationDuration(ghInstallationID, startOfDay)
+	if err != nil {
+		return false, err
+	}
+	return time.Duration(used) >= g.DailyDurationBudget, nil
+}
+
+// skipAnalysis finishes an analysis without running it, setting the statuses
+// to error with reason so the skip is visible on the commit.
+func (g *GitHub) skipAnalysis(ctx context.Context, analysis *db.Analysis, reason string, statusAPIReporter *StatusAPIReporter, toolReporters []*ToolStatusAPIReporter) error {
+	desc := "Skipped: " + reason
+	if err := statusAPIReporter.SetStatus(ctx, StatusStateError, desc); err != nil {
+		return err
+	}
+	for _, reporter := range toolReporters {
+		if err := reporter.SetStatus(ctx, StatusStateError, desc); err != nil {
+			return err
+		}
+	}
+	analysis.SkipReason = reason
+	if err := g.db.FinishAnalysis(analysis.ID, db.AnalysisStatusSkipped, analysis); err != nil {
+		return errors.Wrapf(err, "could not set analysis status for analysisID %v", analysis.ID)
+	}
+	return nil
+}
+
+// commentReporter returns the analyser.Reporter used to comment on the pull
+// request or commit, or nil if no comments should be made.
+func (g *GitHub) commentReporter(logger logger.Logger, client *github.Client, cfg AnalyseConfig, analysisURL string, issueTools map[db.Issue]string) analyser.Reporter {
+	switch {
+	case cfg.pr != 0:
+		// Inline code comments on the PR.
+		reporter := NewPRReviewReporter(logger, client, cfg.owner, cfg.repo, cfg.pr, cfg.sha)
+		// Only some tools ran, so other tools' threads aren't fixed.
+		reporter.keepThreads = cfg.tools != nil
+		return reporter
+	case cfg.commitCount == 0:
+		return nil
+	case cfg.commitCount <= g.InlineCommitThreshold:
+		// Comment on the latest commit the issues inline.
+		return NewInlineCommitCommentReporter(client, cfg.owner, cfg.repo, cfg.sha)
+	default:
+		// Comment on the latest commit a summary of all commits.
+		reporter := NewCommitCommentReporter(client, cfg.owner, cfg.repo, cfg.sha, cfg.commitCount, analysisURL)
+		reporter.groupBy, reporter.issueTools = g.CommitCommentGroupBy, issueTools
+		return reporter
+	}
+}
+
+// commentReporters returns the commentReporter, if any, followed by the
+// reporters summarising the issues it couldn't comment.
+func (g *GitHub) commentReporters(logger logger.Logger, client *github.Client, cfg AnalyseConfig, analysisURL string, issueTools map[db.Issue]string) []analyser.Reporter {
+	reporter := g.commentReporter(logger, client, cfg, analysisURL, issueTools)
+	if reporter == nil {
+		return nil
+	}
+	reporters := []analyser.Reporter{reporter}
+	if suppressing, ok := reporter.(analyser.SuppressingReporter); ok && cfg.pr != 0 {
+		// List the issues the comments suppressed.
+		reporters = append(reporters, NewSuppressedSummaryReporter(client, cfg.owner, cfg.repo, cfg.pr, suppressing, analysisURL))
+	}
+	if _, ok := reporter.(*InlineCommitCommentReporter); ok && g.OffDiffCommitComment {
+		// List the issues outside the diff, which couldn't be commented inline.
+		reporters = append(reporters, NewOffDiffCommentReporter(client, cfg.owner, cfg.repo, cfg.sha, analysisURL))
+	}
+	return reporters
+}
+
+// minSeverity returns the minimum severity of issues to comment, the
+// repository's if configured, else the server's.
+func (g *GitHub) minSeverity(repoConfig analyser.RepoConfig) string {
+	if repoConfig.MinSeverity != "" {
+		return repoConfig.MinSeverity
+	}
+	return g.MinSeverity
+}
+
+// copyIssues returns a copy of issues, for a reporter to use.
+func copyIssues(issues []db.Issue) []db.Issue {
+	return append([]db.Issue(nil), issues...)
+}
+
+// offDiffEnabled returns true if the analysis should find the issues outside
+// the diff, for the OffDiffCommentReporter of an inline commented push.
+func (g *GitHub) offDiffEnabled(cfg AnalyseConfig) bool {
+	return g.OffDiffCommitComment && cfg.pr == 0 && cfg.commitCount > 0 && cfg.commitCount <= g.InlineCommitThreshold
+}
+
+// commentsEnabled returns true if issues should be commented, false if the
+// repository is silent or now is within the installation's quiet hours, in
+// which case only statuses are set.
+func (g *GitHub) commentsEnabled(logger logger.Logger, settings db.RepoSettings, installationID int, now time.Time) bool {
+	if settings.Silent {
+		return false
+	}
+	if window, ok := g.QuietHours[installationID]; ok && window.Contains(now.UTC()) {
+		logger.Info("not commenting during the installation's quiet hours")
+		return false
+	}
+	return true
+}
+
+// toolStatusReporters returns a ToolStatusAPIReporter for each tool if
+// per tool statuses are enabled, else nil.
+func (g *GitHub) toolStatusReporters(logger logger.Logger, client *github.Client, cfg AnalyseConfig, tools []db.Tool, analysisURL string) []*ToolStatusAPIReporter {
+	if !g.PerToolStatuses {
+		return nil
+	}
+	var reporters []*ToolStatusAPIReporter
+	for _, tool := range tools {
+		reporter := NewToolStatusAPIReporter(logger, client, cfg.statusesURL, tool, analysisURL)
+		reporter.SetNoIssuesDesc(g.NoIssuesDesc)
+		reporters = append(reporters, reporter)
+	}
+	return reporters
+}
+
 // stripScheme removes the scheme/protocol and :// from a URL.
 func stripScheme(url string) string {
 	return regexp.MustCompile(`[a-zA-Z0-9+.-]+://`).ReplaceAllString(url, "")
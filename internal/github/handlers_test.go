@@ -7,17 +7,21 @@ import (
 	"crypto/sha1"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/analyser"
 	"github.com/bradleyfalzon/gopherci/internal/db"
 	"github.com/bradleyfalzon/gopherci/internal/logger"
 	"github.com/bradleyfalzon/gopherci/internal/queue"
+	"github.com/bradleyfalzon/gopherci/internal/scheduler"
 	"github.com/google/go-github/github"
 )
 
@@ -88,7 +92,7 @@ func setup(t *testing.T) (*GitHub, *mockAnalyser, *db.MockDB) {
 		c  = make(chan interface{})
 	)
 	queue := queue.NewMemoryQueue(logger.Testing())
-	queue.Wait(context.Background(), &wg, c, func(job interface{}) {})
+	queue.Wait(context.Background(), &wg, c, func(job interface{}) error { return nil })
 
 	// New GitHub
 	g, err := New(logger.Testing(), mockAnalyser, memDB, c, 1, integrationKey, webhookSecret, "https://example.com")
@@ -215,7 +219,7 @@ func TestWebhookHandler(t *testing.T) {
 
 	// Modify .gopherci.yml
 	pushCfg := goodPush()
-	pushCfg.Commits = []github.PushEventCommit{{Modified: []string{configFilename}}}
+	pushCfg.Commits = []github.PushEventCommit{{Modified: []string{".gopherci.yml"}}}
 
 	// No go files
 	pushNoGo := goodPush()
@@ -296,7 +300,7 @@ func TestWebhookHandler(t *testing.T) {
 			js, _ := json.Marshal([]*github.CommitFile{&file})
 			fmt.Fprintln(w, string(js))
 		case "/repos/owner/repo/pulls/3/files?per_page=100":
-			file := github.CommitFile{Filename: github.String(configFilename)}
+			file := github.CommitFile{Filename: github.String(".gopherci.yml")}
 			js, _ := json.Marshal([]*github.CommitFile{&file})
 			fmt.Fprintln(w, string(js))
 		case "/repos/owner/repo/pulls/4/files?per_page=100":
@@ -314,7 +318,7 @@ func TestWebhookHandler(t *testing.T) {
 		g.baseURL = ts.URL
 
 		// add installation
-		_ = memDB.AddGHInstallation(installationID, accountID, senderID)
+		_ = memDB.AddGHInstallation(0, installationID, accountID, senderID)
 		memDB.EnableGHInstallation(installationID)
 
 		// make channel
@@ -329,7 +333,7 @@ func TestWebhookHandler(t *testing.T) {
 		r, _ := http.NewRequest("POST", "http://example.com", bytes.NewReader(js))
 		r.Header.Add("X-GitHub-Event", test.event)
 
-		sig := hmac.New(sha1.New, g.webhookSecret)
+		sig := hmac.New(sha1.New, g.apps[0].webhookSecret)
 		sig.Write(js)
 		r.Header.Add("X-Hub-Signature", fmt.Sprintf("sha1=%x", sig.Sum(nil)))
 
@@ -371,6 +375,9 @@ func TestCheckPRAction(t *testing.T) {
 		{github.String("opened"), nil},
 		{github.String("synchronize"), nil},
 		{github.String("reopened"), nil},
+		{github.String("ready_for_review"), nil},
+		{github.String("labeled"), nil},
+		{github.String("unlabeled"), &ignoreEvent{}},
 	}
 
 	for _, test := range tests {
@@ -391,6 +398,9 @@ func TestCheckPushAffectsGo(t *testing.T) {
 		{github.PushEventCommit{Added: []string{"main.go"}}, true},
 		{github.PushEventCommit{Removed: []string{"main.go"}}, true},
 		{github.PushEventCommit{Modified: []string{"main.go"}}, true},
+		{github.PushEventCommit{Modified: []string{".gopherci.yml"}}, true},
+		{github.PushEventCommit{Modified: []string{".gopherci.yaml"}}, true},
+		{github.PushEventCommit{Modified: []string{"sub/.gopherci.yml"}}, false},
 	}
 
 	for _, test := range tests {
@@ -430,14 +440,54 @@ func TestCheckPRAffectsGo(t *testing.T) {
 	// Get installation
 	g, _, memDB := setup(t)
 	g.baseURL = ts.URL
-	_ = memDB.AddGHInstallation(installationID, 2, 3)
+	_ = memDB.AddGHInstallation(0, installationID, 2, 3)
 	memDB.EnableGHInstallation(installationID)
 	installation, err := g.NewInstallation(installationID)
 	if err != nil {
 		t.Fatal("unexpected error:", err)
 	}
 
-	have, err := checkPRAffectsGo(context.Background(), installation, "owner", "repo", 2)
+	have, err := checkPRAffectsGo(context.Background(), installation, "owner", "repo", 2, 0)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if want := true; have != want {
+		t.Errorf("have: %v, want: %v", have, want)
+	}
+}
+
+func TestCheckPRAffectsGo_maxPages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/1/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/repos/owner/repo/pulls/2/files?per_page=100":
+			file := github.CommitFile{Filename: github.String("main.php")} // first page has no go files
+			js, _ := json.Marshal([]*github.CommitFile{&file})
+			w.Header().Add("Link", `</repos/owner/repo/pulls/2/files/?page=2&per_page=100>; rel="next"`)
+			fmt.Fprintln(w, string(js))
+		default:
+			// second page should not be requested
+			t.Fatalf(r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	const installationID = 1
+
+	// Get installation
+	g, _, memDB := setup(t)
+	g.baseURL = ts.URL
+	_ = memDB.AddGHInstallation(0, installationID, 2, 3)
+	memDB.EnableGHInstallation(installationID)
+	installation, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	have, err := checkPRAffectsGo(context.Background(), installation, "owner", "repo", 2, 1)
 	if err != nil {
 		t.Fatal("unexpected error:", err)
 	}
@@ -470,7 +520,7 @@ func TestCheckPRAccessible(t *testing.T) {
 	// Get installation
 	g, _, memDB := setup(t)
 	g.baseURL = ts.URL
-	_ = memDB.AddGHInstallation(installationID, 2, 3)
+	_ = memDB.AddGHInstallation(0, installationID, 2, 3)
 	memDB.EnableGHInstallation(installationID)
 	installation, err := g.NewInstallation(installationID)
 	if err != nil {
@@ -492,6 +542,31 @@ func TestCheckPRAccessible(t *testing.T) {
 	}
 }
 
+func TestRecordInstallationEvent(t *testing.T) {
+	g, _, memDB := setup(t)
+	memDB.AddGHInstallation(1, 2, 3, 4)
+
+	count := func() int64 {
+		if v, ok := installationEvents.Get("2").(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := count()
+
+	start := time.Now()
+	g.recordInstallationEvent(logger.Testing(), []byte(`{"action":"opened","installation":{"id":2}}`))
+	g.recordInstallationEvent(logger.Testing(), []byte(`{"zen":"no installation"}`))
+
+	have, _ := memDB.GetGHInstallation(2)
+	if have.LastEventAt.Before(start) {
+		t.Errorf("last event at have: %v, want after: %v", have.LastEventAt, start)
+	}
+	if have := count() - before; have != 1 {
+		t.Errorf("counter increased by %v, want 1", have)
+	}
+}
+
 func TestIntegrationInstallationEvent(t *testing.T) {
 	g, _, memDB := setup(t)
 
@@ -517,10 +592,12 @@ func TestIntegrationInstallationEvent(t *testing.T) {
 	}
 
 	// Send create event
-	g.integrationInstallationEvent(event)
+	g.integrationInstallationEvent(1, event)
 
 	want := &db.GHInstallation{
+		ID:             1,
 		InstallationID: installationID,
+		IntegrationID:  1,
 		AccountID:      accountID,
 		SenderID:       senderID,
 	}
@@ -533,7 +610,7 @@ func TestIntegrationInstallationEvent(t *testing.T) {
 
 	// Send delete event
 	event.Action = github.String("deleted")
-	g.integrationInstallationEvent(event)
+	g.integrationInstallationEvent(1, event)
 
 	have, _ = memDB.GetGHInstallation(installationID)
 	if have != nil {
@@ -542,7 +619,7 @@ func TestIntegrationInstallationEvent(t *testing.T) {
 
 	// force error
 	memDB.ForceError(errors.New("forced"))
-	g.integrationInstallationEvent(event)
+	g.integrationInstallationEvent(1, event)
 	memDB.ForceError(nil)
 }
 
@@ -563,6 +640,8 @@ func TestPushConfig(t *testing.T) {
 		commitTo:        "abcdef",
 		commitCount:     2,
 		headRef:         "abcdef",
+		branch:          "master",
+		author:          "sender",
 		goSrcPath:       "github.com/owner/repo",
 		owner:           "owner",
 		repo:            "repo",
@@ -590,6 +669,8 @@ func goodPush() *github.PushEvent {
 			CloneURL:    github.String("https://github.com/owner/repo.git"),
 			HTMLURL:     github.String("https://github.com/owner/repo"),
 		},
+		Ref:     github.String("refs/heads/master"),
+		Sender:  &github.User{Login: github.String("sender")},
 		After:   github.String("abcdef"),
 		Commits: []github.PushEventCommit{{}, {}},
 		Created: github.Bool(false),
@@ -604,6 +685,28 @@ func TestPushConfig_created(t *testing.T) {
 	if want := ""; have.commitFrom != want {
 		t.Errorf("have: %q, want: %q", have, want)
 	}
+
+	tests := map[string]struct {
+		created       bool
+		defaultBranch string
+		want          analyser.RefReader
+	}{
+		"created":                {true, "master", &analyser.BranchMergeBase{Branch: "master", FallbackRef: "abcdef~2"}},
+		"created default branch": {true, "feature", &analyser.FixedRef{BaseRef: "abcdef~2"}},
+		"unknown default branch": {true, "", &analyser.FixedRef{BaseRef: "abcdef~2"}},
+		"not created":            {false, "master", &analyser.FixedRef{BaseRef: "abcdef~2"}},
+	}
+	for desc, test := range tests {
+		e := goodPush()
+		e.Ref = github.String("refs/heads/feature")
+		e.Created = github.Bool(test.created)
+		e.Repo.DefaultBranch = github.String(test.defaultBranch)
+
+		have := PushConfig(e)
+		if !reflect.DeepEqual(have.refReader, test.want) {
+			t.Errorf("%v: ref reader have: %#v, want: %#v", desc, have.refReader, test.want)
+		}
+	}
 }
 
 func TestPullRequestConfig(t *testing.T) {
@@ -620,6 +723,8 @@ func TestPullRequestConfig(t *testing.T) {
 		statusesContext: "ci/gopherci/pr",
 		statusesURL:     "https://github.com/owner/repo/status/abcdef",
 		headRef:         "head-branch",
+		branch:          "head-branch",
+		author:          "author",
 		goSrcPath:       "github.com/owner/repo",
 		owner:           "owner",
 		repo:            "repo",
@@ -631,6 +736,7 @@ func TestPullRequestConfig(t *testing.T) {
 		Number: github.Int(2),
 		PullRequest: &github.PullRequest{
 			StatusesURL: github.String("https://github.com/owner/repo/status/abcdef"),
+			User:        &github.User{Login: github.String("author")},
 			Base: &github.PullRequestBranch{
 				Repo: &github.Repository{
 					HTMLURL:  github.String("https://github.com/owner/repo"),
@@ -657,10 +763,18 @@ func TestPullRequestConfig(t *testing.T) {
 			ID: github.Int(2),
 		},
 	}
-	have := PullRequestConfig(e)
+	have := PullRequestConfig(e, false)
 	if !reflect.DeepEqual(have, want) {
 		t.Errorf("have:\n%+v\nwant:\n%+v", have, want)
 	}
+
+	// Merge ref
+	want.cloner.(*analyser.PullRequestCloner).MergeRef = "refs/pull/2/merge"
+	want.cloner.(*analyser.PullRequestCloner).HeadSHA = "abcdef"
+	have = PullRequestConfig(e, true)
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("merge ref have:\n%+v\nwant:\n%+v", have, want)
+	}
 }
 
 func TestAnalyse(t *testing.T) {
@@ -716,7 +830,7 @@ func TestAnalyse(t *testing.T) {
 		senderID       = 4
 	)
 
-	_ = memDB.AddGHInstallation(installationID, accountID, senderID)
+	_ = memDB.AddGHInstallation(0, installationID, accountID, senderID)
 	memDB.EnableGHInstallation(installationID)
 
 	memDB.Tools = []db.Tool{
@@ -766,7 +880,7 @@ func TestAnalyse_disabled(t *testing.T) {
 	const installationID = 2
 
 	// Added but not enabled
-	_ = memDB.AddGHInstallation(installationID, 3, 4)
+	_ = memDB.AddGHInstallation(0, installationID, 3, 4)
 
 	cfg := AnalyseConfig{installationID: installationID}
 
@@ -792,3 +906,828 @@ func TestStripScheme(t *testing.T) {
 		}
 	}
 }
+
+func TestCommentReporter(t *testing.T) {
+	tests := []struct {
+		threshold   int
+		pr          int
+		commitCount int
+		want        analyser.Reporter
+	}{
+		{threshold: 1, pr: 2, want: &PRReviewReporter{}},
+		{threshold: 1, commitCount: 0, want: nil},
+		{threshold: 1, commitCount: 1, want: &InlineCommitCommentReporter{}},
+		{threshold: 1, commitCount: 2, want: &CommitCommentReporter{}},
+		{threshold: 5, commitCount: 5, want: &InlineCommitCommentReporter{}},
+		{threshold: 5, commitCount: 6, want: &CommitCommentReporter{}},
+		{threshold: 0, commitCount: 1, want: &CommitCommentReporter{}},
+	}
+
+	for _, test := range tests {
+		g, _, _ := setup(t)
+		g.InlineCommitThreshold = test.threshold
+
+		cfg := AnalyseConfig{pr: test.pr, commitCount: test.commitCount}
+		have := g.commentReporter(logger.Testing(), github.NewClient(nil), cfg, "https://example.com/analysis/1", nil)
+		if reflect.TypeOf(have) != reflect.TypeOf(test.want) {
+			t.Errorf("have: %T, want: %T, test: %+v", have, test.want, test)
+		}
+	}
+}
+
+func TestCommentReporters(t *testing.T) {
+	tests := []struct {
+		offDiff     bool
+		pr          int
+		commitCount int
+		want        []analyser.Reporter
+	}{
+		{pr: 2, want: []analyser.Reporter{&PRReviewReporter{}, &SuppressedSummaryReporter{}}},
+		{offDiff: true, pr: 2, want: []analyser.Reporter{&PRReviewReporter{}, &SuppressedSummaryReporter{}}},
+		{commitCount: 0, want: nil},
+		{commitCount: 1, want: []analyser.Reporter{&InlineCommitCommentReporter{}}},
+		{offDiff: true, commitCount: 1, want: []analyser.Reporter{&InlineCommitCommentReporter{}, &OffDiffCommentReporter{}}},
+		{offDiff: true, commitCount: 2, want: []analyser.Reporter{&CommitCommentReporter{}}},
+	}
+
+	for _, test := range tests {
+		g, _, _ := setup(t)
+		g.OffDiffCommitComment = test.offDiff
+
+		cfg := AnalyseConfig{pr: test.pr, commitCount: test.commitCount}
+		have := g.commentReporters(logger.Testing(), github.NewClient(nil), cfg, "https://example.com/analysis/1", nil)
+		if len(have) != len(test.want) {
+			t.Errorf("have: %T, want: %T, test: %+v", have, test.want, test)
+			continue
+		}
+		for i := range have {
+			if reflect.TypeOf(have[i]) != reflect.TypeOf(test.want[i]) {
+				t.Errorf("have: %T, want: %T, test: %+v", have, test.want, test)
+			}
+		}
+	}
+}
+
+func TestCopyIssues(t *testing.T) {
+	issues := []db.Issue{{Path: "a.go"}, {Path: "b.go"}}
+
+	have := copyIssues(issues)
+	have = append(have[:0], have[1:]...) // as if a reporter removed the first issue
+	have[0].Path = "c.go"
+
+	if want := []db.Issue{{Path: "a.go"}, {Path: "b.go"}}; !reflect.DeepEqual(issues, want) {
+		t.Errorf("issues modified\nhave: %+v\nwant: %+v", issues, want)
+	}
+}
+
+func TestOffDiffEnabled(t *testing.T) {
+	tests := []struct {
+		offDiff     bool
+		pr          int
+		commitCount int
+		want        bool
+	}{
+		{offDiff: false, commitCount: 1, want: false},
+		{offDiff: true, commitCount: 1, want: true},
+		{offDiff: true, commitCount: 2, want: false},
+		{offDiff: true, commitCount: 0, want: false},
+		{offDiff: true, pr: 2, commitCount: 1, want: false},
+	}
+
+	for _, test := range tests {
+		g, _, _ := setup(t)
+		g.OffDiffCommitComment = test.offDiff
+
+		cfg := AnalyseConfig{pr: test.pr, commitCount: test.commitCount}
+		if have := g.offDiffEnabled(cfg); have != test.want {
+			t.Errorf("have: %v, want: %v, test: %+v", have, test.want, test)
+		}
+	}
+}
+
+func TestAnalyseConfig_trigger(t *testing.T) {
+	tests := []struct {
+		cfg  AnalyseConfig
+		want db.AnalysisTrigger
+	}{
+		{AnalyseConfig{commitTo: "abcdef"}, db.AnalysisTriggerPush},
+		{AnalyseConfig{pr: 2}, db.AnalysisTriggerPullRequest},
+		{AnalyseConfig{commitTo: "abcdef", fullScan: true}, db.AnalysisTriggerFullScan},
+	}
+	for _, test := range tests {
+		if have := test.cfg.trigger(); have != test.want {
+			t.Errorf("have: %v, want: %v, cfg: %+v", have, test.want, test.cfg)
+		}
+	}
+}
+
+func TestCommentsEnabled(t *testing.T) {
+	window, err := scheduler.ParseWindow("22:00-06:00")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	g, _, _ := setup(t)
+	g.QuietHours = map[int]scheduler.Window{1: window}
+
+	var (
+		day   = time.Date(2017, 9, 15, 12, 0, 0, 0, time.UTC)
+		night = time.Date(2017, 9, 15, 23, 0, 0, 0, time.UTC)
+		// nightLocal is 23:00 UTC in a location 10 hours ahead.
+		nightLocal = night.In(time.FixedZone("AEST", 10*60*60))
+	)
+
+	tests := []struct {
+		desc           string
+		silent         bool
+		installationID int
+		now            time.Time
+		want           bool
+	}{
+		{"outside quiet hours", false, 1, day, true},
+		{"within quiet hours", false, 1, night, false},
+		{"within quiet hours in UTC", false, 1, nightLocal, false},
+		{"no quiet hours", false, 2, night, true},
+		{"silent", true, 1, day, false},
+	}
+	for _, test := range tests {
+		settings := db.RepoSettings{RepositoryID: 3, Silent: test.silent}
+		if have := g.commentsEnabled(logger.Testing(), settings, test.installationID, test.now); have != test.want {
+			t.Errorf("%v: have: %v, want: %v", test.desc, have, test.want)
+		}
+	}
+}
+
+func TestToolStatusReporters(t *testing.T) {
+	g, _, _ := setup(t)
+	cfg := AnalyseConfig{statusesURL: "https://example.com/status"}
+	tools := []db.Tool{{ID: 1, Name: "golint"}, {ID: 2, Name: "go vet"}}
+
+	if have := g.toolStatusReporters(logger.Testing(), github.NewClient(nil), cfg, tools, ""); have != nil {
+		t.Errorf("have: %v, want: nil when disabled", have)
+	}
+
+	g.PerToolStatuses = true
+	g.NoIssuesDesc = "No issues found"
+	var have []string
+	for _, reporter := range g.toolStatusReporters(logger.Testing(), github.NewClient(nil), cfg, tools, "") {
+		have = append(have, reporter.context)
+		if reporter.noIssues != g.NoIssuesDesc {
+			t.Errorf("%v no issues description have: %q, want: %q", reporter.context, reporter.noIssues, g.NoIssuesDesc)
+		}
+	}
+	want := []string{"ci/gopherci/golint", "ci/gopherci/go vet"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("contexts have: %v, want: %v", have, want)
+	}
+}
+
+func TestAnalyse_nullAnalyser(t *testing.T) {
+	g, _, memDB := setup(t)
+	g.analyser = analyser.Null{}
+
+	var states []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/2/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/status-url":
+			var status struct {
+				State string `json:"state"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			states = append(states, status.State)
+		case "/repos/owner/repo/pulls/3/comments":
+			fmt.Fprintln(w, "[]")
+		default:
+			t.Logf(r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	const installationID = 2
+	_ = memDB.AddGHInstallation(0, installationID, 3, 4)
+	memDB.EnableGHInstallation(installationID)
+	memDB.Tools = []db.Tool{
+		{Name: "Name", Path: "tool", Args: "-flag %BASE_BRANCH% ./..."},
+	}
+
+	cfg := AnalyseConfig{
+		cloner:          &analyser.PushCloner{},
+		refReader:       &analyser.FixedRef{BaseRef: "base-branch"},
+		installationID:  installationID,
+		statusesContext: "ci/gopherci/pr",
+		statusesURL:     ts.URL + "/status-url",
+		headRef:         "head-branch",
+		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		pr:              3,
+		sha:             "abc123",
+	}
+
+	if err := g.Analyse(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{string(StatusStatePending), string(StatusStateSuccess)}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("states have: %v, want: %v", states, want)
+	}
+}
+
+func TestAnalyse_minSeverity(t *testing.T) {
+	g, _, memDB := setup(t)
+	g.MinSeverity = "warning"
+
+	var (
+		descs    []string
+		reviewed bool
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/2/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/status-url":
+			var status struct {
+				Description string `json:"description"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			descs = append(descs, status.Description)
+		case "/repos/owner/repo/pulls/3/comments":
+			fmt.Fprintln(w, "[]")
+		case "/repos/owner/repo/pulls/3/reviews":
+			reviewed = true
+		default:
+			t.Logf(r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	const installationID = 2
+	_ = memDB.AddGHInstallation(0, installationID, 3, 4)
+	memDB.EnableGHInstallation(installationID)
+	memDB.Tools = []db.Tool{
+		{Name: "Name", Path: "tool", Args: "./...", Severity: "info"},
+	}
+
+	cfg := AnalyseConfig{
+		cloner:          &analyser.PushCloner{},
+		refReader:       &analyser.FixedRef{BaseRef: "base-branch"},
+		installationID:  installationID,
+		statusesContext: "ci/gopherci/pr",
+		statusesURL:     ts.URL + "/status-url",
+		headRef:         "head-branch",
+		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		pr:              3,
+		sha:             "abc123",
+	}
+
+	if err := g.Analyse(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reviewed {
+		t.Errorf("posted review of issue below minimum severity")
+	}
+	// The status still includes the issue.
+	if len(descs) != 2 || !strings.Contains(descs[1], "1 issue") {
+		t.Errorf("status descriptions have: %q, want 1 issue", descs)
+	}
+}
+
+func TestBudgetExceeded(t *testing.T) {
+	g, _, memDB := setup(t)
+
+	_ = memDB.AddGHInstallation(0, 10, 3, 4)
+	_ = memDB.AddGHInstallation(0, 20, 3, 4)
+	install, _ := memDB.GetGHInstallation(10)
+
+	now := time.Date(2017, 10, 16, 12, 0, 0, 0, time.UTC)
+	memDB.Analyses = []db.Analysis{
+		{InstallationID: 10, CreatedAt: now.Add(-24 * time.Hour), TotalDuration: db.Duration(time.Hour)}, // yesterday
+		{InstallationID: 10, CreatedAt: now.Add(-time.Hour), TotalDuration: db.Duration(5 * time.Minute)},
+		{InstallationID: 10, CreatedAt: now, TotalDuration: db.Duration(5 * time.Minute)},
+		{InstallationID: 20, CreatedAt: now, TotalDuration: db.Duration(time.Hour)}, // other installation
+	}
+
+	tests := []struct {
+		budget time.Duration
+		want   bool
+	}{
+		{0, false}, // unlimited
+		{5 * time.Minute, true},
+		{10 * time.Minute, true},
+		{11 * time.Minute, false},
+	}
+
+	for _, test := range tests {
+		g.DailyDurationBudget = test.budget
+		have, err := g.budgetExceeded(install.ID, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if have != test.want {
+			t.Errorf("budget %v have: %v, want: %v", test.budget, have, test.want)
+		}
+	}
+}
+
+func TestAnalyse_budgetExceeded(t *testing.T) {
+	g, mockAnalyser, memDB := setup(t)
+	g.DailyDurationBudget = time.Minute
+
+	var descs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/2/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/status-url":
+			var status struct {
+				State       string `json:"state"`
+				Description string `json:"description"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			descs = append(descs, status.State+": "+status.Description)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	const installationID = 2
+	_ = memDB.AddGHInstallation(0, installationID, 3, 4)
+	memDB.EnableGHInstallation(installationID)
+	memDB.Analyses = []db.Analysis{
+		{InstallationID: installationID, CreatedAt: time.Now(), TotalDuration: db.Duration(time.Minute)},
+	}
+
+	cfg := AnalyseConfig{
+		cloner:          &analyser.PushCloner{},
+		refReader:       &analyser.FixedRef{BaseRef: "base-branch"},
+		installationID:  installationID,
+		statusesContext: "ci/gopherci/push",
+		statusesURL:     ts.URL + "/status-url",
+		headRef:         "head-branch",
+		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		sha:             "abc123",
+	}
+
+	if err := g.Analyse(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if mockAnalyser.goSrcPath != "" {
+		t.Errorf("executer created for %v, want analysis skipped", mockAnalyser.goSrcPath)
+	}
+
+	want := []string{"pending: In progress", "error: Skipped: " + SkipReasonBudgetExceeded}
+	if !reflect.DeepEqual(descs, want) {
+		t.Errorf("statuses have: %v, want: %v", descs, want)
+	}
+}
+
+func TestAnalyse_skipError(t *testing.T) {
+	g, _, memDB := setup(t)
+	g.DailyDurationBudget = time.Minute
+
+	var descs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/2/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/status-url":
+			var status struct {
+				State       string `json:"state"`
+				Description string `json:"description"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			descs = append(descs, status.State+": "+status.Description)
+			if strings.HasPrefix(status.Description, "Skipped") {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	const installationID = 2
+	_ = memDB.AddGHInstallation(0, installationID, 3, 4)
+	memDB.EnableGHInstallation(installationID)
+	memDB.Analyses = []db.Analysis{
+		{InstallationID: installationID, CreatedAt: time.Now(), TotalDuration: db.Duration(time.Minute)},
+	}
+
+	cfg := AnalyseConfig{
+		cloner:          &analyser.PushCloner{},
+		refReader:       &analyser.FixedRef{BaseRef: "base-branch"},
+		installationID:  installationID,
+		statusesContext: "ci/gopherci/push",
+		statusesURL:     ts.URL + "/status-url",
+		headRef:         "head-branch",
+		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		sha:             "abc123",
+	}
+
+	if err := g.Analyse(cfg); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The pending status must not be left when skipping fails.
+	want := []string{"pending: In progress", "error: Skipped: " + SkipReasonBudgetExceeded, "error: Internal error"}
+	if !reflect.DeepEqual(descs, want) {
+		t.Errorf("statuses have: %v, want: %v", descs, want)
+	}
+}
+
+func TestAnalyse_toolStatusError(t *testing.T) {
+	g, mockAnalyser, memDB := setup(t)
+	g.PerToolStatuses = true
+
+	var descs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/2/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/status-url":
+			var status struct {
+				State       string `json:"state"`
+				Description string `json:"description"`
+				Context     string `json:"context"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			descs = append(descs, status.Context+": "+status.State+": "+status.Description)
+			if status.Context == "ci/gopherci/vet" && status.State == "pending" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	const installationID = 2
+	_ = memDB.AddGHInstallation(0, installationID, 3, 4)
+	memDB.EnableGHInstallation(installationID)
+	memDB.Tools = []db.Tool{
+		{ID: 1, Name: "lint", Path: "tool", Args: "./..."},
+		{ID: 2, Name: "vet", Path: "tool", Args: "./..."},
+	}
+
+	cfg := AnalyseConfig{
+		cloner:          &analyser.PushCloner{},
+		refReader:       &analyser.FixedRef{BaseRef: "base-branch"},
+		installationID:  installationID,
+		statusesContext: "ci/gopherci/push",
+		statusesURL:     ts.URL + "/status-url",
+		headRef:         "head-branch",
+		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		sha:             "abc123",
+	}
+
+	if err := g.Analyse(cfg); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if mockAnalyser.goSrcPath != "" {
+		t.Errorf("executer created for %v, want analysis stopped", mockAnalyser.goSrcPath)
+	}
+
+	// No status may be left pending when setting a tool's status fails.
+	want := []string{
+		"ci/gopherci/push: pending: In progress",
+		"ci/gopherci/lint: pending: In progress",
+		"ci/gopherci/vet: pending: In progress",
+		"ci/gopherci/push: error: Internal error",
+		"ci/gopherci/lint: error: Internal error",
+		"ci/gopherci/vet: error: Internal error",
+	}
+	if !reflect.DeepEqual(descs, want) {
+		t.Errorf("statuses\nhave: %v\nwant: %v", descs, want)
+	}
+}
+
+func TestAnalyse_noTools(t *testing.T) {
+	g, mockAnalyser, memDB := setup(t)
+
+	var descs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/2/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/status-url":
+			var status struct {
+				State       string `json:"state"`
+				Description string `json:"description"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			descs = append(descs, status.State+": "+status.Description)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+	g.baseURL = ts.URL
+
+	const installationID = 2
+	_ = memDB.AddGHInstallation(0, installationID, 3, 4)
+	memDB.EnableGHInstallation(installationID)
+	memDB.Tools = nil
+
+	cfg := AnalyseConfig{
+		cloner:          &analyser.PushCloner{},
+		refReader:       &analyser.FixedRef{BaseRef: "base-branch"},
+		installationID:  installationID,
+		statusesContext: "ci/gopherci/push",
+		statusesURL:     ts.URL + "/status-url",
+		headRef:         "head-branch",
+		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		sha:             "abc123",
+	}
+
+	if err := g.Analyse(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if mockAnalyser.goSrcPath != "" {
+		t.Errorf("executer created for %v, want analysis skipped", mockAnalyser.goSrcPath)
+	}
+
+	want := []string{"pending: In progress", "error: Skipped: " + SkipReasonNoTools}
+	if !reflect.DeepEqual(descs, want) {
+		t.Errorf("statuses have: %v, want: %v", descs, want)
+	}
+}
+
+func TestWebhookHandler_repositoryRules(t *testing.T) {
+	const (
+		installationID = 1
+		repositoryID   = 2
+	)
+
+	tests := []struct {
+		desc    string
+		allowed bool
+		wantMsg bool
+	}{
+		{"denied", false, false},
+		{"allowed", true, true},
+	}
+
+	for _, test := range tests {
+		g, _, memDB := setup(t)
+		_ = memDB.AddGHInstallation(0, installationID, 2, 3)
+		memDB.EnableGHInstallation(installationID)
+		_ = memDB.SetRepositoryRule(installationID, repositoryID, test.allowed)
+
+		c := make(chan interface{}, 1)
+		g.queuePush = c
+
+		push := goodPush()
+		push.Repo.Private = github.Bool(false)
+		push.Commits = []github.PushEventCommit{{Added: []string{"main.go"}}}
+		js, _ := json.Marshal(push)
+		r, _ := http.NewRequest("POST", "http://example.com", bytes.NewReader(js))
+		r.Header.Add("X-GitHub-Event", "push")
+		sig := hmac.New(sha1.New, g.apps[0].webhookSecret)
+		sig.Write(js)
+		r.Header.Add("X-Hub-Signature", fmt.Sprintf("sha1=%x", sig.Sum(nil)))
+
+		w := httptest.NewRecorder()
+		g.WebHookHandler(w, r)
+
+		if want := http.StatusOK; w.Code != want {
+			t.Errorf("%v: code have: %v, want: %v", test.desc, w.Code, want)
+		}
+		if haveMsg := len(c) > 0; haveMsg != test.wantMsg {
+			t.Errorf("%v: message queued have: %v, want: %v", test.desc, haveMsg, test.wantMsg)
+		}
+	}
+}
+
+func TestWebhookHandler_skipStatus(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		var descs []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.RequestURI {
+			case "/installations/1/access_tokens":
+				// respond with any token to installation transport
+				fmt.Fprintln(w, "{}")
+			case "/status-url":
+				var status struct {
+					State       string `json:"state"`
+					Description string `json:"description"`
+					Context     string `json:"context"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				descs = append(descs, status.State+": "+status.Context+": "+status.Description)
+			default:
+				t.Errorf("unexpected request: %v", r.RequestURI)
+			}
+		}))
+
+		g, _, memDB := setup(t)
+		g.baseURL = ts.URL
+		g.SkipStatuses = enabled
+		_ = memDB.AddGHInstallation(0, 1, 2, 3)
+		memDB.EnableGHInstallation(1)
+
+		c := make(chan interface{}, 1)
+		g.queuePush = c
+
+		e := goodPREvent()
+		e.Action = github.String("opened")
+		e.PullRequest.StatusesURL = github.String(ts.URL + "/status-url")
+		e.Repo.Private = github.Bool(true)
+		js, _ := json.Marshal(e)
+		r, _ := http.NewRequest("POST", "http://example.com", bytes.NewReader(js))
+		r.Header.Add("X-GitHub-Event", "pull_request")
+		sig := hmac.New(sha1.New, g.apps[0].webhookSecret)
+		sig.Write(js)
+		r.Header.Add("X-Hub-Signature", fmt.Sprintf("sha1=%x", sig.Sum(nil)))
+
+		w := httptest.NewRecorder()
+		g.WebHookHandler(w, r)
+		ts.Close()
+
+		if want := http.StatusOK; w.Code != want {
+			t.Errorf("enabled %v: code have: %v, want: %v", enabled, w.Code, want)
+		}
+		if len(c) > 0 {
+			t.Errorf("enabled %v: ignored pull request was queued", enabled)
+		}
+		var want []string
+		if enabled {
+			want = []string{"success: ci/gopherci/pr: Skipped: private repositories are not yet supported"}
+		}
+		if !reflect.DeepEqual(descs, want) {
+			t.Errorf("enabled %v: statuses have: %v, want: %v", enabled, descs, want)
+		}
+	}
+}
+
+func TestSkipStatus(t *testing.T) {
+	tests := map[ignoreReason]struct {
+		state StatusState
+		desc  string
+	}{
+		ignoreNoGoFiles:      {StatusStateSuccess, "Skipped: no Go files changed"},
+		ignorePrivateRepos:   {StatusStateSuccess, "Skipped: private repositories are not yet supported"},
+		ignoreMissingLabel:   {StatusStatePending, `Skipped: pull request does not have the "gopherci" label`},
+		ignoreDraft:          {StatusStatePending, "Skipped: pull request is a draft"},
+		ignoreNoInstallation: {"", ""},
+		ignoreInvalidAction:  {"", ""},
+	}
+	for reason, want := range tests {
+		state, desc := skipStatus(&ignoreEvent{reason: reason, extra: "gopherci"})
+		if state != want.state || desc != want.desc {
+			t.Errorf("%v: have: %q %q, want: %q %q", reason, state, desc, want.state, want.desc)
+		}
+	}
+}
+
+func TestIsDraftPR(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    bool
+	}{
+		{`{"pull_request": {"draft": true}}`, true},
+		{`{"pull_request": {"draft": false}}`, false},
+		{`{"pull_request": {}}`, false},
+		{`invalid`, false},
+	}
+	for _, test := range tests {
+		if have := isDraftPR([]byte(test.payload)); have != test.want {
+			t.Errorf("payload %s: have: %v, want: %v", test.payload, have, test.want)
+		}
+	}
+}
+
+func TestIgnoreEvent_repositoryNotAllowed(t *testing.T) {
+	g, _, memDB := setup(t)
+	_ = memDB.SetRepositoryRule(1, 2, false)
+
+	err := g.checkRepositoryAllowed(1, 2)
+	if ierr, ok := err.(*ignoreEvent); !ok || ierr.reason != ignoreRepositoryNotAllowed {
+		t.Errorf("have error: %#v, want ignoreRepositoryNotAllowed", err)
+	}
+	if err := g.checkRepositoryAllowed(1, 3); err != nil {
+		t.Errorf("unexpected error for repository without rule: %v", err)
+	}
+	if err := g.checkRepositoryAllowed(2, 2); err != nil {
+		t.Errorf("unexpected error for installation without rules: %v", err)
+	}
+}
+
+func TestCheckPRLabels(t *testing.T) {
+	labels := []*github.Label{{Name: github.String("bug")}, {Name: github.String("GopherCI")}}
+
+	tests := []struct {
+		label string
+		added *github.Label
+		want  *ignoreEvent
+	}{
+		{"", nil, nil},
+		{"gopherci", nil, nil},
+		{"analyse", nil, &ignoreEvent{reason: ignoreMissingLabel}},
+		{"gopherci", &github.Label{Name: github.String("GopherCI")}, nil},
+		{"gopherci", &github.Label{Name: github.String("bug")}, &ignoreEvent{reason: ignoreInvalidAction}},
+		{"", &github.Label{Name: github.String("bug")}, &ignoreEvent{reason: ignoreInvalidAction}},
+	}
+
+	for _, test := range tests {
+		g, _, memDB := setup(t)
+		_ = memDB.SetRepoSettings(db.RepoSettings{RepositoryID: 2, PRLabel: test.label})
+
+		err := g.checkPRLabels(2, labels, test.added)
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("label %q added %v: unexpected error: %v", test.label, test.added, err)
+			}
+			continue
+		}
+		if ierr, ok := err.(*ignoreEvent); !ok || ierr.reason != test.want.reason {
+			t.Errorf("label %q added %v: have error: %#v, want reason: %v", test.label, test.added, err, test.want.reason)
+		}
+	}
+}
+
+func TestLogIgnoreEvent(t *testing.T) {
+	tests := map[ignoreReason]string{
+		ignoreUnknownEvent:         "unknown_event",
+		ignoreInvalidAction:        "invalid_action",
+		ignoreNoAction:             "no_action",
+		ignoreNoInstallation:       "no_installation",
+		ignoreNoGoFiles:            "no_go_files",
+		ignorePrivateRepos:         "private_repos",
+		ignorePRInaccessible:       "pr_inaccessible",
+		ignoreRepositoryNotAllowed: "repository_not_allowed",
+		ignoreNoCommand:            "no_command",
+		ignoreUnknownTool:          "unknown_tool",
+		ignoreNoWriteAccess:        "no_write_access",
+		ignoreMissingLabel:         "missing_label",
+		ignoreNoAnalysis:           "no_analysis",
+		ignoreStaleCheckRun:        "stale_check_run",
+		ignoreDraft:                "draft",
+	}
+
+	count := func(name string) int64 {
+		if v, ok := ignoredEvents.Get(name).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+
+	for reason, want := range tests {
+		var buf bytes.Buffer
+		before := count(want)
+
+		logIgnoreEvent(logger.New(&buf, "", "production", "", nil), &ignoreEvent{reason: reason})
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("%v: could not decode log entry %q: %v", want, buf.String(), err)
+		}
+		if have := entry["reason"]; have != want {
+			t.Errorf("reason field have: %v, want: %v", have, want)
+		}
+		if have := count(want) - before; have != 1 {
+			t.Errorf("%v: counter increased by %v, want 1", want, have)
+		}
+	}
+}
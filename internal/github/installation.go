@@ -1,11 +1,14 @@
 package github
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
@@ -17,23 +20,48 @@ import (
 type Installation struct {
 	ID     int
 	client *github.Client
+	// token returns an access token for the installation, for use outside
+	// of client, such as pushing with git.
+	token func() (string, error)
+	// created is when the installation's transport was created, and is used
+	// to replace the transport before its tokens are near expiry.
+	created time.Time
 }
 
-func (g *GitHub) NewInstallation(installationID int) (*Installation, error) {
+// installationMaxAge is the age after which a cached installation's transport
+// is replaced. Installation tokens expire after an hour, but the transport only
+// refreshes a token within a minute of its expiry, so a token used by a long
+// analysis, such as when pushing with git, could expire part way through.
+// Replacing the transport before then ensures tokens remain valid for at least
+// the analysis's timeout, and tokens are otherwise reused between webhooks.
+const installationMaxAge = 45 * time.Minute
 
-	// TODO reuse installations, so we maintain rate limit state between webhooks
+// NewInstallation returns an Installation for installationID, or nil if the
+// installation does not exist or is not enabled. Installations are cached
+// and reused, so the client's connections, access tokens and rate limit state
+// are shared between webhooks for the same installation. Cached installations
+// are replaced after installationMaxAge.
+func (g *GitHub) NewInstallation(installationID int) (*Installation, error) {
 	installation, err := g.db.GetGHInstallation(installationID)
 	if err != nil {
 		return nil, err
 	}
-	if installation == nil {
+	if installation == nil || !installation.IsEnabled() {
+		g.invalidateInstallation(installationID)
 		return nil, nil
 	}
-	if !installation.IsEnabled() {
-		return nil, nil
+
+	if cached, ok := g.installations.Load(installationID); ok {
+		cached := cached.(*Installation)
+		if cached.ID == installation.ID && time.Since(cached.created) < installationMaxAge {
+			return cached, nil
+		}
+		// Replace the outdated or stale installation, existing users continue
+		// to use the previous client.
+		g.invalidateInstallation(installationID)
 	}
 
-	itr, err := g.newInstallationTransport(installation.InstallationID)
+	itr, err := g.newInstallationTransport(installation.IntegrationID, installation.InstallationID)
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("could not initialise transport for installation id %v", installation.InstallationID))
 	}
@@ -44,7 +72,21 @@ func (g *GitHub) NewInstallation(installationID int) (*Installation, error) {
 		return nil, err
 	}
 
-	return &Installation{ID: installation.ID, client: client}, nil
+	// Another webhook may have created an installation concurrently, if so,
+	// prefer the stored one so only a single client is used.
+	cached, _ := g.installations.LoadOrStore(installationID, &Installation{
+		ID:      installation.ID,
+		client:  client,
+		token:   itr.Token,
+		created: time.Now(),
+	})
+	return cached.(*Installation), nil
+}
+
+// invalidateInstallation removes a cached installation, the next call to
+// NewInstallation will create a new client.
+func (g *GitHub) invalidateInstallation(installationID int) {
+	g.installations.Delete(installationID)
 }
 
 // IsEnabled returns true if an installation is enabled.
@@ -70,22 +112,14 @@ func (i *Installation) Diff(ctx context.Context, repositoryID int, commitFrom, c
 	if err != nil {
 		return nil, err
 	}
+	// Request the diff via the authenticated client, so private repositories
+	// can be accessed and requests count towards the installation's rate limit.
+	req.Header.Set("Accept", "application/vnd.github.v3.diff")
 
-	var js struct {
-		DiffURL string `json:"diff_url"`
-	}
-	_, err = i.client.Do(ctx, req, &js)
-	if err != nil {
-		return nil, err
-	}
-
-	if js.DiffURL == "" {
-		return nil, fmt.Errorf("no diff url in api: %v", apiURL)
-	}
-
-	resp, err := http.Get(js.DiffURL)
+	var diff bytes.Buffer
+	_, err = i.client.Do(ctx, req, &diff)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "could not get diff from %v", apiURL)
 	}
-	return resp.Body, nil
+	return ioutil.NopCloser(&diff), nil
 }
@@ -2,13 +2,13 @@ package github
 
 import (
 	"context"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/github"
 )
@@ -25,30 +25,24 @@ func TestInstallation_isEnabled(t *testing.T) {
 }
 
 func TestInstallation_diff(t *testing.T) {
-	var (
-		wantDiff = []byte("diff")
-		api      []byte
-	)
+	wantDiff := []byte("diff")
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if have, want := r.Header.Get("Accept"), "application/vnd.github.v3.diff"; have != want {
+			t.Errorf("accept header have: %q, want: %q", have, want)
+		}
 		switch r.RequestURI {
 		case "/repositories/11/pulls/10":
 			// API response for pull requests
-			w.Write(api)
-		case "/repositories/11/compare/zzzct":
-			// API response for first pushes
-			w.Write(api)
+			w.Write(wantDiff)
 		case "/repositories/11/compare/zzzct~3...zzzct":
 			// API response for pushes
-			w.Write(api)
-		case "/diff.diff":
 			w.Write(wantDiff)
 		default:
-			t.Logf(r.RequestURI)
+			t.Errorf("unexpected request: %v", r.RequestURI)
 		}
 	}))
 	defer ts.Close()
 
-	api = []byte(fmt.Sprintf(`{"diff_url": "%v/diff.diff"}`, ts.URL))
 	i := Installation{client: github.NewClient(nil)}
 	i.client.BaseURL, _ = url.Parse(ts.URL)
 
@@ -77,3 +71,111 @@ func TestInstallation_diff(t *testing.T) {
 		}
 	}
 }
+
+func TestNewInstallation_cached(t *testing.T) {
+	const installationID = 1
+
+	g, _, memDB := setup(t)
+	_ = memDB.AddGHInstallation(0, installationID, 2, 3)
+	memDB.EnableGHInstallation(installationID)
+
+	first, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	second, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if first.client != second.client {
+		t.Errorf("expected cached client to be reused, have: %p, want: %p", second.client, first.client)
+	}
+
+	// Deleting the installation must invalidate the cache.
+	g.integrationInstallationEvent(1, &github.InstallationEvent{
+		Action:       github.String("deleted"),
+		Installation: &github.Installation{ID: github.Int(installationID)},
+	})
+
+	if _, ok := g.installations.Load(installationID); ok {
+		t.Errorf("expected installation %v to be removed from cache", installationID)
+	}
+
+	third, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if third.IsEnabled() {
+		t.Errorf("expected deleted installation to be disabled")
+	}
+}
+
+func TestNewInstallation_refresh(t *testing.T) {
+	const installationID = 1
+
+	g, _, memDB := setup(t)
+	_ = memDB.AddGHInstallation(0, installationID, 2, 3)
+	memDB.EnableGHInstallation(installationID)
+
+	first, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Nearing the maximum age, the transport and its token are reused.
+	first.created = time.Now().Add(-installationMaxAge + time.Minute)
+	second, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if first != second {
+		t.Errorf("expected cached installation to be reused, have: %p, want: %p", second, first)
+	}
+
+	// Past the maximum age, the transport is replaced before its token expires.
+	first.created = time.Now().Add(-installationMaxAge)
+	third, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if first.client == third.client {
+		t.Errorf("expected a new client after %v", installationMaxAge)
+	}
+
+	fourth, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if third != fourth {
+		t.Errorf("expected replaced installation to be cached, have: %p, want: %p", fourth, third)
+	}
+}
+
+func TestNewInstallation_suspend(t *testing.T) {
+	const installationID = 1
+
+	g, _, memDB := setup(t)
+	_ = memDB.AddGHInstallation(0, installationID, 2, 3)
+	memDB.EnableGHInstallation(installationID)
+
+	first, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	g.integrationInstallationEvent(1, &github.InstallationEvent{
+		Action:       github.String("suspend"),
+		Installation: &github.Installation{ID: github.Int(installationID)},
+	})
+
+	second, err := g.NewInstallation(installationID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if first.client == second.client {
+		t.Errorf("expected a new client after suspend event")
+	}
+}
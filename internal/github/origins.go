@@ -0,0 +1,148 @@
+package github
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// HookOrigins returns the IP ranges GitHub publishes as the source of its
+// webhooks, fetched from GitHub's meta API.
+func (g *GitHub) HookOrigins(ctx context.Context) ([]*net.IPNet, error) {
+	client := github.NewClient(&http.Client{Transport: g.Transport})
+	var err error
+	if client.BaseURL, err = url.Parse(strings.TrimSuffix(g.baseURL, "/") + "/"); err != nil {
+		return nil, err
+	}
+	meta, _, err := client.APIMeta(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get GitHub meta")
+	}
+	var origins []*net.IPNet
+	for _, cidr := range meta.Hooks {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse hook range %q", cidr)
+		}
+		origins = append(origins, ipnet)
+	}
+	if len(origins) == 0 {
+		return nil, errors.New("GitHub meta contains no hook ranges")
+	}
+	return origins, nil
+}
+
+// hookOriginsInterval is how often WatchHookOrigins refreshes GitHub's
+// webhook ranges.
+const hookOriginsInterval = time.Hour
+
+// WatchHookOrigins fetches the IP ranges GitHub publishes as the source of its
+// webhooks with HookOrigins, and accepts webhooks from them in addition to
+// WebhookOrigins. The ranges are refreshed hourly until ctx is cancelled,
+// keeping the previous ranges if a refresh fails. Returns an error if the
+// ranges can't be fetched initially.
+func (g *GitHub) WatchHookOrigins(ctx context.Context) error {
+	origins, err := g.HookOrigins(ctx)
+	if err != nil {
+		return err
+	}
+	g.setHookOrigins(origins)
+
+	go func() {
+		ticker := time.NewTicker(hookOriginsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				origins, err := g.HookOrigins(ctx)
+				if err != nil {
+					g.logger.With("error", err).Error("could not refresh GitHub's webhook origins")
+					continue
+				}
+				g.setHookOrigins(origins)
+			}
+		}
+	}()
+	return nil
+}
+
+// setHookOrigins sets GitHub's webhook ranges.
+func (g *GitHub) setHookOrigins(origins []*net.IPNet) {
+	g.hookOriginsMu.Lock()
+	g.hookOrigins = origins
+	g.hookOriginsMu.Unlock()
+}
+
+// peerAddrKey is the context key of the address recorded by PeerAddr.
+type peerAddrKey struct{}
+
+// PeerAddr is middleware recording the address of the connection's peer, so
+// it's available after middleware.RealIP replaces the request's RemoteAddr
+// with the address in the X-Forwarded-For or X-Real-IP headers, which any
+// client can set. It must be used before middleware.RealIP.
+func PeerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), peerAddrKey{}, r.RemoteAddr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// originIP returns the source of r. If there are no WebhookProxies, it's the
+// connection's peer recorded by PeerAddr, else r's RemoteAddr if PeerAddr
+// wasn't used. Otherwise it's the address added to the X-Forwarded-For header
+// by the outermost trusted proxy, as addresses before it may be set by the
+// client. Returns nil if the source is unknown.
+func (g *GitHub) originIP(r *http.Request) net.IP {
+	if g.WebhookProxies > 0 {
+		var forwarded []string
+		for _, header := range r.Header["X-Forwarded-For"] {
+			for _, addr := range strings.Split(header, ",") {
+				forwarded = append(forwarded, strings.TrimSpace(addr))
+			}
+		}
+		if len(forwarded) < g.WebhookProxies {
+			return nil // not received via all the proxies
+		}
+		return net.ParseIP(forwarded[len(forwarded)-g.WebhookProxies])
+	}
+
+	addr, ok := r.Context().Value(peerAddrKey{}).(string)
+	if !ok {
+		addr = r.RemoteAddr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
+
+// allowedOrigin returns true if the source of r, see originIP, is within the
+// WebhookOrigins or GitHub's webhook ranges, or if there are neither.
+func (g *GitHub) allowedOrigin(r *http.Request) bool {
+	g.hookOriginsMu.RLock()
+	hookOrigins := g.hookOrigins
+	g.hookOriginsMu.RUnlock()
+
+	if len(g.WebhookOrigins) == 0 && len(hookOrigins) == 0 {
+		return true
+	}
+	ip := g.originIP(r)
+	if ip == nil {
+		return false
+	}
+	for _, origin := range append(append([]*net.IPNet(nil), g.WebhookOrigins...), hookOrigins...) {
+		if origin.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+func TestHookOrigins(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/meta" {
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+		fmt.Fprintln(w, `{"hooks": ["192.30.252.0/22", "2a0a:a440::/29"], "git": ["140.82.112.0/20"]}`)
+	}))
+	defer ts.Close()
+
+	g, _, _ := setup(t)
+	g.baseURL = ts.URL
+
+	have, err := g.HookOrigins(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []*net.IPNet{mustParseCIDR(t, "192.30.252.0/22"), mustParseCIDR(t, "2a0a:a440::/29")}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("have: %v, want: %v", have, want)
+	}
+}
+
+func TestWebhookHandler_origins(t *testing.T) {
+	origins := []*net.IPNet{mustParseCIDR(t, "192.30.252.0/22"), mustParseCIDR(t, "2a0a:a440::/29")}
+
+	tests := map[string]struct {
+		origins    []*net.IPNet
+		remoteAddr string
+		wantCode   int
+	}{
+		"no origins":     {nil, "203.0.113.1:1234", http.StatusOK},
+		"allowed":        {origins, "192.30.252.1:1234", http.StatusOK},
+		"allowed ipv6":   {origins, "[2a0a:a440::1]:1234", http.StatusOK},
+		"allowed realip": {origins, "192.30.255.254", http.StatusOK}, // middleware.RealIP has no port
+		"blocked":        {origins, "203.0.113.1:1234", http.StatusForbidden},
+		"blocked realip": {origins, "203.0.113.1", http.StatusForbidden},
+		"invalid":        {origins, "unknown", http.StatusForbidden},
+	}
+
+	for desc, test := range tests {
+		g, _, _ := setup(t)
+		g.WebhookOrigins = test.origins
+
+		r := httptest.NewRequest("POST", "https://example.com", bytes.NewBufferString(`{"key":"value"}`))
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Add("X-GitHub-Event", "issues")
+		r.Header.Add("X-Hub-Signature", "sha1=d1e100e3f17e8399b73137382896ff1536c59457")
+		w := httptest.NewRecorder()
+		g.WebHookHandler(w, r)
+
+		if w.Code != test.wantCode {
+			t.Errorf("%v: have code: %v, want: %v", desc, w.Code, test.wantCode)
+		}
+	}
+}
+
+func TestWebhookHandler_originsPeerAddr(t *testing.T) {
+	origins := []*net.IPNet{mustParseCIDR(t, "192.30.252.0/22")}
+
+	tests := map[string]struct {
+		proxies    int
+		remoteAddr string
+		forwarded  []string
+		wantCode   int
+	}{
+		"allowed peer":            {0, "192.30.252.1:1234", nil, http.StatusOK},
+		"spoofed forwarded":       {0, "203.0.113.1:1234", []string{"192.30.252.1"}, http.StatusForbidden},
+		"allowed proxied":         {1, "10.0.0.1:1234", []string{"192.30.252.1"}, http.StatusOK},
+		"spoofed proxied":         {1, "10.0.0.1:1234", []string{"192.30.252.1, 203.0.113.1"}, http.StatusForbidden},
+		"allowed proxied headers": {2, "10.0.0.1:1234", []string{"203.0.113.2", "192.30.252.1, 10.0.0.2"}, http.StatusOK},
+		"not proxied":             {1, "192.30.252.1:1234", nil, http.StatusForbidden},
+	}
+
+	for desc, test := range tests {
+		g, _, _ := setup(t)
+		g.WebhookOrigins = origins
+		g.WebhookProxies = test.proxies
+
+		r := httptest.NewRequest("POST", "https://example.com", bytes.NewBufferString(`{"key":"value"}`))
+		r.RemoteAddr = test.remoteAddr
+		for _, forwarded := range test.forwarded {
+			r.Header.Add("X-Forwarded-For", forwarded)
+		}
+		r.Header.Add("X-GitHub-Event", "issues")
+		r.Header.Add("X-Hub-Signature", "sha1=d1e100e3f17e8399b73137382896ff1536c59457")
+		w := httptest.NewRecorder()
+		PeerAddr(middleware.RealIP(http.HandlerFunc(g.WebHookHandler))).ServeHTTP(w, r)
+
+		if w.Code != test.wantCode {
+			t.Errorf("%v: have code: %v, want: %v", desc, w.Code, test.wantCode)
+		}
+	}
+}
+
+func TestWatchHookOrigins(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"hooks": ["192.30.252.0/22"]}`)
+	}))
+	defer ts.Close()
+
+	g, _, _ := setup(t)
+	g.baseURL = ts.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := g.WatchHookOrigins(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := httptest.NewRequest("POST", "https://example.com", nil)
+	r.RemoteAddr = "203.0.113.1:1234"
+	if g.allowedOrigin(r) {
+		t.Errorf("allowed origin outside GitHub's ranges")
+	}
+	r.RemoteAddr = "192.30.252.1:1234"
+	if !g.allowedOrigin(r) {
+		t.Errorf("blocked origin within GitHub's ranges")
+	}
+}
+
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ipnet
+}
@@ -0,0 +1,69 @@
+package github
+
+import (
+	"context"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// listPRFiles returns the files changed by a pull request, requesting every
+// page of files. If maxPages is > 0, only maxPages pages are requested, and
+// more is true if further pages remain.
+func listPRFiles(ctx context.Context, client *github.Client, owner, repo string, number, maxPages int) (files []*github.CommitFile, more bool, err error) {
+	opt := &github.ListOptions{PerPage: 100}
+	for pages := 1; ; pages++ {
+		page, resp, err := client.PullRequests.ListFiles(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "could not list files")
+		}
+		files = append(files, page...)
+		if resp.NextPage == 0 {
+			return files, false, nil
+		}
+		if maxPages > 0 && pages >= maxPages {
+			return files, true, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// listPRComments returns the review comments on a pull request, requesting
+// every page of comments.
+func listPRComments(ctx context.Context, client *github.Client, owner, repo string, number int) ([]*github.PullRequestComment, error) {
+	var (
+		comments []*github.PullRequestComment
+		opt      = &github.PullRequestListCommentsOptions{}
+	)
+	for {
+		page, resp, err := client.PullRequests.ListComments(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not list existing comments")
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			return comments, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// listIssueComments returns the comments on an issue or pull request,
+// requesting every page of comments.
+func listIssueComments(ctx context.Context, client *github.Client, owner, repo string, number int) ([]*github.IssueComment, error) {
+	var (
+		comments []*github.IssueComment
+		opt      = &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	)
+	for {
+		page, resp, err := client.Issues.ListComments(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not list existing comments")
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			return comments, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
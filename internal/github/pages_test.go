@@ -0,0 +1,88 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestListPRFiles(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/repos/owner/repo/pulls/2/files?per_page=100":
+			w.Header().Add("Link", `</repos/owner/repo/pulls/2/files?page=2&per_page=100>; rel="next"`)
+			fmt.Fprintln(w, `[{"filename": "a.go"}]`)
+		case "/repos/owner/repo/pulls/2/files?page=2&per_page=100":
+			w.Header().Add("Link", `</repos/owner/repo/pulls/2/files?page=3&per_page=100>; rel="next"`)
+			fmt.Fprintln(w, `[{"filename": "b.go"}]`)
+		case "/repos/owner/repo/pulls/2/files?page=3&per_page=100":
+			fmt.Fprintln(w, `[{"filename": "c.go"}]`)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(ts.URL)
+
+	tests := []struct {
+		maxPages int
+		want     []string
+		wantMore bool
+	}{
+		{0, []string{"a.go", "b.go", "c.go"}, false},
+		{3, []string{"a.go", "b.go", "c.go"}, false},
+		{2, []string{"a.go", "b.go"}, true},
+	}
+	for _, test := range tests {
+		files, more, err := listPRFiles(context.Background(), client, "owner", "repo", 2, test.maxPages)
+		if err != nil {
+			t.Errorf("maxPages %v: unexpected error: %v", test.maxPages, err)
+			continue
+		}
+		var have []string
+		for _, file := range files {
+			have = append(have, file.GetFilename())
+		}
+		if !reflect.DeepEqual(have, test.want) || more != test.wantMore {
+			t.Errorf("maxPages %v have: %v, %v want: %v, %v", test.maxPages, have, more, test.want, test.wantMore)
+		}
+	}
+}
+
+func TestListPRComments(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/repos/owner/repo/pulls/2/comments":
+			w.Header().Add("Link", `</repos/owner/repo/pulls/2/comments?page=2>; rel="next"`)
+			fmt.Fprintln(w, `[{"body": "first"}]`)
+		case "/repos/owner/repo/pulls/2/comments?page=2":
+			fmt.Fprintln(w, `[{"body": "second"}]`)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(ts.URL)
+
+	comments, err := listPRComments(context.Background(), client, "owner", "repo", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var have []string
+	for _, comment := range comments {
+		have = append(have, comment.GetBody())
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have: %v, want: %v", have, want)
+	}
+}
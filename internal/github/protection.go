@@ -0,0 +1,106 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// prStatusesContext is the status context of pull request analyses.
+const prStatusesContext = "ci/gopherci/pr"
+
+// protectionAccept is the media type required by the branch protection API.
+const protectionAccept = "application/vnd.github.loki-preview+json"
+
+// RequireStatusCheck adds statusContext as a required status check of the
+// protected branch of owner/repo. Branch protection is not enabled by GopherCI,
+// so if the branch is not protected, or does not require status checks, false
+// is returned without an error.
+func (i *Installation) RequireStatusCheck(ctx context.Context, owner, repo, branch, statusContext string) (bool, error) {
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/branches/%s/protection/required_status_checks/contexts",
+		i.client.BaseURL.String(), owner, repo, url.PathEscape(branch),
+	)
+	body, err := json.Marshal([]string{statusContext})
+	if err != nil {
+		return false, errors.Wrap(err, "could not marshal contexts")
+	}
+	req, err := http.NewRequest("POST", apiURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", protectionAccept)
+
+	resp, err := i.client.Do(ctx, req, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "could not add required status check to %v", apiURL)
+	}
+	return true, nil
+}
+
+// repositories returns all repositories accessible to the installation.
+func (i *Installation) repositories(ctx context.Context) ([]*github.Repository, error) {
+	var repos []*github.Repository
+	for page := 1; page != 0; {
+		apiURL := fmt.Sprintf("%s/installation/repositories?per_page=100&page=%d", i.client.BaseURL.String(), page)
+		req, err := http.NewRequest("GET", apiURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+
+		var list struct {
+			Repositories []*github.Repository `json:"repositories"`
+		}
+		resp, err := i.client.Do(ctx, req, &list)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list repositories from %v", apiURL)
+		}
+		repos = append(repos, list.Repositories...)
+		page = resp.NextPage
+	}
+	return repos, nil
+}
+
+// RequireStatusChecks adds the pull request status context as a required
+// status check of the default branch of each of an installation's
+// repositories, if the default branch is protected. Returns the full names of
+// repositories which were updated, skipped as their default branch does not
+// require status checks, and the errors of those which failed. A repository
+// failing does not prevent the remaining repositories being updated.
+func (g *GitHub) RequireStatusChecks(ctx context.Context, installationID int) (updated, skipped []string, failed map[string]error, err error) {
+	installation, err := g.NewInstallation(installationID)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "could not get installation")
+	}
+	if !installation.IsEnabled() {
+		return nil, nil, nil, errors.Errorf("installation %v is not enabled", installationID)
+	}
+
+	repos, err := installation.repositories(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	failed = make(map[string]error)
+	for _, repo := range repos {
+		ok, err := installation.RequireStatusCheck(ctx, repo.GetOwner().GetLogin(), repo.GetName(), repo.GetDefaultBranch(), prStatusesContext)
+		switch {
+		case err != nil:
+			failed[repo.GetFullName()] = err
+		case ok:
+			updated = append(updated, repo.GetFullName())
+		default:
+			skipped = append(skipped, repo.GetFullName())
+		}
+	}
+	return updated, skipped, failed, nil
+}
@@ -0,0 +1,119 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestInstallation_requireStatusCheck(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if have, want := r.Method, "POST"; have != want {
+			t.Errorf("method have: %v, want: %v", have, want)
+		}
+		if have, want := r.Header.Get("Accept"), protectionAccept; have != want {
+			t.Errorf("accept header have: %q, want: %q", have, want)
+		}
+		var contexts []string
+		if err := json.NewDecoder(r.Body).Decode(&contexts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"ci/gopherci/pr"}; !reflect.DeepEqual(contexts, want) {
+			t.Errorf("contexts have: %v, want: %v", contexts, want)
+		}
+
+		switch r.URL.EscapedPath() {
+		case "/repos/owner/protected/branches/release%2F1.0/protection/required_status_checks/contexts":
+			fmt.Fprintln(w, `["ci/gopherci/pr"]`)
+		case "/repos/owner/unprotected/branches/master/protection/required_status_checks/contexts":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, `{"message": "Branch not protected"}`)
+		case "/repos/owner/forbidden/branches/master/protection/required_status_checks/contexts":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintln(w, `{"message": "Resource not accessible by integration"}`)
+		default:
+			t.Errorf("unexpected request: %v", r.URL.EscapedPath())
+		}
+	}))
+	defer ts.Close()
+
+	i := Installation{client: github.NewClient(nil)}
+	i.client.BaseURL, _ = url.Parse(ts.URL)
+
+	tests := []struct {
+		repo, branch string
+		want         bool
+		wantErr      bool
+	}{
+		{"protected", "release/1.0", true, false},
+		{"unprotected", "master", false, false},
+		{"forbidden", "master", false, true},
+	}
+	for _, test := range tests {
+		have, err := i.RequireStatusCheck(context.Background(), "owner", test.repo, test.branch, prStatusesContext)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%v: have error: %v, want error: %v", test.repo, err, test.wantErr)
+		}
+		if have != test.want {
+			t.Errorf("%v: have: %v, want: %v", test.repo, have, test.want)
+		}
+	}
+}
+
+func TestRequireStatusChecks(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/1/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/installation/repositories?per_page=100&page=1":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/installation/repositories?per_page=100&page=2>; rel="next"`, ts.URL))
+			fmt.Fprintln(w, `{"repositories": [{"name": "protected", "full_name": "owner/protected", "default_branch": "master", "owner": {"login": "owner"}}]}`)
+		case "/installation/repositories?per_page=100&page=2":
+			fmt.Fprintln(w, `{"repositories": [{"name": "failing", "full_name": "owner/failing", "default_branch": "master", "owner": {"login": "owner"}}, {"name": "unprotected", "full_name": "owner/unprotected", "default_branch": "develop", "owner": {"login": "owner"}}]}`)
+		case "/repos/owner/protected/branches/master/protection/required_status_checks/contexts":
+			fmt.Fprintln(w, `["ci/gopherci/pr"]`)
+		case "/repos/owner/failing/branches/master/protection/required_status_checks/contexts":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintln(w, `{"message": "Resource not accessible by integration"}`)
+		case "/repos/owner/unprotected/branches/develop/protection/required_status_checks/contexts":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, `{"message": "Branch not protected"}`)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	g, _, memDB := setup(t)
+	g.baseURL = ts.URL
+	_ = memDB.AddGHInstallation(0, 1, 2, 3)
+	memDB.EnableGHInstallation(1)
+
+	updated, skipped, failed, err := g.RequireStatusChecks(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"owner/protected"}; !reflect.DeepEqual(updated, want) {
+		t.Errorf("updated have: %v, want: %v", updated, want)
+	}
+	if want := []string{"owner/unprotected"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped have: %v, want: %v", skipped, want)
+	}
+	if len(failed) != 1 || failed["owner/failing"] == nil {
+		t.Errorf("failed have: %v, want: owner/failing", failed)
+	}
+
+	// Disabled installation
+	if _, _, _, err := g.RequireStatusChecks(context.Background(), 2); err == nil {
+		t.Error("expected error for unknown installation")
+	}
+}
@@ -6,6 +6,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bradleyfalzon/gopherci/internal/analyser"
 	"github.com/bradleyfalzon/gopherci/internal/db"
@@ -15,21 +20,26 @@ import (
 )
 
 // PRCommentReporter is a analyser.Reporter that creates a pull request comment
-// for each issue on a given owner, repo, pr and commit hash. Returns on the
-// first error encountered.
+// for each issue on a given owner, repo, pr and commit hash, and resolves
+// previous comments whose issues have been fixed. Returns on the first error
+// encountered.
 type PRCommentReporter struct {
+	logger logger.Logger
 	client *github.Client
 	owner  string
 	repo   string
 	number int
 	commit string
+	// suppressed are the issues suppressed by the last Report.
+	suppressed []db.Issue
 }
 
-var _ analyser.Reporter = &PRCommentReporter{}
+var _ analyser.SuppressingReporter = &PRCommentReporter{}
 
 // NewPRCommentReporter returns a PRCommentReporter.
-func NewPRCommentReporter(client *github.Client, owner, repo string, number int, commit string) *PRCommentReporter {
+func NewPRCommentReporter(logger logger.Logger, client *github.Client, owner, repo string, number int, commit string) *PRCommentReporter {
 	return &PRCommentReporter{
+		logger: logger,
 		client: client,
 		owner:  owner,
 		repo:   repo,
@@ -39,40 +49,57 @@ func NewPRCommentReporter(client *github.Client, owner, repo string, number int,
 }
 
 // dedupePRIssues deduplicates issues by checking the existing pull request for
-// existing comments and returns comments that don't already exist.
+// existing comments and returns comments that don't already exist. Comment
+// bodies are compared ignoring differences in whitespace, as GitHub may
+// normalise a comment's body.
 func dedupePRIssues(ctx context.Context, client *github.Client, owner, repo string, number int, issues []db.Issue) (filtered []db.Issue, err error) {
-	ecomments, _, err := client.PullRequests.ListComments(ctx, owner, repo, number, nil)
+	ecomments, err := listPRComments(ctx, client, owner, repo, number)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not list existing comments")
+		return nil, err
 	}
 
-	// remove duplicate comments, as we're remove elements based on the index
-	// start from last position and work backwards to keep indexes consistent
-	// even after removing elements.
-	for i := len(issues) - 1; i >= 0; i-- {
-		issue := issues[i]
+	// Build a new slice, so the caller's issues, which other reporters may
+	// use, aren't modified.
+	for _, issue := range issues {
+		exists := false
 		for _, ec := range ecomments {
 			if ec.Path == nil || ec.Position == nil || ec.Body == nil {
 				continue
 			}
-			if issue.Path == *ec.Path && issue.HunkPos == *ec.Position && issue.Issue == *ec.Body {
-				issues = append(issues[:i], issues[i+1:]...)
+			if issue.Path == *ec.Path && issue.HunkPos == *ec.Position && collapseSpace(issue.Issue) == collapseSpace(*ec.Body) {
+				exists = true
 				break
 			}
 		}
+		if !exists {
+			filtered = append(filtered, issue)
+		}
 	}
 
-	return issues, nil
+	return filtered, nil
+}
+
+// collapseSpace trims leading and trailing whitespace, and replaces all other
+// runs of whitespace with a single space.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
 }
 
 // Report implements the analyser.Reporter interface.
 func (r *PRCommentReporter) Report(ctx context.Context, issues []db.Issue) error {
+	r.suppressed = nil
 	filtered, err := dedupePRIssues(ctx, r.client, r.owner, r.repo, r.number, issues)
 	if err != nil {
 		return err
 	}
 
+	// Resolving threads is best effort, failing shouldn't prevent commenting.
+	if err := resolveFixedThreads(ctx, r.client, r.owner, r.repo, r.number, issues); err != nil {
+		r.logger.With("error", err).Error("could not resolve fixed review threads")
+	}
+
 	_, issues = analyser.Suppress(filtered, analyser.MaxIssueComments)
+	r.suppressed = filtered[len(issues):]
 
 	for _, issue := range issues {
 		comment := &github.PullRequestComment{
@@ -92,6 +119,11 @@ func (r *PRCommentReporter) Report(ctx context.Context, issues []db.Issue) error
 	return nil
 }
 
+// Suppressed implements the analyser.SuppressingReporter interface.
+func (r *PRCommentReporter) Suppressed() []db.Issue {
+	return r.suppressed
+}
+
 // StatusState is the state of a GitHub Status API as defined in
 // https://developer.github.com/v3/repos/statuses/
 type StatusState string
@@ -112,10 +144,21 @@ type StatusAPIReporter struct {
 	statusURL string
 	context   string
 	targetURL string
+	duration  time.Duration    // duration is appended to the success description, if non-zero
+	mustFix   []*regexp.Regexp // mustFix match issues which fail the status
+	noIssues  string           // noIssues is the success description if no issues were found, if not blank
 }
 
 var _ analyser.Reporter = &StatusAPIReporter{}
 
+// maxStatusDescLen is the maximum length, in characters, of a status
+// description accepted by GitHub.
+const maxStatusDescLen = 140
+
+// DefaultNoIssuesDesc is the default success status description if no issues
+// were found.
+const DefaultNoIssuesDesc = `Found no issues \ʕ◔ϖ◔ʔ/`
+
 // NewStatusAPIReporter returns a StatusAPIReporter.
 func NewStatusAPIReporter(logger logger.Logger, client *github.Client, statusURL, context, targetURL string) *StatusAPIReporter {
 	return &StatusAPIReporter{
@@ -127,15 +170,39 @@ func NewStatusAPIReporter(logger logger.Logger, client *github.Client, statusURL
 	}
 }
 
+// SetDuration sets the analysis's duration, d, to be appended to the success
+// status description, such as "Found 2 issues in 1m3s". A d of 0 does not
+// append the duration.
+func (r *StatusAPIReporter) SetDuration(d time.Duration) {
+	r.duration = d
+}
+
+// SetMustFix sets the patterns matching issues which must be fixed, if any
+// issue matches, the status is failure instead of success.
+func (r *StatusAPIReporter) SetMustFix(patterns []*regexp.Regexp) {
+	r.mustFix = patterns
+}
+
+// SetNoIssuesDesc sets the success status description used if no issues were
+// found, if desc is blank DefaultNoIssuesDesc is used.
+func (r *StatusAPIReporter) SetNoIssuesDesc(desc string) {
+	r.noIssues = desc
+}
+
 // SetStatus sets the CI Status API
 func (r *StatusAPIReporter) SetStatus(ctx context.Context, status StatusState, description string) error {
+	return r.setStatus(ctx, status, description, r.targetURL)
+}
+
+// setStatus sets the CI Status API linking to targetURL.
+func (r *StatusAPIReporter) setStatus(ctx context.Context, status StatusState, description, targetURL string) error {
 	s := struct {
 		State       string `json:"state,omitempty"`
 		TargetURL   string `json:"target_url,omitempty"`
 		Description string `json:"description,omitempty"`
 		Context     string `json:"context,omitempty"`
 	}{
-		string(status), r.targetURL, description, r.context,
+		string(status), targetURL, description, r.context,
 	}
 
 	r.logger.Infof("Setting %v state: %q, context: %q, description: %q", r.statusURL, status, r.context, description)
@@ -165,25 +232,135 @@ func (r *StatusAPIReporter) SetStatus(ctx context.Context, status StatusState, d
 func (r *StatusAPIReporter) Report(ctx context.Context, issues []db.Issue) error {
 	// TODO remove suppressed count, we don't know how many were suppressed.
 	suppressed, _ := analyser.Suppress(issues, analyser.MaxIssueComments)
-	return r.SetStatus(ctx, StatusStateSuccess, r.statusDesc(issues, suppressed))
+	if mustFix := r.mustFixIssues(issues); len(mustFix) > 0 {
+		return r.setStatus(ctx, StatusStateFailure, r.mustFixDesc(issues, mustFix), r.issueURL(mustFix))
+	}
+	return r.setStatus(ctx, StatusStateSuccess, r.statusDesc(issues, suppressed), r.issueURL(issues))
+}
+
+// mustFixIssues returns the issues matching any of the must fix patterns.
+func (r *StatusAPIReporter) mustFixIssues(issues []db.Issue) []db.Issue {
+	var mustFix []db.Issue
+	for _, issue := range issues {
+		for _, pattern := range r.mustFix {
+			if pattern.MatchString(issue.Issue) {
+				mustFix = append(mustFix, issue)
+				break
+			}
+		}
+	}
+	return mustFix
+}
+
+// mustFixDesc builds a failure status description based on issues, of which
+// mustFix must be fixed, and the duration if set and the description would
+// not exceed GitHub's limit.
+func (r *StatusAPIReporter) mustFixDesc(issues, mustFix []db.Issue) string {
+	desc := fmt.Sprintf("Found %d issues, %d must be fixed", len(issues), len(mustFix))
+	if len(issues) == 1 {
+		desc = "Found 1 issue which must be fixed"
+	}
+	return appendDuration(desc, r.duration)
+}
+
+// issueURL returns the target URL linking to the first issue, or the target
+// URL if there are no issues.
+func (r *StatusAPIReporter) issueURL(issues []db.Issue) string {
+	issue := db.FirstIssue(issues)
+	if issue == nil || r.targetURL == "" {
+		return r.targetURL
+	}
+	return r.targetURL + "#" + issue.Anchor()
 }
 
-// statusDesc builds a status description based on issues.
-func (StatusAPIReporter) statusDesc(issues []db.Issue, suppressed int) string {
+// statusDesc builds a status description based on issues, and the duration
+// if set and the description would not exceed GitHub's limit.
+func (r StatusAPIReporter) statusDesc(issues []db.Issue, suppressed int) string {
 	desc := fmt.Sprintf("Found %d issues", len(issues))
 	switch {
+	case len(issues) == 0 && r.noIssues != "":
+		desc = r.noIssues
 	case len(issues) == 0:
-		return `Found no issues \ʕ◔ϖ◔ʔ/`
+		desc = DefaultNoIssuesDesc
 	case len(issues) == 1:
-		return `Found 1 issue`
+		desc = `Found 1 issue`
 	case suppressed == 1:
 		desc += fmt.Sprintf(" (%v comment suppressed)", suppressed)
 	case suppressed > 1:
 		desc += fmt.Sprintf(" (%v comments suppressed)", suppressed)
 	}
-	return desc
+	return appendDuration(desc, r.duration)
+}
+
+// appendDuration returns desc with d, truncated to seconds, appended. desc is
+// returned unchanged if d is 0 or the result would exceed GitHub's limit.
+func appendDuration(desc string, d time.Duration) string {
+	if d <= 0 {
+		return desc
+	}
+	withDuration := fmt.Sprintf("%s in %v", desc, d-d%time.Second)
+	if utf8.RuneCountInString(withDuration) > maxStatusDescLen {
+		return desc
+	}
+	return withDuration
+}
+
+// ToolStatusAPIReporter uses the GitHub Statuses API to report the status of
+// a single tool, using the context ci/gopherci/<tool>. The status is failure
+// if the tool found any issues.
+type ToolStatusAPIReporter struct {
+	*StatusAPIReporter
+	toolID db.ToolID
+}
+
+var _ analyser.Reporter = &ToolStatusAPIReporter{}
+
+// NewToolStatusAPIReporter returns a ToolStatusAPIReporter for tool.
+func NewToolStatusAPIReporter(logger logger.Logger, client *github.Client, statusURL string, tool db.Tool, targetURL string) *ToolStatusAPIReporter {
+	return &ToolStatusAPIReporter{
+		StatusAPIReporter: NewStatusAPIReporter(logger, client, statusURL, "ci/gopherci/"+tool.Name, targetURL),
+		toolID:            tool.ID,
+	}
 }
 
+// Report implements the analyser.Reporter interface, issues must only be
+// the issues found by the reporter's tool.
+func (r *ToolStatusAPIReporter) Report(ctx context.Context, issues []db.Issue) error {
+	status := StatusStateSuccess
+	if len(issues) > 0 {
+		status = StatusStateFailure
+	}
+	return r.setStatus(ctx, status, r.statusDesc(issues, 0), r.issueURL(issues))
+}
+
+// ReportAnalysis reports the issues found by the reporter's tool in analysis,
+// or success if the tool was not run.
+func (r *ToolStatusAPIReporter) ReportAnalysis(ctx context.Context, analysis *db.Analysis) error {
+	tool, ok := analysis.Tools[r.toolID]
+	if !ok {
+		return r.SetStatus(ctx, StatusStateSuccess, "Not run")
+	}
+	return r.Report(ctx, tool.Issues)
+}
+
+// Keys a commit comment's summary of many issues may be grouped by, see
+// GitHub.CommitCommentGroupBy.
+const (
+	// CommentGroupByFile counts the issues in each file.
+	CommentGroupByFile = "file"
+	// CommentGroupByTool counts the issues found by each tool.
+	CommentGroupByTool = "tool"
+)
+
+const (
+	// minGroupedIssues is the minimum number of issues for a commit comment's
+	// summary to be grouped, fewer issues only use the short summary.
+	minGroupedIssues = 5
+	// maxCommentGroups is the maximum number of groups listed in a commit
+	// comment, the remaining groups are counted together.
+	maxCommentGroups = 20
+)
+
 // CommitCommentReporter creates a single commit comment summarising all issues
 // on a given owner, repo, and commit hash.
 type CommitCommentReporter struct {
@@ -193,6 +370,12 @@ type CommitCommentReporter struct {
 	commit      string
 	commits     int
 	analysisURL string
+	// groupBy is the key a summary of many issues is grouped by, either
+	// CommentGroupByFile or CommentGroupByTool. Blank does not group issues.
+	groupBy string
+	// issueTools are the names of the tools which found each issue, used to
+	// group issues by tool.
+	issueTools map[db.Issue]string
 }
 
 var _ analyser.Reporter = &CommitCommentReporter{}
@@ -217,14 +400,20 @@ func (r *CommitCommentReporter) Report(ctx context.Context, issues []db.Issue) e
 		return nil
 	}
 
-	// msg assumes there's always 2 or more commits, else you'd use InlineCommitCommentReporter
 	plural := ""
 	if len(issues) > 1 {
 		plural = "s"
 	}
-	msg := fmt.Sprintf("GopherCI found **%d** issue%s in the last **%d** commits, see: %s",
-		len(issues), plural, r.commits, r.analysisURL,
+	commits := fmt.Sprintf("the last **%d** commits", r.commits)
+	if r.commits == 1 {
+		commits = "this commit"
+	}
+	msg := fmt.Sprintf("GopherCI found **%d** issue%s in %s, see: %s",
+		len(issues), plural, commits, r.analysisURL,
 	)
+	if len(issues) >= minGroupedIssues {
+		msg += groupedIssues(issues, r.groupBy, r.issueTools)
+	}
 
 	comment := &github.RepositoryComment{
 		Body: github.String(msg),
@@ -233,10 +422,89 @@ func (r *CommitCommentReporter) Report(ctx context.Context, issues []db.Issue) e
 	return errors.Wrapf(err, "could not post comment commit: %q, body: %q", r.commit, *comment.Body)
 }
 
+// issueGroup is the number of issues sharing a key, such as a file.
+type issueGroup struct {
+	key    string
+	issues int
+}
+
+// groupedIssues returns a markdown table counting issues grouped by groupBy,
+// either CommentGroupByFile or CommentGroupByTool, with the largest groups
+// first. Returns a blank string if groupBy is blank. Issues without a tool in
+// issueTools are grouped as unknown.
+func groupedIssues(issues []db.Issue, groupBy string, issueTools map[db.Issue]string) string {
+	var (
+		heading string
+		keyOf   func(db.Issue) string
+	)
+	switch groupBy {
+	case CommentGroupByFile:
+		heading, keyOf = "File", func(issue db.Issue) string { return issue.Path }
+	case CommentGroupByTool:
+		heading, keyOf = "Tool", func(issue db.Issue) string {
+			if tool, ok := issueTools[issue]; ok {
+				return tool
+			}
+			return "unknown"
+		}
+	default:
+		return ""
+	}
+
+	var (
+		groups []issueGroup
+		index  = make(map[string]int) // key -> index in groups
+	)
+	for _, issue := range issues {
+		key := keyOf(issue)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, issueGroup{key: key})
+		}
+		groups[i].issues++
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].issues != groups[j].issues {
+			return groups[i].issues > groups[j].issues
+		}
+		return groups[i].key < groups[j].key
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\n\n| %s | Issues |\n| --- | ---: |\n", heading)
+	for i, group := range groups {
+		if i == maxCommentGroups {
+			var others int
+			for _, group := range groups[i:] {
+				others += group.issues
+			}
+			fmt.Fprintf(&buf, "| %d others | %d |\n", len(groups)-i, others)
+			break
+		}
+		fmt.Fprintf(&buf, "| `%s` | %d |\n", group.key, group.issues)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// issueToolNames returns the name of the tool which found each of analysis's
+// issues, for tools in tools.
+func issueToolNames(analysis *db.Analysis, tools []db.Tool) map[db.Issue]string {
+	names := make(map[db.Issue]string)
+	for _, tool := range tools {
+		for _, issue := range analysis.Tools[tool.ID].Issues {
+			names[issue] = tool.Name
+		}
+	}
+	return names
+}
+
 // InlineCommitCommentReporter is a analyser.Reporter that creates a commit
 // comment for each issue on a single commit. This should only be used if all
 // issues occur on a single commit (not when an analysis checks multiple commits
-// such as during a push for 2 or more commits).
+// such as during a push for 2 or more commits). Issues outside the diff are
+// ignored, see OffDiffCommentReporter.
 type InlineCommitCommentReporter struct {
 	client *github.Client
 	owner  string
@@ -258,7 +526,7 @@ func NewInlineCommitCommentReporter(client *github.Client, owner, repo, commit s
 
 // Report implements the analyser.Reporter interface.
 func (r *InlineCommitCommentReporter) Report(ctx context.Context, issues []db.Issue) error {
-	_, issues = analyser.Suppress(issues, analyser.MaxIssueComments)
+	_, issues = analyser.Suppress(onDiffIssues(issues), analyser.MaxIssueComments)
 
 	for _, issue := range issues {
 		comment := &github.RepositoryComment{
@@ -277,22 +545,111 @@ func (r *InlineCommitCommentReporter) Report(ctx context.Context, issues []db.Is
 	return nil
 }
 
+// onDiffIssues returns the issues within the diff, which can be commented
+// inline.
+func onDiffIssues(issues []db.Issue) []db.Issue {
+	var onDiff []db.Issue
+	for _, issue := range issues {
+		if issue.HunkPos != 0 {
+			onDiff = append(onDiff, issue)
+		}
+	}
+	return onDiff
+}
+
+// OffDiffCommentReporter is a analyser.Reporter that creates a single commit
+// comment listing the issues outside the diff, which an
+// InlineCommitCommentReporter can't comment inline, so they aren't silently
+// lost. The issues outside the diff, with a HunkPos of 0, are only found if
+// analyser.Config.OffDiff is set.
+type OffDiffCommentReporter struct {
+	client      *github.Client
+	owner       string
+	repo        string
+	commit      string
+	analysisURL string
+}
+
+var _ analyser.Reporter = &OffDiffCommentReporter{}
+
+// NewOffDiffCommentReporter returns a OffDiffCommentReporter. analysisURL is
+// the URL of the analysis.
+func NewOffDiffCommentReporter(client *github.Client, owner, repo, commit, analysisURL string) *OffDiffCommentReporter {
+	return &OffDiffCommentReporter{
+		client:      client,
+		owner:       owner,
+		repo:        repo,
+		commit:      commit,
+		analysisURL: analysisURL,
+	}
+}
+
+// Report implements the analyser.Reporter interface, only issues outside the
+// diff are reported.
+func (r *OffDiffCommentReporter) Report(ctx context.Context, issues []db.Issue) error {
+	var offDiff []db.Issue
+	for _, issue := range issues {
+		if issue.HunkPos == 0 {
+			offDiff = append(offDiff, issue)
+		}
+	}
+	if len(offDiff) == 0 {
+		return nil
+	}
+	comment := &github.RepositoryComment{
+		Body: github.String(offDiffSummary(offDiff, r.analysisURL)),
+	}
+	_, _, err := r.client.Repositories.CreateComment(ctx, r.owner, r.repo, r.commit, comment)
+	return errors.Wrapf(err, "could not post off diff comment commit: %q", r.commit)
+}
+
+// offDiffSummary returns a comment body listing the issues outside the diff,
+// at most maxCommentGroups, linking to analysisURL if not blank.
+func offDiffSummary(offDiff []db.Issue, analysisURL string) string {
+	var buf bytes.Buffer
+	plural := ""
+	if len(offDiff) > 1 {
+		plural = "s"
+	}
+	fmt.Fprintf(&buf, "GopherCI found **%d** issue%s in this commit outside the changed lines", len(offDiff), plural)
+	if analysisURL != "" {
+		fmt.Fprintf(&buf, ", see: %s", analysisURL)
+	}
+	buf.WriteString("\n\n")
+	for i, issue := range offDiff {
+		if i == maxCommentGroups {
+			fmt.Fprintf(&buf, "- %d others\n", len(offDiff)-i)
+			break
+		}
+		fmt.Fprintf(&buf, "- `%s:%d`: %s\n", issue.Path, issue.Line, collapseSpace(issue.Issue))
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
 // PRReviewReporter is a analyser.Reporter that creates a pull request review
 // on a given owner, repo, pr and commit hash. Sets review status to COMMENT
-// if there are comments.
+// if there are comments. Previous review threads whose issues have been fixed
+// are resolved.
 type PRReviewReporter struct {
+	logger logger.Logger
 	client *github.Client
 	owner  string
 	repo   string
 	number int
 	commit string
+	// keepThreads does not resolve fixed threads, as the reported issues are
+	// only some of the pull request's issues.
+	keepThreads bool
+	// suppressed are the issues suppressed by the last Report.
+	suppressed []db.Issue
 }
 
-var _ analyser.Reporter = &PRReviewReporter{}
+var _ analyser.SuppressingReporter = &PRReviewReporter{}
 
 // NewPRReviewReporter returns a PRReviewReporter.
-func NewPRReviewReporter(client *github.Client, owner, repo string, number int, commit string) *PRReviewReporter {
+func NewPRReviewReporter(logger logger.Logger, client *github.Client, owner, repo string, number int, commit string) *PRReviewReporter {
 	return &PRReviewReporter{
+		logger: logger,
 		client: client,
 		owner:  owner,
 		repo:   repo,
@@ -303,12 +660,23 @@ func NewPRReviewReporter(client *github.Client, owner, repo string, number int,
 
 // Report implements the analyser.Reporter interface.
 func (r *PRReviewReporter) Report(ctx context.Context, issues []db.Issue) error {
+	r.suppressed = nil
+	if !r.keepThreads {
+		// Resolving threads is best effort, failing shouldn't prevent the
+		// review.
+		if err := resolveFixedThreads(ctx, r.client, r.owner, r.repo, r.number, issues); err != nil {
+			r.logger.With("error", err).Error("could not resolve fixed review threads")
+		}
+	}
+
 	issues, err := dedupePRIssues(ctx, r.client, r.owner, r.repo, r.number, issues)
 	if err != nil {
 		return err
 	}
 
-	_, issues = analyser.Suppress(issues, analyser.MaxIssueComments)
+	filtered := issues
+	_, issues = analyser.Suppress(filtered, analyser.MaxIssueComments)
+	r.suppressed = filtered[len(issues):]
 
 	if len(issues) == 0 {
 		return nil
@@ -330,3 +698,126 @@ func (r *PRReviewReporter) Report(ctx context.Context, issues []db.Issue) error
 	})
 	return errors.Wrap(err, "could not post review")
 }
+
+// Suppressed implements the analyser.SuppressingReporter interface.
+func (r *PRReviewReporter) Suppressed() []db.Issue {
+	return r.suppressed
+}
+
+// SuppressedSummaryReporter is a analyser.Reporter that maintains a single
+// pull request comment listing the issues suppressed by another reporter, so
+// they aren't silently lost. The comment is created by the first analysis
+// suppressing issues, and edited by later analyses. The other reporter must
+// report first.
+type SuppressedSummaryReporter struct {
+	client      *github.Client
+	owner       string
+	repo        string
+	number      int
+	reporter    analyser.SuppressingReporter
+	analysisURL string
+}
+
+var _ analyser.Reporter = &SuppressedSummaryReporter{}
+
+// NewSuppressedSummaryReporter returns a SuppressedSummaryReporter summarising
+// the issues suppressed by reporter. analysisURL is the URL of the analysis.
+func NewSuppressedSummaryReporter(client *github.Client, owner, repo string, number int, reporter analyser.SuppressingReporter, analysisURL string) *SuppressedSummaryReporter {
+	return &SuppressedSummaryReporter{
+		client:      client,
+		owner:       owner,
+		repo:        repo,
+		number:      number,
+		reporter:    reporter,
+		analysisURL: analysisURL,
+	}
+}
+
+// Report implements the analyser.Reporter interface, issues are ignored in
+// favour of the issues suppressed by the reporter. If a previous analysis
+// posted a summary, it's edited, even if no issues were suppressed, so it
+// doesn't list issues from an earlier commit. A previous summary is only
+// found among the App's own comments.
+func (r *SuppressedSummaryReporter) Report(ctx context.Context, _ []db.Issue) error {
+	suppressed := r.reporter.Suppressed()
+
+	comments, err := listIssueComments(ctx, r.client, r.owner, r.repo, r.number)
+	if err != nil {
+		return err
+	}
+	// Only the App's own summary is edited, not a user's comment quoting it.
+	var (
+		previous *github.IssueComment
+		login    string
+	)
+	for _, comment := range comments {
+		if !strings.HasPrefix(comment.GetBody(), suppressedSummaryMarker) {
+			continue
+		}
+		if login == "" {
+			if login, err = viewerLogin(ctx, r.client); err != nil {
+				return err
+			}
+		}
+		if isAppUser(comment.GetUser(), login) {
+			previous = comment
+		}
+	}
+
+	if previous == nil && len(suppressed) == 0 {
+		return nil
+	}
+	comment := &github.IssueComment{
+		Body: github.String(suppressedSummary(suppressed, r.analysisURL)),
+	}
+	if previous == nil {
+		_, _, err = r.client.Issues.CreateComment(ctx, r.owner, r.repo, r.number, comment)
+		return errors.Wrap(err, "could not post suppressed issues comment")
+	}
+	if previous.GetBody() == comment.GetBody() {
+		return nil
+	}
+	_, _, err = r.client.Issues.EditComment(ctx, r.owner, r.repo, previous.GetID(), comment)
+	return errors.Wrap(err, "could not edit suppressed issues comment")
+}
+
+// suppressedSummaryMarker prefixes the suppressed issues comment, so a later
+// analysis can find and edit it.
+const suppressedSummaryMarker = "<!-- gopherci:suppressed-summary -->\n"
+
+// suppressedSummary returns a comment body listing the suppressed issues in a
+// collapsible section, at most maxCommentGroups, linking to analysisURL if not
+// blank.
+func suppressedSummary(suppressed []db.Issue, analysisURL string) string {
+	var buf bytes.Buffer
+	buf.WriteString(suppressedSummaryMarker)
+	if len(suppressed) == 0 {
+		buf.WriteString("GopherCI suppressed no issues in the latest analysis")
+		if analysisURL != "" {
+			fmt.Fprintf(&buf, ", see: %s", analysisURL)
+		}
+		return buf.String()
+	}
+	plural := ""
+	if len(suppressed) > 1 {
+		plural = "s"
+	}
+	fmt.Fprintf(&buf, "GopherCI suppressed **%d** issue%s to limit the number of comments", len(suppressed), plural)
+	if analysisURL != "" {
+		fmt.Fprintf(&buf, ", see: %s", analysisURL)
+	}
+	fmt.Fprintf(&buf, "\n\n<details>\n<summary>Suppressed issue%s</summary>\n\n", plural)
+	for i, issue := range suppressed {
+		if i == maxCommentGroups {
+			fmt.Fprintf(&buf, "- …and %d more", len(suppressed)-i)
+			if analysisURL != "" {
+				fmt.Fprintf(&buf, ", see: %s", analysisURL)
+			}
+			buf.WriteString("\n")
+			break
+		}
+		fmt.Fprintf(&buf, "- `%s:%d`: %s\n", issue.Path, issue.Line, collapseSpace(issue.Issue))
+	}
+	buf.WriteString("\n</details>")
+	return buf.String()
+}
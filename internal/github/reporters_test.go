@@ -1,6 +1,7 @@
 package github
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,9 +9,12 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
 	"github.com/bradleyfalzon/gopherci/internal/db"
 	"github.com/bradleyfalzon/gopherci/internal/logger"
 	"github.com/google/go-cmp/cmp"
@@ -52,6 +56,12 @@ func TestDedupePRIssues(t *testing.T) {
 					Path:     github.String(expectedCmtPath),
 					Position: github.Int(expectedCmtPos + 2),
 				},
+				{
+					// Body normalised with trailing whitespace
+					Body:     github.String("multi  word " + expectedCmtBody + " \n"),
+					Path:     github.String(expectedCmtPath),
+					Position: github.Int(expectedCmtPos + 3),
+				},
 			}
 			json, _ := json.Marshal(comments)
 			fmt.Fprint(w, string(json))
@@ -63,11 +73,14 @@ func TestDedupePRIssues(t *testing.T) {
 	client.BaseURL, _ = url.Parse(ts.URL)
 
 	var issues = []db.Issue{
-		{Path: expectedCmtPath, HunkPos: expectedCmtPos, Issue: expectedCmtBody},     // remove
-		{Path: expectedCmtPath, HunkPos: expectedCmtPos + 1, Issue: expectedCmtBody}, // keep
-		{Path: expectedCmtPath, HunkPos: expectedCmtPos + 2, Issue: expectedCmtBody}, // remove
+		{Path: expectedCmtPath, HunkPos: expectedCmtPos, Issue: expectedCmtBody},                     // remove
+		{Path: expectedCmtPath, HunkPos: expectedCmtPos + 1, Issue: expectedCmtBody},                 // keep
+		{Path: expectedCmtPath, HunkPos: expectedCmtPos + 2, Issue: expectedCmtBody},                 // remove
+		{Path: expectedCmtPath, HunkPos: expectedCmtPos + 3, Issue: "multi word " + expectedCmtBody}, // remove
 	}
 
+	original := append([]db.Issue(nil), issues...)
+
 	filtered, err := dedupePRIssues(context.Background(), client, expectedOwner, expectedRepo, expectedPR, issues)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -76,6 +89,50 @@ func TestDedupePRIssues(t *testing.T) {
 	if want := 1; len(filtered) != want {
 		t.Errorf("filtered comment count %v does not match %v", len(filtered), want)
 	}
+	if !reflect.DeepEqual(issues, original) {
+		t.Errorf("issues modified\nhave: %+v\nwant: %+v", issues, original)
+	}
+}
+
+func TestDedupePRIssues_issueTemplate(t *testing.T) {
+	// A multi-line rendered body is still deduped after GitHub normalises
+	// its line endings.
+	tmpl, err := analyser.ParseIssueTemplate("**{{.Severity}}** {{.Tool}}: {{.Message}}\n\nSee {{.ToolURL}}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	data := analyser.IssueTemplateData{Tool: "vet", ToolURL: "https://golang.org/cmd/vet", Message: "unreachable code", Severity: "error"}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := buf.String()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		comments := []*github.PullRequestComment{{
+			Body:     github.String(strings.Replace(body, "\n", "\r\n", -1)),
+			Path:     github.String("main.go"),
+			Position: github.Int(1),
+		}}
+		json, _ := json.Marshal(comments)
+		fmt.Fprint(w, string(json))
+	}))
+	defer ts.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(ts.URL)
+
+	issues := []db.Issue{
+		{Path: "main.go", HunkPos: 1, Issue: body}, // remove
+		{Path: "main.go", HunkPos: 2, Issue: body}, // keep
+	}
+	filtered, err := dedupePRIssues(context.Background(), client, "owner", "repo", 2, issues)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []db.Issue{{Path: "main.go", HunkPos: 2, Issue: body}}; !reflect.DeepEqual(filtered, want) {
+		t.Errorf("filtered have: %v, want: %v", filtered, want)
+	}
 }
 
 func TestPRCommentReporter_report(t *testing.T) {
@@ -120,7 +177,7 @@ func TestPRCommentReporter_report(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	r := NewPRCommentReporter(github.NewClient(nil), expectedOwner, expectedRepo, expectedPR, expectedCmtSHA)
+	r := NewPRCommentReporter(logger.Testing(), github.NewClient(nil), expectedOwner, expectedRepo, expectedPR, expectedCmtSHA)
 	r.client.BaseURL, _ = url.Parse(ts.URL)
 
 	var issues = []db.Issue{{Path: expectedCmtPath, HunkPos: expectedCmtPos, Issue: expectedCmtBody}}
@@ -170,6 +227,80 @@ func TestStatusAPIReporter_SetStatus(t *testing.T) {
 	}
 }
 
+func TestStatusAPIReporter_mustFix(t *testing.T) {
+	type status struct {
+		State       string `json:"state,omitempty"`
+		TargetURL   string `json:"target_url,omitempty"`
+		Description string `json:"description,omitempty"`
+	}
+	var have status
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&have); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	issues := []db.Issue{
+		{Path: "main.go", Line: 1, Issue: "exported func Foo should have comment"},
+		{Path: "main.go", Line: 5, Issue: "G104: Errors unhandled."},
+		{Path: "db.go", Line: 9, Issue: "G201: SQL string formatting"},
+	}
+	patterns := []*regexp.Regexp{regexp.MustCompile(`^G20[0-9]:`), regexp.MustCompile(`(?i)sql injection`)}
+
+	tests := map[string]struct {
+		patterns []*regexp.Regexp
+		issues   []db.Issue
+		want     status
+	}{
+		"no patterns": {nil, issues, status{"success", "https://example.com#issue-db.go-L9", "Found 3 issues"}},
+		"no match":    {patterns, issues[:2], status{"success", "https://example.com#issue-main.go-L1", "Found 2 issues"}},
+		"match":       {patterns, issues, status{"failure", "https://example.com#issue-db.go-L9", "Found 3 issues, 1 must be fixed"}},
+		"single":      {patterns, issues[2:], status{"failure", "https://example.com#issue-db.go-L9", "Found 1 issue which must be fixed"}},
+	}
+
+	for desc, test := range tests {
+		have = status{}
+		r := NewStatusAPIReporter(logger.Testing(), github.NewClient(nil), ts.URL, "ci/gopherci/push", "https://example.com")
+		r.SetMustFix(test.patterns)
+		if err := r.Report(context.Background(), test.issues); err != nil {
+			t.Fatalf("%v: unexpected error: %v", desc, err)
+		}
+		if diff := cmp.Diff(have, test.want); diff != "" {
+			t.Errorf("%v: unexpected status (-have +want)\n%s", desc, diff)
+		}
+	}
+}
+
+func TestStatusAPIReporter_issueURL(t *testing.T) {
+	tests := []struct {
+		targetURL string
+		issues    []db.Issue
+		want      string
+	}{
+		{"https://example.com/analysis/1", nil, "https://example.com/analysis/1"},
+		{"", []db.Issue{{Path: "main.go", Line: 1}}, ""},
+		{
+			"https://example.com/analysis/1",
+			[]db.Issue{{Path: "main.go", Line: 10}, {Path: "main.go", Line: 2}},
+			"https://example.com/analysis/1#issue-main.go-L2",
+		},
+		{
+			"https://example.com/analysis/1",
+			[]db.Issue{{Path: "pkg/a b.go", Line: 3}},
+			"https://example.com/analysis/1#issue-pkg%2Fa%20b.go-L3",
+		},
+	}
+
+	for _, test := range tests {
+		r := StatusAPIReporter{targetURL: test.targetURL}
+		if have := r.issueURL(test.issues); have != test.want {
+			t.Errorf("have: %q, want: %q", have, test.want)
+		}
+	}
+}
+
 func TestStatusAPIReporter_statusDesc(t *testing.T) {
 	tests := []struct {
 		issues     []db.Issue
@@ -193,11 +324,125 @@ func TestStatusAPIReporter_statusDesc(t *testing.T) {
 	}
 }
 
+func TestStatusAPIReporter_statusDescNoIssues(t *testing.T) {
+	r := StatusAPIReporter{}
+	r.SetNoIssuesDesc("No issues found")
+	r.SetDuration(5 * time.Second)
+
+	if have, want := r.statusDesc([]db.Issue{}, 0), "No issues found in 5s"; have != want {
+		t.Errorf("have: %v want: %v", have, want)
+	}
+	if have, want := r.statusDesc([]db.Issue{{}}, 0), "Found 1 issue in 5s"; have != want {
+		t.Errorf("have: %v want: %v", have, want)
+	}
+
+	r.SetNoIssuesDesc("")
+	if have, want := r.statusDesc([]db.Issue{}, 0), DefaultNoIssuesDesc+" in 5s"; have != want {
+		t.Errorf("have: %v want: %v", have, want)
+	}
+}
+
+func TestStatusAPIReporter_statusDescDuration(t *testing.T) {
+	tests := []struct {
+		issues   []db.Issue
+		duration time.Duration
+		want     string
+	}{
+		{[]db.Issue{{}, {}}, 63*time.Second + 500*time.Millisecond, "Found 2 issues in 1m3s"},
+		{[]db.Issue{{}}, 5 * time.Second, "Found 1 issue in 5s"},
+		{[]db.Issue{}, 2 * time.Hour, `Found no issues \ʕ◔ϖ◔ʔ/ in 2h0m0s`},
+		{[]db.Issue{{}, {}}, 0, "Found 2 issues"},
+	}
+
+	for _, test := range tests {
+		r := StatusAPIReporter{}
+		r.SetDuration(test.duration)
+		have := r.statusDesc(test.issues, 0)
+		if have != test.want {
+			t.Errorf("have: %v want: %v", have, test.want)
+		}
+	}
+}
+
+func TestAppendDuration(t *testing.T) {
+	fits := strings.Repeat("ʕ", maxStatusDescLen-len(" in 1s"))
+	tooLong := fits + "ʕ"
+
+	tests := []struct {
+		desc string
+		d    time.Duration
+		want string
+	}{
+		{"Found 1 issue", time.Second, "Found 1 issue in 1s"},
+		{"Found 1 issue", 0, "Found 1 issue"},
+		{fits, time.Second, fits + " in 1s"},
+		{tooLong, time.Second, tooLong}, // exceeds GitHub's limit
+	}
+
+	for _, test := range tests {
+		if have := appendDuration(test.desc, test.d); have != test.want {
+			t.Errorf("have: %q want: %q", have, test.want)
+		}
+	}
+}
+
+func TestToolStatusAPIReporter_reportAnalysis(t *testing.T) {
+	type status struct {
+		State       string `json:"state,omitempty"`
+		Description string `json:"description,omitempty"`
+		Context     string `json:"context,omitempty"`
+	}
+	var have status
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&have); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	analysis := db.NewAnalysis()
+	analysis.Tools[1] = db.AnalysisTool{ToolID: 1, Issues: []db.Issue{{Issue: "issue1"}, {Issue: "issue2"}}}
+	analysis.Tools[2] = db.AnalysisTool{ToolID: 2}
+
+	tests := []struct {
+		tool db.Tool
+		want status
+	}{
+		{db.Tool{ID: 1, Name: "golint"}, status{string(StatusStateFailure), "Found 2 issues", "ci/gopherci/golint"}},
+		{db.Tool{ID: 2, Name: "go vet"}, status{string(StatusStateSuccess), `Found no issues \ʕ◔ϖ◔ʔ/`, "ci/gopherci/go vet"}},
+		{db.Tool{ID: 3, Name: "megacheck"}, status{string(StatusStateSuccess), "Not run", "ci/gopherci/megacheck"}},
+	}
+
+	for _, test := range tests {
+		have = status{}
+		r := NewToolStatusAPIReporter(logger.Testing(), github.NewClient(nil), ts.URL, test.tool, "https://example.com")
+		if err := r.ReportAnalysis(context.Background(), analysis); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(have, test.want); diff != "" {
+			t.Errorf("unexpected status for %v (-have +want)\n%s", test.tool.Name, diff)
+		}
+	}
+}
+
 func TestCommitCommentReporter_report(t *testing.T) {
+	var many []db.Issue
+	for i, path := range []string{"a.go", "b.go", "a.go", "c.go", "a.go", "b.go"} {
+		many = append(many, db.Issue{Path: path, Line: i + 1, Issue: "some issue"})
+	}
+	manyTools := map[db.Issue]string{
+		many[0]: "golint", many[1]: "go vet", many[2]: "golint",
+		many[3]: "golint", many[4]: "go vet",
+	}
+
 	var tests = []struct {
-		issues    []db.Issue
-		wantBody  string
-		wantCount int // number of comments wanted
+		issues     []db.Issue
+		commits    int    // number of commits, defaults to 2
+		groupBy    string // groupBy is the key issues are grouped by
+		issueTools map[db.Issue]string
+		wantBody   string
+		wantCount  int // number of comments wanted
 	}{
 		{
 			issues: []db.Issue{
@@ -218,6 +463,41 @@ func TestCommitCommentReporter_report(t *testing.T) {
 			issues:    []db.Issue{},
 			wantCount: 0,
 		},
+		{
+			issues: []db.Issue{
+				{Issue: "some issue"},
+			},
+			commits:   1,
+			wantBody:  "GopherCI found **1** issue in this commit, see: https://example.com",
+			wantCount: 1,
+		},
+		{
+			issues:    many,
+			wantBody:  "GopherCI found **6** issues in the last **2** commits, see: https://example.com",
+			wantCount: 1,
+		},
+		{
+			issues:  many,
+			groupBy: CommentGroupByFile,
+			wantBody: "GopherCI found **6** issues in the last **2** commits, see: https://example.com\n\n" +
+				"| File | Issues |\n| --- | ---: |\n| `a.go` | 3 |\n| `b.go` | 2 |\n| `c.go` | 1 |",
+			wantCount: 1,
+		},
+		{
+			issues:     many,
+			groupBy:    CommentGroupByTool,
+			issueTools: manyTools,
+			wantBody: "GopherCI found **6** issues in the last **2** commits, see: https://example.com\n\n" +
+				"| Tool | Issues |\n| --- | ---: |\n| `golint` | 3 |\n| `go vet` | 2 |\n| `unknown` | 1 |",
+			wantCount: 1,
+		},
+		{
+			// Too few issues to group.
+			issues:    many[:minGroupedIssues-1],
+			groupBy:   CommentGroupByFile,
+			wantBody:  "GopherCI found **4** issues in the last **2** commits, see: https://example.com",
+			wantCount: 1,
+		},
 	}
 
 	for _, test := range tests {
@@ -255,8 +535,14 @@ func TestCommitCommentReporter_report(t *testing.T) {
 		}))
 		defer ts.Close()
 
-		r := NewCommitCommentReporter(github.NewClient(nil), expectedOwner, expectedRepo, expectedCmtSHA, 2, "https://example.com")
+		commits := test.commits
+		if commits == 0 {
+			commits = 2
+		}
+
+		r := NewCommitCommentReporter(github.NewClient(nil), expectedOwner, expectedRepo, expectedCmtSHA, commits, "https://example.com")
 		r.client.BaseURL, _ = url.Parse(ts.URL)
+		r.groupBy, r.issueTools = test.groupBy, test.issueTools
 
 		err := r.Report(context.Background(), test.issues)
 		if err != nil {
@@ -313,6 +599,66 @@ func TestInlineCommitCommentReporter_report(t *testing.T) {
 	}
 }
 
+func TestOffDiffCommentReporter_report(t *testing.T) {
+	var comments []github.RepositoryComment
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI != "/repos/owner/repo/commits/abc123/comments" {
+			t.Errorf("unexpected request: %v", r.RequestURI)
+			return
+		}
+		var comment github.RepositoryComment
+		if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		comments = append(comments, comment)
+	}))
+	defer ts.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(ts.URL)
+	reporters := []analyser.Reporter{
+		NewInlineCommitCommentReporter(client, "owner", "repo", "abc123"),
+		NewOffDiffCommentReporter(client, "owner", "repo", "abc123", "https://example.com"),
+	}
+
+	issues := []db.Issue{
+		{Path: "main.go", Line: 2, HunkPos: 1, Issue: "on diff"},
+		{Path: "main.go", Line: 10, Issue: "off\ndiff"},
+		{Path: "foo.go", Line: 3, Issue: "also off diff"},
+	}
+	for _, reporter := range reporters {
+		if err := reporter.Report(context.Background(), issues); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	want := []github.RepositoryComment{
+		{Body: github.String("on diff"), Path: github.String("main.go"), Position: github.Int(1)},
+		{Body: github.String("GopherCI found **2** issues in this commit outside the changed lines, see: https://example.com\n\n" +
+			"- `main.go:10`: off diff\n" +
+			"- `foo.go:3`: also off diff",
+		)},
+	}
+	if diff := cmp.Diff(comments, want); diff != "" {
+		t.Errorf("unexpected comments (-have +want)\n%s", diff)
+	}
+}
+
+func TestOffDiffCommentReporter_noOffDiff(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %v", r.RequestURI)
+	}))
+	defer ts.Close()
+
+	r := NewOffDiffCommentReporter(github.NewClient(nil), "owner", "repo", "abc123", "https://example.com")
+	r.client.BaseURL, _ = url.Parse(ts.URL)
+
+	issues := []db.Issue{{Path: "main.go", Line: 2, HunkPos: 1, Issue: "on diff"}}
+	if err := r.Report(context.Background(), issues); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestPRReviewReporter_report(t *testing.T) {
 	var (
 		owner = "owner"
@@ -366,7 +712,7 @@ func TestPRReviewReporter_report(t *testing.T) {
 		}))
 		defer ts.Close()
 
-		r := NewPRReviewReporter(github.NewClient(nil), owner, repo, pr, sha)
+		r := NewPRReviewReporter(logger.Testing(), github.NewClient(nil), owner, repo, pr, sha)
 		r.client.BaseURL, _ = url.Parse(ts.URL)
 
 		err := r.Report(context.Background(), test.issues)
@@ -379,3 +725,212 @@ func TestPRReviewReporter_report(t *testing.T) {
 		}
 	}
 }
+
+func TestCollapseSpace(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"body", "body"},
+		{"body \n", "body"},
+		{"  multi \t word\nbody ", "multi word body"},
+	}
+	for _, test := range tests {
+		if have := collapseSpace(test.in); have != test.want {
+			t.Errorf("collapseSpace(%q) have: %q, want: %q", test.in, have, test.want)
+		}
+	}
+}
+
+func TestPRReviewReporter_suppressed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/repos/owner/repo/pulls/2/comments":
+			// Call to ListComments
+			fmt.Fprintln(w, "[]")
+		default:
+			t.Logf(r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	var issues []db.Issue
+	for i := 0; i < analyser.MaxIssueComments+2; i++ {
+		issues = append(issues, db.Issue{Issue: fmt.Sprintf("issue %d", i), Path: "path.go", Line: i, HunkPos: i})
+	}
+
+	r := NewPRReviewReporter(logger.Testing(), github.NewClient(nil), "owner", "repo", 2, "abc123")
+	r.client.BaseURL, _ = url.Parse(ts.URL)
+
+	if err := r.Report(context.Background(), issues); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := issues[analyser.MaxIssueComments:]; !reflect.DeepEqual(r.Suppressed(), want) {
+		t.Errorf("suppressed have: %+v, want: %+v", r.Suppressed(), want)
+	}
+
+	if err := r.Report(context.Background(), issues[:1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.Suppressed()) != 0 {
+		t.Errorf("suppressed have: %+v, want none", r.Suppressed())
+	}
+}
+
+func TestPRReviewReporter_resolveThreadsError(t *testing.T) {
+	var reviewed bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/graphql":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/repos/owner/repo/pulls/2/comments":
+			// Call to ListComments
+			fmt.Fprintln(w, "[]")
+		case "/repos/owner/repo/pulls/2/reviews":
+			reviewed = true
+			fmt.Fprintln(w, "{}")
+		default:
+			t.Logf(r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	r := NewPRReviewReporter(logger.Testing(), github.NewClient(nil), "owner", "repo", 2, "abc123")
+	r.client.BaseURL, _ = url.Parse(ts.URL)
+
+	issues := []db.Issue{{Issue: "issue", Path: "path.go", Line: 1, HunkPos: 1}}
+	if err := r.Report(context.Background(), issues); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reviewed {
+		t.Error("review not posted after failing to resolve threads")
+	}
+}
+
+// suppressingReporter is an analyser.SuppressingReporter which suppressed
+// issues.
+type suppressingReporter []db.Issue
+
+func (r suppressingReporter) Report(context.Context, []db.Issue) error { return nil }
+func (r suppressingReporter) Suppressed() []db.Issue                   { return r }
+
+func TestSuppressedSummaryReporter_report(t *testing.T) {
+	const analysisURL = "https://example.com/analysis/1"
+	issues := []db.Issue{{Path: "main.go", Line: 1, Issue: "issue"}}
+
+	tests := map[string]struct {
+		suppressed []db.Issue
+		previous   string // previous is the body of a previous summary.
+		wantMethod string // wantMethod is the method of the comment's request.
+	}{
+		"none":                {nil, "", ""},
+		"suppressed":          {issues, "", "POST"},
+		"previous":            {issues, suppressedSummary(nil, analysisURL), "PATCH"},
+		"previous none":       {nil, suppressedSummary(issues, analysisURL), "PATCH"},
+		"previous unchanged":  {issues, suppressedSummary(issues, analysisURL), ""},
+		"previous other user": {issues, "GopherCI suppressed **1** issue", "POST"},
+	}
+	bot := &github.User{Login: github.String("gopherci[bot]"), Type: github.String("Bot")}
+	user := &github.User{Login: github.String("alice"), Type: github.String("User")}
+
+	for desc, test := range tests {
+		var (
+			have       *github.IssueComment
+			haveMethod string
+		)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/repos/owner/repo/issues/2/comments":
+				comments := []*github.IssueComment{
+					{ID: github.Int(3), User: user, Body: github.String(suppressedSummary(issues, analysisURL) + "\n> quoted")},
+					{ID: github.Int(4), User: user, Body: github.String("LGTM")},
+				}
+				if test.previous != "" {
+					comments = append(comments, &github.IssueComment{ID: github.Int(5), User: bot, Body: github.String(test.previous)})
+				}
+				json.NewEncoder(w).Encode(comments)
+			case r.Method == "POST" && r.URL.Path == "/graphql":
+				fmt.Fprintln(w, `{"data": {"viewer": {"login": "gopherci"}}}`)
+			case r.Method == "POST" && r.RequestURI == "/repos/owner/repo/issues/2/comments",
+				r.Method == "PATCH" && r.RequestURI == "/repos/owner/repo/issues/comments/5":
+				haveMethod = r.Method
+				if err := json.NewDecoder(r.Body).Decode(&have); err != nil {
+					t.Errorf("%v: unexpected error: %v", desc, err)
+				}
+			default:
+				t.Errorf("%v: unexpected request: %v %v", desc, r.Method, r.RequestURI)
+			}
+		}))
+
+		r := NewSuppressedSummaryReporter(github.NewClient(nil), "owner", "repo", 2, suppressingReporter(test.suppressed), analysisURL)
+		r.client.BaseURL, _ = url.Parse(ts.URL)
+
+		err := r.Report(context.Background(), nil)
+		ts.Close()
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", desc, err)
+		}
+		if haveMethod != test.wantMethod {
+			t.Errorf("%v: comment method have: %q, want: %q", desc, haveMethod, test.wantMethod)
+		}
+		if have != nil && have.GetBody() != suppressedSummary(test.suppressed, analysisURL) {
+			t.Errorf("%v: unexpected body: %q", desc, have.GetBody())
+		}
+	}
+}
+
+func TestSuppressedSummary(t *testing.T) {
+	tests := []struct {
+		suppressed  []db.Issue
+		analysisURL string
+		want        string
+	}{
+		{
+			suppressed:  []db.Issue{{Path: "main.go", Line: 1, Issue: "exported func Foo should have\n  comment"}},
+			analysisURL: "https://example.com/analysis/1",
+			want: "<!-- gopherci:suppressed-summary -->\n" +
+				"GopherCI suppressed **1** issue to limit the number of comments, see: https://example.com/analysis/1\n\n" +
+				"<details>\n<summary>Suppressed issue</summary>\n\n" +
+				"- `main.go:1`: exported func Foo should have comment\n" +
+				"\n</details>",
+		},
+		{
+			suppressed: []db.Issue{
+				{Path: "main.go", Line: 1, Issue: "first"},
+				{Path: "pkg/foo.go", Line: 20, Issue: "second"},
+			},
+			want: "<!-- gopherci:suppressed-summary -->\n" +
+				"GopherCI suppressed **2** issues to limit the number of comments\n\n" +
+				"<details>\n<summary>Suppressed issues</summary>\n\n" +
+				"- `main.go:1`: first\n" +
+				"- `pkg/foo.go:20`: second\n" +
+				"\n</details>",
+		},
+		{
+			analysisURL: "https://example.com/analysis/2",
+			want: "<!-- gopherci:suppressed-summary -->\n" +
+				"GopherCI suppressed no issues in the latest analysis, see: https://example.com/analysis/2",
+		},
+	}
+
+	for _, test := range tests {
+		if have := suppressedSummary(test.suppressed, test.analysisURL); have != test.want {
+			t.Errorf("have:\n%s\nwant:\n%s", have, test.want)
+		}
+	}
+}
+
+func TestSuppressedSummary_max(t *testing.T) {
+	var suppressed []db.Issue
+	for i := 1; i <= maxCommentGroups+5; i++ {
+		suppressed = append(suppressed, db.Issue{Path: "main.go", Line: i, Issue: "issue"})
+	}
+
+	have := suppressedSummary(suppressed, "https://example.com/analysis/1")
+	if count := strings.Count(have, "`main.go:"); count != maxCommentGroups {
+		t.Errorf("listed %v issues, want: %v", count, maxCommentGroups)
+	}
+	if want := "- …and 5 more, see: https://example.com/analysis/1\n\n</details>"; !strings.HasSuffix(have, want) {
+		t.Errorf("have:\n%s\nwant suffix:\n%s", have, want)
+	}
+}
@@ -0,0 +1,216 @@
+package github
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// ErrRerunForbidden is returned by Rerun if the user does not have write
+// access to the analysed repository.
+var ErrRerunForbidden = errors.New("user does not have write access to the repository")
+
+// Rerun is a queue job to analyse a push's commits again, reconstructed from
+// the push's previous analysis. Only the commit status is reported, as the
+// previous analysis's comments remain.
+type Rerun struct {
+	InstallationID int
+	RepositoryID   int
+	Owner          string
+	Repo           string
+	CloneURL       string
+	HTMLURL        string
+	StatusesURL    string // StatusesURL is the URL to set the status of CommitTo.
+	Branch         string
+	DefaultBranch  string
+	CommitFrom     string // CommitFrom is blank if the push created Branch.
+	CommitTo       string
+	Author         string
+}
+
+func init() {
+	// Rerun is added to the queue, which may gob encode it.
+	gob.Register(&Rerun{})
+}
+
+// RerunConfig returns an AnalyseConfig for a re-run of a push's analysis.
+func RerunConfig(r *Rerun) AnalyseConfig {
+	var refReader analyser.RefReader = &analyser.FixedRef{BaseRef: r.CommitFrom}
+	if r.CommitFrom == "" {
+		// The number of commits in a push which created a branch isn't
+		// recorded, so compare against where the branch diverged from the
+		// default branch, as PushConfig does, or the last commit.
+		fallbackRef := r.CommitTo + "~1"
+		refReader = &analyser.FixedRef{BaseRef: fallbackRef}
+		if r.DefaultBranch != "" && r.DefaultBranch != r.Branch {
+			refReader = &analyser.BranchMergeBase{Branch: r.DefaultBranch, FallbackRef: fallbackRef}
+		}
+	}
+
+	return AnalyseConfig{
+		cloner: &analyser.PushCloner{
+			HeadURL: r.CloneURL,
+			HeadRef: r.CommitTo,
+		},
+		refReader:       refReader,
+		installationID:  r.InstallationID,
+		repositoryID:    r.RepositoryID,
+		statusesContext: "ci/gopherci/push",
+		statusesURL:     r.StatusesURL,
+		commitFrom:      r.CommitFrom,
+		commitTo:        r.CommitTo,
+		headRef:         r.CommitTo,
+		branch:          r.Branch,
+		author:          r.Author,
+		goSrcPath:       stripScheme(r.HTMLURL),
+		owner:           r.Owner,
+		repo:            r.Repo,
+		sha:             r.CommitTo,
+	}
+}
+
+// IsIgnored returns true if err was returned by Rerun because the analysis
+// cannot be re-run, such as its repository being private, rather than because
+// it could not be queued.
+func IsIgnored(err error) bool {
+	_, ok := err.(*ignoreEvent)
+	return ok
+}
+
+// Rerun queues analysis to be analysed again on behalf of the GitHub user
+// login, who must have write access to the repository, else
+// ErrRerunForbidden is returned. A pull request is analysed at its current
+// head, as for a rerequested check run, if it's still open, isn't a draft and
+// has the repository's required label. A full scan is analysed at the same commit, and
+// a push is analysed with the same commits. See IsIgnored for errors returned
+// if the analysis cannot be re-run.
+func (g *GitHub) Rerun(ctx context.Context, analysis *db.Analysis, login string) error {
+	installation, err := g.NewInstallation(analysis.InstallationID)
+	if err != nil {
+		return errors.Wrap(err, "could not get installation")
+	}
+	if !installation.IsEnabled() {
+		return errors.Errorf("installation %v is not enabled", analysis.InstallationID)
+	}
+
+	req, err := installation.client.NewRequest("GET", fmt.Sprintf("repositories/%d", analysis.RepositoryID), nil)
+	if err != nil {
+		return errors.Wrap(err, "could not make repository request")
+	}
+	repo := &github.Repository{}
+	if _, err := installation.client.Do(ctx, req, repo); err != nil {
+		return errors.Wrapf(err, "could not get repository %v", analysis.RepositoryID)
+	}
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	switch err := checkWriteAccess(ctx, installation, owner, name, login).(type) {
+	case nil:
+	case *ignoreEvent:
+		return ErrRerunForbidden
+	default:
+		return err
+	}
+	if err := g.checkRepositoryAllowed(analysis.InstallationID, analysis.RepositoryID); err != nil {
+		return err
+	}
+	if repo.GetPrivate() {
+		return &ignoreEvent{reason: ignorePrivateRepos}
+	}
+
+	if analysis.RequestNumber != 0 {
+		pr, draft, err := getPullRequest(ctx, installation.client, owner, name, analysis.RequestNumber)
+		if err != nil {
+			return err
+		}
+		if err := g.checkRerunPR(analysis.RepositoryID, pr, draft); err != nil {
+			return err
+		}
+		g.queuePullRequest(&github.PullRequestEvent{
+			Action:       github.String("rerun"),
+			Number:       github.Int(analysis.RequestNumber),
+			PullRequest:  pr,
+			Repo:         repo,
+			Sender:       &github.User{Login: github.String(login)},
+			Installation: &github.Installation{ID: github.Int(analysis.InstallationID)},
+		})
+		return nil
+	}
+
+	if analysis.Trigger == db.AnalysisTriggerFullScan {
+		g.queuePush <- &FullScan{
+			InstallationID: analysis.InstallationID,
+			RepositoryID:   analysis.RepositoryID,
+			Owner:          owner,
+			Repo:           name,
+			CloneURL:       repo.GetCloneURL(),
+			HTMLURL:        repo.GetHTMLURL(),
+			StatusesURL:    strings.Replace(repo.GetStatusesURL(), "{sha}", analysis.CommitTo, -1),
+			Branch:         analysis.Branch,
+			SHA:            analysis.CommitTo,
+		}
+		return nil
+	}
+
+	g.queuePush <- newRerun(analysis.InstallationID, analysis, repo)
+	return nil
+}
+
+// getPullRequest returns the pull request number of owner's repo, and whether
+// it's a draft. The draft field is decoded from the response, as it's not
+// supported by github.PullRequest.
+func getPullRequest(ctx context.Context, client *github.Client, owner, repo string, number int) (*github.PullRequest, bool, error) {
+	req, err := client.NewRequest("GET", fmt.Sprintf("repos/%v/%v/pulls/%d", owner, repo, number), nil)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "could not make pull request request")
+	}
+	var pr struct {
+		github.PullRequest
+		Draft bool `json:"draft"`
+	}
+	if _, err := client.Do(ctx, req, &pr); err != nil {
+		return nil, false, errors.Wrapf(err, "could not get pull request %v", number)
+	}
+	return &pr.PullRequest, pr.Draft, nil
+}
+
+// checkRerunPR returns an error of type *ignoreEvent if pr, which is being
+// analysed again, is no longer analysed by its webhook events. That is, if its
+// head repository has been deleted, it's closed, it's a draft, or it's missing
+// the repository's required label.
+func (g *GitHub) checkRerunPR(repositoryID int, pr *github.PullRequest, draft bool) error {
+	if pr.Head == nil || pr.Head.Repo == nil {
+		// The head repository has been deleted.
+		return &ignoreEvent{reason: ignorePRInaccessible, extra: "head repository not found"}
+	}
+	if pr.GetState() != "open" {
+		return &ignoreEvent{reason: ignorePRClosed}
+	}
+	if draft {
+		return &ignoreEvent{reason: ignoreDraft}
+	}
+	return g.checkPRLabels(repositoryID, pr.Labels, nil)
+}
+
+// newRerun returns a Rerun of installationID's push analysis of repo.
+func newRerun(installationID int, analysis *db.Analysis, repo *github.Repository) *Rerun {
+	return &Rerun{
+		InstallationID: installationID,
+		RepositoryID:   analysis.RepositoryID,
+		Owner:          repo.GetOwner().GetLogin(),
+		Repo:           repo.GetName(),
+		CloneURL:       repo.GetCloneURL(),
+		HTMLURL:        repo.GetHTMLURL(),
+		StatusesURL:    strings.Replace(repo.GetStatusesURL(), "{sha}", analysis.CommitTo, -1),
+		Branch:         analysis.Branch,
+		DefaultBranch:  repo.GetDefaultBranch(),
+		CommitFrom:     analysis.CommitFrom,
+		CommitTo:       analysis.CommitTo,
+		Author:         analysis.Author,
+	}
+}
@@ -0,0 +1,247 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+)
+
+func TestRerunConfig(t *testing.T) {
+	rerun := &Rerun{
+		InstallationID: 1,
+		RepositoryID:   2,
+		Owner:          "owner",
+		Repo:           "repo",
+		CloneURL:       "https://github.com/owner/repo.git",
+		HTMLURL:        "https://github.com/owner/repo",
+		StatusesURL:    "https://github.com/owner/repo/status/abcdef",
+		Branch:         "feature",
+		DefaultBranch:  "master",
+		CommitFrom:     "abcdef~2",
+		CommitTo:       "abcdef",
+		Author:         "gopher",
+	}
+	want := AnalyseConfig{
+		cloner: &analyser.PushCloner{
+			HeadURL: "https://github.com/owner/repo.git",
+			HeadRef: "abcdef",
+		},
+		refReader:       &analyser.FixedRef{BaseRef: "abcdef~2"},
+		installationID:  1,
+		repositoryID:    2,
+		statusesContext: "ci/gopherci/push",
+		statusesURL:     "https://github.com/owner/repo/status/abcdef",
+		commitFrom:      "abcdef~2",
+		commitTo:        "abcdef",
+		headRef:         "abcdef",
+		branch:          "feature",
+		author:          "gopher",
+		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		sha:             "abcdef",
+	}
+	if have := RerunConfig(rerun); !reflect.DeepEqual(have, want) {
+		t.Errorf("have:\n%+v\nwant:\n%+v", have, want)
+	}
+
+	// A push which created a branch compares against the default branch.
+	rerun.CommitFrom = ""
+	want.commitFrom = ""
+	want.refReader = &analyser.BranchMergeBase{Branch: "master", FallbackRef: "abcdef~1"}
+	if have := RerunConfig(rerun); !reflect.DeepEqual(have, want) {
+		t.Errorf("created branch have:\n%+v\nwant:\n%+v", have, want)
+	}
+
+	// A push which created the default branch compares against the last commit.
+	rerun.Branch, want.branch = "master", "master"
+	want.refReader = &analyser.FixedRef{BaseRef: "abcdef~1"}
+	if have := RerunConfig(rerun); !reflect.DeepEqual(have, want) {
+		t.Errorf("created default branch have:\n%+v\nwant:\n%+v", have, want)
+	}
+}
+
+// rerunServer returns a test server of the GitHub API for re-running analyses
+// of repository 2, owner/repo, where user has permission.
+func rerunServer(t *testing.T, permission string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/1/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/repositories/2":
+			fmt.Fprintln(w, `{"id": 2, "name": "repo", "default_branch": "master", "owner": {"login": "owner"},
+  "clone_url": "https://github.com/owner/repo.git", "html_url": "https://github.com/owner/repo",
+  "statuses_url": "https://api.github.com/repos/owner/repo/statuses/{sha}"}`)
+		case "/repos/owner/repo/collaborators/user/permission":
+			fmt.Fprintf(w, `{"permission": %q}`, permission)
+		case "/repos/owner/repo/pulls/3":
+			fmt.Fprintln(w, `{"number": 3, "state": "open", "labels": [{"name": "other"}], "head": {"ref": "feature", "sha": "abcdef", "repo": {"id": 2}}}`)
+		case "/repos/owner/repo/pulls/4":
+			fmt.Fprintln(w, `{"number": 4, "state": "closed", "head": {"ref": "feature", "sha": "abcdef", "repo": {"id": 2}}}`)
+		case "/repos/owner/repo/pulls/5":
+			fmt.Fprintln(w, `{"number": 5, "state": "open", "draft": true, "labels": [{"name": "gopherci"}], "head": {"ref": "feature", "sha": "abcdef", "repo": {"id": 2}}}`)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+}
+
+func TestRerun_push(t *testing.T) {
+	ts := rerunServer(t, "write")
+	defer ts.Close()
+
+	g, _, memDB := setup(t)
+	g.baseURL = ts.URL
+	c := make(chan interface{}, 1)
+	g.queuePush = c
+	_ = memDB.AddGHInstallation(0, 1, 2, 3)
+	memDB.EnableGHInstallation(1)
+
+	analysis := &db.Analysis{
+		InstallationID: 1,
+		RepositoryID:   2,
+		CommitFrom:     "abcdef~2",
+		CommitTo:       "abcdef",
+		Branch:         "feature",
+		Author:         "gopher",
+	}
+	if err := g.Rerun(context.Background(), analysis, "user"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := &Rerun{
+		InstallationID: 1,
+		RepositoryID:   2,
+		Owner:          "owner",
+		Repo:           "repo",
+		CloneURL:       "https://github.com/owner/repo.git",
+		HTMLURL:        "https://github.com/owner/repo",
+		StatusesURL:    "https://api.github.com/repos/owner/repo/statuses/abcdef",
+		Branch:         "feature",
+		DefaultBranch:  "master",
+		CommitFrom:     "abcdef~2",
+		CommitTo:       "abcdef",
+		Author:         "gopher",
+	}
+	if have := <-c; !reflect.DeepEqual(have, want) {
+		t.Errorf("have:\n%+v\nwant:\n%+v", have, want)
+	}
+}
+
+func TestRerun_pullRequest(t *testing.T) {
+	ts := rerunServer(t, "admin")
+	defer ts.Close()
+
+	g, _, memDB := setup(t)
+	g.baseURL = ts.URL
+	c := make(chan interface{}, 1)
+	g.queuePush = c
+	_ = memDB.AddGHInstallation(0, 1, 2, 3)
+	memDB.EnableGHInstallation(1)
+
+	analysis := &db.Analysis{InstallationID: 1, RepositoryID: 2, RequestNumber: 3}
+	if err := g.Rerun(context.Background(), analysis, "user"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	e, ok := (<-c).(*github.PullRequestEvent)
+	if !ok {
+		t.Fatalf("queued job is not a pull request event")
+	}
+	if e.GetNumber() != 3 || *e.PullRequest.Head.SHA != "abcdef" || e.Repo.GetID() != 2 || *e.Installation.ID != 1 {
+		t.Errorf("unexpected pull request event: %+v", e)
+	}
+}
+
+func TestRerun_forbidden(t *testing.T) {
+	ts := rerunServer(t, "read")
+	defer ts.Close()
+
+	g, _, memDB := setup(t)
+	g.baseURL = ts.URL
+	c := make(chan interface{}, 1)
+	g.queuePush = c
+	_ = memDB.AddGHInstallation(0, 1, 2, 3)
+	memDB.EnableGHInstallation(1)
+
+	analysis := &db.Analysis{InstallationID: 1, RepositoryID: 2, CommitTo: "abcdef"}
+	if err := g.Rerun(context.Background(), analysis, "user"); err != ErrRerunForbidden {
+		t.Errorf("have error: %v, want: %v", err, ErrRerunForbidden)
+	}
+	if len(c) != 0 {
+		t.Errorf("analysis was queued")
+	}
+}
+
+func TestRerun_fullScan(t *testing.T) {
+	ts := rerunServer(t, "write")
+	defer ts.Close()
+
+	g, _, memDB := setup(t)
+	g.baseURL = ts.URL
+	c := make(chan interface{}, 1)
+	g.queuePush = c
+	_ = memDB.AddGHInstallation(0, 1, 2, 3)
+	memDB.EnableGHInstallation(1)
+
+	analysis := &db.Analysis{
+		InstallationID: 1,
+		RepositoryID:   2,
+		Trigger:        db.AnalysisTriggerFullScan,
+		CommitTo:       "abcdef",
+		Branch:         "master",
+	}
+	if err := g.Rerun(context.Background(), analysis, "user"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := &FullScan{
+		InstallationID: 1,
+		RepositoryID:   2,
+		Owner:          "owner",
+		Repo:           "repo",
+		CloneURL:       "https://github.com/owner/repo.git",
+		HTMLURL:        "https://github.com/owner/repo",
+		StatusesURL:    "https://api.github.com/repos/owner/repo/statuses/abcdef",
+		Branch:         "master",
+		SHA:            "abcdef",
+	}
+	if have := <-c; !reflect.DeepEqual(have, want) {
+		t.Errorf("have:\n%+v\nwant:\n%+v", have, want)
+	}
+}
+
+func TestRerun_ignored(t *testing.T) {
+	ts := rerunServer(t, "write")
+	defer ts.Close()
+
+	g, _, memDB := setup(t)
+	g.baseURL = ts.URL
+	c := make(chan interface{}, 1)
+	g.queuePush = c
+	_ = memDB.AddGHInstallation(0, 1, 2, 3)
+	memDB.EnableGHInstallation(1)
+	_ = memDB.SetRepoSettings(db.RepoSettings{RepositoryID: 2, PRLabel: "gopherci"})
+
+	tests := map[string]*db.Analysis{
+		"closed":        {InstallationID: 1, RepositoryID: 2, RequestNumber: 4},
+		"draft":         {InstallationID: 1, RepositoryID: 2, RequestNumber: 5},
+		"missing label": {InstallationID: 1, RepositoryID: 2, RequestNumber: 3},
+	}
+	for desc, analysis := range tests {
+		if err := g.Rerun(context.Background(), analysis, "user"); !IsIgnored(err) {
+			t.Errorf("%v: have error: %v, want ignored", desc, err)
+		}
+	}
+	if len(c) != 0 {
+		t.Errorf("analysis was queued")
+	}
+}
@@ -0,0 +1,136 @@
+package github
+
+import (
+	"context"
+	"encoding/gob"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/pkg/errors"
+)
+
+// fullScanStatusesContext is the status API context of full scans.
+const fullScanStatusesContext = "ci/gopherci/scan"
+
+// FullScan is a queue job to analyse all issues in a repository's branch,
+// instead of only the changes of an event, such as a nightly scan of the
+// default branch. Only the commit status is reported, no comments are made.
+type FullScan struct {
+	InstallationID int
+	RepositoryID   int
+	Owner          string
+	Repo           string
+	CloneURL       string
+	HTMLURL        string
+	StatusesURL    string // StatusesURL is the URL to set the status of SHA.
+	Branch         string
+	SHA            string // SHA is the branch's head when the scan was queued.
+}
+
+func init() {
+	// FullScan is added to the queue, which may gob encode it.
+	gob.Register(&FullScan{})
+}
+
+// FullScanConfig returns an AnalyseConfig for a full scan.
+func FullScanConfig(s *FullScan) AnalyseConfig {
+	return AnalyseConfig{
+		cloner: &analyser.PushCloner{
+			HeadURL: s.CloneURL,
+			HeadRef: s.SHA,
+		},
+		refReader:       &analyser.FixedRef{BaseRef: s.SHA},
+		installationID:  s.InstallationID,
+		repositoryID:    s.RepositoryID,
+		statusesContext: fullScanStatusesContext,
+		statusesURL:     s.StatusesURL,
+		commitTo:        s.SHA,
+		headRef:         s.SHA,
+		branch:          s.Branch,
+		goSrcPath:       stripScheme(s.HTMLURL),
+		owner:           s.Owner,
+		repo:            s.Repo,
+		sha:             s.SHA,
+		fullScan:        true,
+	}
+}
+
+// QueueFullScans queues a full scan of the default branch of each repository
+// accessible to each enabled installation. Private repositories and
+// repositories not allowed by the installation's rules are skipped, as they
+// are for events. An installation's errors are logged and its remaining
+// repositories skipped, so one installation does not prevent others being
+// scanned. Returns the number of scans queued.
+func (g *GitHub) QueueFullScans(ctx context.Context) (int, error) {
+	installations, err := g.db.ListGHInstallations()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not list installations")
+	}
+
+	var queued int
+	for _, ghi := range installations {
+		scans, err := g.fullScans(ctx, ghi.InstallationID)
+		if err != nil {
+			g.logger.With("installationID", ghi.InstallationID).With("error", err).Error("could not list full scans")
+		}
+		for _, scan := range scans {
+			select {
+			case g.queuePush <- scan:
+				queued++
+			case <-ctx.Done():
+				return queued, ctx.Err()
+			}
+		}
+	}
+	return queued, nil
+}
+
+// fullScans returns the full scans of an installation's repositories, or the
+// scans found before an error occurred.
+func (g *GitHub) fullScans(ctx context.Context, installationID int) ([]*FullScan, error) {
+	installation, err := g.NewInstallation(installationID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get installation")
+	}
+	if !installation.IsEnabled() {
+		return nil, nil
+	}
+
+	repos, err := installation.repositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var scans []*FullScan
+	for _, repo := range repos {
+		if repo.GetPrivate() {
+			continue
+		}
+		if err := g.checkRepositoryAllowed(installationID, repo.GetID()); err != nil {
+			if _, ok := err.(*ignoreEvent); ok {
+				continue
+			}
+			return scans, err
+		}
+
+		owner, name, branch := repo.GetOwner().GetLogin(), repo.GetName(), repo.GetDefaultBranch()
+		head, _, err := installation.client.Repositories.GetBranch(ctx, owner, name, branch)
+		if err != nil {
+			return scans, errors.Wrapf(err, "could not get branch %v of %v", branch, repo.GetFullName())
+		}
+		sha := head.GetCommit().GetSHA()
+
+		scans = append(scans, &FullScan{
+			InstallationID: installationID,
+			RepositoryID:   repo.GetID(),
+			Owner:          owner,
+			Repo:           name,
+			CloneURL:       repo.GetCloneURL(),
+			HTMLURL:        repo.GetHTMLURL(),
+			StatusesURL:    strings.Replace(repo.GetStatusesURL(), "{sha}", sha, -1),
+			Branch:         branch,
+			SHA:            sha,
+		})
+	}
+	return scans, nil
+}
@@ -0,0 +1,105 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+)
+
+func TestFullScanConfig(t *testing.T) {
+	want := AnalyseConfig{
+		cloner: &analyser.PushCloner{
+			HeadURL: "https://github.com/owner/repo.git",
+			HeadRef: "abcdef",
+		},
+		refReader:       &analyser.FixedRef{BaseRef: "abcdef"},
+		installationID:  1,
+		repositoryID:    2,
+		statusesContext: "ci/gopherci/scan",
+		statusesURL:     "https://github.com/owner/repo/status/abcdef",
+		commitTo:        "abcdef",
+		headRef:         "abcdef",
+		branch:          "master",
+		goSrcPath:       "github.com/owner/repo",
+		owner:           "owner",
+		repo:            "repo",
+		sha:             "abcdef",
+		fullScan:        true,
+	}
+
+	have := FullScanConfig(&FullScan{
+		InstallationID: 1,
+		RepositoryID:   2,
+		Owner:          "owner",
+		Repo:           "repo",
+		CloneURL:       "https://github.com/owner/repo.git",
+		HTMLURL:        "https://github.com/owner/repo",
+		StatusesURL:    "https://github.com/owner/repo/status/abcdef",
+		Branch:         "master",
+		SHA:            "abcdef",
+	})
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("have:\n%+v\nwant:\n%+v", have, want)
+	}
+}
+
+func TestQueueFullScans(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/installations/1/access_tokens", "/installations/2/access_tokens":
+			// respond with any token to installation transport
+			fmt.Fprintln(w, "{}")
+		case "/installation/repositories?per_page=100&page=1":
+			fmt.Fprintln(w, `{"repositories": [
+  {"id": 10, "name": "public", "full_name": "owner/public", "default_branch": "develop", "owner": {"login": "owner"},
+   "clone_url": "https://github.com/owner/public.git", "html_url": "https://github.com/owner/public",
+   "statuses_url": "https://api.github.com/repos/owner/public/statuses/{sha}"},
+  {"id": 11, "name": "private", "full_name": "owner/private", "private": true, "default_branch": "master", "owner": {"login": "owner"}},
+  {"id": 12, "name": "denied", "full_name": "owner/denied", "default_branch": "master", "owner": {"login": "owner"}}
+]}`)
+		case "/repos/owner/public/branches/develop":
+			fmt.Fprintln(w, `{"name": "develop", "commit": {"sha": "abcdef"}}`)
+		default:
+			t.Errorf("unexpected request: %v", r.RequestURI)
+		}
+	}))
+	defer ts.Close()
+
+	g, _, memDB := setup(t)
+	g.baseURL = ts.URL
+	c := make(chan interface{}, 10)
+	g.queuePush = c
+
+	_ = memDB.AddGHInstallation(0, 1, 2, 3)
+	memDB.EnableGHInstallation(1)
+	_ = memDB.AddGHInstallation(0, 2, 2, 3) // not enabled
+	_ = memDB.SetRepositoryRule(1, 12, false)
+
+	queued, err := g.QueueFullScans(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := 1; queued != want {
+		t.Fatalf("queued have: %v, want: %v", queued, want)
+	}
+
+	want := &FullScan{
+		InstallationID: 1,
+		RepositoryID:   10,
+		Owner:          "owner",
+		Repo:           "public",
+		CloneURL:       "https://github.com/owner/public.git",
+		HTMLURL:        "https://github.com/owner/public",
+		StatusesURL:    "https://api.github.com/repos/owner/public/statuses/abcdef",
+		Branch:         "develop",
+		SHA:            "abcdef",
+	}
+	if have := <-c; !reflect.DeepEqual(have, want) {
+		t.Errorf("have:\n%+v\nwant:\n%+v", have, want)
+	}
+}
@@ -0,0 +1,217 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// reviewThread is a pull request review thread, described by its first
+// comment.
+type reviewThread struct {
+	ID         string
+	IsResolved bool
+	Author     string // Author is the login of the first comment's author.
+	Path       string
+	Position   *int // Position is nil if the comment is outdated.
+	Body       string
+}
+
+// threadsToResolve returns the IDs of unresolved threads started by login
+// whose issue is no longer present in issues. If a thread is outdated, it's
+// still considered present if the same issue exists anywhere in the file.
+func threadsToResolve(threads []reviewThread, login string, issues []db.Issue) []string {
+	if login == "" {
+		return nil
+	}
+	var ids []string
+	for _, thread := range threads {
+		if thread.IsResolved || thread.Author != login {
+			continue
+		}
+		present := false
+		for _, issue := range issues {
+			if issue.Path != thread.Path || collapseSpace(issue.Issue) != collapseSpace(thread.Body) {
+				continue
+			}
+			if thread.Position == nil || *thread.Position == issue.HunkPos {
+				present = true
+				break
+			}
+		}
+		if !present {
+			ids = append(ids, thread.ID)
+		}
+	}
+	return ids
+}
+
+// graphQL executes a GitHub GraphQL API query with variables, decoding the
+// response's data into v.
+func graphQL(ctx context.Context, client *github.Client, query string, variables map[string]interface{}, v interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return errors.Wrap(err, "could not marshal graphql query")
+	}
+
+	req, err := http.NewRequest("POST", graphQLURL(client.BaseURL), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not make graphql request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return errors.Wrap(err, "could not execute graphql request")
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("graphql error: %s", resp.Errors[0].Message)
+	}
+	if len(resp.Data) == 0 || v == nil {
+		return nil
+	}
+	return errors.Wrap(json.Unmarshal(resp.Data, v), "could not unmarshal graphql data")
+}
+
+// viewerLogin returns the login of the authenticated user, which for an
+// installation is the login of the App's bot user.
+func viewerLogin(ctx context.Context, client *github.Client) (string, error) {
+	var data struct {
+		Viewer struct {
+			Login string `json:"login"`
+		} `json:"viewer"`
+	}
+	if err := graphQL(ctx, client, `query { viewer { login } }`, nil, &data); err != nil {
+		return "", errors.WithMessage(err, "could not get viewer login")
+	}
+	return data.Viewer.Login, nil
+}
+
+// isAppUser returns true if user is the bot user whose viewer login is login,
+// see viewerLogin. The REST API suffixes a bot user's login with "[bot]".
+func isAppUser(user *github.User, login string) bool {
+	return login != "" && user.GetType() == "Bot" &&
+		strings.TrimSuffix(user.GetLogin(), "[bot]") == strings.TrimSuffix(login, "[bot]")
+}
+
+// graphQLURL returns the GraphQL API endpoint for the REST API's baseURL. A
+// GitHub Enterprise REST API is at /api/v3/ with GraphQL at /api/graphql,
+// otherwise GraphQL is at /graphql relative to baseURL.
+func graphQLURL(baseURL *url.URL) string {
+	u := *baseURL
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if strings.HasSuffix(u.Path, "/api/v3") {
+		u.Path = strings.TrimSuffix(u.Path, "/v3")
+	}
+	u.Path += "/graphql"
+	return u.String()
+}
+
+// resolveFixedThreads resolves review threads on a pull request previously
+// started by the authenticated installation, whose issues are no longer
+// present in issues, which must be all the issues found by the current
+// analysis.
+func resolveFixedThreads(ctx context.Context, client *github.Client, owner, repo string, number int, issues []db.Issue) error {
+	const query = `query($owner: String!, $repo: String!, $number: Int!, $cursor: String) {
+  viewer { login }
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          id
+          isResolved
+          comments(first: 1) {
+            nodes { author { login } path position body }
+          }
+        }
+      }
+    }
+  }
+}`
+	var (
+		login   string
+		threads []reviewThread
+		cursor  *string
+	)
+	for {
+		var data struct {
+			Viewer struct {
+				Login string `json:"login"`
+			} `json:"viewer"`
+			Repository struct {
+				PullRequest struct {
+					ReviewThreads struct {
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+						Nodes []struct {
+							ID         string `json:"id"`
+							IsResolved bool   `json:"isResolved"`
+							Comments   struct {
+								Nodes []struct {
+									Author struct {
+										Login string `json:"login"`
+									} `json:"author"`
+									Path     string `json:"path"`
+									Position *int   `json:"position"`
+									Body     string `json:"body"`
+								} `json:"nodes"`
+							} `json:"comments"`
+						} `json:"nodes"`
+					} `json:"reviewThreads"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		}
+		variables := map[string]interface{}{"owner": owner, "repo": repo, "number": number, "cursor": cursor}
+		if err := graphQL(ctx, client, query, variables, &data); err != nil {
+			return errors.WithMessage(err, "could not list review threads")
+		}
+
+		login = data.Viewer.Login
+		reviewThreads := data.Repository.PullRequest.ReviewThreads
+		for _, node := range reviewThreads.Nodes {
+			if len(node.Comments.Nodes) == 0 {
+				continue
+			}
+			comment := node.Comments.Nodes[0]
+			threads = append(threads, reviewThread{
+				ID:         node.ID,
+				IsResolved: node.IsResolved,
+				Author:     comment.Author.Login,
+				Path:       comment.Path,
+				Position:   comment.Position,
+				Body:       comment.Body,
+			})
+		}
+		if !reviewThreads.PageInfo.HasNextPage {
+			break
+		}
+		endCursor := reviewThreads.PageInfo.EndCursor
+		cursor = &endCursor
+	}
+
+	const mutation = `mutation($threadID: ID!) {
+  resolveReviewThread(input: {threadId: $threadID}) { thread { id } }
+}`
+	for _, id := range threadsToResolve(threads, login, issues) {
+		if err := graphQL(ctx, client, mutation, map[string]interface{}{"threadID": id}, nil); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("could not resolve review thread %v", id))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-github/github"
+)
+
+func TestThreadsToResolve(t *testing.T) {
+	const login = "gopherci"
+
+	issues := []db.Issue{
+		{Path: "main.go", HunkPos: 1, Issue: "still present"},
+		{Path: "main.go", HunkPos: 5, Issue: "moved"},
+	}
+
+	tests := map[string]struct {
+		thread reviewThread
+		want   bool
+	}{
+		"present":              {reviewThread{Author: login, Path: "main.go", Position: github.Int(1), Body: "still present"}, false},
+		"present whitespace":   {reviewThread{Author: login, Path: "main.go", Position: github.Int(1), Body: "still present\n"}, false},
+		"fixed":                {reviewThread{Author: login, Path: "main.go", Position: github.Int(2), Body: "fixed"}, true},
+		"different position":   {reviewThread{Author: login, Path: "main.go", Position: github.Int(2), Body: "still present"}, true},
+		"different path":       {reviewThread{Author: login, Path: "other.go", Position: github.Int(1), Body: "still present"}, true},
+		"outdated present":     {reviewThread{Author: login, Path: "main.go", Position: nil, Body: "moved"}, false},
+		"outdated fixed":       {reviewThread{Author: login, Path: "main.go", Position: nil, Body: "fixed"}, true},
+		"already resolved":     {reviewThread{Author: login, Path: "main.go", Position: github.Int(2), Body: "fixed", IsResolved: true}, false},
+		"other author":         {reviewThread{Author: "user", Path: "main.go", Position: github.Int(2), Body: "fixed"}, false},
+		"other author present": {reviewThread{Author: "user", Path: "main.go", Position: github.Int(1), Body: "still present"}, false},
+	}
+
+	for desc, test := range tests {
+		test.thread.ID = desc
+		have := threadsToResolve([]reviewThread{test.thread}, login, issues)
+		if resolved := len(have) == 1; resolved != test.want {
+			t.Errorf("%v: resolved have: %v, want: %v", desc, resolved, test.want)
+		}
+	}
+
+	// Unknown login never resolves
+	thread := reviewThread{ID: "1", Path: "main.go", Position: github.Int(2), Body: "fixed"}
+	if have := threadsToResolve([]reviewThread{thread}, "", issues); have != nil {
+		t.Errorf("unknown login have: %v, want: nil", have)
+	}
+}
+
+func TestResolveFixedThreads(t *testing.T) {
+	var resolved []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI != "/graphql" {
+			t.Fatalf("unexpected request: %v", r.RequestURI)
+		}
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		switch {
+		case strings.HasPrefix(req.Query, "query") && req.Variables["cursor"] == nil:
+			fmt.Fprintln(w, `{"data": {
+  "viewer": {"login": "gopherci"},
+  "repository": {"pullRequest": {"reviewThreads": {"pageInfo": {"hasNextPage": true, "endCursor": "C1"}, "nodes": [
+    {"id": "T1", "isResolved": false, "comments": {"nodes": [{"author": {"login": "gopherci"}, "path": "main.go", "position": 1, "body": "present"}]}},
+    {"id": "T2", "isResolved": false, "comments": {"nodes": [{"author": {"login": "gopherci"}, "path": "main.go", "position": 2, "body": "fixed"}]}},
+    {"id": "T3", "isResolved": false, "comments": {"nodes": [{"author": {"login": "user"}, "path": "main.go", "position": 3, "body": "review"}]}}
+  ]}}}
+}}`)
+		case strings.HasPrefix(req.Query, "query") && req.Variables["cursor"] == "C1":
+			fmt.Fprintln(w, `{"data": {
+  "viewer": {"login": "gopherci"},
+  "repository": {"pullRequest": {"reviewThreads": {"pageInfo": {"hasNextPage": false, "endCursor": "C2"}, "nodes": [
+    {"id": "T4", "isResolved": false, "comments": {"nodes": [{"author": {"login": "gopherci"}, "path": "main.go", "position": 4, "body": "fixed"}]}}
+  ]}}}
+}}`)
+		case strings.HasPrefix(req.Query, "mutation"):
+			resolved = append(resolved, req.Variables["threadID"].(string))
+			fmt.Fprintln(w, `{"data": {"resolveReviewThread": {"thread": {"id": "T2"}}}}`)
+		default:
+			t.Fatalf("unexpected query: %v, variables: %v", req.Query, req.Variables)
+		}
+	}))
+	defer ts.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(ts.URL)
+
+	issues := []db.Issue{{Path: "main.go", HunkPos: 1, Issue: "present"}}
+	if err := resolveFixedThreads(context.Background(), client, "owner", "repo", 2, issues); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"T2", "T4"}; !reflect.DeepEqual(resolved, want) {
+		t.Errorf("resolved have: %v, want: %v", resolved, want)
+	}
+}
+
+func TestResolveFixedThreads_graphQLError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"errors": [{"message": "not permitted"}]}`)
+	}))
+	defer ts.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(ts.URL)
+
+	err := resolveFixedThreads(context.Background(), client, "owner", "repo", 2, nil)
+	if err == nil || !strings.Contains(err.Error(), "not permitted") {
+		t.Errorf("have error: %v, want graphql error", err)
+	}
+}
+
+func TestGraphQLURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"https://api.github.com/", "https://api.github.com/graphql"},
+		{"https://github.example.com/api/v3/", "https://github.example.com/api/graphql"},
+		{"http://127.0.0.1:8080", "http://127.0.0.1:8080/graphql"},
+	}
+	for _, test := range tests {
+		baseURL, err := url.Parse(test.baseURL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if have := graphQLURL(baseURL); have != test.want {
+			t.Errorf("graphQLURL(%q) have: %q, want: %q", test.baseURL, have, test.want)
+		}
+	}
+}
+
+func TestIsAppUser(t *testing.T) {
+	tests := []struct {
+		user  *github.User
+		login string
+		want  bool
+	}{
+		{&github.User{Login: github.String("gopherci[bot]"), Type: github.String("Bot")}, "gopherci", true},
+		{&github.User{Login: github.String("gopherci[bot]"), Type: github.String("Bot")}, "gopherci[bot]", true},
+		{&github.User{Login: github.String("other[bot]"), Type: github.String("Bot")}, "gopherci", false},
+		{&github.User{Login: github.String("gopherci"), Type: github.String("User")}, "gopherci", false},
+		{&github.User{Login: github.String("gopherci[bot]"), Type: github.String("Bot")}, "", false},
+		{nil, "gopherci", false},
+	}
+	for _, test := range tests {
+		if have := isAppUser(test.user, test.login); have != test.want {
+			t.Errorf("user: %v login: %q have: %v, want: %v", test.user, test.login, have, test.want)
+		}
+	}
+}
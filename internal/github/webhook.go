@@ -0,0 +1,160 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/pkg/errors"
+)
+
+// WebhookSignatureHeader is the header of a result webhook containing the
+// HMAC SHA256 hex digest of the payload, prefixed by sha256=, using the
+// webhook's secret as the key.
+const WebhookSignatureHeader = "X-GopherCI-Signature"
+
+// resultWebhookTimeout is the maximum time to send a result webhook, so an
+// unresponsive receiver does not hold up the analysis's queue worker.
+const resultWebhookTimeout = 10 * time.Second
+
+// ResultWebhook is an outgoing webhook receiving the results of analyses.
+type ResultWebhook struct {
+	URL    string // URL is POSTed each analysis's results.
+	Secret []byte // Secret is the key used to sign payloads.
+}
+
+// WebhookReporter is a analyser.Reporter that POSTs an analysis and its
+// issues as JSON to a ResultWebhook, signing the payload so the receiver can
+// verify it was sent by GopherCI.
+type WebhookReporter struct {
+	client         *http.Client
+	hook           ResultWebhook
+	owner          string
+	repo           string
+	installationID int
+	analysis       *db.Analysis
+	analysisURL    string
+	issueTools     map[db.Issue]string // issueTools are the names of the tools which found each issue
+}
+
+var _ analyser.Reporter = &WebhookReporter{}
+
+// NewWebhookReporter returns a WebhookReporter reporting analysis of the
+// owner's repo for the GitHub installationID. issueTools are the names of the
+// tools which found each issue, may be nil.
+func NewWebhookReporter(client *http.Client, hook ResultWebhook, owner, repo string, installationID int, analysis *db.Analysis, analysisURL string, issueTools map[db.Issue]string) *WebhookReporter {
+	return &WebhookReporter{
+		client:         client,
+		hook:           hook,
+		owner:          owner,
+		repo:           repo,
+		installationID: installationID,
+		analysis:       analysis,
+		analysisURL:    analysisURL,
+		issueTools:     issueTools,
+	}
+}
+
+// webhookPayload is the JSON document POSTed to a ResultWebhook.
+type webhookPayload struct {
+	Analysis webhookAnalysis `json:"analysis"`
+	Issues   []webhookIssue  `json:"issues"`
+}
+
+// webhookAnalysis is the analysis of a webhookPayload.
+type webhookAnalysis struct {
+	ID             int                `json:"id"`
+	URL            string             `json:"url"`
+	InstallationID int                `json:"installation_id"`
+	Owner          string             `json:"owner"`
+	Repo           string             `json:"repo"`
+	Trigger        db.AnalysisTrigger `json:"trigger,omitempty"`
+	CommitFrom     string             `json:"commit_from,omitempty"`
+	CommitTo       string             `json:"commit_to,omitempty"`
+	RequestNumber  int                `json:"request_number,omitempty"`
+	Branch         string             `json:"branch,omitempty"`
+	Author         string             `json:"author,omitempty"`
+	Duration       float64            `json:"duration"` // Duration is the analysis's duration in seconds.
+}
+
+// webhookIssue is an issue of a webhookPayload.
+type webhookIssue struct {
+	Tool     string `json:"tool,omitempty"`
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	EndLine  int    `json:"end_line,omitempty"`
+	Issue    string `json:"issue"`
+	Severity string `json:"severity,omitempty"`
+}
+
+// Report implements the analyser.Reporter interface.
+func (r *WebhookReporter) Report(ctx context.Context, issues []db.Issue) error {
+	payload := webhookPayload{
+		Analysis: webhookAnalysis{
+			ID:             r.analysis.ID,
+			URL:            r.analysisURL,
+			InstallationID: r.installationID,
+			Owner:          r.owner,
+			Repo:           r.repo,
+			Trigger:        r.analysis.Trigger,
+			CommitFrom:     r.analysis.CommitFrom,
+			CommitTo:       r.analysis.CommitTo,
+			RequestNumber:  r.analysis.RequestNumber,
+			Branch:         r.analysis.Branch,
+			Author:         r.analysis.Author,
+			Duration:       time.Duration(r.analysis.TotalDuration).Seconds(),
+		},
+		Issues: []webhookIssue{}, // encode no issues as an empty list, not null
+	}
+	for _, issue := range issues {
+		payload.Issues = append(payload.Issues, webhookIssue{
+			Tool:     r.issueTools[issue],
+			Path:     issue.Path,
+			Line:     issue.Line,
+			Column:   issue.Column,
+			EndLine:  issue.EndLine,
+			Issue:    issue.Issue,
+			Severity: issue.Severity,
+		})
+	}
+
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal webhook payload")
+	}
+
+	req, err := http.NewRequest("POST", r.hook.URL, bytes.NewReader(js))
+	if err != nil {
+		return errors.Wrap(err, "could not make webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GopherCI")
+	req.Header.Set(WebhookSignatureHeader, signPayload(r.hook.Secret, js))
+
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "could not send webhook")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("received status code %d from webhook", resp.StatusCode)
+	}
+	return nil
+}
+
+// signPayload returns the value of the WebhookSignatureHeader for payload.
+func signPayload(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package github
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebhookReporter_report(t *testing.T) {
+	var (
+		secret = []byte("secret")
+		have   []byte
+		sig    string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if have := r.Header.Get("Content-Type"); have != "application/json" {
+			t.Errorf("content type have: %q, want: application/json", have)
+		}
+		var err error
+		if have, err = ioutil.ReadAll(r.Body); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sig = r.Header.Get(WebhookSignatureHeader)
+	}))
+	defer ts.Close()
+
+	analysis := db.NewAnalysis()
+	analysis.ID = 1
+	analysis.Trigger = db.AnalysisTriggerPullRequest
+	analysis.CommitTo = "abcdef"
+	analysis.RequestNumber = 2
+	analysis.Branch = "feature"
+	analysis.TotalDuration = db.Duration(90 * time.Second)
+
+	issues := []db.Issue{
+		{Path: "main.go", Line: 1, Column: 2, Issue: "exported func Foo should have comment", Severity: "warning"},
+		{Path: "db.go", Line: 9, EndLine: 11, Issue: "G201: SQL string formatting"},
+	}
+	issueTools := map[db.Issue]string{issues[0]: "golint"}
+
+	r := NewWebhookReporter(ts.Client(), ResultWebhook{URL: ts.URL, Secret: secret}, "owner", "repo", 3, analysis, "https://example.com/analysis/1", issueTools)
+	if err := r.Report(context.Background(), issues); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(have)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); sig != want {
+		t.Errorf("signature have: %q, want: %q", sig, want)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(have, &payload); err != nil {
+		t.Fatalf("could not unmarshal payload %s: %v", have, err)
+	}
+	want := map[string]interface{}{
+		"analysis": map[string]interface{}{
+			"id":              1.0,
+			"url":             "https://example.com/analysis/1",
+			"installation_id": 3.0,
+			"owner":           "owner",
+			"repo":            "repo",
+			"trigger":         "pull_request",
+			"commit_to":       "abcdef",
+			"request_number":  2.0,
+			"branch":          "feature",
+			"duration":        90.0,
+		},
+		"issues": []interface{}{
+			map[string]interface{}{
+				"tool":     "golint",
+				"path":     "main.go",
+				"line":     1.0,
+				"column":   2.0,
+				"issue":    "exported func Foo should have comment",
+				"severity": "warning",
+			},
+			map[string]interface{}{
+				"path":     "db.go",
+				"line":     9.0,
+				"end_line": 11.0,
+				"issue":    "G201: SQL string formatting",
+			},
+		},
+	}
+	if diff := cmp.Diff(payload, want); diff != "" {
+		t.Errorf("unexpected payload (-have +want)\n%s", diff)
+	}
+}
+
+func TestWebhookReporter_reportError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	r := NewWebhookReporter(ts.Client(), ResultWebhook{URL: ts.URL}, "owner", "repo", 3, db.NewAnalysis(), "", nil)
+	if err := r.Report(context.Background(), nil); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -5,11 +5,13 @@
 package logger
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"time"
 
 	"github.com/evalphobia/logrus_sentry"
+	"github.com/getsentry/raven-go"
 	"github.com/sirupsen/logrus"
 )
 
@@ -23,6 +25,10 @@ type Logger interface {
 	Info(args ...interface{})
 	Infof(format string, args ...interface{})
 
+	// Warn logs unexpected events that were handled, but may need attention.
+	Warn(args ...interface{})
+	Warnf(format string, args ...interface{})
+
 	// Error logs, errors. An error should only be logged once.
 	Error(args ...interface{})
 	Errorf(format string, args ...interface{})
@@ -35,13 +41,28 @@ type Logger interface {
 	With(name string, value interface{}) Logger
 }
 
+// InstallationKey is the context key of a GitHub installation's ID. Errors
+// logged with this context are tagged with the installation in Sentry, and
+// may be routed to the installation's own Sentry project, see New.
+const InstallationKey = "installationID"
+
+// sentryLevels are the levels sent to Sentry.
+var sentryLevels = []logrus.Level{
+	logrus.PanicLevel,
+	logrus.FatalLevel,
+	logrus.ErrorLevel,
+}
+
 // Log implements the Logger interface by wrapping logrus.
 type log struct {
 	logrus *logrus.Entry
 }
 
-// New constructs a new Logger.
-func New(out io.Writer, build, env, sentryDSN string) Logger {
+// New constructs a new Logger. If sentryDSN is set, errors are sent to Sentry.
+// sentryRoutes maps an installation ID to a Sentry DSN which receives errors
+// logged with the installation's context instead of sentryDSN, a blank DSN
+// disables sending the installation's errors to Sentry.
+func New(out io.Writer, build, env, sentryDSN string, sentryRoutes map[string]string) Logger {
 	logger := logrus.New()
 	logger.Out = out
 	switch env {
@@ -59,21 +80,27 @@ func New(out io.Writer, build, env, sentryDSN string) Logger {
 		ctxLogger = ctxLogger.WithField("server_name", hostname)
 	}
 
-	if sentryDSN != "" {
-		hook, err := logrus_sentry.NewSentryHook(sentryDSN, []logrus.Level{
-			logrus.PanicLevel,
-			logrus.FatalLevel,
-			logrus.ErrorLevel,
-		})
-		hook.SetEnvironment(env)
-		hook.SetRelease(build)
-		hook.StacktraceConfiguration.Enable = true
-		hook.StacktraceConfiguration.Level = logrus.ErrorLevel // defaults to panic
-		hook.Timeout = 1 * time.Second                         // 100ms default is often too low
-		if err != nil {
-			logger.WithError(err).Fatal("could not setup sentry logrus")
+	if sentryDSN != "" || len(sentryRoutes) > 0 {
+		router := &sentryRouter{routes: make(map[string]logrus.Hook)}
+		if sentryDSN != "" {
+			hook, err := newSentryHook(sentryDSN, build, env)
+			if err != nil {
+				logger.WithError(err).Fatal("could not setup sentry logrus")
+			}
+			router.fallback = hook
 		}
-		logger.Hooks.Add(hook)
+		for installationID, dsn := range sentryRoutes {
+			if dsn == "" {
+				router.routes[installationID] = nil // disabled
+				continue
+			}
+			hook, err := newSentryHook(dsn, build, env)
+			if err != nil {
+				logger.WithError(err).WithField(InstallationKey, installationID).Fatal("could not setup sentry logrus")
+			}
+			router.routes[installationID] = hook
+		}
+		logger.Hooks.Add(router)
 		ctxLogger.WithField("area", "logger").Info("enabled sentry")
 	}
 
@@ -82,9 +109,65 @@ func New(out io.Writer, build, env, sentryDSN string) Logger {
 	}
 }
 
+// newSentryHook returns a logrus hook sending errors to the Sentry dsn.
+func newSentryHook(dsn, build, env string) (logrus.Hook, error) {
+	hook, err := logrus_sentry.NewSentryHook(dsn, sentryLevels)
+	if err != nil {
+		return nil, err
+	}
+	hook.SetEnvironment(env)
+	hook.SetRelease(build)
+	hook.StacktraceConfiguration.Enable = true
+	hook.StacktraceConfiguration.Level = logrus.ErrorLevel // defaults to panic
+	hook.Timeout = 1 * time.Second                         // 100ms default is often too low
+	return hook, nil
+}
+
+// sentryRouter is a logrus hook which tags entries with their installation
+// and sends them to the installation's route, or the fallback if the
+// installation has no route.
+type sentryRouter struct {
+	fallback logrus.Hook            // fallback may be nil to not send entries.
+	routes   map[string]logrus.Hook // routes by installation ID, a nil hook disables sending.
+}
+
+// Levels implements the logrus.Hook interface.
+func (r *sentryRouter) Levels() []logrus.Level {
+	return sentryLevels
+}
+
+// Fire implements the logrus.Hook interface.
+func (r *sentryRouter) Fire(entry *logrus.Entry) error {
+	installationID, ok := entry.Data[InstallationKey]
+	if !ok {
+		if r.fallback == nil {
+			return nil
+		}
+		return r.fallback.Fire(entry)
+	}
+
+	id := fmt.Sprint(installationID)
+	hook, routed := r.routes[id]
+	if !routed {
+		hook = r.fallback
+	}
+	if hook == nil {
+		return nil
+	}
+
+	// Copy the entry so the tags aren't written to other hooks or the output.
+	tagged := *entry
+	tagged.Data = make(logrus.Fields, len(entry.Data)+1)
+	for k, v := range entry.Data {
+		tagged.Data[k] = v
+	}
+	tagged.Data["tags"] = raven.Tags{{Key: InstallationKey, Value: id}}
+	return hook.Fire(&tagged)
+}
+
 // Testing returns a logger for use in tests.
 func Testing() Logger {
-	return New(os.Stdout, "", "testing", "")
+	return New(os.Stdout, "", "testing", "", nil)
 }
 
 // Debug implements the Logger interface.
@@ -107,6 +190,16 @@ func (l *log) Infof(format string, args ...interface{}) {
 	l.logrus.Infof(format, args...)
 }
 
+// Warn implements the Logger interface.
+func (l *log) Warn(args ...interface{}) {
+	l.logrus.Warn(args...)
+}
+
+// Warnf implements the Logger interface.
+func (l *log) Warnf(format string, args ...interface{}) {
+	l.logrus.Warnf(format, args...)
+}
+
 // Error implements the Logger interface.
 func (l *log) Error(args ...interface{}) {
 	l.logrus.Error(args...)
@@ -2,8 +2,13 @@ package logger
 
 import (
 	"bytes"
+	"io/ioutil"
+	"reflect"
 	"regexp"
 	"testing"
+
+	"github.com/getsentry/raven-go"
+	"github.com/sirupsen/logrus"
 )
 
 func TestLogger(t *testing.T) {
@@ -12,6 +17,8 @@ func TestLogger(t *testing.T) {
 time="" level=debug msg="debugf arg" logger=gci server_name= 
 time="" level=info msg=infoarg logger=gci server_name= 
 time="" level=info msg="infof arg" logger=gci server_name= 
+time="" level=warning msg=warnarg logger=gci server_name= 
+time="" level=warning msg="warnf arg" logger=gci server_name= 
 time="" level=error msg=errorarg logger=gci server_name= 
 time="" level=error msg="errorf arg" logger=gci server_name= 
 time="" level=info msg=context key=value logger=gci server_name= 
@@ -19,6 +26,8 @@ time="" level=info msg=context key=value logger=gci server_name=
 
 	wantProduction := `{"level":"info","logger":"gci","msg":"infoarg","server_name":"","time":""}
 {"level":"info","logger":"gci","msg":"infof arg","server_name":"","time":""}
+{"level":"warning","logger":"gci","msg":"warnarg","server_name":"","time":""}
+{"level":"warning","logger":"gci","msg":"warnf arg","server_name":"","time":""}
 {"level":"error","logger":"gci","msg":"errorarg","server_name":"","time":""}
 {"level":"error","logger":"gci","msg":"errorf arg","server_name":"","time":""}
 {"key":"value","level":"info","logger":"gci","msg":"context","server_name":"","time":""}
@@ -35,7 +44,7 @@ time="" level=info msg=context key=value logger=gci server_name=
 	for desc, test := range tests {
 		var out bytes.Buffer
 
-		l := New(&out, "buildabc", test.env, "")
+		l := New(&out, "buildabc", test.env, "", nil)
 
 		l.Debug("debug", "arg")
 		l.Debugf("debugf %s", "arg")
@@ -43,6 +52,9 @@ time="" level=info msg=context key=value logger=gci server_name=
 		l.Info("info", "arg")
 		l.Infof("infof %s", "arg")
 
+		l.Warn("warn", "arg")
+		l.Warnf("warnf %s", "arg")
+
 		l.Error("error", "arg")
 		l.Errorf("errorf %s", "arg")
 
@@ -59,3 +71,79 @@ time="" level=info msg=context key=value logger=gci server_name=
 		}
 	}
 }
+
+// recordingHook is a logrus hook which records fired entries.
+type recordingHook struct {
+	entries []*logrus.Entry
+}
+
+func (h *recordingHook) Levels() []logrus.Level { return sentryLevels }
+
+func (h *recordingHook) Fire(entry *logrus.Entry) error {
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func TestSentryRouter(t *testing.T) {
+	var (
+		fallback = &recordingHook{}
+		routed   = &recordingHook{}
+	)
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Hooks.Add(&sentryRouter{
+		fallback: fallback,
+		routes: map[string]logrus.Hook{
+			"2": routed,
+			"3": nil, // disabled
+		},
+	})
+	var l Logger = &log{logrus: logger.WithField("logger", "gci")}
+
+	l.Error("global")
+	l.With(InstallationKey, 1).With("area", "github").Error("unrouted")
+	l.With(InstallationKey, 2).Error("routed")
+	l.With(InstallationKey, 3).Error("disabled")
+	l.With(InstallationKey, 2).Info("not an error")
+
+	if len(fallback.entries) != 2 {
+		t.Fatalf("fallback have %v entries, want 2", len(fallback.entries))
+	}
+	if _, ok := fallback.entries[0].Data["tags"]; ok {
+		t.Errorf("global entry has tags: %v", fallback.entries[0].Data)
+	}
+	if have, want := fallback.entries[1].Data["tags"], (raven.Tags{{Key: InstallationKey, Value: "1"}}); !reflect.DeepEqual(have, want) {
+		t.Errorf("unrouted tags have: %v, want: %v", have, want)
+	}
+	if have, want := fallback.entries[1].Data["area"], "github"; have != want {
+		t.Errorf("unrouted area have: %v, want: %v", have, want)
+	}
+
+	if len(routed.entries) != 1 {
+		t.Fatalf("routed have %v entries, want 1", len(routed.entries))
+	}
+	if have, want := routed.entries[0].Message, "routed"; have != want {
+		t.Errorf("routed message have: %q, want: %q", have, want)
+	}
+	if have, want := routed.entries[0].Data["tags"], (raven.Tags{{Key: InstallationKey, Value: "2"}}); !reflect.DeepEqual(have, want) {
+		t.Errorf("routed tags have: %v, want: %v", have, want)
+	}
+}
+
+func TestSentryRouter_noFallback(t *testing.T) {
+	routed := &recordingHook{}
+	router := &sentryRouter{routes: map[string]logrus.Hook{"2": routed}}
+
+	for _, data := range []logrus.Fields{{}, {InstallationKey: 1}, {InstallationKey: 2}} {
+		entry := &logrus.Entry{Data: data, Level: logrus.ErrorLevel}
+		if err := router.Fire(entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := data["tags"]; ok {
+			t.Errorf("original entry was modified: %v", data)
+		}
+	}
+	if len(routed.entries) != 1 {
+		t.Errorf("routed have %v entries, want 1", len(routed.entries))
+	}
+}
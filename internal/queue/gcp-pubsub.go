@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"strconv"
 	"sync"
 	"time"
 
@@ -32,21 +33,71 @@ const (
 	version          = "1"
 	defaultSubName   = "worker"
 	defaultTopicName = "gopherci-ci"
+	deadLetterSuffix = "-dead-letter"
+
+	// attemptAttr is the message attribute containing the job's attempt
+	// number, starting at 1. It's stored in the message, rather than by the
+	// subscriber, so it's kept when the job is retried by another subscriber.
+	attemptAttr = "attempt"
+	// maxDeliveryAttempts is the number of times a job which fails
+	// transiently is processed before it's considered poison and moved to the
+	// dead letter topic.
+	maxDeliveryAttempts = 5
+	// maxProcessingTime is the maximum time a job's ack deadline is extended
+	// while it's processing, after which it may be redelivered.
+	maxProcessingTime = 30 * time.Minute
 )
 
 // GCPPubSubQueue is a queue using Google Compute Platform's PubSub product.
 type GCPPubSubQueue struct {
-	logger       logger.Logger
-	topic        *pubsub.Topic
-	subscription *pubsub.Subscription
+	logger          logger.Logger
+	topic           *pubsub.Topic
+	deadLetterTopic *pubsub.Topic // deadLetterTopic receives jobs which repeatedly failed
+	subscription    *pubsub.Subscription
+	receiver        receiver // receiver receives from the subscription, replaced in tests
+
+	// Pause pauses receiving jobs, which remain in the subscription until
+	// resumed. Optional, may be set after New and before use.
+	Pause *Pause
+
+	// deadLetter publishes a poison message's data, replaced in tests.
+	deadLetter func(ctx context.Context, data []byte) error
+	// retry publishes a failed message's data as the next attempt, replaced
+	// in tests.
+	retry func(ctx context.Context, data []byte, attempt int) error
+}
+
+// message is a received Pub/Sub message which can be acknowledged,
+// implemented by *pubsub.Message.
+type message interface {
+	// Ack acknowledges the message, so it will not be redelivered.
+	Ack()
+	// Nack indicates the message could not be processed, so it will be
+	// redelivered.
+	Nack()
+}
+
+// receiver receives messages, implemented by *pubsub.Subscription.
+type receiver interface {
+	// Receive calls f with each message received until ctx is done.
+	Receive(ctx xContext.Context, f func(xContext.Context, *pubsub.Message)) error
 }
 
 var cxnTimeout = 15 * time.Second
 
+// retryBackoff is the delay before a job which failed transiently on its
+// first attempt is retried, doubling for each later attempt, so retries
+// outlast short outages.
+var retryBackoff = 30 * time.Second
+
 // NewGCPPubSubQueue creates connects to Google Pub/Sub with a topic and
-// subscriber in a one-to-one architecture.
-func NewGCPPubSubQueue(ctx context.Context, logger logger.Logger, projectID, topicName string) (*GCPPubSubQueue, error) {
+// subscriber in a one-to-one architecture. Each subscriber processes up to
+// maxOutstanding jobs concurrently, values less than 1 process one job at a
+// time.
+func NewGCPPubSubQueue(ctx context.Context, logger logger.Logger, projectID, topicName string, maxOutstanding int) (*GCPPubSubQueue, error) {
 	q := &GCPPubSubQueue{logger: logger}
+	q.deadLetter = q.publishDeadLetter
+	q.retry = q.publishRetry
 
 	if projectID == "" {
 		return nil, errors.New("projectID must not be empty")
@@ -73,6 +124,12 @@ func NewGCPPubSubQueue(ctx context.Context, logger logger.Logger, projectID, top
 		return nil, errors.Wrap(err, "could not create topic")
 	}
 
+	logger.Infof("creating topic %q", topicName+deadLetterSuffix)
+	q.deadLetterTopic, err = client.CreateTopic(cxnCtx, topicName+deadLetterSuffix)
+	if code := grpc.Code(err); code != codes.OK && code != codes.AlreadyExists {
+		return nil, errors.Wrap(err, "could not create dead letter topic")
+	}
+
 	subName := topicName + "-" + defaultSubName
 
 	logger.Infof("creating subscription %q", subName)
@@ -84,16 +141,34 @@ func NewGCPPubSubQueue(ctx context.Context, logger logger.Logger, projectID, top
 		return nil, errors.Wrap(err, "could not create subscription")
 	}
 
-	q.subscription.ReceiveSettings.MaxOutstandingMessages = 1 // limit concurrency
+	setReceiveSettings(&q.subscription.ReceiveSettings, maxOutstanding)
+	q.receiver = q.subscription
 
 	return q, nil
 }
 
+// setReceiveSettings limits the concurrency of a subscriber to maxOutstanding
+// jobs, or one if maxOutstanding is less than 1.
+func setReceiveSettings(settings *pubsub.ReceiveSettings, maxOutstanding int) {
+	if maxOutstanding < 1 {
+		maxOutstanding = 1
+	}
+	settings.MaxOutstandingMessages = maxOutstanding // limit concurrency
+	// Jobs are only acknowledged after they've been processed, so extend the
+	// ack deadline while processing to prevent redelivery.
+	settings.MaxExtension = maxProcessingTime
+}
+
 // Wait waits for messages on queuePush and adds them to the Pub/Sub queue.
 // Upon receiving messages from Pub/Sub, f is invoked with the message. Wait
 // is non-blocking, increments wg for each routine started, and when context
 // is closed will mark the wg as done as routines are shutdown.
-func (q GCPPubSubQueue) Wait(ctx context.Context, wg *sync.WaitGroup, queuePush <-chan interface{}, f func(interface{})) {
+//
+// Messages are only acknowledged after f has processed them, if the process
+// crashes, the message is redelivered. If f returns a transient error, see
+// Transient, the job is retried up to maxDeliveryAttempts times, other errors
+// are not retried. Jobs which aren't retried are moved to a dead letter topic.
+func (q *GCPPubSubQueue) Wait(ctx context.Context, wg *sync.WaitGroup, queuePush <-chan interface{}, f func(interface{}) error) {
 	// Routine to add jobs to the GCP Pub/Sub Queue
 	wg.Add(1)
 	go func() {
@@ -102,6 +177,7 @@ func (q GCPPubSubQueue) Wait(ctx context.Context, wg *sync.WaitGroup, queuePush
 			case <-ctx.Done():
 				q.logger.Info("job waiter exiting")
 				q.topic.Stop()
+				q.deadLetterTopic.Stop()
 				wg.Done()
 				return
 			case job := <-queuePush:
@@ -113,7 +189,7 @@ func (q GCPPubSubQueue) Wait(ctx context.Context, wg *sync.WaitGroup, queuePush
 		}
 	}()
 
-	// Routine to listen for jobs and process one at a time
+	// Routine to listen for jobs and process up to maxOutstanding at a time
 	wg.Add(1)
 	go func() {
 		q.receive(ctx, f)
@@ -131,7 +207,7 @@ func (q *GCPPubSubQueue) queue(ctx context.Context, job interface{}) error {
 	}
 
 	var (
-		msg         = &pubsub.Message{Data: buf.Bytes()}
+		msg         = &pubsub.Message{Data: buf.Bytes(), Attributes: attemptAttrs(1)}
 		maxAttempts = 3
 		msgID       string
 		err         error
@@ -157,33 +233,183 @@ type container struct {
 	Job interface{}
 }
 
-// receive calls sub.Receive, which blocks forever waiting for new jobs.
-func (q *GCPPubSubQueue) receive(ctx context.Context, f func(interface{})) {
-	err := q.subscription.Receive(ctx, func(ctx xContext.Context, msg *pubsub.Message) {
-		logger := q.logger.With("messageID", msg.ID)
+// receive calls Receive, which blocks forever waiting for new jobs. While
+// paused, Receive is stopped, after the jobs processing have completed, so
+// unacknowledged jobs remain in the subscription.
+func (q *GCPPubSubQueue) receive(ctx context.Context, f func(interface{}) error) {
+	for ctx.Err() == nil {
+		paused, changed := q.Pause.state()
+		if paused {
+			q.logger.Info("paused, waiting to resume receiving")
+			select {
+			case <-ctx.Done():
+			case <-changed:
+			}
+			continue
+		}
 
-		logger.With("publishTime", msg.PublishTime).Info("processing job published")
+		// Stop receiving if paused.
+		receiveCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-changed:
+			case <-receiveCtx.Done():
+			}
+			cancel()
+		}()
+		err := q.receiver.Receive(receiveCtx, func(ctx xContext.Context, msg *pubsub.Message) {
+			q.logger.With("messageID", msg.ID).With("publishTime", msg.PublishTime).Info("processing job published")
+			q.process(ctx, msg.ID, messageAttempt(msg.Attributes), msg.Data, msg, f)
+		})
+		cancel()
+		if err != nil && err != context.Canceled {
+			q.logger.With("error", err).Error("could not receive on subscription")
+			return
+		}
+	}
+}
 
-		// Acknowledge the job now, anything else that could fail by this instance
-		// will probably fail for others.
-		msg.Ack()
-		logger.Info("acknowledged job")
+// attemptAttrs returns the attributes of a message for attempt.
+func attemptAttrs(attempt int) map[string]string {
+	return map[string]string{attemptAttr: strconv.Itoa(attempt)}
+}
 
-		reader := bytes.NewReader(msg.Data)
-		dec := gob.NewDecoder(reader)
+// messageAttempt returns the attempt number from a message's attributes,
+// messages without a valid attempt are the first attempt.
+func messageAttempt(attrs map[string]string) int {
+	attempt, err := strconv.Atoi(attrs[attemptAttr])
+	if err != nil || attempt < 1 {
+		return 1
+	}
+	return attempt
+}
 
-		var job container
-		if err := dec.Decode(&job); err != nil {
-			logger.With("error", err).Errorf("could not decode job")
+// process decodes and processes a single message with f, which is the
+// attempt'th attempt to process the job. If f fails transiently, and it's not
+// the last attempt, the job is published as the next attempt after
+// retryDelay. Messages that
+// cannot be decoded, fail permanently, or have failed maxDeliveryAttempts
+// times, are dead lettered.
+func (q *GCPPubSubQueue) process(ctx context.Context, id string, attempt int, data []byte, msg message, f func(interface{}) error) {
+	logger := q.logger.With("messageID", id).With("attempt", attempt)
+
+	var job container
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&job); err != nil {
+		logger.With("error", err).Errorf("could not decode job")
+		q.poison(ctx, id, data, msg)
+		return
+	}
+	logger.Info("processing")
+
+	if err := f(job.Job); err != nil {
+		if !temporary(err) {
+			logger.With("error", err).Info("failed processing job permanently")
+			q.poison(ctx, id, data, msg)
+			return
+		}
+		logger.With("error", err).Infof("failed processing job attempt %v of %v", attempt, maxDeliveryAttempts)
+		if attempt >= maxDeliveryAttempts {
+			q.poison(ctx, id, data, msg)
 			return
 		}
-		logger.Info("processing")
+		// Nacking would redeliver the message with the same attempt, so the
+		// next attempt is published, and this one acknowledged. If it could
+		// not be published, this attempt is redelivered.
+		delay := time.NewTimer(retryDelay(attempt))
+		select {
+		case <-ctx.Done():
+			delay.Stop()
+			logger.Info("stopped before retrying job")
+			msg.Nack()
+			return
+		case <-delay.C:
+		}
+		if err := q.retry(ctx, data, attempt+1); err != nil {
+			logger.With("error", err).Error("could not retry job")
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+		return
+	}
 
-		f(job.Job)
-	})
-	if err != nil && err != context.Canceled {
-		q.logger.With("error", err).Error("could not receive on subscription")
+	msg.Ack()
+	logger.Info("acknowledged job")
+}
+
+// retryDelay returns the delay before retrying a job which failed
+// transiently on its attempt'th attempt.
+func retryDelay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	return retryBackoff << uint(attempt-1)
+}
+
+// poison moves a message that can never be processed to the dead letter
+// topic, and acknowledges it. If the message could not be dead lettered, it
+// will be redelivered.
+func (q *GCPPubSubQueue) poison(ctx context.Context, id string, data []byte, msg message) {
+	logger := q.logger.With("messageID", id)
+	if err := q.deadLetter(ctx, data); err != nil {
+		logger.With("error", err).Error("could not dead letter job")
+		msg.Nack()
+		return
+	}
+	msg.Ack()
+	logger.Error("dead lettered job")
+}
+
+// publishDeadLetter publishes data to the dead letter topic.
+func (q *GCPPubSubQueue) publishDeadLetter(ctx context.Context, data []byte) error {
+	res := q.deadLetterTopic.Publish(ctx, &pubsub.Message{Data: data})
+	_, err := res.Get(ctx)
+	return errors.Wrap(err, "could not publish to dead letter topic")
+}
+
+// publishRetry publishes data to the topic as the attempt'th attempt.
+func (q *GCPPubSubQueue) publishRetry(ctx context.Context, data []byte, attempt int) error {
+	res := q.topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: attemptAttrs(attempt)})
+	_, err := res.Get(ctx)
+	return errors.Wrap(err, "could not publish retry")
+}
+
+// Transient marks err as a transient failure to process a job, such as a
+// timeout, which may succeed if the job is retried. Errors which aren't
+// transient are not retried.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{err}
+}
+
+// transientError is an error marked by Transient.
+type transientError struct {
+	error
+}
+
+// Temporary returns true, as used by net.Error.
+func (transientError) Temporary() bool { return true }
+
+// temporary returns true if err, or an error it wraps, has a Temporary method
+// returning true, such as those marked by Transient.
+func temporary(err error) bool {
+	for err != nil {
+		if t, ok := err.(interface {
+			Temporary() bool
+		}); ok && t.Temporary() {
+			return true
+		}
+		cause, ok := err.(interface {
+			Cause() error
+		})
+		if !ok {
+			return false
+		}
+		err = cause.Cause()
 	}
+	return false
 }
 
 // delete deletes the topic and subcriptions, used to cleanup unit tests.
@@ -203,4 +429,8 @@ func (q *GCPPubSubQueue) delete(ctx context.Context) {
 	if err != nil {
 		q.logger.With("error", err).Error("could not delete topic")
 	}
+	err = q.deadLetterTopic.Delete(ctx)
+	if err != nil {
+		q.logger.With("error", err).Error("could not delete dead letter topic")
+	}
 }
@@ -1,9 +1,11 @@
 package queue
 
 import (
+	"bytes"
 	"context"
 	"encoding/gob"
 	"fmt"
+	"net"
 	"reflect"
 	"sync"
 	"testing"
@@ -11,6 +13,9 @@ import (
 
 	"github.com/bradleyfalzon/gopherci/internal/logger"
 	"github.com/pkg/errors"
+	xContext "golang.org/x/net/context"
+
+	"cloud.google.com/go/pubsub"
 )
 
 // TODO read from .env
@@ -28,13 +33,14 @@ func TestGCPPubSubQueue(t *testing.T) {
 		topic       = fmt.Sprintf("%s-unit-tests-%v", defaultTopicName, time.Now().Unix())
 		have        interface{}
 	)
-	q, err := NewGCPPubSubQueue(ctx, logger.Testing(), projectID, topic)
+	q, err := NewGCPPubSubQueue(ctx, logger.Testing(), projectID, topic, 1)
 	if err != nil {
 		t.Fatal("unexpected error:", err)
 	}
 
-	f := func(job interface{}) {
+	f := func(job interface{}) error {
 		have = job
+		return nil
 	}
 
 	q.Wait(ctx, &wg, c, f)
@@ -77,10 +83,235 @@ func TestGCPPubSubQueue_timeout(t *testing.T) {
 		ctx   = context.Background()
 		topic = fmt.Sprintf("%s-unit-tests-%v", defaultTopicName, time.Now().Unix())
 	)
-	_, err := NewGCPPubSubQueue(ctx, logger.Testing(), projectID, topic)
+	_, err := NewGCPPubSubQueue(ctx, logger.Testing(), projectID, topic, 1)
 
 	have := errors.Cause(err)
 	if want := context.DeadlineExceeded; have != want {
 		t.Fatalf("have %v, want %v", have, want)
 	}
 }
+
+func TestSetReceiveSettings(t *testing.T) {
+	tests := map[int]int{
+		-1: 1,
+		0:  1,
+		1:  1,
+		8:  8,
+	}
+	for maxOutstanding, want := range tests {
+		var settings pubsub.ReceiveSettings
+		setReceiveSettings(&settings, maxOutstanding)
+		if settings.MaxOutstandingMessages != want {
+			t.Errorf("%v: max outstanding messages have: %v, want: %v", maxOutstanding, settings.MaxOutstandingMessages, want)
+		}
+		if settings.MaxExtension != maxProcessingTime {
+			t.Errorf("%v: max extension have: %v, want: %v", maxOutstanding, settings.MaxExtension, maxProcessingTime)
+		}
+	}
+}
+
+// mockMessage records the order of calls to process a message.
+type mockMessage struct {
+	calls *[]string
+}
+
+func (m mockMessage) Ack()  { *m.calls = append(*m.calls, "ack") }
+func (m mockMessage) Nack() { *m.calls = append(*m.calls, "nack") }
+
+func TestGCPPubSubQueue_process(t *testing.T) {
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(container{"job"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	var calls []string
+	q := &GCPPubSubQueue{
+		logger: logger.Testing(),
+		deadLetter: func(_ context.Context, data []byte) error {
+			calls = append(calls, "dead letter")
+			return nil
+		},
+		retry: func(_ context.Context, data []byte, attempt int) error {
+			calls = append(calls, fmt.Sprintf("retry %v", attempt))
+			return nil
+		},
+	}
+	msg := mockMessage{&calls}
+
+	var fErr error
+	f := func(job interface{}) error {
+		if job != "job" {
+			t.Errorf("have job: %v, want: %v", job, "job")
+		}
+		calls = append(calls, "process")
+		return fErr
+	}
+
+	// Acknowledged only after successful processing
+	q.process(context.Background(), "1", 1, buf.Bytes(), msg, f)
+	if want := []string{"process", "ack"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("success calls have: %v, want: %v", calls, want)
+	}
+
+	// Transient failures are retried as the next attempt until they're dead
+	// lettered
+	calls = nil
+	fErr = errors.Wrap(Transient(errors.New("failure")), "wrapped")
+	var want []string
+	for i := 1; i < maxDeliveryAttempts; i++ {
+		q.process(context.Background(), "2", i, buf.Bytes(), msg, f)
+		want = append(want, "process", fmt.Sprintf("retry %v", i+1), "ack")
+	}
+	q.process(context.Background(), "2", maxDeliveryAttempts, buf.Bytes(), msg, f)
+	want = append(want, "process", "dead letter", "ack")
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("transient failure calls have: %v, want: %v", calls, want)
+	}
+
+	// Permanent failures are dead lettered without retrying
+	calls = nil
+	fErr = errors.New("failure")
+	q.process(context.Background(), "3", 1, buf.Bytes(), msg, f)
+	if want := []string{"process", "dead letter", "ack"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("permanent failure calls have: %v, want: %v", calls, want)
+	}
+
+	// Attempts which could not be retried are redelivered
+	calls = nil
+	fErr = Transient(errors.New("failure"))
+	q.retry = func(context.Context, []byte, int) error {
+		calls = append(calls, "retry")
+		return errors.New("publish failure")
+	}
+	q.process(context.Background(), "4", 1, buf.Bytes(), msg, f)
+	if want := []string{"process", "retry", "nack"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("retry failure calls have: %v, want: %v", calls, want)
+	}
+
+	// Attempts stopped before they're retried are redelivered
+	calls = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.process(ctx, "4", 1, buf.Bytes(), msg, f)
+	if want := []string{"process", "nack"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("stopped retry calls have: %v, want: %v", calls, want)
+	}
+
+	// Undecodable jobs are dead lettered without processing
+	calls = nil
+	q.process(context.Background(), "5", 1, []byte("invalid"), msg, f)
+	if want := []string{"dead letter", "ack"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("invalid calls have: %v, want: %v", calls, want)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, retryBackoff},
+		{1, retryBackoff},
+		{2, 2 * retryBackoff},
+		{4, 8 * retryBackoff},
+	}
+	for _, test := range tests {
+		if have := retryDelay(test.attempt); have != test.want {
+			t.Errorf("attempt %v: have: %v, want: %v", test.attempt, have, test.want)
+		}
+	}
+}
+
+func TestMessageAttempt(t *testing.T) {
+	tests := []struct {
+		attrs map[string]string
+		want  int
+	}{
+		{nil, 1},
+		{map[string]string{}, 1},
+		{map[string]string{attemptAttr: "invalid"}, 1},
+		{map[string]string{attemptAttr: "0"}, 1},
+		{attemptAttrs(1), 1},
+		{attemptAttrs(3), 3},
+	}
+	for _, test := range tests {
+		if have := messageAttempt(test.attrs); have != test.want {
+			t.Errorf("%v: have: %v, want: %v", test.attrs, have, test.want)
+		}
+	}
+}
+
+func TestTemporary(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("permanent"), false},
+		{Transient(errors.New("transient")), true},
+		{errors.Wrap(Transient(errors.New("transient")), "wrapped"), true},
+		{&net.DNSError{IsTimeout: true}, true},
+		{errors.Wrap(&net.DNSError{}, "wrapped"), false},
+	}
+	for _, test := range tests {
+		if have := temporary(test.err); have != test.want {
+			t.Errorf("%v: have: %v, want: %v", test.err, have, test.want)
+		}
+	}
+	if Transient(nil) != nil {
+		t.Error("expected Transient(nil) to be nil")
+	}
+}
+
+// mockReceiver records when receiving starts and stops.
+type mockReceiver struct {
+	started, stopped chan struct{}
+}
+
+func (r *mockReceiver) Receive(ctx xContext.Context, f func(xContext.Context, *pubsub.Message)) error {
+	r.started <- struct{}{}
+	<-ctx.Done()
+	r.stopped <- struct{}{}
+	return nil
+}
+
+func TestGCPPubSubQueue_receivePaused(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		recv        = &mockReceiver{started: make(chan struct{}), stopped: make(chan struct{})}
+		done        = make(chan struct{})
+	)
+	q := &GCPPubSubQueue{logger: logger.Testing(), receiver: recv, Pause: &Pause{}}
+
+	// Paused before receiving
+	q.Pause.Pause()
+	go func() {
+		q.receive(ctx, func(interface{}) error { return nil })
+		close(done)
+	}()
+	select {
+	case <-recv.started:
+		t.Fatal("started receiving while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Resuming starts, and pausing stops, receiving
+	q.Pause.Resume()
+	<-recv.started
+	q.Pause.Pause()
+	<-recv.stopped
+	select {
+	case <-recv.started:
+		t.Fatal("started receiving while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.Pause.Resume()
+	<-recv.started
+
+	// Cancelling stops receiving
+	cancel()
+	<-recv.stopped
+	<-done
+}
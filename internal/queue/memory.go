@@ -10,8 +10,22 @@ import (
 
 const pollInterval = 500 * time.Millisecond
 
-// MemoryQueue is an in memory queue of infinite size.
+// MemoryQueue is an in memory queue of infinite size. Jobs are not persisted,
+// so jobs remaining in the queue when the process exits are lost, see
+// DrainTimeout.
 type MemoryQueue struct {
+	// DrainTimeout is the maximum duration to continue processing the jobs
+	// remaining in the queue once the context is cancelled. Jobs not started
+	// within DrainTimeout are dropped and logged. Optional, may be set after
+	// New and before use, defaults to dropping all remaining jobs.
+	DrainTimeout time.Duration
+
+	// Pause pauses processing of jobs, which remain in the queue until
+	// resumed. As jobs aren't persisted, jobs remaining in the queue on
+	// shutdown are drained even if paused. Optional, may be set after New and
+	// before use.
+	Pause *Pause
+
 	logger logger.Logger
 	mu     sync.Mutex // protects queue
 	queue  []interface{}
@@ -24,8 +38,9 @@ func NewMemoryQueue(logger logger.Logger) *MemoryQueue {
 
 // Wait waits for messages on queuePush and adds them to the queue. New
 // message are checked for regularly and when a new message is ready f
-// will be called with the argument of the job.
-func (q *MemoryQueue) Wait(ctx context.Context, wg *sync.WaitGroup, queuePush <-chan interface{}, f func(interface{})) {
+// will be called with the argument of the job. Jobs are not retried if f
+// returns an error.
+func (q *MemoryQueue) Wait(ctx context.Context, wg *sync.WaitGroup, queuePush <-chan interface{}, f func(interface{}) error) {
 	// Routine to add jobs to the queue
 	wg.Add(1)
 	go func() {
@@ -54,24 +69,68 @@ func (q *MemoryQueue) Wait(ctx context.Context, wg *sync.WaitGroup, queuePush <-
 }
 
 // receive polls the queue for new jobs and sends them on the pop channel.
-func (q *MemoryQueue) receive(ctx context.Context, f func(interface{})) {
+func (q *MemoryQueue) receive(ctx context.Context, f func(interface{}) error) {
 	ticker := time.NewTicker(pollInterval)
 	for {
 		select {
 		case <-ctx.Done():
 			q.logger.Info("listen stopping")
 			ticker.Stop()
+			q.drain(f)
 			return
 		case <-ticker.C:
-			if len(q.queue) == 0 {
+			if q.Pause.Paused() {
 				break
 			}
-			// queue the next item
-			var job interface{}
-			q.mu.Lock()
-			job, q.queue = q.queue[len(q.queue)-1], q.queue[:len(q.queue)-1]
-			q.mu.Unlock()
-			f(job)
+			job, ok := q.pop()
+			if !ok {
+				break
+			}
+			q.process(job, f)
+		}
+	}
+}
+
+// drain processes the jobs remaining in the queue until the queue is empty or
+// DrainTimeout has elapsed, when the remaining jobs are dropped. Jobs are
+// drained even if paused, as they would otherwise be lost.
+func (q *MemoryQueue) drain(f func(interface{}) error) {
+	if q.Pause.Paused() {
+		q.logger.Info("draining queued jobs while paused, as they're lost on shutdown")
+	}
+	deadline := time.Now().Add(q.DrainTimeout)
+	for time.Now().Before(deadline) {
+		job, ok := q.pop()
+		if !ok {
+			return
 		}
+		q.process(job, f)
+	}
+
+	q.mu.Lock()
+	dropped := len(q.queue)
+	q.queue = nil
+	q.mu.Unlock()
+	if dropped > 0 {
+		q.logger.Errorf("dropped %d queued jobs on shutdown", dropped)
+	}
+}
+
+// pop removes and returns the next job from the queue, ok is false if the
+// queue is empty.
+func (q *MemoryQueue) pop() (job interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.queue) == 0 {
+		return nil, false
+	}
+	job, q.queue = q.queue[len(q.queue)-1], q.queue[:len(q.queue)-1]
+	return job, true
+}
+
+// process calls f with job, logging any error.
+func (q *MemoryQueue) process(job interface{}, f func(interface{}) error) {
+	if err := f(job); err != nil {
+		q.logger.With("error", err).Error("could not process job")
 	}
 }
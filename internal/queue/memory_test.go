@@ -18,8 +18,9 @@ func TestMemoryQueue(t *testing.T) {
 	)
 	q := NewMemoryQueue(logger.Testing())
 
-	f := func(interface{}) {
+	f := func(interface{}) error {
 		haveJob = true
+		return nil
 	}
 
 	q.Wait(ctx, &wg, c, f)
@@ -34,3 +35,119 @@ func TestMemoryQueue(t *testing.T) {
 	}
 	cancel()
 }
+
+func TestMemoryQueue_drain(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		wg          sync.WaitGroup
+		processed   []interface{}
+	)
+	q := NewMemoryQueue(logger.Testing())
+	q.DrainTimeout = time.Minute
+	q.queue = []interface{}{1, 2, 3}
+
+	f := func(job interface{}) error {
+		processed = append(processed, job)
+		return nil
+	}
+
+	cancel()
+	q.Wait(ctx, &wg, make(chan interface{}), f)
+	wg.Wait()
+
+	if len(processed) != 3 {
+		t.Errorf("processed %v jobs, want 3: %v", len(processed), processed)
+	}
+	if len(q.queue) != 0 {
+		t.Errorf("queue not empty: %v", q.queue)
+	}
+}
+
+func TestMemoryQueue_drainTimeout(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		wg          sync.WaitGroup
+		processed   int
+	)
+	q := NewMemoryQueue(logger.Testing())
+	q.queue = []interface{}{1, 2, 3}
+
+	f := func(interface{}) error {
+		processed++
+		return nil
+	}
+
+	cancel()
+	q.Wait(ctx, &wg, make(chan interface{}), f)
+	wg.Wait()
+
+	if processed != 0 {
+		t.Errorf("processed %v jobs, want 0", processed)
+	}
+	if len(q.queue) != 0 {
+		t.Errorf("queue not empty: %v", q.queue)
+	}
+}
+
+func TestMemoryQueue_pause(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		wg          sync.WaitGroup
+		c           = make(chan interface{})
+		processed   = make(chan interface{}, 1)
+	)
+	q := NewMemoryQueue(logger.Testing())
+	q.Pause = &Pause{}
+	q.Pause.Pause()
+
+	q.Wait(ctx, &wg, c, func(job interface{}) error {
+		processed <- job
+		return nil
+	})
+	c <- 1
+
+	select {
+	case job := <-processed:
+		t.Fatalf("processed job %v while paused", job)
+	case <-time.After(pollInterval * 2):
+	}
+
+	q.Pause.Resume()
+	select {
+	case <-processed:
+	case <-time.After(pollInterval * 2):
+		t.Errorf("did not process job after resuming")
+	}
+	cancel()
+	wg.Wait()
+}
+
+func TestMemoryQueue_drainPaused(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		wg          sync.WaitGroup
+		processed   int
+	)
+	q := NewMemoryQueue(logger.Testing())
+	q.DrainTimeout = time.Minute
+	q.Pause = &Pause{}
+	q.Pause.Pause()
+	q.queue = []interface{}{1, 2}
+
+	f := func(interface{}) error {
+		processed++
+		return nil
+	}
+
+	cancel()
+	q.Wait(ctx, &wg, make(chan interface{}), f)
+	wg.Wait()
+
+	// Jobs aren't persisted, so they're drained rather than lost.
+	if processed != 2 {
+		t.Errorf("processed %v jobs while paused, want 2", processed)
+	}
+	if len(q.queue) != 0 {
+		t.Errorf("queue not empty: %v", q.queue)
+	}
+}
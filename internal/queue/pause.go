@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+)
+
+// Pause pauses the processing of a queue's jobs, such as during maintenance.
+// While paused, jobs are still added to the queue, and are processed once
+// resumed. Jobs already processing when paused are completed. The zero value
+// is not paused, and a nil Pause is never paused.
+type Pause struct {
+	mu      sync.Mutex    // protects paused and changed
+	paused  bool          // paused is true if processing is paused
+	changed chan struct{} // changed is closed and replaced when paused changes
+}
+
+// Pause pauses processing, it's a no-op if already paused.
+func (p *Pause) Pause() {
+	p.set(true)
+}
+
+// Resume resumes processing, it's a no-op if not paused.
+func (p *Pause) Resume() {
+	p.set(false)
+}
+
+// Paused returns true if processing is paused.
+func (p *Pause) Paused() bool {
+	paused, _ := p.state()
+	return paused
+}
+
+// set pauses or resumes processing, notifying waiters of any change.
+func (p *Pause) set(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused == paused {
+		return
+	}
+	p.paused = paused
+	if p.changed != nil {
+		close(p.changed)
+		p.changed = nil
+	}
+}
+
+// Watch pauses or resumes processing every interval as returned by paused,
+// until ctx is done, so a pause stored outside the process, such as in a
+// database, applies to every process. If paused returns an error, it's logged
+// and processing remains as it was.
+func (p *Pause) Watch(ctx context.Context, logger logger.Logger, interval time.Duration, paused func() (bool, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		switch stored, err := paused(); {
+		case err != nil:
+			logger.With("error", err).Error("could not get whether the queue is paused")
+		case stored != p.Paused():
+			logger.Infof("queue paused changed to %v", stored)
+			p.set(stored)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// state returns whether processing is paused, and a channel which is closed
+// when that changes. A nil Pause returns a nil channel, which never closes.
+func (p *Pause) state() (paused bool, changed <-chan struct{}) {
+	if p == nil {
+		return false, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.changed == nil {
+		p.changed = make(chan struct{})
+	}
+	return p.paused, p.changed
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+)
+
+func TestPause(t *testing.T) {
+	var p Pause
+	if p.Paused() {
+		t.Fatal("zero value is paused")
+	}
+
+	_, changed := p.state()
+	p.Pause()
+	if !p.Paused() {
+		t.Fatal("not paused after Pause")
+	}
+	select {
+	case <-changed:
+	default:
+		t.Fatal("pausing did not close changed")
+	}
+
+	_, changed = p.state()
+	p.Pause()
+	select {
+	case <-changed:
+		t.Fatal("pausing again closed changed")
+	default:
+	}
+
+	p.Resume()
+	if p.Paused() {
+		t.Fatal("paused after Resume")
+	}
+	select {
+	case <-changed:
+	default:
+		t.Fatal("resuming did not close changed")
+	}
+}
+
+func TestPause_nil(t *testing.T) {
+	var p *Pause
+	paused, changed := p.state()
+	if paused || changed != nil || p.Paused() {
+		t.Errorf("nil Pause is paused: %v, changed: %v", paused, changed)
+	}
+}
+
+func TestPause_watch(t *testing.T) {
+	var (
+		p           Pause
+		ctx, cancel = context.WithCancel(context.Background())
+		stored      = make(chan bool)
+		done        = make(chan struct{})
+	)
+	paused := func() (bool, error) {
+		select {
+		case s := <-stored:
+			return s, nil
+		case <-ctx.Done():
+			return false, errors.New("watch continued after cancel")
+		}
+	}
+	go func() {
+		p.Watch(ctx, logger.Testing(), time.Millisecond, paused)
+		close(done)
+	}()
+
+	_, changed := p.state()
+	stored <- true
+	<-changed
+	if !p.Paused() {
+		t.Fatal("not paused after stored pause")
+	}
+
+	_, changed = p.state()
+	stored <- false
+	<-changed
+	if p.Paused() {
+		t.Fatal("paused after stored resume")
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,178 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit set of the field's values
+	// domAny and dowAny are true if the field starts with *, as when both
+	// day of month and day of week are restricted, either may match.
+	domAny, dowAny bool
+}
+
+// descriptors are the supported shorthand cron expressions.
+var descriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// bounds are the minimum and maximum values of a cron field.
+type bounds struct {
+	name     string
+	min, max int
+}
+
+var (
+	minuteBounds = bounds{"minute", 0, 59}
+	hourBounds   = bounds{"hour", 0, 23}
+	domBounds    = bounds{"day of month", 1, 31}
+	monthBounds  = bounds{"month", 1, 12}
+	dowBounds    = bounds{"day of week", 0, 7}
+)
+
+// Parse parses a standard 5 field cron expression, minute, hour, day of month,
+// month and day of week, or a descriptor such as @daily. Fields support *,
+// values, ranges, lists and steps, such as */15 or 1-5,10. Day of week 0 and
+// 7 are both Sunday.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expr, ok := descriptors[spec]; ok {
+		spec = expr
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("cron expression %q must have 5 fields, have %v", spec, len(fields))
+	}
+
+	var (
+		s   Schedule
+		err error
+	)
+	if s.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return Schedule{}, err
+	}
+	if s.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return Schedule{}, err
+	}
+	if s.dom, err = parseField(fields[2], domBounds); err != nil {
+		return Schedule{}, err
+	}
+	if s.month, err = parseField(fields[3], monthBounds); err != nil {
+		return Schedule{}, err
+	}
+	if s.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return Schedule{}, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 << 0 // 7 is also Sunday
+	}
+	s.domAny = strings.HasPrefix(fields[2], "*")
+	s.dowAny = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parseField parses a comma separated list of values, ranges and steps
+// returning the values as a bit set.
+func parseField(field string, b bounds) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeSpec, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			var err error
+			rangeSpec = item[:i]
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %v field %q", b.name, item)
+			}
+		}
+
+		var low, high int
+		switch i := strings.IndexByte(rangeSpec, '-'); {
+		case rangeSpec == "*":
+			low, high = b.min, b.max
+		case i >= 0:
+			var err error
+			if low, err = parseValue(rangeSpec[:i], b); err != nil {
+				return 0, err
+			}
+			if high, err = parseValue(rangeSpec[i+1:], b); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range in %v field %q", b.name, item)
+			}
+		default:
+			var err error
+			if low, err = parseValue(rangeSpec, b); err != nil {
+				return 0, err
+			}
+			high = low
+			if step > 1 {
+				high = b.max // a step from a value continues to the maximum
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// parseValue parses a single value within bounds.
+func parseValue(value string, b bounds) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value in %v field %q", b.name, value)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("%v field value %v must be between %v and %v", b.name, v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// maxSearch is the furthest Next searches for a matching time, so schedules
+// which never match, such as the 30th of February, don't search forever.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next returns the next time after t matching the schedule, in t's location,
+// or the zero time if the schedule never matches.
+func (s Schedule) Next(t time.Time) time.Time {
+	limit := t.Add(maxSearch)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches returns true if t's day matches the day of month and day of week
+// fields. If both are restricted, either may match.
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if !s.domAny && !s.dowAny {
+		return dom || dow
+	}
+	return dom && dow
+}
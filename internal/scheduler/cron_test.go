@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_errors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@fortnightly",
+	}
+	for _, spec := range tests {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestSchedule_next(t *testing.T) {
+	// Friday 2017-09-15 10:30:20 UTC
+	from := time.Date(2017, 9, 15, 10, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2017, 9, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2017, 9, 15, 10, 45, 0, 0, time.UTC)},
+		{"30 * * * *", time.Date(2017, 9, 15, 11, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2017, 9, 16, 2, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2017, 9, 16, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2017, 9, 15, 11, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", time.Date(2017, 9, 15, 11, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2017, 9, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2017, 9, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,20 * *", time.Date(2017, 9, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Both day of month and day of week restricted, either matches.
+		{"0 0 20 * 1", time.Date(2017, 9, 18, 0, 0, 0, 0, time.UTC)},
+		// Never matches.
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.spec, err)
+			continue
+		}
+		if have := schedule.Next(from); !have.Equal(test.want) {
+			t.Errorf("%q: have: %v, want: %v", test.spec, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Package scheduler runs jobs periodically according to a cron schedule.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+)
+
+// Run calls job at each time matching schedule, until ctx is cancelled. Errors
+// returned by job are logged and do not stop later runs. Run blocks, and
+// returns when ctx is cancelled, or if the schedule never matches.
+func Run(ctx context.Context, logger logger.Logger, schedule Schedule, job func(context.Context) error) {
+	for {
+		next := schedule.Next(time.Now().UTC())
+		if next.IsZero() {
+			logger.Error("schedule never matches, stopping")
+			return
+		}
+		logger.Infof("next run at %v", next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		if err := job(ctx); err != nil {
+			logger.With("error", err).Error("scheduled job failed")
+			continue
+		}
+		logger.Infof("scheduled job finished in %v", time.Since(start))
+	}
+}
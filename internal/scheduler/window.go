@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily period of time, such as 22:00-06:00. A window whose end is
+// before its start spans midnight.
+type Window struct {
+	start, end int // start and end are minutes since midnight, end is exclusive
+}
+
+// ParseWindow parses a window of the form HH:MM-HH:MM, such as 09:00-17:30.
+func ParseWindow(spec string) (Window, error) {
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return Window{}, fmt.Errorf("window %q must be of the form HH:MM-HH:MM", spec)
+	}
+	start, err := parseClock(spec[:i])
+	if err != nil {
+		return Window{}, err
+	}
+	end, err := parseClock(spec[i+1:])
+	if err != nil {
+		return Window{}, err
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("window %q must not start and end at the same time", spec)
+	}
+	return Window{start: start, end: end}, nil
+}
+
+// parseClock parses a time of day of the form HH:MM, returning the minutes
+// since midnight.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, must be of the form HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains returns true if t, in its location, is within the window.
+func (w Window) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindow_errors(t *testing.T) {
+	tests := []string{
+		"",
+		"22:00",
+		"22:00-",
+		"24:00-06:00",
+		"22:60-06:00",
+		"10pm-6am",
+		"09:00-09:00",
+	}
+	for _, spec := range tests {
+		if _, err := ParseWindow(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestWindow_contains(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2017, 9, 15, hour, min, 30, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"09:00-17:30", at(8, 59), false},
+		{"09:00-17:30", at(9, 0), true},
+		{"09:00-17:30", at(17, 29), true},
+		{"09:00-17:30", at(17, 30), false},
+		{"22:00-06:00", at(21, 59), false},
+		{"22:00-06:00", at(22, 0), true},
+		{"22:00-06:00", at(0, 0), true},
+		{"22:00-06:00", at(5, 59), true},
+		{"22:00-06:00", at(6, 0), false},
+		{"22:00-06:00", at(12, 0), false},
+		{" 00:00 - 23:59 ", at(23, 58), true},
+	}
+	for _, test := range tests {
+		w, err := ParseWindow(test.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.spec, err)
+			continue
+		}
+		if have := w.Contains(test.t); have != test.want {
+			t.Errorf("%q contains %v have: %v, want: %v", test.spec, test.t, have, test.want)
+		}
+	}
+}
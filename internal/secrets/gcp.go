@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2/google"
+)
+
+// gcpSecretManagerEndpoint is the default Google Cloud Secret Manager API
+// endpoint.
+const gcpSecretManagerEndpoint = "https://secretmanager.googleapis.com"
+
+// GCPSecretManager is a Source which reads secrets from Google Cloud Secret
+// Manager, the reference is the secret version's resource name, such as
+// projects/my-project/secrets/webhook-secret/versions/latest. If the version
+// is omitted, the latest version is read.
+type GCPSecretManager struct {
+	Endpoint string       // Endpoint is the API endpoint, if blank the default endpoint is used.
+	Client   *http.Client // Client is used to make requests, if nil the Application Default Credentials are used.
+
+	mu sync.Mutex
+}
+
+// Secret implements the Source interface.
+func (g *GCPSecretManager) Secret(ctx context.Context, ref string) ([]byte, error) {
+	name := strings.Trim(ref, "/")
+	if !strings.HasPrefix(name, "projects/") || !strings.Contains(name, "/secrets/") {
+		return nil, errors.Errorf("reference must be projects/<project>/secrets/<secret>[/versions/<version>], have %q", ref)
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	client, err := g.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = gcpSecretManagerEndpoint
+	}
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v1/%s:access", strings.TrimRight(endpoint, "/"), name), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create request")
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not request secret")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %v: %s", resp.Status, body)
+	}
+
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &version); err != nil {
+		return nil, errors.Wrap(err, "could not decode response")
+	}
+	secret, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode payload")
+	}
+	return secret, nil
+}
+
+// client returns the HTTP client, creating a client using the Application
+// Default Credentials on first use.
+func (g *GCPSecretManager) client(ctx context.Context) (*http.Client, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Client != nil {
+		return g.Client, nil
+	}
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Google Cloud client")
+	}
+	g.Client = client
+	return client, nil
+}
@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGCPSecretManager_Secret(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/projects/p/secrets/webhook/versions/latest:access":
+			fmt.Fprint(w, `{"name":"projects/p/secrets/webhook/versions/2","payload":{"data":"bGF0ZXN0"}}`) // latest
+		case "/v1/projects/p/secrets/webhook/versions/1:access":
+			fmt.Fprint(w, `{"name":"projects/p/secrets/webhook/versions/1","payload":{"data":"Zmlyc3Q="}}`) // first
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tests := map[string]struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		"latest by default": {"projects/p/secrets/webhook", "latest", false},
+		"version":           {"projects/p/secrets/webhook/versions/1", "first", false},
+		"not found":         {"projects/p/secrets/unknown", "", true},
+		"invalid":           {"webhook", "", true},
+	}
+
+	sm := &GCPSecretManager{Endpoint: ts.URL, Client: http.DefaultClient}
+	for desc, test := range tests {
+		have, err := sm.Secret(context.Background(), test.ref)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case !test.wantErr && err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		case string(have) != test.want:
+			t.Errorf("%v: have: %q, want: %q", desc, have, test.want)
+		}
+	}
+}
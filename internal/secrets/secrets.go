@@ -0,0 +1,117 @@
+// Package secrets reads secrets, such as private keys and webhook secrets,
+// from a file or a secret manager selected by a URI's scheme, such as
+// file:///etc/gopherci/key.pem or vault://secret/data/gopherci#key.
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"regexp"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Source reads secrets from a single secret store.
+type Source interface {
+	// Secret returns the secret identified by ref, which is the secret's URI
+	// without the scheme, such as /etc/gopherci/key.pem for
+	// file:///etc/gopherci/key.pem.
+	Secret(ctx context.Context, ref string) ([]byte, error)
+}
+
+// uriRegexp matches a secret's URI, capturing the scheme and reference.
+var uriRegexp = regexp.MustCompile(`^([a-z][a-z0-9+.-]*)://(.*)$`)
+
+// IsURI returns true if v is a secret's URI, such as vault://secret/gopherci,
+// instead of a path or literal value.
+func IsURI(v string) bool {
+	return uriRegexp.MatchString(v)
+}
+
+// Resolver reads secrets from the Source registered for each URI's scheme.
+type Resolver struct {
+	mu      sync.RWMutex
+	sources map[string]Source
+}
+
+// NewResolver returns a Resolver with the file scheme registered.
+func NewResolver() *Resolver {
+	r := &Resolver{sources: make(map[string]Source)}
+	r.Register("file", File{})
+	return r
+}
+
+// Register registers src to read secrets with scheme, replacing any Source
+// previously registered.
+func (r *Resolver) Register(scheme string, src Source) {
+	r.mu.Lock()
+	r.sources[scheme] = src
+	r.mu.Unlock()
+}
+
+// Resolve returns the secret identified by uri, returning an error if uri is
+// invalid or no Source is registered for its scheme.
+func (r *Resolver) Resolve(ctx context.Context, uri string) ([]byte, error) {
+	matches := uriRegexp.FindStringSubmatch(uri)
+	if matches == nil {
+		return nil, errors.Errorf("invalid secret URI %q", uri)
+	}
+	scheme, ref := matches[1], matches[2]
+
+	r.mu.RLock()
+	src, ok := r.sources[scheme]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown secret URI scheme %q", scheme)
+	}
+
+	secret, err := src.Secret(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read %s secret %q", scheme, ref)
+	}
+	return secret, nil
+}
+
+// ResolveFile returns the secret identified by v if it's a URI, else the
+// contents of the file at path v.
+func (r *Resolver) ResolveFile(ctx context.Context, v string) ([]byte, error) {
+	if IsURI(v) {
+		return r.Resolve(ctx, v)
+	}
+	return ioutil.ReadFile(v)
+}
+
+// ResolveValue returns the secret identified by v if it's a URI, else v.
+func (r *Resolver) ResolveValue(ctx context.Context, v string) (string, error) {
+	if !IsURI(v) {
+		return v, nil
+	}
+	secret, err := r.Resolve(ctx, v)
+	return string(secret), err
+}
+
+// File is a Source which reads secrets from the file system, the reference is
+// the file's path.
+type File struct{}
+
+// Secret implements the Source interface.
+func (File) Secret(_ context.Context, path string) ([]byte, error) {
+	if path == "" {
+		return nil, errors.New("path is required")
+	}
+	return ioutil.ReadFile(path)
+}
+
+// Memory is a Source which reads secrets from a map of reference to secret,
+// for use in tests and development.
+type Memory map[string][]byte
+
+// Secret implements the Source interface.
+func (m Memory) Secret(_ context.Context, ref string) ([]byte, error) {
+	secret, ok := m[ref]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return secret, nil
+}
@@ -0,0 +1,122 @@
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsURI(t *testing.T) {
+	tests := map[string]bool{
+		"file:///etc/gopherci/key.pem":   true,
+		"vault://secret/gopherci#key":    true,
+		"gcpsm://projects/p/secrets/key": true,
+		"private-key.pem":                false,
+		"/etc/gopherci/key.pem":          false,
+		"s3cr3t":                         false,
+		"://missing-scheme":              false,
+		"Vault://secret":                 false,
+	}
+	for have, want := range tests {
+		if IsURI(have) != want {
+			t.Errorf("IsURI(%q) have: %v, want: %v", have, !want, want)
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopherci-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(path, []byte("file secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewResolver()
+	r.Register("mem", Memory{"webhook": []byte("memory secret")})
+
+	tests := map[string]struct {
+		uri     string
+		want    string
+		wantErr bool
+	}{
+		"file":           {"file://" + path, "file secret", false},
+		"file missing":   {"file://" + filepath.Join(dir, "missing.pem"), "", true},
+		"file no path":   {"file://", "", true},
+		"memory":         {"mem://webhook", "memory secret", false},
+		"memory missing": {"mem://unknown", "", true},
+		"unknown scheme": {"aws://secret", "", true},
+		"not a URI":      {path, "", true},
+	}
+
+	for desc, test := range tests {
+		have, err := r.Resolve(context.Background(), test.uri)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case !test.wantErr && err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		case string(have) != test.want:
+			t.Errorf("%v: have: %q, want: %q", desc, have, test.want)
+		}
+	}
+}
+
+func TestResolver_ResolveFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "gopherci-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("file secret")
+	f.Close()
+
+	r := NewResolver()
+	r.Register("mem", Memory{"key": []byte("memory secret")})
+
+	tests := map[string]string{
+		f.Name():             "file secret", // plain paths are read as a file
+		"mem://key":          "memory secret",
+		"file://" + f.Name(): "file secret",
+	}
+	for v, want := range tests {
+		have, err := r.ResolveFile(context.Background(), v)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", v, err)
+			continue
+		}
+		if string(have) != want {
+			t.Errorf("%v: have: %q, want: %q", v, have, want)
+		}
+	}
+}
+
+func TestResolver_ResolveValue(t *testing.T) {
+	r := NewResolver()
+	r.Register("mem", Memory{"webhook": []byte("memory secret")})
+
+	tests := map[string]struct {
+		want    string
+		wantErr bool
+	}{
+		"literal":       {"literal", false}, // plain values are the secret
+		"mem://webhook": {"memory secret", false},
+		"mem://unknown": {"", true},
+	}
+	for v, test := range tests {
+		have, err := r.ResolveValue(context.Background(), v)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", v)
+		case !test.wantErr && err != nil:
+			t.Errorf("%v: unexpected error: %v", v, err)
+		case have != test.want:
+			t.Errorf("%v: have: %q, want: %q", v, have, test.want)
+		}
+	}
+}
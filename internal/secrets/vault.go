@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Vault is a Source which reads secrets from a HashiCorp Vault key/value
+// secrets engine, the reference is the secret's path and field, such as
+// secret/data/gopherci#webhook_secret. Both version 1 and 2 of the key/value
+// secrets engine are supported.
+type Vault struct {
+	Addr   string       // Addr is Vault's address, such as https://vault:8200.
+	Token  string       // Token is the Vault token used to read secrets.
+	Client *http.Client // Client is used to make requests, if nil http.DefaultClient is used.
+}
+
+// Secret implements the Source interface.
+func (v *Vault) Secret(ctx context.Context, ref string) ([]byte, error) {
+	i := strings.LastIndexByte(ref, '#')
+	if i <= 0 || i == len(ref)-1 {
+		return nil, errors.Errorf("reference must be path#field, have %q", ref)
+	}
+	path, field := strings.Trim(ref[:i], "/"), ref[i+1:]
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v1/%s", strings.TrimRight(v.Addr, "/"), path), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create request")
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not request secret")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %v: %s", resp.Status, body)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, errors.Wrap(err, "could not decode response")
+	}
+
+	data := secret.Data
+	// Version 2 of the key/value secrets engine nests the values with their
+	// metadata.
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return nil, errors.Errorf("field %q not found", field)
+	}
+	return []byte(value), nil
+}
@@ -0,0 +1,57 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVault_Secret(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv1/gopherci":
+			fmt.Fprint(w, `{"data":{"webhook_secret":"v1 secret"}}`)
+		case "/v1/kv2/data/gopherci":
+			fmt.Fprint(w, `{"data":{"data":{"webhook_secret":"v2 secret"},"metadata":{"version":1}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+		}
+	}))
+	defer ts.Close()
+
+	tests := map[string]struct {
+		token   string
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		"kv v1":         {"token", "kv1/gopherci#webhook_secret", "v1 secret", false},
+		"kv v2":         {"token", "kv2/data/gopherci#webhook_secret", "v2 secret", false},
+		"leading slash": {"token", "/kv1/gopherci#webhook_secret", "v1 secret", false},
+		"missing field": {"token", "kv1/gopherci#unknown", "", true},
+		"no field":      {"token", "kv1/gopherci", "", true},
+		"not found":     {"token", "kv1/unknown#webhook_secret", "", true},
+		"forbidden":     {"invalid", "kv1/gopherci#webhook_secret", "", true},
+	}
+
+	for desc, test := range tests {
+		vault := &Vault{Addr: ts.URL + "/", Token: test.token}
+		have, err := vault.Secret(context.Background(), test.ref)
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("%v: expected error", desc)
+		case !test.wantErr && err != nil:
+			t.Errorf("%v: unexpected error: %v", desc, err)
+		case string(have) != test.want:
+			t.Errorf("%v: have: %q, want: %q", desc, have, test.want)
+		}
+	}
+}
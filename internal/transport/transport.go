@@ -0,0 +1,42 @@
+// Package transport constructs the HTTP transports used by all outbound
+// clients, so proxy configuration is consistently honoured.
+package transport
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// New returns a transport with the same settings as http.DefaultTransport,
+// sending requests via proxy. If proxy is blank, the proxy is determined by
+// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func New(proxy string) (*http.Transport, error) {
+	proxyFunc := http.ProxyFromEnvironment
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse proxy %q", proxy)
+		}
+		if proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, errors.Errorf("proxy %q must be an absolute URL, such as http://proxy:3128", proxy)
+		}
+		proxyFunc = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Transport{
+		Proxy: proxyFunc,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}, nil
+}
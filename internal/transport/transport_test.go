@@ -0,0 +1,42 @@
+package transport
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tr, err := New("http://proxy.example.com:3128")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, target := range []string{"http://example.com", "https://api.github.com"} {
+		r, _ := http.NewRequest("GET", target, nil)
+		proxy, err := tr.Proxy(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := "http://proxy.example.com:3128"; proxy == nil || proxy.String() != want {
+			t.Errorf("%v proxy have: %v, want: %v", target, proxy, want)
+		}
+	}
+}
+
+func TestNew_environment(t *testing.T) {
+	tr, err := New("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tr.Proxy == nil {
+		t.Error("expected proxy from environment, have: nil")
+	}
+}
+
+func TestNew_invalid(t *testing.T) {
+	for _, proxy := range []string{"%", "proxy.example.com"} {
+		if _, err := New(proxy); err == nil {
+			t.Errorf("%q expected error, have: nil", proxy)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionCookie   = "gci_session"
+	stateCookie     = "gci_oauth_state"
+	sessionDuration = 7 * 24 * time.Hour
+	stateDuration   = 10 * time.Minute
+	csrfField       = "csrf_token" // csrfField is the form field containing the CSRFToken
+)
+
+// Auth authenticates users of the web UI using GitHub's OAuth flow and
+// stores the user's login in a signed session cookie.
+type Auth struct {
+	logger     logger.Logger
+	oauth      *oauth2.Config
+	apiURL     string          // apiURL is the base URL for the GitHub API
+	gciBaseURL string          // gciBaseURL is the base URL for GopherCI
+	key        []byte          // key signs session and state cookies
+	admins     map[string]bool // admins is a set of GitHub logins permitted to access admin endpoints
+
+	// Transport is used for requests to GitHub, if nil http.DefaultTransport
+	// is used. Optional, may be set after NewAuth and before use.
+	Transport http.RoundTripper
+}
+
+// NewAuth returns an Auth using an OAuth application's clientID and
+// clientSecret. The OAuth application's callback URL must be set to
+// gciBaseURL/login/callback. key is used to sign cookies and admins is a
+// list of GitHub logins permitted to access admin endpoints. If clientID is
+// blank, authentication is disabled.
+func NewAuth(logger logger.Logger, gciBaseURL, clientID, clientSecret string, key []byte, admins []string) (*Auth, error) {
+	if clientID != "" && len(key) == 0 {
+		return nil, errors.New("session key must be set when OAuth is enabled")
+	}
+	a := &Auth{
+		logger: logger,
+		oauth: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  "https://github.com/login/oauth/authorize",
+				TokenURL: "https://github.com/login/oauth/access_token",
+			},
+			RedirectURL: gciBaseURL + "/login/callback",
+		},
+		apiURL:     "https://api.github.com/",
+		gciBaseURL: gciBaseURL,
+		key:        key,
+		admins:     make(map[string]bool),
+	}
+	for _, admin := range admins {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			a.admins[admin] = true
+		}
+	}
+	return a, nil
+}
+
+// IsEnabled returns true if authentication has been configured.
+func (a *Auth) IsEnabled() bool {
+	return a != nil && a.oauth.ClientID != ""
+}
+
+// LoginHandler redirects the user to GitHub to authorize GopherCI, the
+// optional target_url is where the user will be returned to afterwards.
+func (a *Auth) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.IsEnabled() {
+		http.Error(w, "authentication is not enabled", http.StatusNotFound)
+		return
+	}
+
+	target := r.URL.Query().Get("target_url")
+	if target == "" {
+		target = a.gciBaseURL + "/"
+	}
+	// No open redirects
+	if !a.isLocalURL(target) {
+		http.Error(w, "invalid target_url", http.StatusBadRequest)
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		a.logger.With("error", err).Error("could not generate oauth state")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	state := hex.EncodeToString(b)
+
+	a.setCookie(w, stateCookie, state+"|"+target, stateDuration)
+	http.Redirect(w, r, a.oauth.AuthCodeURL(state), http.StatusFound)
+}
+
+// CallbackHandler handles the user returning from GitHub after authorizing
+// GopherCI, validating the state, creating a session and redirecting the user
+// to their original target.
+func (a *Auth) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.IsEnabled() {
+		http.Error(w, "authentication is not enabled", http.StatusNotFound)
+		return
+	}
+
+	value, ok := a.cookie(r, stateCookie)
+	if !ok {
+		http.Error(w, "invalid or expired state", http.StatusBadRequest)
+		return
+	}
+	a.clearCookie(w, stateCookie)
+
+	parts := strings.SplitN(value, "|", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[0]), []byte(r.URL.Query().Get("state"))) {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+	target := parts[1]
+	// No open redirects
+	if !a.isLocalURL(target) {
+		http.Error(w, "invalid target_url", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if a.Transport != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: a.Transport})
+	}
+
+	token, err := a.oauth.Exchange(ctx, r.URL.Query().Get("code"))
+	if err != nil {
+		a.logger.With("error", err).Info("could not exchange oauth code")
+		http.Error(w, "could not authorize", http.StatusBadRequest)
+		return
+	}
+
+	client := github.NewClient(a.oauth.Client(ctx, token))
+	if client.BaseURL, err = url.Parse(a.apiURL); err != nil {
+		a.logger.With("error", err).Error("could not parse api url")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	user, _, err := client.Users.Get(r.Context(), "")
+	if err != nil || user.GetLogin() == "" {
+		a.logger.With("error", err).Error("could not get authenticated user")
+		http.Error(w, "could not get user", http.StatusInternalServerError)
+		return
+	}
+
+	a.logger.With("login", user.GetLogin()).Info("user logged in")
+	a.setCookie(w, sessionCookie, user.GetLogin(), sessionDuration)
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// isLocalURL returns true if target is an absolute URL with GopherCI's
+// scheme and host, and within its base path.
+func (a *Auth) isLocalURL(target string) bool {
+	base, err := url.Parse(a.gciBaseURL)
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == base.Scheme && u.Host == base.Host && u.User == nil &&
+		strings.HasPrefix(u.Path, strings.TrimSuffix(base.Path, "/")+"/")
+}
+
+// LogoutHandler removes the user's session, it must be a POST so other sites
+// cannot log the user out.
+func (a *Auth) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	a.clearCookie(w, sessionCookie)
+	http.Redirect(w, r, a.gciBaseURL+"/", http.StatusSeeOther)
+}
+
+// User returns the GitHub login of the authenticated user, or a blank string
+// if the user is not authenticated.
+func (a *Auth) User(r *http.Request) string {
+	if !a.IsEnabled() {
+		return ""
+	}
+	login, _ := a.cookie(r, sessionCookie)
+	return login
+}
+
+// IsAdmin returns true if the authenticated user is an admin.
+func (a *Auth) IsAdmin(r *http.Request) bool {
+	login := a.User(r)
+	return login != "" && a.admins[login]
+}
+
+// RequireAdmin is a middleware which only permits admins to access next,
+// unauthenticated users are redirected to login.
+func (a *Auth) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case !a.IsEnabled():
+			http.Error(w, "authentication is not enabled", http.StatusForbidden)
+		case a.User(r) == "":
+			target := url.QueryEscape(a.gciBaseURL + r.URL.RequestURI())
+			http.Redirect(w, r, a.gciBaseURL+"/login?target_url="+target, http.StatusFound)
+		case !a.IsAdmin(r):
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// userKey is the request context key of the login of the user authenticated
+// by RequireUser.
+type userKey struct{}
+
+// RequireUser is a middleware which only permits authenticated users to
+// access next, the user's login is available with ContextUser. Unauthenticated
+// users are redirected to login, unless the request is not a GET, as they
+// can't be returned to it.
+func (a *Auth) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		login := a.User(r)
+		switch {
+		case !a.IsEnabled():
+			http.Error(w, "authentication is not enabled", http.StatusForbidden)
+		case login == "" && r.Method != "GET":
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		case login == "":
+			target := url.QueryEscape(a.gciBaseURL + r.URL.RequestURI())
+			http.Redirect(w, r, a.gciBaseURL+"/login?target_url="+target, http.StatusFound)
+		default:
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, login)))
+		}
+	})
+}
+
+// ContextUser returns the login of the user authenticated by RequireUser, or
+// a blank string if the user is not authenticated.
+func ContextUser(ctx context.Context) string {
+	login, _ := ctx.Value(userKey{}).(string)
+	return login
+}
+
+// CSRFToken returns the token to include as the csrf_token value of forms
+// submitted to handlers using RequireCSRF, or a blank string if the user is
+// not authenticated. The token is bound to the user's session.
+func (a *Auth) CSRFToken(r *http.Request) string {
+	if a.User(r) == "" {
+		return ""
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	return a.sign("csrf|" + c.Value)
+}
+
+// RequireCSRF is a middleware which only permits requests to next, other than
+// GET and HEAD, if their csrf_token form value is the user's CSRFToken, so
+// other sites cannot submit forms on behalf of the user.
+func (a *Auth) RequireCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			token := a.CSRFToken(r)
+			if token == "" || !hmac.Equal([]byte(r.FormValue(csrfField)), []byte(token)) {
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setCookie sets a signed cookie name with value, which expires after d.
+func (a *Auth) setCookie(w http.ResponseWriter, name, value string, d time.Duration) {
+	expires := time.Now().Add(d)
+	payload := fmt.Sprintf("%d|%s", expires.Unix(), value)
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + a.sign(payload),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.gciBaseURL, "https://"),
+		// Lax, not strict, so the cookies are sent when GitHub redirects
+		// the user back to the callback.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearCookie removes the cookie name.
+func (a *Auth) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// cookie returns the value of a signed cookie name and true, or false if the
+// cookie does not exist, has been tampered with or has expired.
+func (a *Auth) cookie(r *http.Request, name string) (string, bool) {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.SplitN(c.Value, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+	if !hmac.Equal([]byte(a.sign(string(payload))), []byte(parts[1])) {
+		return "", false
+	}
+	fields := strings.SplitN(string(payload), "|", 2)
+	if len(fields) != 2 {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+	return fields[1], true
+}
+
+// sign returns the hex encoded HMAC of payload.
+func (a *Auth) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
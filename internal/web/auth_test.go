@@ -0,0 +1,287 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"golang.org/x/oauth2"
+)
+
+func authSetup(t *testing.T) (*Auth, *httptest.Server) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintln(w, `{"access_token": "token", "token_type": "bearer"}`)
+		case "/user":
+			fmt.Fprintln(w, `{"login": "admin"}`)
+		default:
+			t.Log(r.RequestURI)
+		}
+	}))
+
+	a, err := NewAuth(logger.Testing(), "https://example.com", "client-id", "client-secret", []byte("key"), []string{"admin"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a.oauth.Endpoint = oauth2.Endpoint{
+		AuthURL:  ts.URL + "/login/oauth/authorize",
+		TokenURL: ts.URL + "/login/oauth/access_token",
+	}
+	a.apiURL = ts.URL + "/"
+	return a, ts
+}
+
+// login calls the LoginHandler and returns the state and state cookie.
+func login(t *testing.T, a *Auth, target string) (string, *http.Cookie) {
+	w := httptest.NewRecorder()
+	a.LoginHandler(w, httptest.NewRequest("GET", "https://example.com/login?target_url="+url.QueryEscape(target), nil))
+	if want := http.StatusFound; w.Code != want {
+		t.Fatalf("login code have: %v, want: %v", w.Code, want)
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == stateCookie {
+			if cookie.SameSite != http.SameSiteLaxMode {
+				t.Errorf("state cookie same site have: %v, want: %v", cookie.SameSite, http.SameSiteLaxMode)
+			}
+			return location.Query().Get("state"), cookie
+		}
+	}
+	t.Fatalf("no state cookie set")
+	return "", nil
+}
+
+func TestAuth_loginTarget(t *testing.T) {
+	a, ts := authSetup(t)
+	defer ts.Close()
+
+	tests := []struct {
+		target   string
+		wantCode int
+	}{
+		{"https://example.com/analysis/1", http.StatusFound},
+		{"", http.StatusFound},
+		{"https://evil.com", http.StatusBadRequest},
+		{"https://example.com.evil.com/", http.StatusBadRequest},
+		{"https://example.com@evil.com/", http.StatusBadRequest},
+		{"https://user@example.com/", http.StatusBadRequest},
+		{"http://example.com/", http.StatusBadRequest},
+		{"//evil.com/", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		a.LoginHandler(w, httptest.NewRequest("GET", "https://example.com/login?target_url="+url.QueryEscape(test.target), nil))
+		if w.Code != test.wantCode {
+			t.Errorf("target %q code have: %v, want: %v", test.target, w.Code, test.wantCode)
+		}
+	}
+}
+
+func TestAuth_callback(t *testing.T) {
+	a, ts := authSetup(t)
+	defer ts.Close()
+
+	const target = "https://example.com/analysis/1"
+
+	tests := map[string]struct {
+		state    func(state string) string
+		cookie   func(cookie *http.Cookie) *http.Cookie
+		wantCode int
+	}{
+		"valid": {
+			state:    func(state string) string { return state },
+			cookie:   func(cookie *http.Cookie) *http.Cookie { return cookie },
+			wantCode: http.StatusSeeOther,
+		},
+		"state mismatch": {
+			state:    func(state string) string { return "invalid" },
+			cookie:   func(cookie *http.Cookie) *http.Cookie { return cookie },
+			wantCode: http.StatusBadRequest,
+		},
+		"no cookie": {
+			state:    func(state string) string { return state },
+			cookie:   func(cookie *http.Cookie) *http.Cookie { return nil },
+			wantCode: http.StatusBadRequest,
+		},
+		"tampered cookie": {
+			state: func(state string) string { return state },
+			cookie: func(cookie *http.Cookie) *http.Cookie {
+				cookie.Value = strings.Replace(cookie.Value, ".", "a.", 1)
+				return cookie
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for desc, test := range tests {
+		state, cookie := login(t, a, target)
+
+		r := httptest.NewRequest("GET", "https://example.com/login/callback?code=code&state="+test.state(state), nil)
+		if cookie := test.cookie(cookie); cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		a.CallbackHandler(w, r)
+
+		if w.Code != test.wantCode {
+			t.Errorf("%v: code have: %v, want: %v", desc, w.Code, test.wantCode)
+		}
+		if test.wantCode != http.StatusSeeOther {
+			continue
+		}
+
+		if have := w.Header().Get("Location"); have != target {
+			t.Errorf("%v: location have: %q, want: %q", desc, have, target)
+		}
+
+		// Session cookie should authenticate the user.
+		r = httptest.NewRequest("GET", target, nil)
+		for _, cookie := range w.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+		if want := "admin"; a.User(r) != want {
+			t.Errorf("%v: user have: %q, want: %q", desc, a.User(r), want)
+		}
+	}
+}
+
+func TestAuth_requireAdmin(t *testing.T) {
+	a, ts := authSetup(t)
+	defer ts.Close()
+
+	handler := a.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := map[string]struct {
+		login    string
+		wantCode int
+	}{
+		"unauthenticated": {"", http.StatusFound},
+		"not admin":       {"user", http.StatusForbidden},
+		"admin":           {"admin", http.StatusOK},
+	}
+
+	for desc, test := range tests {
+		r := httptest.NewRequest("GET", "https://example.com/admin", nil)
+		if test.login != "" {
+			w := httptest.NewRecorder()
+			a.setCookie(w, sessionCookie, test.login, sessionDuration)
+			for _, cookie := range w.Result().Cookies() {
+				r.AddCookie(cookie)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("%v: code have: %v, want: %v", desc, w.Code, test.wantCode)
+		}
+	}
+}
+
+func TestAuth_requireUser(t *testing.T) {
+	a, ts := authSetup(t)
+	defer ts.Close()
+
+	var have string
+	handler := a.RequireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		have = ContextUser(r.Context())
+	}))
+
+	tests := map[string]struct {
+		method   string
+		login    string
+		wantCode int
+	}{
+		"unauthenticated":      {"GET", "", http.StatusFound},
+		"unauthenticated post": {"POST", "", http.StatusUnauthorized},
+		"user":                 {"POST", "user", http.StatusOK},
+	}
+
+	for desc, test := range tests {
+		have = ""
+		r := httptest.NewRequest(test.method, "https://example.com/analysis/1/rerun", nil)
+		if test.login != "" {
+			w := httptest.NewRecorder()
+			a.setCookie(w, sessionCookie, test.login, sessionDuration)
+			for _, cookie := range w.Result().Cookies() {
+				r.AddCookie(cookie)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("%v: code have: %v, want: %v", desc, w.Code, test.wantCode)
+		}
+		if have != test.login {
+			t.Errorf("%v: context user have: %q, want: %q", desc, have, test.login)
+		}
+	}
+}
+
+func TestAuth_requireCSRF(t *testing.T) {
+	a, ts := authSetup(t)
+	defer ts.Close()
+
+	handler := a.RequireCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// sessionCookies returns the cookies of a new session for login.
+	sessionCookies := func(login string) []*http.Cookie {
+		w := httptest.NewRecorder()
+		a.setCookie(w, sessionCookie, login, sessionDuration)
+		return w.Result().Cookies()
+	}
+	session, other := sessionCookies("admin"), sessionCookies("user")
+
+	// token returns the CSRF token of a session.
+	token := func(cookies []*http.Cookie) string {
+		r := httptest.NewRequest("GET", "https://example.com/", nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		return a.CSRFToken(r)
+	}
+	if token(nil) != "" {
+		t.Errorf("unauthenticated token have: %q, want blank", token(nil))
+	}
+
+	tests := map[string]struct {
+		method   string
+		cookies  []*http.Cookie
+		token    string
+		wantCode int
+	}{
+		"get":              {"GET", session, "", http.StatusOK},
+		"valid":            {"POST", session, token(session), http.StatusOK},
+		"missing":          {"POST", session, "", http.StatusForbidden},
+		"other session":    {"POST", session, token(other), http.StatusForbidden},
+		"unauthenticated":  {"POST", nil, token(session), http.StatusForbidden},
+		"unauth and blank": {"POST", nil, "", http.StatusForbidden},
+	}
+
+	for desc, test := range tests {
+		form := url.Values{csrfField: {test.token}}
+		r := httptest.NewRequest(test.method, "https://example.com/admin/maintenance", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range test.cookies {
+			r.AddCookie(cookie)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("%v: code have: %v, want: %v", desc, w.Code, test.wantCode)
+		}
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sort"
+	"unicode"
+	"unicode/utf8"
 
 	"sourcegraph.com/sourcegraph/go-diff/diff"
 
@@ -64,6 +67,104 @@ type Line struct {
 	ChangeType ChangeType
 	LineNo     int
 	Issues     []db.Issue
+	// Anchor is the name of the line's HTML anchor, blank if it has no issues.
+	Anchor string
+	// InRange is true if the line is within the range of a multi-line issue.
+	InRange bool
+	// Segments is Line split to highlight the columns of Issues, nil if no
+	// issues have a column.
+	Segments []Segment
+}
+
+// A Segment is part of a line.
+type Segment struct {
+	Text      string
+	Highlight bool // Highlight is true if an issue's column points to Text.
+}
+
+// segments splits line into segments, highlighting the word at each issue's
+// column, where columns are 1-based byte offsets. Returns nil if no issues
+// have a column within the line.
+func segments(line string, issues []db.Issue) []Segment {
+	var cols []int
+	for _, issue := range issues {
+		if issue.Column > 0 && issue.Column <= len(line) {
+			cols = append(cols, issue.Column-1)
+		}
+	}
+	if len(cols) == 0 {
+		return nil
+	}
+	sort.Ints(cols)
+
+	var (
+		segs []Segment
+		pos  int
+	)
+	for _, start := range cols {
+		if start < pos {
+			continue // overlaps previous highlight
+		}
+		end := start
+		for end < len(line) {
+			r, size := utf8.DecodeRuneInString(line[end:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			end += size
+		}
+		if end == start {
+			// Not a word, highlight a single character.
+			_, size := utf8.DecodeRuneInString(line[start:])
+			end += size
+		}
+		if start > pos {
+			segs = append(segs, Segment{Text: line[pos:start]})
+		}
+		segs = append(segs, Segment{Text: line[start:end], Highlight: true})
+		pos = end
+	}
+	if pos < len(line) {
+		segs = append(segs, Segment{Text: line[pos:]})
+	}
+	return segs
+}
+
+// issueIndex indexes issues by path and line, so the issues on each line of a
+// diff are found without checking every issue.
+type issueIndex struct {
+	lines  map[string]map[int][]db.Issue // lines are the issues on each line of each path
+	ranges map[string][]db.Issue         // ranges are the multi-line issues of each path
+}
+
+// newIssueIndex returns an issueIndex of issues.
+func newIssueIndex(issues []db.Issue) issueIndex {
+	idx := issueIndex{
+		lines:  make(map[string]map[int][]db.Issue),
+		ranges: make(map[string][]db.Issue),
+	}
+	for _, issue := range issues {
+		if idx.lines[issue.Path] == nil {
+			idx.lines[issue.Path] = make(map[int][]db.Issue)
+		}
+		idx.lines[issue.Path][issue.Line] = append(idx.lines[issue.Path][issue.Line], issue)
+		if issue.EndLine != 0 {
+			idx.ranges[issue.Path] = append(idx.ranges[issue.Path], issue)
+		}
+	}
+	return idx
+}
+
+// line returns the issues on line of path, in the order they were indexed,
+// and whether line is within the range of a multi-line issue.
+func (idx issueIndex) line(path string, line int) (issues []db.Issue, inRange bool) {
+	for _, issue := range idx.ranges[path] {
+		if issue.Line <= line && line <= issue.EndLine {
+			inRange = true
+			break
+		}
+	}
+	return idx.lines[path][line], inRange
 }
 
 // DiffIssues reads a diff and adds the issues to the lines affected. Only
@@ -79,7 +180,10 @@ func DiffIssues(ctx context.Context, diffReader io.Reader, issues []db.Issue) ([
 		return nil, errors.Wrap(err, "could not parse diff")
 	}
 
-	var patches []Patch
+	var (
+		patches []Patch
+		idx     = newIssueIndex(issues)
+	)
 	for _, fileDiff := range fileDiffs {
 		file := Patch{
 			Path: fileDiff.NewName[2:], // strip leading "a/" or "b/"
@@ -109,13 +213,16 @@ func DiffIssues(ctx context.Context, diffReader io.Reader, issues []db.Issue) ([
 
 				// Find issues matching this line, ignore removed lines as an
 				// issue may appear on the same line number that replaced this.
-				var lineIssues []db.Issue
+				var (
+					lineIssues []db.Issue
+					inRange    bool
+					anchor     string
+				)
 				if changeType != ChangeRemove {
-					for _, issue := range issues {
-						if issue.Path == file.Path && issue.Line == diffLineNo {
-							hunkHasIssues = true
-							lineIssues = append(lineIssues, issue)
-						}
+					lineIssues, inRange = idx.line(file.Path, diffLineNo)
+					if len(lineIssues) > 0 {
+						hunkHasIssues = true
+						anchor = db.LineAnchor(file.Path, diffLineNo)
 					}
 				}
 
@@ -124,6 +231,9 @@ func DiffIssues(ctx context.Context, diffReader io.Reader, issues []db.Issue) ([
 					LineNo:     diffLineNo,
 					Line:       scanner.Text()[1:],
 					Issues:     lineIssues,
+					Anchor:     anchor,
+					InRange:    inRange,
+					Segments:   segments(scanner.Text()[1:], lineIssues),
 				})
 
 				if changeType == ChangeRemove {
@@ -3,6 +3,7 @@ package web
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -54,6 +55,7 @@ index 0000000..3de84a3
 					{Line: "       fmt.Println(\"Hi\")", ChangeType: "remove", LineNo: 6, Issues: nil},
 					{Line: "       fmt.Println(\"Hi: %v\", \"alice\")", ChangeType: "add", LineNo: 6, Issues: []db.Issue{
 						{Path: "main.go", Line: 6, Issue: "issue here"}},
+						Anchor: "issue-main.go-L6",
 					},
 					{Line: "}", ChangeType: "none", LineNo: 7, Issues: nil},
 				},
@@ -65,3 +67,160 @@ index 0000000..3de84a3
 		t.Errorf("\nhave: %#v\nwant: %#v", havePatches, wantPatches)
 	}
 }
+
+func TestAnalysisFiles_column(t *testing.T) {
+	diffReader := bytes.NewBuffer([]byte(`diff --git a/main.go b/main.go
+index 4810940..4090359 100644
+--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-var a = 1
++var foo = bar
+`))
+
+	issues := []db.Issue{
+		{Path: "main.go", Line: 1, Column: 5, Issue: "issue here"},
+	}
+
+	havePatches, err := DiffIssues(context.Background(), diffReader, issues)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(havePatches) != 1 || len(havePatches[0].Hunks) != 1 || len(havePatches[0].Hunks[0].Lines) != 2 {
+		t.Fatalf("unexpected patches: %#v", havePatches)
+	}
+	lines := havePatches[0].Hunks[0].Lines
+	if lines[0].Segments != nil {
+		t.Errorf("removed line segments have: %#v, want: nil", lines[0].Segments)
+	}
+	want := []Segment{{Text: "var "}, {Text: "foo", Highlight: true}, {Text: " = bar"}}
+	if !reflect.DeepEqual(lines[1].Segments, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", lines[1].Segments, want)
+	}
+}
+
+func TestAnalysisFiles_range(t *testing.T) {
+	diffReader := bytes.NewBuffer([]byte(`diff --git a/main.go b/main.go
+index 4810940..4090359 100644
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,4 @@
+ package main
+-func main() {}
++func main() {
++	println()
++}
+`))
+
+	issues := []db.Issue{
+		{Path: "main.go", Line: 2, EndLine: 3, Issue: "function is too long, lines 2-3"},
+	}
+
+	havePatches, err := DiffIssues(context.Background(), diffReader, issues)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(havePatches) != 1 || len(havePatches[0].Hunks) != 1 || len(havePatches[0].Hunks[0].Lines) != 5 {
+		t.Fatalf("unexpected patches: %#v", havePatches)
+	}
+	var have []bool
+	for _, line := range havePatches[0].Hunks[0].Lines {
+		have = append(have, line.InRange)
+	}
+	if want := []bool{false, false, true, true, false}; !reflect.DeepEqual(have, want) {
+		t.Errorf("in range have: %v, want: %v", have, want)
+	}
+}
+
+func TestIssueIndex(t *testing.T) {
+	issues := []db.Issue{
+		{Path: "main.go", Line: 2, Issue: "first"},
+		{Path: "other.go", Line: 2, Issue: "other file"},
+		{Path: "main.go", Line: 4, EndLine: 6, Issue: "range"},
+		{Path: "main.go", Line: 2, Issue: "second"},
+	}
+	idx := newIssueIndex(issues)
+
+	tests := []struct {
+		path        string
+		line        int
+		wantIssues  []db.Issue
+		wantInRange bool
+	}{
+		{"main.go", 1, nil, false},
+		{"main.go", 2, []db.Issue{issues[0], issues[3]}, false},
+		{"other.go", 2, []db.Issue{issues[1]}, false},
+		{"main.go", 4, []db.Issue{issues[2]}, true},
+		{"main.go", 6, nil, true},
+		{"main.go", 7, nil, false},
+		{"other.go", 5, nil, false},
+		{"missing.go", 2, nil, false},
+	}
+	for _, test := range tests {
+		haveIssues, haveInRange := idx.line(test.path, test.line)
+		if !reflect.DeepEqual(haveIssues, test.wantIssues) || haveInRange != test.wantInRange {
+			t.Errorf("%v:%v have: %v %v, want: %v %v", test.path, test.line, haveIssues, haveInRange, test.wantIssues, test.wantInRange)
+		}
+	}
+}
+
+// BenchmarkDiffIssues benchmarks a large analysis, where each file of the
+// diff is a new file with an issue on every tenth line.
+func BenchmarkDiffIssues(b *testing.B) {
+	const (
+		files = 50
+		lines = 1000
+	)
+	var (
+		buf    bytes.Buffer
+		issues []db.Issue
+	)
+	for f := 0; f < files; f++ {
+		path := fmt.Sprintf("file%d.go", f)
+		fmt.Fprintf(&buf, "diff --git a/%[1]s b/%[1]s\nnew file mode 100644\n--- /dev/null\n+++ b/%[1]s\n@@ -0,0 +1,%[2]d @@\n", path, lines)
+		for l := 1; l <= lines; l++ {
+			fmt.Fprintf(&buf, "+line %d\n", l)
+			if l%10 == 0 {
+				issues = append(issues, db.Issue{Path: path, Line: l, Issue: "issue"})
+			}
+		}
+	}
+	diff := buf.Bytes()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DiffIssues(context.Background(), bytes.NewReader(diff), issues); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	const line = "x := foo(bar_1)"
+	tests := []struct {
+		cols []int
+		want []Segment
+	}{
+		{nil, nil},
+		{[]int{0}, nil},  // unknown column
+		{[]int{16}, nil}, // beyond the line
+		{[]int{1}, []Segment{{Text: "x", Highlight: true}, {Text: " := foo(bar_1)"}}},
+		{[]int{3}, []Segment{{Text: "x "}, {Text: ":", Highlight: true}, {Text: "= foo(bar_1)"}}},
+		{[]int{10, 6}, []Segment{{Text: "x := "}, {Text: "foo", Highlight: true}, {Text: "("}, {Text: "bar_1", Highlight: true}, {Text: ")"}}},
+		{[]int{6, 7}, []Segment{{Text: "x := "}, {Text: "foo", Highlight: true}, {Text: "(bar_1)"}}}, // overlapping
+		{[]int{15}, []Segment{{Text: "x := foo(bar_1"}, {Text: ")", Highlight: true}}},
+	}
+
+	for _, test := range tests {
+		var issues []db.Issue
+		for _, col := range test.cols {
+			issues = append(issues, db.Issue{Column: col})
+		}
+		have := segments(line, issues)
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("cols %v\nhave: %#v\nwant: %#v", test.cols, have, test.want)
+		}
+	}
+}
@@ -1,19 +1,32 @@
 package web
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/db"
 	"github.com/bradleyfalzon/gopherci/internal/github"
 	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/bradleyfalzon/gopherci/internal/queue"
 	"github.com/go-chi/chi"
 )
 
 // Web handles general web/html responses (not API hooks).
 type Web struct {
+	// Pause pauses processing of the queue during maintenance, see
+	// MaintenanceHandler. Optional, may be set after NewWeb and before use.
+	Pause *queue.Pause
+	// Auth provides the CSRF tokens of forms, see Auth.RequireCSRF.
+	// Optional, may be set after NewWeb and before use.
+	Auth *Auth
+
 	logger    logger.Logger
 	db        db.DB
 	gh        *github.GitHub
@@ -84,13 +97,6 @@ func (web *Web) AnalysisHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	outputs, err := web.db.AnalysisOutputs(analysis.ID)
-	if err != nil {
-		logger.With("error", err).Error("cannot get analysis output")
-		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get analysis output")
-		return
-	}
-
 	vcs, err := NewVCS(web.gh, analysis)
 	if err != nil {
 		logger.With("error", err).Error("cannot get analysis VCS")
@@ -129,17 +135,615 @@ func (web *Web) AnalysisHandler(w http.ResponseWriter, r *http.Request) {
 		Title       string
 		Analysis    *db.Analysis
 		Patches     []Patch
-		Outputs     []db.Output
 		TotalIssues int
+		CSRFToken   string
 	}{
 		Title:       "Analysis",
 		Analysis:    analysis,
 		Patches:     patches,
-		Outputs:     outputs,
 		TotalIssues: len(analysis.Issues()),
+		CSRFToken:   web.csrfToken(r),
 	}
 
 	if err := web.templates.ExecuteTemplate(w, "analysis.tmpl", page); err != nil {
 		logger.With("error", err).Error("cannot parse analysis template")
 	}
 }
+
+// RerunHandler queues an analysis to be analysed again for the user
+// authenticated by Auth.RequireUser, who must have write access to the
+// repository, redirecting to the repository's analyses.
+func (web *Web) RerunHandler(w http.ResponseWriter, r *http.Request) {
+	analysisID, err := strconv.ParseInt(chi.URLParam(r, "analysisID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid analysis ID")
+		return
+	}
+
+	login := ContextUser(r.Context())
+	logger := web.logger.With("analysisID", analysisID).With("login", login)
+
+	analysis, err := web.db.GetAnalysis(int(analysisID))
+	if err != nil {
+		logger.With("error", err).Error("cannot get analysis")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get analysis")
+		return
+	}
+	if analysis == nil {
+		web.NotFoundHandler(w, r)
+		return
+	}
+
+	err = web.gh.Rerun(r.Context(), analysis, login)
+	switch {
+	case err == github.ErrRerunForbidden:
+		web.errorHandler(w, r, http.StatusForbidden, "Write access to the repository is required to re-run an analysis")
+		return
+	case github.IsIgnored(err):
+		logger.With("error", err).Info("cannot re-run ignored analysis")
+		web.errorHandler(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Analysis cannot be re-run: %s", err))
+		return
+	case err != nil:
+		logger.With("error", err).Error("cannot re-run analysis")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not re-run analysis")
+		return
+	}
+	logger.Info("queued analysis re-run")
+
+	http.Redirect(w, r, fmt.Sprintf("/repo/%d/analyses", analysis.RepositoryID), http.StatusSeeOther)
+}
+
+// AnalysisOutputsHandler writes the outputs of a single analysis as plain
+// text, in the order they were executed. See outputFilter for the optional
+// query parameters to filter and page the outputs.
+func (web *Web) AnalysisOutputsHandler(w http.ResponseWriter, r *http.Request) {
+	web.streamOutputs(w, r, "text/plain; charset=utf-8", func(w io.Writer, i int, output db.Output) error {
+		_, err := fmt.Fprintf(w, "$ %s (%v)\n%s\n\n", output.Arguments, output.Duration, output.Output)
+		return err
+	}, nil)
+}
+
+// jsonOutput is an output of an analysis returned by AnalysisOutputsJSONHandler.
+type jsonOutput struct {
+	Arguments string `json:"arguments"`
+	Duration  string `json:"duration"`
+	Output    string `json:"output"`
+}
+
+// AnalysisOutputsJSONHandler returns the outputs of an analysis as a JSON
+// array, used to lazy load outputs when displaying an analysis. See
+// outputFilter for the optional query parameters to filter and page the
+// outputs.
+func (web *Web) AnalysisOutputsJSONHandler(w http.ResponseWriter, r *http.Request) {
+	web.streamOutputs(w, r, "application/json", func(w io.Writer, i int, output db.Output) error {
+		prefix := ","
+		if i == 0 {
+			prefix = "["
+		}
+		js, err := json.Marshal(jsonOutput{
+			Arguments: output.Arguments,
+			Duration:  output.Duration.String(),
+			Output:    output.Output,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s%s\n", prefix, js)
+		return err
+	}, func(w io.Writer, n int) error {
+		suffix := "]"
+		if n == 0 {
+			suffix = "[]"
+		}
+		_, err := fmt.Fprintln(w, suffix)
+		return err
+	})
+}
+
+// streamOutputs writes the outputs of the analysis requested by r to w with
+// contentType, calling write with each output as it's read from the database
+// and flushing it to the client, so an analysis's outputs are never buffered
+// in memory. If finish is not nil, it's called with the number of outputs
+// after all outputs have been written.
+func (web *Web) streamOutputs(w http.ResponseWriter, r *http.Request, contentType string, write func(w io.Writer, i int, output db.Output) error, finish func(w io.Writer, n int) error) {
+	analysisID, err := strconv.ParseInt(chi.URLParam(r, "analysisID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid analysis ID")
+		return
+	}
+
+	filter, paged, err := outputFilter(r.URL.Query())
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid output filter")
+		return
+	}
+
+	logger := web.logger.With("analysisID", analysisID)
+
+	analysis, err := web.db.GetAnalysis(int(analysisID))
+	if err != nil {
+		logger.With("error", err).Error("cannot get analysis")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get analysis")
+		return
+	}
+
+	if analysis == nil {
+		web.NotFoundHandler(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	flusher, _ := w.(http.Flusher)
+	var n int
+	each := func(output db.Output) error {
+		if err := write(w, n, output); err != nil {
+			return err
+		}
+		n++
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	if paged {
+		var outputs []db.Output
+		outputs, err = web.db.AnalysisOutputsPage(analysis.ID, filter)
+		for i := 0; err == nil && i < len(outputs); i++ {
+			err = each(outputs[i])
+		}
+	} else {
+		err = web.db.EachAnalysisOutput(analysis.ID, each)
+	}
+	switch {
+	case err != nil && n == 0:
+		logger.With("error", err).Error("cannot get analysis output")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get analysis output")
+		return
+	case err != nil:
+		// The response has been partially written, so it's too late to
+		// respond with an error.
+		logger.With("error", err).Error("cannot write analysis output")
+		return
+	}
+	if finish != nil {
+		if err := finish(w, n); err != nil {
+			logger.With("error", err).Error("cannot write analysis output")
+		}
+	}
+}
+
+// outputFilter returns the filter set by the optional query parameters prefix,
+// exclude (which may be repeated), limit and offset. If none are set, paged
+// is false and all outputs should be returned.
+func outputFilter(query url.Values) (filter db.OutputFilter, paged bool, err error) {
+	filter.Prefix = query.Get("prefix")
+	for _, exclude := range query["exclude"] {
+		if exclude != "" {
+			filter.Exclude = append(filter.Exclude, exclude)
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 {
+			return filter, false, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil || filter.Offset < 0 {
+			return filter, false, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	paged = filter.Prefix != "" || len(filter.Exclude) > 0 || filter.Limit > 0 || filter.Offset > 0
+	return filter, paged, nil
+}
+
+// RecurringIssuesHandler displays issues that have been found in multiple
+// analyses of a repository. The optional min query parameter sets the minimum
+// number of analyses an issue must be found in, defaults to 2.
+func (web *Web) RecurringIssuesHandler(w http.ResponseWriter, r *http.Request) {
+	repositoryID, err := strconv.ParseInt(chi.URLParam(r, "repositoryID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid repository ID")
+		return
+	}
+
+	minCount := 2
+	if r.URL.Query().Get("min") != "" {
+		minCount, err = strconv.Atoi(r.URL.Query().Get("min"))
+		if err != nil || minCount < 1 {
+			web.errorHandler(w, r, http.StatusBadRequest, "Invalid minimum count")
+			return
+		}
+	}
+
+	logger := web.logger.With("repositoryID", repositoryID)
+
+	issues, err := web.db.RecurringIssues(int(repositoryID), minCount)
+	if err != nil {
+		logger.With("error", err).Error("cannot get recurring issues")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get recurring issues")
+		return
+	}
+
+	var page = struct {
+		Title        string
+		RepositoryID int64
+		MinCount     int
+		Issues       []db.RecurringIssue
+	}{
+		Title:        "Recurring Issues",
+		RepositoryID: repositoryID,
+		MinCount:     minCount,
+		Issues:       issues,
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "recurring.tmpl", page); err != nil {
+		logger.With("error", err).Error("cannot parse recurring template")
+	}
+}
+
+// AnalysesHandler displays the recent analyses of a repository. The optional
+// trigger, branch and author query parameters filter the analyses.
+func (web *Web) AnalysesHandler(w http.ResponseWriter, r *http.Request) {
+	repositoryID, err := strconv.ParseInt(chi.URLParam(r, "repositoryID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid repository ID")
+		return
+	}
+
+	filter := db.AnalysisFilter{
+		RepositoryID: int(repositoryID),
+		Trigger:      db.AnalysisTrigger(r.URL.Query().Get("trigger")),
+		Branch:       r.URL.Query().Get("branch"),
+		Author:       r.URL.Query().Get("author"),
+	}
+	switch filter.Trigger {
+	case "", db.AnalysisTriggerPush, db.AnalysisTriggerPullRequest, db.AnalysisTriggerFullScan:
+	default:
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid trigger")
+		return
+	}
+
+	logger := web.logger.With("repositoryID", repositoryID)
+
+	analyses, err := web.db.ListAnalyses(filter)
+	if err != nil {
+		logger.With("error", err).Error("cannot list analyses")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not list analyses")
+		return
+	}
+
+	var page = struct {
+		Title        string
+		RepositoryID int64
+		Filter       db.AnalysisFilter
+		Analyses     []db.Analysis
+	}{
+		Title:        "Analyses",
+		RepositoryID: repositoryID,
+		Filter:       filter,
+		Analyses:     analyses,
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "analyses.tmpl", page); err != nil {
+		logger.With("error", err).Error("cannot parse analyses template")
+	}
+}
+
+// FailedAnalysesHandler displays analyses of all repositories which finished
+// with an internal error in the last hours, defaulting to 24, with the output
+// of the last command executed to help operators triage.
+func (web *Web) FailedAnalysesHandler(w http.ResponseWriter, r *http.Request) {
+	hours := 24
+	if r.URL.Query().Get("hours") != "" {
+		var err error
+		hours, err = strconv.Atoi(r.URL.Query().Get("hours"))
+		if err != nil || hours < 1 {
+			web.errorHandler(w, r, http.StatusBadRequest, "Invalid hours")
+			return
+		}
+	}
+
+	analyses, err := web.db.ListFailedAnalyses(time.Now().Add(-time.Duration(hours) * time.Hour))
+	if err != nil {
+		web.logger.With("error", err).Error("cannot list failed analyses")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not list failed analyses")
+		return
+	}
+
+	var page = struct {
+		Title    string
+		Hours    int
+		Analyses []db.FailedAnalysis
+	}{
+		Title:    "Failed Analyses",
+		Hours:    hours,
+		Analyses: analyses,
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "failed.tmpl", page); err != nil {
+		web.logger.With("error", err).Error("cannot parse failed template")
+	}
+}
+
+// StaleInstallationsHandler displays enabled installations which haven't sent
+// a webhook in the last days, defaulting to 7, which may be misconfigured.
+func (web *Web) StaleInstallationsHandler(w http.ResponseWriter, r *http.Request) {
+	days := 7
+	if r.URL.Query().Get("days") != "" {
+		var err error
+		days, err = strconv.Atoi(r.URL.Query().Get("days"))
+		if err != nil || days < 1 {
+			web.errorHandler(w, r, http.StatusBadRequest, "Invalid days")
+			return
+		}
+	}
+
+	installations, err := web.db.ListStaleGHInstallations(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		web.logger.With("error", err).Error("cannot list stale installations")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not list stale installations")
+		return
+	}
+
+	var page = struct {
+		Title         string
+		Days          int
+		Installations []db.GHInstallation
+	}{
+		Title:         "Stale Installations",
+		Days:          days,
+		Installations: installations,
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "stale.tmpl", page); err != nil {
+		web.logger.With("error", err).Error("cannot parse stale template")
+	}
+}
+
+// jsonMigration is an applied migration returned by MigrationsHandler.
+type jsonMigration struct {
+	ID        string    `json:"id"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// MigrationsHandler returns the database's current schema version and the
+// applied migrations as JSON, so operators can verify a deploy's migrations.
+func (web *Web) MigrationsHandler(w http.ResponseWriter, r *http.Request) {
+	migrations, err := web.db.ListMigrations()
+	if err != nil {
+		web.logger.With("error", err).Error("cannot list migrations")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not list migrations")
+		return
+	}
+
+	page := struct {
+		Version    int             `json:"version"`
+		Migrations []jsonMigration `json:"migrations"`
+	}{Migrations: []jsonMigration{}}
+	for _, migration := range migrations {
+		page.Version = migration.Version()
+		page.Migrations = append(page.Migrations, jsonMigration{ID: migration.ID, AppliedAt: migration.AppliedAt})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		web.logger.With("error", err).Error("cannot encode migrations")
+	}
+}
+
+// InstallationReposHandler displays each repository analysed by an
+// installation, with the status and number of issues of its latest analysis.
+func (web *Web) InstallationReposHandler(w http.ResponseWriter, r *http.Request) {
+	installationID, err := strconv.ParseInt(chi.URLParam(r, "installationID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid installation ID")
+		return
+	}
+
+	logger := web.logger.With("installationID", installationID)
+
+	repos, err := web.db.ListInstallationRepositories(int(installationID))
+	if err != nil {
+		logger.With("error", err).Error("cannot list installation repositories")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not list repositories")
+		return
+	}
+
+	var page = struct {
+		Title          string
+		InstallationID int64
+		Repositories   []db.RepositorySummary
+		CSRFToken      string
+	}{
+		Title:          "Repositories",
+		InstallationID: installationID,
+		Repositories:   repos,
+		CSRFToken:      web.csrfToken(r),
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "installation-repos.tmpl", page); err != nil {
+		logger.With("error", err).Error("cannot parse installation repos template")
+	}
+}
+
+// RequireStatusChecksHandler adds GopherCI's pull request status as a required
+// status check to the protected default branches of an installation's
+// repositories, responding with the repositories updated, skipped and failed.
+func (web *Web) RequireStatusChecksHandler(w http.ResponseWriter, r *http.Request) {
+	installationID, err := strconv.ParseInt(chi.URLParam(r, "installationID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid installation ID")
+		return
+	}
+
+	logger := web.logger.With("installationID", installationID)
+
+	updated, skipped, failed, err := web.gh.RequireStatusChecks(r.Context(), int(installationID))
+	if err != nil {
+		logger.With("error", err).Error("cannot require status checks")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not require status checks")
+		return
+	}
+	logger.Infof("required status checks on %d repositories, skipped %d unprotected, %d failed", len(updated), len(skipped), len(failed))
+
+	var failedRepos []string
+	for repo, err := range failed {
+		logger.With("repo", repo).With("error", err).Error("cannot require status check")
+		failedRepos = append(failedRepos, repo)
+	}
+	sort.Strings(failedRepos)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, repo := range updated {
+		fmt.Fprintf(w, "required: %s\n", repo)
+	}
+	for _, repo := range skipped {
+		fmt.Fprintf(w, "skipped, default branch does not require status checks: %s\n", repo)
+	}
+	for _, repo := range failedRepos {
+		fmt.Fprintf(w, "failed: %s: %s\n", repo, failed[repo])
+	}
+}
+
+// csrfToken returns the CSRF token for forms in r's response, or a blank
+// string if web has no Auth.
+func (web *Web) csrfToken(r *http.Request) string {
+	if web.Auth == nil {
+		return ""
+	}
+	return web.Auth.CSRFToken(r)
+}
+
+// MaintenanceHandler displays whether processing of the queue is paused for
+// maintenance. Events continue to be queued while paused. If the request is a
+// POST, the action form value first pauses or resumes processing. The pause is
+// stored in the database, so it applies to every instance, see Pause.Watch,
+// and this instance's Pause is set immediately.
+func (web *Web) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if web.Pause == nil {
+		web.NotFoundHandler(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var paused bool
+		switch action := r.FormValue("action"); action {
+		case "pause":
+			paused = true
+		case "resume":
+		default:
+			web.errorHandler(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid action %q, must be pause or resume", action))
+			return
+		}
+		if err := web.db.SetQueuePaused(paused); err != nil {
+			web.logger.With("error", err).Error("cannot set queue paused")
+			web.errorHandler(w, r, http.StatusInternalServerError, "Could not pause or resume the queue")
+			return
+		}
+		if paused {
+			web.Pause.Pause()
+			web.logger.Info("paused queue for maintenance")
+		} else {
+			web.Pause.Resume()
+			web.logger.Info("resumed queue after maintenance")
+		}
+	}
+
+	paused, err := web.db.QueuePaused()
+	if err != nil {
+		web.logger.With("error", err).Error("cannot get queue paused")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get whether the queue is paused")
+		return
+	}
+
+	var page = struct {
+		Title     string
+		Paused    bool
+		CSRFToken string
+	}{
+		Title:     "Maintenance",
+		Paused:    paused,
+		CSRFToken: web.csrfToken(r),
+	}
+
+	if err := web.templates.ExecuteTemplate(w, "maintenance.tmpl", page); err != nil {
+		web.logger.With("error", err).Error("cannot parse maintenance template")
+	}
+}
+
+// badgeDefaultBranch is the branch shown by a badge without a branch query
+// parameter.
+const badgeDefaultBranch = "master"
+
+// BadgeHandler displays an SVG badge with the result of the latest analysis
+// of a push to a repository's branch, for use in a repository's README. The
+// branch is set by the branch query parameter, such as badge.svg?branch=main,
+// defaulting to badgeDefaultBranch.
+func (web *Web) BadgeHandler(w http.ResponseWriter, r *http.Request) {
+	repositoryID, err := strconv.ParseInt(chi.URLParam(r, "repositoryID"), 10, 32)
+	if err != nil {
+		web.errorHandler(w, r, http.StatusBadRequest, "Invalid repository ID")
+		return
+	}
+
+	branch := r.URL.Query().Get("branch")
+	if branch == "" {
+		branch = badgeDefaultBranch
+	}
+
+	logger := web.logger.With("repositoryID", repositoryID).With("branch", branch)
+
+	analysis, err := web.db.LatestAnalysis(int(repositoryID), branch)
+	if err != nil {
+		logger.With("error", err).Error("cannot get latest analysis")
+		web.errorHandler(w, r, http.StatusInternalServerError, "Could not get latest analysis")
+		return
+	}
+
+	var message, color string
+	switch {
+	case analysis == nil:
+		message, color = "unknown", "#9f9f9f"
+	case len(analysis.Issues()) == 0:
+		message, color = "passing", "#4c1"
+	default:
+		message, color = fmt.Sprintf("issues: %d", len(analysis.Issues())), "#e05d44"
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// Allow badges to be cached briefly, as they're often proxied by GitHub.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Del("Expires")
+	w.Header().Del("Pragma")
+
+	if err := web.templates.ExecuteTemplate(w, "badge.tmpl", newBadge("gopherci", message, color)); err != nil {
+		logger.With("error", err).Error("cannot parse badge template")
+	}
+}
+
+// badge contains the text and dimensions of an SVG badge.
+type badge struct {
+	Label, Message, Color  string
+	LabelWidth, LabelX     int
+	MessageWidth, MessageX int
+	Width                  int
+}
+
+// newBadge returns a badge with dimensions estimated from the text's length.
+func newBadge(label, message, color string) badge {
+	const (
+		charWidth = 7  // approximate width of a character in pixels
+		padding   = 10 // total horizontal padding of each section
+	)
+	b := badge{
+		Label:        label,
+		Message:      message,
+		Color:        color,
+		LabelWidth:   len(label)*charWidth + padding,
+		MessageWidth: len(message)*charWidth + padding,
+	}
+	b.Width = b.LabelWidth + b.MessageWidth
+	b.LabelX = b.LabelWidth / 2
+	b.MessageX = b.LabelWidth + b.MessageWidth/2
+	return b
+}
@@ -0,0 +1,586 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/db"
+	"github.com/bradleyfalzon/gopherci/internal/logger"
+	"github.com/bradleyfalzon/gopherci/internal/queue"
+	"github.com/go-chi/chi"
+	"github.com/google/go-cmp/cmp"
+)
+
+func setup(t *testing.T) (*Web, *db.MockDB, chi.Router) {
+	templates, err := template.ParseGlob("templates/*.tmpl")
+	if err != nil {
+		t.Fatalf("could not parse templates: %v", err)
+	}
+
+	memDB := db.NewMockDB()
+	web := &Web{
+		logger:    logger.Testing(),
+		db:        memDB,
+		templates: templates,
+	}
+
+	r := chi.NewRouter()
+	r.Get("/analysis/{analysisID}/outputs.txt", web.AnalysisOutputsHandler)
+	r.Get("/analysis/{analysisID}/outputs.json", web.AnalysisOutputsJSONHandler)
+	r.Post("/analysis/{analysisID}/rerun", web.RerunHandler)
+	r.Get("/repo/{repositoryID}/analyses", web.AnalysesHandler)
+	r.Get("/repo/{repositoryID}/badge.svg", web.BadgeHandler)
+	r.Get("/admin/failed-analyses", web.FailedAnalysesHandler)
+	r.Get("/admin/stale-installations", web.StaleInstallationsHandler)
+	r.Get("/admin/migrations", web.MigrationsHandler)
+	r.Get("/admin/maintenance", web.MaintenanceHandler)
+	r.Post("/admin/maintenance", web.MaintenanceHandler)
+	r.Get("/installation/{installationID}/repos", web.InstallationReposHandler)
+	return web, memDB, r
+}
+
+func TestAnalysisOutputsHandler(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	memDB.Analysis = db.NewAnalysis()
+	memDB.Analysis.ID = 10
+	memDB.Outputs = []db.Output{
+		{ID: 1, AnalysisID: 10, Arguments: "go env", Duration: db.Duration(time.Second), Output: "GOPATH=/go"},
+		{ID: 2, AnalysisID: 10, Arguments: "go version", Duration: db.Duration(2 * time.Second), Output: "go version go1.9 linux/amd64"},
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/analysis/10/outputs.txt", nil))
+
+	if want := http.StatusOK; w.Code != want {
+		t.Errorf("code have: %v, want: %v", w.Code, want)
+	}
+
+	if want := "text/plain; charset=utf-8"; w.Header().Get("Content-Type") != want {
+		t.Errorf("content type have: %q, want: %q", w.Header().Get("Content-Type"), want)
+	}
+
+	want := "$ go env (1s)\nGOPATH=/go\n\n$ go version (2s)\ngo version go1.9 linux/amd64\n\n"
+	if diff := cmp.Diff(w.Body.String(), want); diff != "" {
+		t.Errorf("unexpected body (-have +want)\n%s", diff)
+	}
+}
+
+func TestAnalysisOutputsJSONHandler(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	memDB.Analysis = db.NewAnalysis()
+	memDB.Analysis.ID = 10
+
+	// No outputs
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/analysis/10/outputs.json", nil))
+	if want := "[]\n"; w.Body.String() != want {
+		t.Errorf("body have: %q, want: %q", w.Body.String(), want)
+	}
+
+	memDB.Outputs = []db.Output{
+		{ID: 1, AnalysisID: 10, Arguments: "go env", Duration: db.Duration(time.Second), Output: "GOPATH=/go"},
+		{ID: 2, AnalysisID: 10, Arguments: "go version", Duration: db.Duration(2 * time.Second), Output: "<go1.9>"},
+		{ID: 3, AnalysisID: 11, Arguments: "other analysis"},
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/analysis/10/outputs.json", nil))
+
+	if want := http.StatusOK; w.Code != want {
+		t.Errorf("code have: %v, want: %v", w.Code, want)
+	}
+	if want := "application/json"; w.Header().Get("Content-Type") != want {
+		t.Errorf("content type have: %q, want: %q", w.Header().Get("Content-Type"), want)
+	}
+
+	var have []jsonOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &have); err != nil {
+		t.Fatalf("could not unmarshal %q: %v", w.Body.String(), err)
+	}
+	want := []jsonOutput{
+		{Arguments: "go env", Duration: "1s", Output: "GOPATH=/go"},
+		{Arguments: "go version", Duration: "2s", Output: "<go1.9>"},
+	}
+	if diff := cmp.Diff(have, want); diff != "" {
+		t.Errorf("unexpected outputs (-have +want)\n%s", diff)
+	}
+}
+
+// flushRecorder is a ResponseRecorder which records the body at each flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []string
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.Body.String())
+	f.ResponseRecorder.Flush()
+}
+
+func TestAnalysisOutputsHandler_streaming(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	memDB.Analysis = db.NewAnalysis()
+	memDB.Analysis.ID = 10
+	memDB.Outputs = []db.Output{
+		{ID: 1, AnalysisID: 10, Arguments: "first", Output: "output 1"},
+		{ID: 2, AnalysisID: 10, Arguments: "second", Output: "output 2"},
+		{ID: 3, AnalysisID: 10, Arguments: "third", Output: "output 3"},
+	}
+
+	for _, url := range []string{"/analysis/10/outputs.txt", "/analysis/10/outputs.json"} {
+		w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		r.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+		// Each output must be sent to the client before the next is read.
+		if len(w.flushed) != len(memDB.Outputs) {
+			t.Fatalf("%v: flushes have: %v, want: %v", url, len(w.flushed), len(memDB.Outputs))
+		}
+		for i, body := range w.flushed {
+			if want := memDB.Outputs[i].Output; !strings.Contains(body, want) {
+				t.Errorf("%v: flush %d does not contain %q: %q", url, i, want, body)
+			}
+			if i+1 < len(memDB.Outputs) && strings.Contains(body, memDB.Outputs[i+1].Output) {
+				t.Errorf("%v: flush %d contains next output: %q", url, i, body)
+			}
+		}
+	}
+}
+
+func TestAnalysisOutputsHandler_filter(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	memDB.Analysis = db.NewAnalysis()
+	memDB.Analysis.ID = 10
+	memDB.Outputs = []db.Output{
+		{ID: 1, AnalysisID: 10, Arguments: "go env", Output: "env"},
+		{ID: 2, AnalysisID: 10, Arguments: "go version", Output: "version"},
+		{ID: 3, AnalysisID: 10, Arguments: "golint ./...", Output: "golint"},
+		{ID: 4, AnalysisID: 10, Arguments: "go vet ./...", Output: "vet"},
+		{ID: 5, AnalysisID: 11, Arguments: "golint ./...", Output: "other analysis"},
+	}
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     []string
+	}{
+		{"", http.StatusOK, []string{"env", "version", "golint", "vet"}},
+		{"?prefix=golint", http.StatusOK, []string{"golint"}},
+		{"?exclude=go+env&exclude=go+version", http.StatusOK, []string{"golint", "vet"}},
+		{"?limit=2", http.StatusOK, []string{"env", "version"}},
+		{"?limit=2&offset=1", http.StatusOK, []string{"version", "golint"}},
+		{"?exclude=go+env&offset=2", http.StatusOK, []string{"vet"}},
+		{"?offset=10", http.StatusOK, nil},
+		{"?limit=0", http.StatusBadRequest, nil},
+		{"?offset=-1", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/analysis/10/outputs.json"+test.query, nil))
+
+		if w.Code != test.wantCode {
+			t.Errorf("query %q code have: %v, want: %v", test.query, w.Code, test.wantCode)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var outputs []jsonOutput
+		if err := json.Unmarshal(w.Body.Bytes(), &outputs); err != nil {
+			t.Fatalf("query %q could not unmarshal %q: %v", test.query, w.Body.String(), err)
+		}
+		var have []string
+		for _, output := range outputs {
+			have = append(have, output.Output)
+		}
+		if diff := cmp.Diff(have, test.want); diff != "" {
+			t.Errorf("query %q unexpected outputs (-have +want)\n%s", test.query, diff)
+		}
+	}
+}
+
+func TestAnalysisOutputsHandler_notFound(t *testing.T) {
+	_, _, r := setup(t)
+
+	tests := []struct {
+		url      string
+		wantCode int
+	}{
+		{"/analysis/10/outputs.txt", http.StatusNotFound},
+		{"/analysis/abc/outputs.txt", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+
+		if w.Code != test.wantCode {
+			t.Errorf("url: %v code have: %v, want: %v", test.url, w.Code, test.wantCode)
+		}
+	}
+}
+
+func TestBadgeHandler(t *testing.T) {
+	tests := []struct {
+		branch  string // branch is the analysed branch.
+		url     string
+		issues  []db.Issue
+		want    string
+		notWant string
+	}{
+		{"master", "/repo/5/badge.svg", nil, "passing", "issues:"},
+		{"master", "/repo/5/badge.svg", []db.Issue{{Issue: "issue1"}, {Issue: "issue2"}}, "issues: 2", "passing"},
+		{"main", "/repo/5/badge.svg?branch=main", nil, "passing", "issues:"},
+		{"feature", "/repo/5/badge.svg", nil, "unknown", "passing"},
+	}
+
+	for _, test := range tests {
+		_, memDB, r := setup(t)
+		memDB.Analysis = db.NewAnalysis()
+		memDB.Analysis.ID = 10
+		memDB.Analysis.RepositoryID = 5
+		memDB.Analysis.Branch = test.branch
+		memDB.Analysis.Tools[1] = db.AnalysisTool{ToolID: 1, Issues: test.issues}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("code have: %v, want: %v", w.Code, http.StatusOK)
+		}
+		if have, want := w.Header().Get("Content-Type"), "image/svg+xml"; have != want {
+			t.Errorf("content type have: %q, want: %q", have, want)
+		}
+		if have, want := w.Header().Get("Cache-Control"), "public, max-age=300"; have != want {
+			t.Errorf("cache control have: %q, want: %q", have, want)
+		}
+		body := w.Body.String()
+		if !strings.HasPrefix(body, "<svg") {
+			t.Errorf("body is not svg: %q", body)
+		}
+		if !strings.Contains(body, ">"+test.want+"</text>") {
+			t.Errorf("body does not contain %q: %q", test.want, body)
+		}
+		if strings.Contains(body, test.notWant) {
+			t.Errorf("body contains %q: %q", test.notWant, body)
+		}
+	}
+}
+
+func TestBadgeHandler_unknown(t *testing.T) {
+	_, _, r := setup(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/repo/5/badge.svg", nil))
+
+	if !strings.Contains(w.Body.String(), ">unknown</text>") {
+		t.Errorf("body does not contain unknown: %q", w.Body.String())
+	}
+}
+
+func TestAnalysesHandler(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	memDB.Analyses = []db.Analysis{
+		{ID: 11, RepositoryID: 2, Trigger: db.AnalysisTriggerPush, Branch: "master", Author: "gopher", Status: db.AnalysisStatusSuccess},
+		{ID: 12, RepositoryID: 2, Trigger: db.AnalysisTriggerPullRequest, RequestNumber: 3, Branch: "feature", Author: "contributor", Status: db.AnalysisStatusFailure},
+	}
+
+	tests := []struct {
+		url      string
+		wantCode int
+		want     []string
+		notWant  []string
+	}{
+		{"/repo/2/analyses", http.StatusOK, []string{"/analysis/11", "/analysis/12"}, nil},
+		{"/repo/2/analyses?trigger=push", http.StatusOK, []string{"/analysis/11"}, []string{"/analysis/12"}},
+		{"/repo/2/analyses?author=contributor", http.StatusOK, []string{"/analysis/12"}, []string{"/analysis/11"}},
+		{"/repo/2/analyses?branch=other", http.StatusOK, []string{"No analyses found"}, []string{"/analysis/11", "/analysis/12"}},
+		{"/repo/2/analyses?trigger=unknown", http.StatusBadRequest, nil, nil},
+		{"/repo/abc/analyses", http.StatusBadRequest, nil, nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+
+		if w.Code != test.wantCode {
+			t.Errorf("url: %v code have: %v, want: %v", test.url, w.Code, test.wantCode)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("url: %v body does not contain %q", test.url, want)
+			}
+		}
+		for _, notWant := range test.notWant {
+			if strings.Contains(w.Body.String(), notWant) {
+				t.Errorf("url: %v body contains %q", test.url, notWant)
+			}
+		}
+	}
+}
+
+func TestMigrationsHandler(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	applied := time.Date(2017, 9, 15, 10, 30, 0, 0, time.UTC)
+	memDB.Migrations = []db.Migration{
+		{ID: "10_analysis_environment.sql", AppliedAt: applied},
+		{ID: "1_gh_installations.sql", AppliedAt: applied},
+		{ID: "2_tools.sql", AppliedAt: applied},
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/migrations", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("code have: %v, want: %v", w.Code, http.StatusOK)
+	}
+	if have, want := w.Header().Get("Content-Type"), "application/json"; have != want {
+		t.Errorf("content type have: %q, want: %q", have, want)
+	}
+	want := `{"version":10,"migrations":[` +
+		`{"id":"1_gh_installations.sql","applied_at":"2017-09-15T10:30:00Z"},` +
+		`{"id":"2_tools.sql","applied_at":"2017-09-15T10:30:00Z"},` +
+		`{"id":"10_analysis_environment.sql","applied_at":"2017-09-15T10:30:00Z"}]}` + "\n"
+	if have := w.Body.String(); have != want {
+		t.Errorf("body\nhave: %s\nwant: %s", have, want)
+	}
+
+	// Errors are reported
+	memDB.ForceError(errors.New("forced"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/migrations", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("code have: %v, want: %v", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRerunHandler(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	memDB.Analysis = db.NewAnalysis()
+	memDB.Analysis.ID = 10
+
+	tests := []struct {
+		url      string
+		wantCode int
+	}{
+		{"/analysis/abc/rerun", http.StatusBadRequest},
+		{"/analysis/11/rerun", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", test.url, nil))
+		if w.Code != test.wantCode {
+			t.Errorf("url: %v code have: %v, want: %v", test.url, w.Code, test.wantCode)
+		}
+	}
+
+	// Errors are reported
+	memDB.ForceError(errors.New("forced"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/analysis/10/rerun", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("code have: %v, want: %v", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestFailedAnalysesHandler(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	memDB.Analyses = []db.Analysis{
+		{ID: 11, RepositoryID: 2, Status: db.AnalysisStatusError, CreatedAt: time.Now().Add(-time.Hour)},
+		{ID: 12, RepositoryID: 2, Status: db.AnalysisStatusError, CreatedAt: time.Now().Add(-48 * time.Hour)},
+		{ID: 13, RepositoryID: 2, Status: db.AnalysisStatusSuccess, CreatedAt: time.Now()},
+	}
+	memDB.Outputs = []db.Output{
+		{ID: 1, AnalysisID: 11, Arguments: "go get", Output: "could not fetch"},
+	}
+
+	tests := []struct {
+		url      string
+		wantCode int
+		want     []string
+		notWant  []string
+	}{
+		{"/admin/failed-analyses", http.StatusOK, []string{"/analysis/11", "go get", "could not fetch"}, []string{"/analysis/12", "/analysis/13"}},
+		{"/admin/failed-analyses?hours=72", http.StatusOK, []string{"/analysis/11", "/analysis/12"}, []string{"/analysis/13"}},
+		{"/admin/failed-analyses?hours=0", http.StatusBadRequest, nil, nil},
+		{"/admin/failed-analyses?hours=abc", http.StatusBadRequest, nil, nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+
+		if w.Code != test.wantCode {
+			t.Errorf("url: %v code have: %v, want: %v", test.url, w.Code, test.wantCode)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("url: %v body does not contain %q", test.url, want)
+			}
+		}
+		for _, notWant := range test.notWant {
+			if strings.Contains(w.Body.String(), notWant) {
+				t.Errorf("url: %v body contains %q", test.url, notWant)
+			}
+		}
+	}
+}
+
+func TestStaleInstallationsHandler(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	for installationID, lastEvent := range map[int]time.Duration{
+		1: time.Hour,
+		2: 72 * time.Hour,
+		3: 0, // never
+	} {
+		memDB.AddGHInstallation(1, installationID, 10+installationID, 20)
+		memDB.EnableGHInstallation(installationID)
+		if lastEvent > 0 {
+			memDB.RecordGHInstallationEvent(installationID, time.Now().Add(-lastEvent))
+		}
+	}
+
+	tests := []struct {
+		url      string
+		wantCode int
+		want     []string
+		notWant  []string
+	}{
+		{"/admin/stale-installations", http.StatusOK, []string{"/installation/3/repos", "never"}, []string{"/installation/1/", "/installation/2/"}},
+		{"/admin/stale-installations?days=1", http.StatusOK, []string{"/installation/2/repos", "/installation/3/repos"}, []string{"/installation/1/"}},
+		{"/admin/stale-installations?days=0", http.StatusBadRequest, nil, nil},
+		{"/admin/stale-installations?days=abc", http.StatusBadRequest, nil, nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+
+		if w.Code != test.wantCode {
+			t.Errorf("url: %v code have: %v, want: %v", test.url, w.Code, test.wantCode)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("url: %v body does not contain %q", test.url, want)
+			}
+		}
+		for _, notWant := range test.notWant {
+			if strings.Contains(w.Body.String(), notWant) {
+				t.Errorf("url: %v body contains %q", test.url, notWant)
+			}
+		}
+	}
+}
+
+func TestInstallationReposHandler(t *testing.T) {
+	_, memDB, r := setup(t)
+
+	memDB.Analyses = []db.Analysis{
+		{ID: 11, InstallationID: 1, RepositoryID: 2, Status: db.AnalysisStatusSuccess, CreatedAt: time.Now()},
+		{ID: 12, InstallationID: 1, RepositoryID: 3, Status: db.AnalysisStatusFailure, CreatedAt: time.Now(), Tools: map[db.ToolID]db.AnalysisTool{
+			1: {Issues: []db.Issue{{Issue: "first"}, {Issue: "second"}}},
+		}},
+		{ID: 13, InstallationID: 2, RepositoryID: 4, Status: db.AnalysisStatusSuccess, CreatedAt: time.Now()},
+	}
+
+	tests := []struct {
+		url      string
+		wantCode int
+		want     []string
+		notWant  []string
+	}{
+		{"/installation/1/repos", http.StatusOK, []string{"/repo/2/analyses", "/analysis/11", "/repo/3/analyses", "/analysis/12", "<td>2</td>", "/admin/installation/1/require-status-checks"}, []string{"/repo/4/analyses"}},
+		{"/installation/5/repos", http.StatusOK, []string{"No repositories have been analysed."}, nil},
+		{"/installation/abc/repos", http.StatusBadRequest, nil, nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+
+		if w.Code != test.wantCode {
+			t.Errorf("url: %v code have: %v, want: %v", test.url, w.Code, test.wantCode)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("url: %v body does not contain %q", test.url, want)
+			}
+		}
+		for _, notWant := range test.notWant {
+			if strings.Contains(w.Body.String(), notWant) {
+				t.Errorf("url: %v body contains %q", test.url, notWant)
+			}
+		}
+	}
+}
+
+func TestMaintenanceHandler(t *testing.T) {
+	web, memDB, r := setup(t)
+
+	// Not available without a pause
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/maintenance", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("code have: %v, want: %v", w.Code, http.StatusNotFound)
+	}
+
+	web.Pause = &queue.Pause{}
+	tests := []struct {
+		method, action string
+		wantCode       int
+		wantPaused     bool
+	}{
+		{"GET", "", http.StatusOK, false},
+		{"POST", "pause", http.StatusOK, true},
+		{"GET", "", http.StatusOK, true},
+		{"POST", "stop", http.StatusBadRequest, true},
+		{"POST", "resume", http.StatusOK, false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/admin/maintenance", strings.NewReader("action="+test.action))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.wantCode {
+			t.Errorf("%v %q code have: %v, want: %v", test.method, test.action, w.Code, test.wantCode)
+		}
+		if have := web.Pause.Paused(); have != test.wantPaused {
+			t.Errorf("%v %q paused have: %v, want: %v", test.method, test.action, have, test.wantPaused)
+		}
+		if have, _ := memDB.QueuePaused(); have != test.wantPaused {
+			t.Errorf("%v %q stored paused have: %v, want: %v", test.method, test.action, have, test.wantPaused)
+		}
+		if test.wantCode == http.StatusOK && strings.Contains(w.Body.String(), `value="resume"`) != test.wantPaused {
+			t.Errorf("%v %q unexpected body: %q", test.method, test.action, w.Body.String())
+		}
+	}
+
+	// Errors are reported
+	memDB.ForceError(errors.New("forced"))
+	req := httptest.NewRequest("POST", "/admin/maintenance", strings.NewReader("action=pause"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("code have: %v, want: %v", w.Code, http.StatusInternalServerError)
+	}
+	if web.Pause.Paused() {
+		t.Error("paused although the pause could not be stored")
+	}
+}
@@ -3,20 +3,26 @@ package main
 import (
 	"context"
 	"database/sql"
+	"expvar"
 	"fmt"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/bradleyfalzon/gopherci/internal/analyser"
+	"github.com/bradleyfalzon/gopherci/internal/config"
 	"github.com/bradleyfalzon/gopherci/internal/db"
 	"github.com/bradleyfalzon/gopherci/internal/github"
 	"github.com/bradleyfalzon/gopherci/internal/logger"
 	"github.com/bradleyfalzon/gopherci/internal/queue"
+	"github.com/bradleyfalzon/gopherci/internal/scheduler"
+	"github.com/bradleyfalzon/gopherci/internal/secrets"
+	"github.com/bradleyfalzon/gopherci/internal/transport"
 	"github.com/bradleyfalzon/gopherci/internal/web"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -30,51 +36,60 @@ import (
 // build tracks the build version of the binary.
 var build string
 
+// pauseWatchInterval is how often the queue's pause is read from the
+// database, so pausing from any instance applies to all instances.
+const pauseWatchInterval = 10 * time.Second
+
 func main() {
 	// Load environment from .env, ignore errors as it's optional and dev only
 	_ = godotenv.Load()
 
-	rootLogger := logger.New(os.Stdout, build, os.Getenv("LOGGER_ENV"), os.Getenv("LOGGER_SENTRY_DSN"))
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		// Print the effective configuration, to debug deployments.
+		if err := config.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, cfgErr := config.Load()
+
+	rootLogger := logger.New(os.Stdout, build, cfg.LoggerEnv, cfg.LoggerSentryDSN, cfg.LoggerSentryRoutes)
 	logger := rootLogger.With("area", "main")
 	logger.With("build", build).Info("starting gopherci")
+	if cfgErr != nil {
+		logger.With("error", cfgErr).Fatal("could not load configuration")
+	}
+
+	router := chi.NewRouter()
+	router.Use(github.PeerAddr)   // Record the connection's peer for webhook origins
+	router.Use(middleware.RealIP) // Blindly accept XFF header, ensure LB overwrites it
+	router.Use(middleware.DefaultCompress)
+	router.Use(middleware.Recoverer)
+	router.Use(middleware.NoCache)
 
-	r := chi.NewRouter()
-	r.Use(middleware.RealIP) // Blindly accept XFF header, ensure LB overwrites it
-	r.Use(middleware.DefaultCompress)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.NoCache)
+	// Routes are registered on r with the handler timeout, those streaming
+	// responses are registered on router without it.
+	r := router.With(handlerTimeout(time.Duration(cfg.HTTPHandlerTimeout) * time.Second))
 
 	// http server for graceful shutdown
-	srv := &http.Server{
-		Addr:    ":3000",
-		Handler: r,
-	}
+	srv := newServer(cfg, ":3000", router)
 
 	// Graceful shutdown handler
 	ctx, cancel := context.WithCancel(context.Background())
 	go SignalHandler(rootLogger.With("area", "signalHandler"), cancel, srv)
 
-	switch {
-	case os.Getenv("GCI_BASE_URL") == "":
+	if cfg.BaseURL == "" {
 		logger.Info("GCI_BASE_URL is blank, URLs linking back to GopherCI will not work")
-	case os.Getenv("GITHUB_ID") == "":
-		logger.Error("GITHUB_ID is not set")
-	case os.Getenv("GITHUB_PEM_FILE") == "":
-		logger.Fatal("GITHUB_PEM_FILE is not set")
-	case os.Getenv("GITHUB_WEBHOOK_SECRET") == "":
-		logger.Fatal("GITHUB_WEBHOOK_SECRET is not set")
 	}
 
 	// Database
 	logger.Infof("connecting to %q db name: %q, username: %q, host: %q, port: %q",
-		os.Getenv("DB_DRIVER"), os.Getenv("DB_DATABASE"), os.Getenv("DB_USERNAME"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"),
-	)
-
-	dsn := fmt.Sprintf(`%s:%s@tcp(%s:%s)/%s?charset=utf8&collation=utf8_unicode_ci&timeout=6s&time_zone='%%2B00:00'&parseTime=true`,
-		os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_DATABASE"),
+		cfg.DB.Driver, cfg.DB.Database, cfg.DB.Username, cfg.DB.Host, cfg.DB.Port,
 	)
 
-	sqlDB, err := sql.Open(os.Getenv("DB_DRIVER"), dsn)
+	sqlDB, err := sql.Open(cfg.DB.Driver, cfg.DB.DSN())
 	if err != nil {
 		logger.With("error", err).Fatal("could not open database")
 	}
@@ -88,110 +103,289 @@ func main() {
 		direction = migrate.Down
 		migrateMax = 1
 	}
-	n, err := migrate.ExecMax(sqlDB, os.Getenv("DB_DRIVER"), migrations, direction, migrateMax)
+	n, err := migrate.ExecMax(sqlDB, cfg.DB.Driver, migrations, direction, migrateMax)
 	logger.Infof("applied %d migrations to database", n)
 	if err != nil {
 		logger.With("error", err).Fatal("could not execute all migrations")
 	}
 
-	db, err := db.NewSQLDB(sqlDB, os.Getenv("DB_DRIVER"))
+	gciDB, err := db.NewSQLDB(sqlDB, cfg.DB.Driver)
 	if err != nil {
 		logger.With("error", err).Fatal("could not initialise database")
 	}
-	go db.Cleanup(ctx, rootLogger.With("area", "db"))
-
-	var analyserMemoryLimit int64
-	if os.Getenv("ANALYSER_MEMORY_LIMIT") != "" {
-		analyserMemoryLimit, err = strconv.ParseInt(os.Getenv("ANALYSER_MEMORY_LIMIT"), 10, 32)
+	gciDB.MaxOutput = cfg.DB.MaxOutput
+	gciDB.MaxDiffOutput = cfg.DB.MaxDiffOutput
+	gciDB.AnalysisRetention = time.Duration(cfg.DB.AnalysisRetention) * 24 * time.Hour
+	gciDB.MaxIssues = cfg.DB.MaxIssues
+	go gciDB.Cleanup(ctx, rootLogger.With("area", "db"))
+
+	if cfg.DB.SeedTools {
+		n, err := db.SeedTools(gciDB, db.DefaultTools)
 		if err != nil {
-			logger.With("error", err).Fatal("could not parse ANALYSER_MEMORY_LIMIT")
+			logger.With("error", err).Fatal("could not seed tools")
+		}
+		if n > 0 {
+			logger.Infof("no tools found, seeded %d default tools", n)
 		}
 	}
 
+	// Report tools which analyses will skip, rather than only when analysing.
+	tools, err := gciDB.ListTools()
+	if err != nil {
+		logger.With("error", err).Fatal("could not list tools")
+	}
+	_, invalid := db.ValidTools(tools)
+	for _, err := range invalid {
+		logger.With("error", err).Error("tool will be skipped by analyses")
+	}
+
 	// Analyser
-	logger.Infof("using analyser %q", os.Getenv("ANALYSER"))
-	var analyse analyser.Analyser
-	switch os.Getenv("ANALYSER") {
+	logger.Infof("using analyser %q", cfg.Analyser.Type)
+	var (
+		analyse        analyser.Analyser
+		dockerAnalyser *analyser.Docker
+	)
+	goModuleEnv := analyser.GoModuleEnv{
+		Proxy:   cfg.Analyser.GoProxy,
+		NoSumDB: cfg.Analyser.GoNoSumDB,
+		Private: cfg.Analyser.GoPrivate,
+	}
+	switch cfg.Analyser.Type {
 	case "filesystem":
-		if os.Getenv("ANALYSER_FILESYSTEM_PATH") == "" {
-			logger.Fatal("ANALYSER_FILESYSTEM_PATH is not set")
-		}
-		analyse, err = analyser.NewFileSystem(os.Getenv("ANALYSER_FILESYSTEM_PATH"), int(analyserMemoryLimit))
+		fs, err := analyser.NewFileSystem(cfg.Analyser.FileSystemPath, cfg.Analyser.MemoryLimit)
 		if err != nil {
 			logger.Fatal("could not initialise file system analyser:", err)
 		}
+		fs.MaxWorkspaces = cfg.Analyser.FileSystemMaxWorkspaces
+		fs.MaxDiskUsage = int64(cfg.Analyser.FileSystemMaxDiskUsage) * 1024 * 1024
+		fs.GitSSHKeyFile = cfg.Analyser.GitSSHKeyFile
+		fs.GitSSHKnownHostsFile = cfg.Analyser.GitSSHKnownHostsFile
+		fs.GoModuleEnv = goModuleEnv
+		fs.KeepOnFailure = cfg.Analyser.KeepOnFailure
+		analyse = fs
 	case "docker":
-		image := os.Getenv("ANALYSER_DOCKER_IMAGE")
-		if image == "" {
-			image = analyser.DockerDefaultImage
-		}
-		analyse, err = analyser.NewDocker(rootLogger.With("area", "docker"), image, int(analyserMemoryLimit))
+		dockerAnalyser, err = analyser.NewDocker(rootLogger.With("area", "docker"), cfg.Analyser.DockerImage, cfg.Analyser.MemoryLimit)
 		if err != nil {
 			logger.Fatal("could not initialise Docker analyser:", err)
 		}
-	case "":
-		logger.Fatal("ANALYSER is not set")
-	default:
-		logger.Fatalf("Unknown ANALYSER option %q", os.Getenv("ANALYSER"))
+		dockerAnalyser.GitSSHKeyFile = cfg.Analyser.GitSSHKeyFile
+		dockerAnalyser.GitSSHKnownHostsFile = cfg.Analyser.GitSSHKnownHostsFile
+		dockerAnalyser.GoModuleEnv = goModuleEnv
+		dockerAnalyser.MaxContainers = cfg.Analyser.DockerMaxContainers
+		dockerAnalyser.ContainerWaitTimeout = time.Duration(cfg.Analyser.DockerContainerWait) * time.Second
+		dockerAnalyser.KeepOnFailure = cfg.Analyser.KeepOnFailure
+		if err := dockerAnalyser.EnablePool(ctx, cfg.Analyser.DockerPoolSize, cfg.Analyser.DockerPoolMaxUses); err != nil {
+			logger.With("error", err).Fatal("could not start Docker analyser pool")
+		}
+		analyse = dockerAnalyser
+	case "null":
+		logger.Info("null analyser does not run any tools, all analyses will succeed without issues")
+		analyse = analyser.Null{}
 	}
 
-	// GitHub
-	logger.Infof("github Integration ID: %q, GitHub Integration PEM File: %q", os.Getenv("GITHUB_ID"), os.Getenv("GITHUB_PEM_FILE"))
-	integrationID, err := strconv.ParseInt(os.Getenv("GITHUB_ID"), 10, 64)
+	selfTestCtx, selfTestCancel := context.WithTimeout(ctx, 2*time.Minute)
+	goVersion, err := analyser.SelfTest(selfTestCtx, analyse)
+	selfTestCancel()
 	if err != nil {
-		logger.Fatalf("could not parse integrationID %q", os.Getenv("GITHUB_ID"))
+		logger.With("error", err).Fatal("analyser self-test failed")
 	}
+	logger.Infof("analyser self-test passed: %v", goVersion)
 
-	integrationKey, err := ioutil.ReadFile(os.Getenv("GITHUB_PEM_FILE"))
+	// Outbound HTTP transport
+	if cfg.HTTPProxy != "" {
+		logger.Infof("using HTTP proxy %q for outbound requests", cfg.HTTPProxy)
+	}
+	tr, err := transport.New(cfg.HTTPProxy)
+	if err != nil {
+		logger.With("error", err).Fatal("could not initialise HTTP transport")
+	}
+
+	// Secrets, such as the GitHub private key, may be read from a secret manager
+	secretsResolver := secrets.NewResolver()
+	if cfg.Secrets.VaultAddr != "" {
+		secretsResolver.Register("vault", &secrets.Vault{
+			Addr:   cfg.Secrets.VaultAddr,
+			Token:  cfg.Secrets.VaultToken,
+			Client: &http.Client{Transport: tr, Timeout: 30 * time.Second},
+		})
+	}
+	secretsResolver.Register("gcpsm", &secrets.GCPSecretManager{})
+
+	// GitHub
+	logger.Infof("github Integration ID: %v, GitHub Integration PEM File: %q", cfg.GitHub.ID, cfg.GitHub.PEMFile)
+	integrationKey, err := secretsResolver.ResolveFile(ctx, cfg.GitHub.PEMFile)
 	if err != nil {
 		logger.Fatalf("could not read private key for GitHub integration: %s", err)
 	}
+	webhookSecret, err := secretsResolver.ResolveValue(ctx, cfg.GitHub.WebhookSecret)
+	if err != nil {
+		logger.Fatalf("could not read webhook secret for GitHub integration: %s", err)
+	}
 
 	// queuePush is used to add a job to the queue
 	var queuePush = make(chan interface{})
 
-	gh, err := github.New(rootLogger, analyse, db, queuePush, int(integrationID), integrationKey, os.Getenv("GITHUB_WEBHOOK_SECRET"), os.Getenv("GCI_BASE_URL"))
+	gh, err := github.New(rootLogger, analyse, gciDB, queuePush, cfg.GitHub.ID, integrationKey, webhookSecret, cfg.BaseURL)
 	if err != nil {
 		logger.Fatal("could not initialise GitHub:", err)
 	}
+	for _, app := range cfg.GitHub.Apps {
+		key, err := secretsResolver.ResolveFile(ctx, app.PEMFile)
+		if err != nil {
+			logger.Fatalf("could not read private key for GitHub App %v: %s", app.ID, err)
+		}
+		secret, err := secretsResolver.ResolveValue(ctx, app.WebhookSecret)
+		if err != nil {
+			logger.Fatalf("could not read webhook secret for GitHub App %v: %s", app.ID, err)
+		}
+		if err := gh.AddApp(app.ID, key, secret); err != nil {
+			logger.Fatal("could not add GitHub App:", err)
+		}
+	}
+	gh.Transport = tr
+	gh.InlineCommitThreshold = cfg.GitHub.InlineCommitThreshold
+	gh.CommitCommentGroupBy = cfg.GitHub.CommitCommentGroupBy
+	gh.OffDiffCommitComment = cfg.GitHub.OffDiffCommitComment
+	gh.SkipNonCodeChanges = cfg.Analyser.SkipNonCodeChanges
+	gh.MaxTools = cfg.Analyser.MaxTools
+	gh.MaxModules = cfg.Analyser.MaxModules
+	gh.MutedTools = cfg.Analyser.MutedTools
+	gh.CloneTimeout = time.Duration(cfg.Analyser.CloneTimeout) * time.Second
+	gh.CompareBase = cfg.Analyser.CompareBase
+	gh.IssueOrder = cfg.Analyser.IssueOrder
+	if cfg.Analyser.IssueTemplate != "" {
+		gh.IssueTemplate, err = analyser.ParseIssueTemplate(cfg.Analyser.IssueTemplate)
+		if err != nil {
+			logger.With("error", err).Fatal("could not parse issue template")
+		}
+	}
+	if cfg.Analyser.IncompatibleRegexp != "" {
+		gh.IncompatibleRegexp = regexp.MustCompile(cfg.Analyser.IncompatibleRegexp) // validated by config
+	}
+	gh.PerToolStatuses = cfg.GitHub.PerToolStatuses
+	gh.SkipStatuses = cfg.GitHub.SkipStatuses
+	gh.StatusDuration = cfg.GitHub.StatusDuration
+	gh.NoIssuesDesc = cfg.GitHub.NoIssuesDescription
+	gh.PushCheckRuns = cfg.GitHub.PushCheckRuns
+	gh.PRFilesMaxPages = cfg.GitHub.PRFilesMaxPages
+	gh.MinSeverity = cfg.GitHub.MinSeverity
+	gh.CloneProtocol = cfg.GitHub.CloneProtocol
+	gh.DailyDurationBudget = time.Duration(cfg.GitHub.DailyDurationBudget) * time.Minute
+	gh.PRDebounceWindow = time.Duration(cfg.GitHub.PRDebounceWindow) * time.Second
+	gh.AutoFixCommand = strings.Fields(cfg.GitHub.AutoFixCommand)
+	gh.AutoFixInstallations = cfg.GitHub.AutoFixInstallations
+	gh.QuietHours = cfg.GitHub.QuietHours
+	gh.WebhookOrigins = cfg.GitHub.WebhookOrigins
+	gh.WebhookProxies = cfg.GitHub.WebhookProxies
+	if cfg.GitHub.WebhookOriginsMeta {
+		if err := gh.WatchHookOrigins(ctx); err != nil {
+			logger.Fatal("could not get GitHub's webhook origins:", err)
+		}
+	}
+	if len(cfg.GitHub.ResultWebhooks) > 0 {
+		gh.ResultWebhooks = make(map[int]github.ResultWebhook, len(cfg.GitHub.ResultWebhooks))
+	}
+	for installationID, hookURL := range cfg.GitHub.ResultWebhooks {
+		secret, err := secretsResolver.ResolveValue(ctx, cfg.GitHub.ResultWebhookSecrets[installationID])
+		if err != nil {
+			logger.Fatalf("could not read result webhook secret for installation %v: %s", installationID, err)
+		}
+		gh.ResultWebhooks[installationID] = github.ResultWebhook{URL: hookURL, Secret: []byte(secret)}
+	}
 	r.Post("/gh/webhook", gh.WebHookHandler)
 	r.Get("/gh/callback", gh.CallbackHandler)
 
 	var (
 		wg         sync.WaitGroup // wait for queue to finish before exiting
-		qProcessor = queueProcessor{github: gh, logger: rootLogger.With("area", "queueProcessor")}
+		qProcessor = queueProcessor{github: gh, logger: rootLogger.With("area", "queueProcessor"), prMergeRef: cfg.GitHub.PRMergeRef}
+		pause      = &queue.Pause{} // pause processing for maintenance
 	)
+	if cfg.Queuer.Paused {
+		logger.Info("QUEUER_PAUSED is true, queued events won't be processed by any instance until resumed")
+		if err := gciDB.SetQueuePaused(true); err != nil {
+			logger.With("error", err).Fatal("could not pause queue")
+		}
+	}
+	// Share the pause with all instances, the first check happens before
+	// processing starts.
+	paused, err := gciDB.QueuePaused()
+	if err != nil {
+		logger.With("error", err).Fatal("could not get whether the queue is paused")
+	}
+	if paused {
+		pause.Pause()
+	}
+	go pause.Watch(ctx, rootLogger.With("area", "pause"), pauseWatchInterval, gciDB.QueuePaused)
 
-	switch os.Getenv("QUEUER") {
+	switch cfg.Queuer.Type {
 	case "memory":
 		memq := queue.NewMemoryQueue(rootLogger.With("area", "memoryQueue"))
+		memq.DrainTimeout = time.Duration(cfg.Queuer.MemoryDrainTimeout) * time.Second
+		memq.Pause = pause
 		memq.Wait(ctx, &wg, queuePush, qProcessor.Process)
 	case "gcppubsub":
-		switch {
-		case os.Getenv("QUEUER_GCPPUBSUB_PROJECT_ID") == "":
-			logger.Fatalf("QUEUER_GCPPUBSUB_PROJECT_ID is not set")
-		}
-		gcp, err := queue.NewGCPPubSubQueue(ctx, rootLogger.With("area", "gcpPubSubQueue"), os.Getenv("QUEUER_GCPPUBSUB_PROJECT_ID"), os.Getenv("QUEUER_GCPPUBSUB_TOPIC"))
+		gcp, err := queue.NewGCPPubSubQueue(ctx, rootLogger.With("area", "gcpPubSubQueue"), cfg.Queuer.GCPPubSubProjectID, cfg.Queuer.GCPPubSubTopic, cfg.Queuer.GCPPubSubMaxOutstanding)
 		if err != nil {
 			logger.Fatal("Could not initialise GCPPubSubQueue:", err)
 		}
+		gcp.Pause = pause
 		gcp.Wait(ctx, &wg, queuePush, qProcessor.Process)
-	case "":
-		logger.Fatal("QUEUER is not set")
-	default:
-		logger.Fatalf("Unknown QUEUER option %q", os.Getenv("QUEUER"))
+	}
+
+	// Scheduled full scans
+	if cfg.GitHub.FullScanSchedule != "" {
+		schedule, err := scheduler.Parse(cfg.GitHub.FullScanSchedule)
+		if err != nil {
+			logger.With("error", err).Fatal("could not parse full scan schedule")
+		}
+		scanLogger := rootLogger.With("area", "fullScanScheduler")
+		go scheduler.Run(ctx, scanLogger, schedule, func(ctx context.Context) error {
+			queued, err := gh.QueueFullScans(ctx)
+			scanLogger.Infof("queued %v full scans", queued)
+			return err
+		})
 	}
 
 	// Web routes
-	web, err := web.NewWeb(rootLogger.With("area", "web"), db, gh)
+	auth, err := web.NewAuth(rootLogger.With("area", "auth"), cfg.BaseURL,
+		cfg.GitHub.OAuthClientID, cfg.GitHub.OAuthClientSecret, cfg.SessionKey, cfg.Admins,
+	)
+	if err != nil {
+		logger.With("error", err).Fatal("could not instantiate auth")
+	}
+	auth.Transport = tr
+	if !auth.IsEnabled() {
+		logger.Info("GITHUB_OAUTH_CLIENT_ID is blank, web UI authentication is disabled")
+	}
+	r.Get("/login", auth.LoginHandler)
+	r.Get("/login/callback", auth.CallbackHandler)
+	r.Post("/logout", auth.LogoutHandler)
+
+	web, err := web.NewWeb(rootLogger.With("area", "web"), gciDB, gh)
 	if err != nil {
 		logger.With("error", err).Fatal("could not instantiate web")
 	}
+	web.Pause = pause
+	web.Auth = auth
 	workDir, _ := os.Getwd()
 	FileServer(r, "/static", http.Dir(filepath.Join(workDir, "internal", "web", "static")))
 
 	r.NotFound(web.NotFoundHandler)
 	r.Get("/analysis/{analysisID}", web.AnalysisHandler)
+	router.Get("/analysis/{analysisID}/outputs.txt", web.AnalysisOutputsHandler)
+	router.Get("/analysis/{analysisID}/outputs.json", web.AnalysisOutputsJSONHandler)
+	r.With(auth.RequireUser, auth.RequireCSRF).Post("/analysis/{analysisID}/rerun", web.RerunHandler)
+	r.Get("/repo/{repositoryID}/recurring-issues", web.RecurringIssuesHandler)
+	r.Get("/repo/{repositoryID}/analyses", web.AnalysesHandler)
+	r.Get("/repo/{repositoryID}/badge.svg", web.BadgeHandler)
+	r.With(auth.RequireAdmin).Get("/admin/failed-analyses", web.FailedAnalysesHandler)
+	r.With(auth.RequireAdmin).Get("/admin/stale-installations", web.StaleInstallationsHandler)
+	r.With(auth.RequireAdmin).Get("/admin/migrations", web.MigrationsHandler)
+	r.With(auth.RequireAdmin).Get("/installation/{installationID}/repos", web.InstallationReposHandler)
+	r.With(auth.RequireAdmin, auth.RequireCSRF).Post("/admin/installation/{installationID}/require-status-checks", web.RequireStatusChecksHandler)
+	r.With(auth.RequireAdmin).Get("/admin/maintenance", web.MaintenanceHandler)
+	r.With(auth.RequireAdmin, auth.RequireCSRF).Post("/admin/maintenance", web.MaintenanceHandler)
+	r.With(auth.RequireAdmin).Get("/admin/debug/vars", expvar.Handler().ServeHTTP)
 
 	// Health checks
 	r.Get("/health-check", HealthCheckHandler)
@@ -206,6 +400,9 @@ func main() {
 	// Wait for current item in queue to finish
 	logger.Info("waiting for queuer to finish")
 	wg.Wait()
+	if dockerAnalyser != nil {
+		dockerAnalyser.Close(context.Background())
+	}
 	logger.Info("exiting gracefully")
 }
 
@@ -228,12 +425,14 @@ func FileServer(r chi.Router, path string, root http.FileSystem) {
 
 // Queue processor is the callback called by queuer when receiving a job
 type queueProcessor struct {
-	github *github.GitHub
-	logger logger.Logger
+	github     *github.GitHub
+	logger     logger.Logger
+	prMergeRef bool // prMergeRef analyses a pull request's merge ref instead of its head.
 }
 
-// queueListen listens for jobs on the queue and executes the relevant handlers.
-func (q *queueProcessor) Process(job interface{}) {
+// Process executes the relevant handler for a job received from the queue,
+// returning an error if the job should be retried.
+func (q *queueProcessor) Process(job interface{}) error {
 	start := time.Now()
 	q.logger.Infof("processing job type %T", job)
 	var err error
@@ -244,10 +443,25 @@ func (q *queueProcessor) Process(job interface{}) {
 			err = errors.Wrapf(err, "cannot analyse push event for sha %v on repo %v", *e.After, *e.Repo.HTMLURL)
 		}
 	case *gh.PullRequestEvent:
-		err = q.github.Analyse(github.PullRequestConfig(e))
+		err = q.github.Analyse(github.PullRequestConfig(e, q.prMergeRef))
 		if err != nil {
 			err = errors.Wrapf(err, "cannot analyse pr %v", *e.PullRequest.HTMLURL)
 		}
+	case *github.ToolRun:
+		err = q.github.Analyse(github.ToolRunConfig(e, q.prMergeRef))
+		if err != nil {
+			err = errors.Wrapf(err, "cannot run %v on pr %v", e.Tool, e.Event.PullRequest.GetHTMLURL())
+		}
+	case *github.FullScan:
+		err = q.github.Analyse(github.FullScanConfig(e))
+		if err != nil {
+			err = errors.Wrapf(err, "cannot full scan %v on repo %v", e.SHA, e.HTMLURL)
+		}
+	case *github.Rerun:
+		err = q.github.Analyse(github.RerunConfig(e))
+		if err != nil {
+			err = errors.Wrapf(err, "cannot re-run push for sha %v on repo %v", e.CommitTo, e.HTMLURL)
+		}
 	default:
 		err = fmt.Errorf("unknown queue job type %T", e)
 	}
@@ -255,4 +469,22 @@ func (q *queueProcessor) Process(job interface{}) {
 	if err != nil {
 		q.logger.With("error", err).Error("processing error")
 	}
+	if transient(err) {
+		return queue.Transient(err)
+	}
+	return err
+}
+
+// transient returns true if err may not occur if the job is retried, such as
+// when no executer is available, or GitHub's API is unavailable.
+func transient(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *gh.ErrorResponse:
+		return cause.Response != nil && cause.Response.StatusCode >= http.StatusInternalServerError
+	case *gh.RateLimitError:
+		return true
+	case net.Error:
+		return cause.Temporary() || cause.Timeout()
+	}
+	return errors.Cause(err) == analyser.ErrQuotaExceeded
 }
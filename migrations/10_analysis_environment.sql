@@ -0,0 +1,8 @@
+-- +migrate Up
+ALTER TABLE analysis ADD COLUMN go_version VARCHAR(64) NULL DEFAULT NULL AFTER total_duration;
+ALTER TABLE analysis ADD COLUMN max_address_space VARCHAR(32) NULL DEFAULT NULL AFTER go_version;
+ALTER TABLE analysis ADD COLUMN max_open_files VARCHAR(32) NULL DEFAULT NULL AFTER max_address_space;
+ALTER TABLE analysis ADD COLUMN max_processes VARCHAR(32) NULL DEFAULT NULL AFTER max_open_files;
+
+-- +migrate Down
+ALTER TABLE analysis DROP COLUMN go_version, DROP COLUMN max_address_space, DROP COLUMN max_open_files, DROP COLUMN max_processes;
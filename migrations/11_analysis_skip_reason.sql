@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE analysis ADD COLUMN skip_reason VARCHAR(255) NULL DEFAULT NULL AFTER total_duration;
+
+-- +migrate Down
+ALTER TABLE analysis DROP COLUMN skip_reason;
@@ -0,0 +1,8 @@
+-- +migrate Up
+ALTER TABLE analysis ADD COLUMN trigger_type VARCHAR(32) NULL DEFAULT NULL AFTER request_number;
+ALTER TABLE analysis ADD COLUMN branch VARCHAR(255) NULL DEFAULT NULL AFTER trigger_type;
+ALTER TABLE analysis ADD COLUMN author VARCHAR(255) NULL DEFAULT NULL AFTER branch;
+ALTER TABLE analysis ADD KEY (repository_id, trigger_type), ADD KEY (repository_id, branch), ADD KEY (repository_id, author);
+
+-- +migrate Down
+ALTER TABLE analysis DROP COLUMN trigger_type, DROP COLUMN branch, DROP COLUMN author;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE issues ADD COLUMN col INT UNSIGNED NULL DEFAULT NULL AFTER line;
+
+-- +migrate Down
+ALTER TABLE issues DROP COLUMN col;
@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE tools ADD COLUMN version_args VARCHAR(255) NULL DEFAULT NULL AFTER args;
+ALTER TABLE analysis_tool ADD COLUMN version VARCHAR(255) NULL DEFAULT NULL AFTER duration;
+
+-- +migrate Down
+ALTER TABLE tools DROP COLUMN version_args;
+ALTER TABLE analysis_tool DROP COLUMN version;
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE gh_repository_rules (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    installation_id INT UNSIGNED NOT NULL,
+    repository_id INT UNSIGNED NOT NULL,
+    allowed TINYINT(1) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE installation_repository (installation_id, repository_id)
+);
+
+-- +migrate Down
+DROP TABLE gh_repository_rules;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE tools ADD COLUMN whole_new_files TINYINT(1) NOT NULL DEFAULT 0 AFTER version_args;
+
+-- +migrate Down
+ALTER TABLE tools DROP COLUMN whole_new_files;
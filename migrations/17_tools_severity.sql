@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE tools ADD COLUMN severity VARCHAR(32) NOT NULL DEFAULT '' AFTER whole_new_files;
+
+-- +migrate Down
+ALTER TABLE tools DROP COLUMN severity;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE gh_installations ADD COLUMN integration_id INT UNSIGNED NOT NULL DEFAULT 0 AFTER installation_id;
+
+-- +migrate Down
+ALTER TABLE gh_installations DROP COLUMN integration_id;
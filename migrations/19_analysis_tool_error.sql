@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE analysis_tool ADD COLUMN error VARCHAR(255) NOT NULL DEFAULT '' AFTER version;
+
+-- +migrate Down
+ALTER TABLE analysis_tool DROP COLUMN error;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE analysis ADD COLUMN base_duration TIME(3) NULL DEFAULT NULL AFTER deps_duration;
+
+-- +migrate Down
+ALTER TABLE analysis DROP COLUMN base_duration;
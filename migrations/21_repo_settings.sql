@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE repo_settings (
+    repository_id INT UNSIGNED NOT NULL,
+    silent TINYINT(1) NOT NULL DEFAULT 0,
+    pr_label VARCHAR(255) NOT NULL DEFAULT '',
+    disabled_tools TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (repository_id)
+);
+
+-- +migrate Down
+DROP TABLE repo_settings;
@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE issues ADD COLUMN end_line INT UNSIGNED NULL DEFAULT NULL AFTER hunk_pos;
+ALTER TABLE issues ADD COLUMN end_hunk_pos INT UNSIGNED NULL DEFAULT NULL AFTER end_line;
+
+-- +migrate Down
+ALTER TABLE issues DROP COLUMN end_line, DROP COLUMN end_hunk_pos;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE gh_installations ADD COLUMN last_event_at TIMESTAMP NULL DEFAULT NULL AFTER enabled_at;
+
+-- +migrate Down
+ALTER TABLE gh_installations DROP COLUMN last_event_at;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE tools MODIFY `regexp` TEXT NOT NULL;
+
+-- +migrate Down
+ALTER TABLE tools MODIFY `regexp` VARCHAR(128) NOT NULL;
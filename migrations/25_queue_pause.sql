@@ -0,0 +1,11 @@
+-- +migrate Up
+CREATE TABLE queue_pause (
+    id TINYINT UNSIGNED NOT NULL,
+    paused TINYINT(1) NOT NULL DEFAULT 0,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+);
+INSERT INTO queue_pause (id, paused) VALUES (1, 0);
+
+-- +migrate Down
+DROP TABLE queue_pause;
@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE analysis MODIFY status ENUM("Pending", "Failure", "Success", "Error", "Skipped") DEFAULT "Pending";
+
+-- +migrate Down
+UPDATE analysis SET status = "Success" WHERE status = "Skipped";
+ALTER TABLE analysis MODIFY status ENUM("Pending", "Failure", "Success", "Error") DEFAULT "Pending";
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/config"
+)
+
+// newServer returns the HTTP server listening on addr and serving handler,
+// with timeouts from cfg limiting how long slow or idle clients can hold a
+// connection open.
+func newServer(cfg config.Config, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.HTTPReadHeaderTimeout) * time.Second,
+		ReadTimeout:       time.Duration(cfg.HTTPReadTimeout) * time.Second,
+		WriteTimeout:      time.Duration(cfg.HTTPWriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(cfg.HTTPIdleTimeout) * time.Second,
+	}
+}
+
+// handlerTimeout returns middleware which responds with 503 Service
+// Unavailable and cancels the request's context if the handler hasn't finished
+// within timeout. A timeout of 0 has no timeout.
+//
+// Unlike the server's write timeout, it isn't applied per connection, so it can
+// be left off routes streaming responses, which http.TimeoutHandler would
+// buffer.
+func handlerTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if timeout == 0 {
+			return next
+		}
+		return http.TimeoutHandler(next, timeout, http.StatusText(http.StatusServiceUnavailable))
+	}
+}
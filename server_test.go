@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/gopherci/internal/config"
+)
+
+func TestNewServer(t *testing.T) {
+	cfg := config.Config{
+		HTTPReadHeaderTimeout: 10,
+		HTTPReadTimeout:       30,
+		HTTPWriteTimeout:      60,
+		HTTPIdleTimeout:       120,
+	}
+	handler := http.NotFoundHandler()
+
+	srv := newServer(cfg, ":3000", handler)
+	if want := ":3000"; srv.Addr != want {
+		t.Errorf("addr have: %v, want: %v", srv.Addr, want)
+	}
+	if srv.Handler == nil {
+		t.Errorf("handler is nil")
+	}
+	if want := 10 * time.Second; srv.ReadHeaderTimeout != want {
+		t.Errorf("read header timeout have: %v, want: %v", srv.ReadHeaderTimeout, want)
+	}
+	if want := 30 * time.Second; srv.ReadTimeout != want {
+		t.Errorf("read timeout have: %v, want: %v", srv.ReadTimeout, want)
+	}
+	if want := 60 * time.Second; srv.WriteTimeout != want {
+		t.Errorf("write timeout have: %v, want: %v", srv.WriteTimeout, want)
+	}
+	if want := 2 * time.Minute; srv.IdleTimeout != want {
+		t.Errorf("idle timeout have: %v, want: %v", srv.IdleTimeout, want)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(100 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	handlerTimeout(10*time.Millisecond)(slow).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if want := http.StatusServiceUnavailable; w.Code != want {
+		t.Errorf("status have: %v, want: %v", w.Code, want)
+	}
+
+	w = httptest.NewRecorder()
+	handlerTimeout(0)(slow).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if want := http.StatusOK; w.Code != want {
+		t.Errorf("no timeout status have: %v, want: %v", w.Code, want)
+	}
+}